@@ -0,0 +1,46 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+// Alphabet is the set of bytes the generation is restricted to with -alphabet-from-input
+type Alphabet [256]bool
+
+// InputAlphabet is the alphabet of the prompt, nil if the generation isn't restricted
+var InputAlphabet *Alphabet
+
+// NewAlphabet returns the bytes observed in the prompt with the ascii whitespace and punctuation,
+// multi-byte characters add their lead and continuation bytes so the script of the prompt is kept
+func NewAlphabet(prompt []byte) *Alphabet {
+	alphabet := Alphabet{}
+	for _, symbol := range prompt {
+		alphabet[symbol] = true
+	}
+	for _, symbol := range []byte(" \t\n\r!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~") {
+		alphabet[symbol] = true
+	}
+	return &alphabet
+}
+
+// Allowed returns true if the last byte of the output is in the alphabet, a nil alphabet allows everything
+func (a *Alphabet) Allowed(output []byte) bool {
+	if a == nil || len(output) == 0 {
+		return true
+	}
+	return a[output[len(output)-1]]
+}
+
+// Restrict removes the candidates that aren't in the alphabet
+func (a *Alphabet) Restrict(candidates []byte) []byte {
+	if a == nil {
+		return candidates
+	}
+	restricted := candidates[:0]
+	for _, candidate := range candidates {
+		if a[candidate] {
+			restricted = append(restricted, candidate)
+		}
+	}
+	return restricted
+}
@@ -0,0 +1,31 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestAlphabet(t *testing.T) {
+	db := NewTestModel(t)
+	defer func(alphabet *Alphabet) {
+		InputAlphabet = alphabet
+	}(InputAlphabet)
+	InputAlphabet = NewAlphabet([]byte("it was"))
+	if !InputAlphabet.Allowed([]byte("it w")) || !InputAlphabet.Allowed([]byte("it,")) || InputAlphabet.Allowed([]byte("it b")) {
+		t.Fatal("only the bytes of the prompt, whitespace and punctuation should be allowed")
+	}
+	for _, candidate := range Candidates(db, []byte("it was the best of")) {
+		if !InputAlphabet[candidate] {
+			t.Fatal("the candidate isn't in the alphabet", candidate)
+		}
+	}
+	pathes := []Result{{Output: []byte("it wa")}, {Output: []byte("it wz")}}
+	Exclude(pathes, true, 2)
+	if pathes[0].Entropy == math.MaxFloat64 || pathes[1].Entropy != math.MaxFloat64 {
+		t.Fatal("the path leaving the alphabet should be excluded", pathes)
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// AnomalyPreview is the number of bytes of an anomalous line that are kept for the report
+const AnomalyPreview = 120
+
+// Anomaly is a line whose self entropy per byte is an outlier of its corpus
+type Anomaly struct {
+	Line    int     `json:"line"`
+	Entropy float64 `json:"entropy"`
+	// Z is the number of standard deviations between the entropy of the line and the mean entropy of the corpus,
+	// high for corrupted, machine generated or off domain text and low for repeated boilerplate
+	Z    float64 `json:"z"`
+	Text string  `json:"text"`
+}
+
+// Anomalies computes the mean and standard deviation of the entropy per byte of the lines and returns the lines
+// whose z-score is beyond the threshold in either direction, most anomalous first
+func Anomalies(scores []LineScore, threshold float64) (anomalies []Anomaly, mean, deviation float64) {
+	if len(scores) == 0 {
+		return nil, 0, 0
+	}
+	for _, score := range scores {
+		mean += score.Entropy
+	}
+	mean /= float64(len(scores))
+	for _, score := range scores {
+		difference := score.Entropy - mean
+		deviation += difference * difference
+	}
+	deviation = math.Sqrt(deviation / float64(len(scores)))
+	if deviation == 0 {
+		return nil, mean, deviation
+	}
+	for _, score := range scores {
+		z := (score.Entropy - mean) / deviation
+		if math.Abs(z) > threshold {
+			anomalies = append(anomalies, Anomaly{
+				Line:    score.Line,
+				Entropy: score.Entropy,
+				Z:       z,
+				Text:    string(score.Text),
+			})
+		}
+	}
+	sort.SliceStable(anomalies, func(i, j int) bool {
+		return math.Abs(anomalies[i].Z) > math.Abs(anomalies[j].Z)
+	})
+	return anomalies, mean, deviation
+}
+
+func anomalies() {
+	db := OpenModel(*FlagModel)
+	defer db.Close()
+
+	var in io.Reader = os.Stdin
+	if *FlagAnomalies != "-" {
+		file, err := os.Open(*FlagAnomalies)
+		if err != nil {
+			Fail(ExitData, err)
+		}
+		defer file.Close()
+		in = file
+	}
+	chunk := *FlagChunk
+	if chunk == 0 {
+		chunk = ScoreChunk
+	}
+	scores := []LineScore{}
+	_, _, err := ScoreText(db, in, chunk, *FlagOverlap, func(score LineScore) {
+		// the text is the buffer of the scanner, only a preview is kept so the corpus isn't held in memory
+		text := score.Text
+		if len(text) > AnomalyPreview {
+			text = text[:AnomalyPreview]
+		}
+		score.Text = append([]byte{}, text...)
+		scores = append(scores, score)
+	})
+	if err != nil {
+		Fail(ExitData, fmt.Errorf("%s: %w", *FlagAnomalies, err))
+	}
+	found, mean, deviation := Anomalies(scores, *FlagZScore)
+	if *FlagJSON {
+		encoder := json.NewEncoder(Output)
+		for _, anomaly := range found {
+			if err := encoder.Encode(anomaly); err != nil {
+				Fail(ExitData, err)
+			}
+		}
+		return
+	}
+	fmt.Printf("lines %d mean %f deviation %f anomalies %d\n", len(scores), mean, deviation, len(found))
+	for _, anomaly := range found {
+		fmt.Printf("%d\t%f\t%f\t%s\n", anomaly.Line, anomaly.Z, anomaly.Entropy, strconv.Quote(anomaly.Text))
+	}
+}
@@ -0,0 +1,31 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestAnomalies(t *testing.T) {
+	scores := []LineScore{}
+	for i := 0; i < 40; i++ {
+		scores = append(scores, LineScore{Line: i + 1, Text: []byte("line"), Entropy: 2 + float64(i%2)/10})
+	}
+	scores = append(scores, LineScore{Line: 41, Text: []byte("noise"), Entropy: 6}, LineScore{Line: 42, Text: []byte("aaaa"), Entropy: 0.5})
+	anomalies, mean, deviation := Anomalies(scores, 2)
+	if len(anomalies) != 2 || anomalies[0].Line != 41 || anomalies[1].Line != 42 || anomalies[0].Text != "noise" {
+		t.Fatal("the outliers should be found most anomalous first", anomalies)
+	}
+	if anomalies[0].Z <= 2 || anomalies[1].Z >= -2 {
+		t.Fatal("the z-score should be signed", anomalies)
+	}
+	if math.Abs(anomalies[0].Z-(6-mean)/deviation) > 1e-9 {
+		t.Fatal("invalid z-score", anomalies[0].Z, mean, deviation)
+	}
+	if anomalies, _, _ := Anomalies(scores[:40], 2); len(anomalies) != 0 {
+		t.Fatal("a uniform corpus shouldn't have anomalies", anomalies)
+	}
+}
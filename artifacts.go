@@ -0,0 +1,179 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Auto is the value of an artifact flag that places the artifact in the cache directory
+const Auto = "auto"
+
+const (
+	// ArtifactModels are the learned square models
+	ArtifactModels = "models"
+	// ArtifactBaselines are the benchmark baselines
+	ArtifactBaselines = "baselines"
+	// ArtifactFeatures are the inference cache sidecars
+	ArtifactFeatures = "features"
+)
+
+// ArtifactKinds are the subdirectories of the cache directory
+var ArtifactKinds = []string{ArtifactModels, ArtifactBaselines, ArtifactFeatures}
+
+// ErrOffline is returned for network requests in offline mode
+var ErrOffline = errors.New("network access is disabled in offline mode")
+
+// offline is a round tripper that refuses every request
+type offline struct{}
+
+// RoundTrip refuses the request
+func (offline) RoundTrip(r *http.Request) (*http.Response, error) {
+	return nil, fmt.Errorf("%s: %w", r.URL, ErrOffline)
+}
+
+// Offline disables the network requests of the http clients, so nothing is fetched from or sent to the network
+func Offline() {
+	http.DefaultTransport = offline{}
+	http.DefaultClient.Transport = offline{}
+}
+
+// CacheDir is the cache directory, -cachedir or lit in the user cache directory
+func CacheDir() (string, error) {
+	if *FlagCacheDir != "" {
+		return *FlagCacheDir, nil
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "lit"), nil
+}
+
+// ArtifactPath returns the path of an artifact in the cache directory, creating the directory of its kind
+func ArtifactPath(kind, name string) (string, error) {
+	dir, err := CacheDir()
+	if err != nil {
+		return "", err
+	}
+	dir = filepath.Join(dir, kind)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name), nil
+}
+
+// ResolveArtifacts replaces the auto artifact flags with their paths in the cache directory.
+// The inference cache sidecar is named after the model, so each model has its own.
+func ResolveArtifacts() error {
+	artifacts := []struct {
+		Flag *string
+		Kind string
+		Name string
+	}{
+		{FlagSquareModel, ArtifactModels, "square.bolt"},
+		{FlagBaseline, ArtifactBaselines, "bench.json"},
+		{FlagCache, ArtifactFeatures, filepath.Base(*FlagModel) + ".cache"},
+	}
+	for _, artifact := range artifacts {
+		if *artifact.Flag != Auto {
+			continue
+		}
+		path, err := ArtifactPath(artifact.Kind, artifact.Name)
+		if err != nil {
+			return err
+		}
+		*artifact.Flag = path
+	}
+	return nil
+}
+
+// Artifact is a file in the cache directory
+type Artifact struct {
+	Kind string
+	Path string
+	Size int64
+}
+
+// Artifacts lists the files in the cache directory by kind
+func Artifacts() ([]Artifact, error) {
+	dir, err := CacheDir()
+	if err != nil {
+		return nil, err
+	}
+	artifacts := make([]Artifact, 0, 8)
+	for _, kind := range ArtifactKinds {
+		err := filepath.Walk(filepath.Join(dir, kind), func(path string, info os.FileInfo, err error) error {
+			if os.IsNotExist(err) {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			if info.Mode().IsRegular() {
+				artifacts = append(artifacts, Artifact{Kind: kind, Path: path, Size: info.Size()})
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return artifacts, nil
+}
+
+// CleanArtifacts removes the files of the kinds in the cache directory, all of them if no kinds are given
+func CleanArtifacts(kinds ...string) error {
+	dir, err := CacheDir()
+	if err != nil {
+		return err
+	}
+	if len(kinds) == 0 {
+		kinds = ArtifactKinds
+	}
+	for _, kind := range kinds {
+		known := false
+		for _, k := range ArtifactKinds {
+			known = known || k == kind
+		}
+		if !known {
+			return fmt.Errorf("unknown artifact kind %q", kind)
+		}
+	}
+	for _, kind := range kinds {
+		if err := os.RemoveAll(filepath.Join(dir, kind)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func artifacts() {
+	command := strings.SplitN(*FlagArtifacts, ":", 2)
+	switch command[0] {
+	case "ls":
+		artifacts, err := Artifacts()
+		if err != nil {
+			Fail(ExitData, err)
+		}
+		for _, artifact := range artifacts {
+			fmt.Printf("%-10s %12d %s\n", artifact.Kind, artifact.Size, artifact.Path)
+		}
+	case "clean":
+		var kinds []string
+		if len(command) == 2 {
+			kinds = strings.Split(command[1], ",")
+		}
+		if err := CleanArtifacts(kinds...); err != nil {
+			Fail(ExitData, err)
+		}
+	default:
+		Fail(ExitFlags, fmt.Errorf("unknown artifacts command %q, expected ls or clean", *FlagArtifacts))
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestArtifacts(t *testing.T) {
+	dir, cache, offline := *FlagCacheDir, *FlagCache, *FlagOffline
+	transport, client := http.DefaultTransport, http.DefaultClient.Transport
+	defer func() {
+		*FlagCacheDir, *FlagCache, *FlagOffline = dir, cache, offline
+		http.DefaultTransport, http.DefaultClient.Transport = transport, client
+	}()
+	*FlagCacheDir, *FlagCache = t.TempDir(), Auto
+	if err := ResolveArtifacts(); err != nil {
+		t.Fatal(err)
+	}
+	if *FlagCache != filepath.Join(*FlagCacheDir, ArtifactFeatures, filepath.Base(*FlagModel)+".cache") {
+		t.Fatal("the auto cache should be in the features directory", *FlagCache)
+	}
+	if err := os.WriteFile(*FlagCache, []byte("cache"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	artifacts, err := Artifacts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(artifacts) != 1 || artifacts[0].Kind != ArtifactFeatures || artifacts[0].Size != 5 {
+		t.Fatal("unexpected artifacts", artifacts)
+	}
+	if err := CleanArtifacts("unknown"); err == nil {
+		t.Fatal("unknown kinds should be an error")
+	}
+	if err := CleanArtifacts(ArtifactFeatures); err != nil {
+		t.Fatal(err)
+	}
+	if artifacts, err := Artifacts(); err != nil || len(artifacts) != 0 {
+		t.Fatal("the artifacts should be removed", artifacts, err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	*FlagOffline = true
+	Offline()
+	if _, err := http.Get(server.URL); !errors.Is(err, ErrOffline) {
+		t.Fatal("requests should fail offline", err)
+	}
+	if _, err := NewScorer(server.URL); !errors.Is(err, ErrOffline) {
+		t.Fatal("http scorers should fail offline", err)
+	}
+}
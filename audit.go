@@ -0,0 +1,68 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+)
+
+// Divergence finds the first byte where a and b differ, -1 is returned if they are identical
+func Divergence(a, b []byte) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	if len(a) != len(b) {
+		if len(a) < len(b) {
+			return len(a)
+		}
+		return len(b)
+	}
+	return -1
+}
+
+// Audit runs a generator twice and returns the outputs and the first divergence point
+func Audit(generate func()) (a, b []byte, divergence int) {
+	output := Output
+	defer func() {
+		Output = output
+	}()
+	run := func() []byte {
+		buffer := bytes.Buffer{}
+		Output = &buffer
+		generate()
+		return buffer.Bytes()
+	}
+	a, b = run(), run()
+	return a, b, Divergence(a, b)
+}
+
+func audit(generate func()) {
+	if generate == nil {
+		Fail(ExitFlags, fmt.Errorf("audit requires a generation mode"))
+	}
+	a, b, divergence := Audit(generate)
+	if divergence < 0 {
+		fmt.Printf("identical %d bytes\n", len(a))
+		return
+	}
+	start := divergence - 32
+	if start < 0 {
+		start = 0
+	}
+	end := func(output []byte) int {
+		if divergence+32 < len(output) {
+			return divergence + 32
+		}
+		return len(output)
+	}
+	fmt.Printf("diverged at byte %d\n", divergence)
+	fmt.Printf("first:  %q\n", a[start:end(a)])
+	fmt.Printf("second: %q\n", b[start:end(b)])
+	os.Exit(ExitInternal)
+}
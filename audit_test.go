@@ -0,0 +1,30 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestAudit(t *testing.T) {
+	if Divergence([]byte("abc"), []byte("abc")) != -1 {
+		t.Fatal("identical outputs shouldn't diverge")
+	}
+	if d := Divergence([]byte("abc"), []byte("abd")); d != 2 {
+		t.Fatal("unexpected divergence", d)
+	}
+	if d := Divergence([]byte("ab"), []byte("abc")); d != 2 {
+		t.Fatal("unexpected divergence", d)
+	}
+	i := 0
+	_, _, divergence := Audit(func() {
+		fmt.Fprintf(Output, "run %d", i)
+		i++
+	})
+	if divergence != 4 {
+		t.Fatal("unexpected divergence", divergence)
+	}
+}
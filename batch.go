@@ -0,0 +1,94 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// BatchResult is the json line of a prompt of a batch
+type BatchResult struct {
+	Line    int     `json:"line"`
+	Prompt  string  `json:"prompt"`
+	Output  string  `json:"output"`
+	Bytes   []byte  `json:"bytes"`
+	Entropy float64 `json:"entropy"`
+	Usage   Usage   `json:"usage"`
+	Error   string  `json:"error,omitempty"`
+}
+
+// Batch generates from each line of prompts with a mode and writes a json line for each to w.
+// The output is the generated text after the prompt with the output filter applied.
+// Blank lines are skipped, and a prompt that fails has the error in its result instead of stopping the batch.
+// The modes are configured with package state, so the prompts are generated one at a time.
+func Batch(ctx context.Context, mode string, prompts io.Reader, w io.Writer) error {
+	server, encoder := &Server{}, json.NewEncoder(w)
+	scanner := bufio.NewScanner(prompts)
+	size := *FlagMaxPrompt + 1
+	if size < bufio.MaxScanTokenSize {
+		size = bufio.MaxScanTokenSize
+	}
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), size)
+	for line := 1; scanner.Scan(); line++ {
+		prompt := scanner.Text()
+		if strings.TrimSpace(prompt) == "" {
+			continue
+		}
+		var last Result
+		usage, err := server.Stream(ctx, GenerateRequest{Mode: mode, Prompt: prompt}, func(step Result) error {
+			last = step
+			return nil
+		})
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		normalized, _ := NormalizePrompt([]byte(prompt))
+		generated := Generated(last.Output, normalized)
+		result := BatchResult{
+			Line:    line,
+			Prompt:  prompt,
+			Output:  string(generated),
+			Bytes:   generated,
+			Entropy: last.Entropy,
+			Usage:   usage,
+		}
+		if err != nil {
+			result.Error = err.Error()
+		}
+		if err := encoder.Encode(result); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func batch() {
+	mode := ModeName()
+	if mode == "" {
+		Fail(ExitFlags, fmt.Errorf("batch requires a generation mode"))
+	}
+	prompts, err := os.Open(*FlagBatch)
+	if err != nil {
+		Fail(ExitData, err)
+	}
+	defer prompts.Close()
+	out := os.Stdout
+	if *FlagBatchOut != "" {
+		if out, err = os.Create(*FlagBatchOut); err != nil {
+			Fail(ExitData, err)
+		}
+		defer out.Close()
+	}
+	if err := Batch(Context, mode, prompts, out); err != nil {
+		Check()
+		Fail(ExitData, err)
+	}
+}
@@ -0,0 +1,44 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestBatch(t *testing.T) {
+	model, err := GoldenModel(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	path, steps := *FlagModel, *FlagSteps
+	defer func() {
+		*FlagModel, *FlagSteps = path, steps
+	}()
+	*FlagModel, *FlagSteps = model, 2
+	prompts := strings.NewReader(GoldenPrompt + "\n\nit was\n")
+	buffer := bytes.Buffer{}
+	if err := Batch(context.Background(), "attention", prompts, &buffer); err != nil {
+		t.Fatal(err)
+	}
+	decoder, lines := json.NewDecoder(&buffer), []int{}
+	for decoder.More() {
+		var result BatchResult
+		if err := decoder.Decode(&result); err != nil {
+			t.Fatal(err)
+		}
+		if result.Error != "" || len(result.Bytes) != 3 || result.Usage.Bytes != 3 || result.Output != string(result.Bytes) {
+			t.Fatal("unexpected result", result)
+		}
+		lines = append(lines, result.Line)
+	}
+	if len(lines) != 2 || lines[0] != 1 || lines[1] != 3 {
+		t.Fatal("there should be a result for each prompt", lines)
+	}
+}
@@ -0,0 +1,205 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/pointlander/compress"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/pointlander/lit/matrix"
+)
+
+// Length is the length of the benchmark matrices
+const Length = 128
+
+// BenchTime is the minimum time a benchmark is run for
+const BenchTime = time.Second
+
+// Benchmark is a named benchmark, Setup prepares it with the golden model and returns the benchmarked operation
+type Benchmark struct {
+	Name  string
+	Setup func(db *bolt.DB) func()
+}
+
+// Benchmarks is the benchmark suite
+var Benchmarks = []Benchmark{
+	{"SelfEntropyKernel", func(db *bolt.DB) func() {
+		rnd := rand.New(rand.NewSource(1))
+		weights, importance := matrix.NewRandMatrix(rnd, 0, Width, Length), matrix.NewRandMatrix(rnd, 0, Length, 1)
+		return func() {
+			matrix.SelfEntropyKernel(weights, weights, weights, importance)
+		}
+	}},
+	{"SelfEntropyKernelParallel", func(db *bolt.DB) func() {
+		rnd := rand.New(rand.NewSource(1))
+		weights, importance := matrix.NewRandMatrix(rnd, 0, Width, Length), matrix.NewRandMatrix(rnd, 0, Length, 1)
+		return func() {
+			matrix.SelfEntropyKernelParallel(weights, weights, weights, importance)
+		}
+	}},
+	{"FastComplexSelfEntropyKernel", func(db *bolt.DB) func() {
+		rnd := rand.New(rand.NewSource(1))
+		weights, importance := matrix.NewRandComplexMatrix(rnd, 0, Width, Length), matrix.NewRandComplexMatrix(rnd, 0, Length, 1)
+		return func() {
+			matrix.FastComplexSelfEntropyKernel(weights, weights, weights, importance)
+		}
+	}},
+	{"BoltLookup", func(db *bolt.DB) func() {
+		symbol := Symbols{}
+		copy(symbol[:], "it was th")
+		return func() {
+			db.View(func(tx *bolt.Tx) error {
+				Lookup(tx.Bucket(ModelBucket), symbol)
+				return nil
+			})
+		}
+	}},
+	{"Decompress", func(db *bolt.DB) func() {
+		data := make([]byte, 2*Width)
+		for i := range data {
+			data[i] = byte(i % 7)
+		}
+		buffer := bytes.Buffer{}
+		compress.Mark1Compress1(data, &buffer)
+		compressed, output := buffer.Bytes(), make([]byte, 2*Width)
+		return func() {
+			compress.Mark1Decompress1(bytes.NewBuffer(compressed), output)
+		}
+	}},
+	{"LRUGetFlush", func(db *bolt.DB) func() {
+		lru, n := NewLRU(1024), 0
+		return func() {
+			lru.Get(Symbols{byte(n), byte(n >> 8), byte(n >> 16)})
+			lru.Flush()
+			n++
+		}
+	}},
+	{"SquareSelfEntropy", func(db *bolt.DB) func() {
+		s := &Square{}
+		s.Learn([]byte(GoldenCorpus))
+		return func() {
+			s.SelfEntropy([]byte("it was"))
+		}
+	}},
+	{"WindowsInterned", func(db *bolt.DB) func() {
+		text := []byte(strings.Repeat("it was the best of times ", 64))
+		return func() {
+			cache := VectorCache
+			VectorCache = NewVectorLRU(1 << 22)
+			Windows(db, text)
+			VectorCache = cache
+		}
+	}},
+	{"SelfEntropy", func(db *bolt.DB) func() {
+		return func() {
+			SelfEntropy(db, []byte("it was the best of times"), nil)
+		}
+	}},
+}
+
+// Baseline is the stored result of a benchmark
+type Baseline struct {
+	NsPerOp     int64
+	AllocsPerOp int64
+	BytesPerOp  int64
+}
+
+// Regressed returns true if the result is worse than the baseline by more than the threshold ratio
+func (b Baseline) Regressed(result Baseline, threshold float64) bool {
+	worse := func(a, b int64) bool {
+		return float64(a) > float64(b)*threshold && a > b
+	}
+	return worse(result.NsPerOp, b.NsPerOp) || worse(result.AllocsPerOp, b.AllocsPerOp) ||
+		worse(result.BytesPerOp, b.BytesPerOp)
+}
+
+// Measure runs an operation for at least the duration and returns its time and allocations per operation
+func Measure(operation func(), duration time.Duration) Baseline {
+	operation()
+	for n := int64(1); ; n *= 2 {
+		var before, after runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+		start := time.Now()
+		for i := int64(0); i < n; i++ {
+			operation()
+		}
+		elapsed := time.Since(start)
+		runtime.ReadMemStats(&after)
+		if elapsed >= duration || n >= 1<<30 {
+			return Baseline{
+				NsPerOp:     elapsed.Nanoseconds() / n,
+				AllocsPerOp: int64(after.Mallocs-before.Mallocs) / n,
+				BytesPerOp:  int64(after.TotalAlloc-before.TotalAlloc) / n,
+			}
+		}
+	}
+}
+
+func bench() {
+	selected := make(map[string]bool)
+	for _, name := range strings.Split(*FlagBench, ",") {
+		selected[name] = true
+	}
+	baselines := make(map[string]Baseline)
+	if *FlagBaseline != "" {
+		data, err := ioutil.ReadFile(*FlagBaseline)
+		if err == nil {
+			if err := json.Unmarshal(data, &baselines); err != nil {
+				Fail(ExitData, fmt.Errorf("%s: %w", *FlagBaseline, err))
+			}
+		} else if !os.IsNotExist(err) {
+			Fail(ExitData, err)
+		}
+	}
+	dir, err := os.MkdirTemp("", "bench")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+	db, err := OpenGoldenModel(filepath.Join(dir, "golden.bolt"))
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+	results, regressed := make(map[string]Baseline), []string{}
+	for _, benchmark := range Benchmarks {
+		if !selected["all"] && !selected[benchmark.Name] {
+			continue
+		}
+		result := Measure(benchmark.Setup(db), BenchTime)
+		results[benchmark.Name] = result
+		status := ""
+		if baseline, ok := baselines[benchmark.Name]; ok && baseline.Regressed(result, *FlagThreshold) {
+			status, regressed = " REGRESSION", append(regressed, benchmark.Name)
+		}
+		fmt.Printf("%-30s %12d ns/op %8d allocs/op %10d B/op%s\n", benchmark.Name,
+			result.NsPerOp, result.AllocsPerOp, result.BytesPerOp, status)
+	}
+	if *FlagBaseline != "" && len(baselines) == 0 {
+		data, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			panic(err)
+		}
+		if err := ioutil.WriteFile(*FlagBaseline, data, 0644); err != nil {
+			panic(err)
+		}
+		fmt.Println("wrote baseline", *FlagBaseline)
+	}
+	if len(regressed) > 0 {
+		Fail(ExitRegression, fmt.Errorf("regressed %s", strings.Join(regressed, ",")))
+	}
+}
@@ -0,0 +1,43 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func BenchmarkSuite(b *testing.B) {
+	for _, benchmark := range Benchmarks {
+		b.Run(benchmark.Name, func(b *testing.B) {
+			operation := benchmark.Setup(NewTestModel(b))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				operation()
+			}
+		})
+	}
+}
+
+func TestMeasure(t *testing.T) {
+	var sink []byte
+	result := Measure(func() {
+		sink = make([]byte, 1024)
+	}, 10*time.Millisecond)
+	if result.NsPerOp <= 0 || result.AllocsPerOp != 1 || result.BytesPerOp < 1024 || len(sink) != 1024 {
+		t.Fatal("the operation should take time and allocate once", result)
+	}
+}
+
+func TestBaselineRegressed(t *testing.T) {
+	baseline := Baseline{NsPerOp: 100, AllocsPerOp: 10, BytesPerOp: 1000}
+	if baseline.Regressed(Baseline{NsPerOp: 110, AllocsPerOp: 10, BytesPerOp: 1000}, 1.2) {
+		t.Fatal("result within the threshold shouldn't regress")
+	}
+	if !baseline.Regressed(Baseline{NsPerOp: 100, AllocsPerOp: 13, BytesPerOp: 1000}, 1.2) {
+		t.Fatal("more allocations should regress")
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/gob"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Entry is a cached context lookup
+type Entry struct {
+	Key     Symbols
+	Found   bool
+	Order   int
+	Decoded [Width]uint16
+	Hits    uint64
+}
+
+// Cache caches the decoded vectors of the contexts looked up during inference
+type Cache struct {
+	sync.RWMutex
+	// Model identifies the model the vectors are from
+	Model string
+	// Bucket is the model bucket the vectors are from
+	Bucket string
+	// Size is the maximum number of entries
+	Size    int
+	Entries map[Symbols]*Entry
+}
+
+// InferenceCache is the inference cache, nil if caching is disabled
+var InferenceCache *Cache
+
+// NewCache creates a new cache for the current bucket of a model
+func NewCache(model string, size int) *Cache {
+	return &Cache{
+		Model:   model,
+		Bucket:  string(ModelBucket),
+		Size:    size,
+		Entries: make(map[Symbols]*Entry),
+	}
+}
+
+// CacheModel identifies the model file by its path and modification time, so a stale cache isn't loaded.
+// The -max-order changes the looked up vectors, so it is part of the identity.
+func CacheModel(path string) string {
+	info, err := os.Stat(path)
+	if err != nil {
+		return ""
+	}
+	model := path + "@" + info.ModTime().String()
+	if backoff := Backoff(); backoff > 0 {
+		model += fmt.Sprintf("#%d", Order-backoff)
+	}
+	return model
+}
+
+// Get gets a cached entry
+func (c *Cache) Get(key Symbols) (*Entry, bool) {
+	c.RLock()
+	defer c.RUnlock()
+	entry, ok := c.Entries[key]
+	return entry, ok
+}
+
+// Put caches an entry if the cache isn't full
+func (c *Cache) Put(entry *Entry) {
+	c.Lock()
+	defer c.Unlock()
+	if len(c.Entries) < c.Size {
+		c.Entries[entry.Key] = entry
+	}
+}
+
+// CachedLookup looks up the vector of a context through the inference cache.
+// The cache is bypassed if the model has been routed to a different bucket.
+func CachedLookup(db *bolt.DB, symbol Symbols) (found bool, order int, decoded [Width]uint16) {
+	cache := InferenceCache
+	if cache != nil && cache.Bucket != string(ModelBucket) {
+		cache = nil
+	}
+	if cache != nil {
+		if entry, ok := cache.Get(symbol); ok {
+			cache.Lock()
+			entry.Hits++
+			cache.Unlock()
+			return entry.Found, entry.Order, entry.Decoded
+		}
+	}
+	read := Read(db, func(b *bolt.Bucket) {
+		found, order, decoded = Lookup(b, symbol)
+	})
+	if !read {
+		db.View(func(tx *bolt.Tx) error {
+			found, order, decoded = Lookup(tx.Bucket(ModelBucket), symbol)
+			return nil
+		})
+	}
+	if cache != nil {
+		cache.Put(&Entry{Key: symbol, Found: found, Order: order, Decoded: decoded, Hits: 1})
+	}
+	return found, order, decoded
+}
+
+// cacheFile is the sidecar file format of the cache
+type cacheFile struct {
+	Model   string
+	Bucket  string
+	Entries []Entry
+}
+
+// Save saves the most used entries of the cache to a sidecar file
+func (c *Cache) Save(path string) error {
+	c.RLock()
+	file := cacheFile{Model: c.Model, Bucket: c.Bucket, Entries: make([]Entry, 0, len(c.Entries))}
+	for _, entry := range c.Entries {
+		file.Entries = append(file.Entries, *entry)
+	}
+	c.RUnlock()
+	sort.Slice(file.Entries, func(i, j int) bool {
+		return file.Entries[i].Hits > file.Entries[j].Hits
+	})
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	return gob.NewEncoder(out).Encode(file)
+}
+
+// LoadCache loads a cache from a sidecar file, an empty cache is returned if the file
+// doesn't exist or is for a different model
+func LoadCache(path, model string, size int) *Cache {
+	cache := NewCache(model, size)
+	in, err := os.Open(path)
+	if err != nil {
+		return cache
+	}
+	defer in.Close()
+	var file cacheFile
+	if err := gob.NewDecoder(in).Decode(&file); err != nil || file.Model != model || file.Bucket != cache.Bucket {
+		return cache
+	}
+	for i := range file.Entries {
+		cache.Put(&file.Entries[i])
+	}
+	return cache
+}
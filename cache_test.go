@@ -0,0 +1,40 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestCache(t *testing.T) {
+	db := NewTestModel(t)
+	input := append(make([]byte, Order-2), "it was the best"...)
+	expected := SelfEntropy(db, input, nil)
+
+	InferenceCache = NewCache("model", 1024)
+	defer func() {
+		InferenceCache = nil
+	}()
+	for i := 0; i < 2; i++ {
+		if entropy := SelfEntropy(db, input, nil); entropy[0] != expected[0] {
+			t.Fatal("cached entropy should match", entropy, expected)
+		}
+	}
+	if len(InferenceCache.Entries) == 0 {
+		t.Fatal("lookups should be cached")
+	}
+
+	path := filepath.Join(t.TempDir(), "cache")
+	if err := InferenceCache.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	if loaded := LoadCache(path, "model", 1024); len(loaded.Entries) != len(InferenceCache.Entries) {
+		t.Fatal("the cache should be reloaded")
+	}
+	if loaded := LoadCache(path, "other", 1024); len(loaded.Entries) != 0 {
+		t.Fatal("a cache for a different model should not be loaded")
+	}
+}
@@ -0,0 +1,39 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// Context cancels the generations and learning when it is done.
+// main cancels it on an interrupt or after -timeout, and the servers set it to the context of each request.
+var Context = context.Background()
+
+// Canceled returns true if Context is done. The searches return right away when it is,
+// so their goroutines finish and the generation stops at its next Check.
+func Canceled() bool {
+	return Context.Err() != nil
+}
+
+// Check stops the generation or learning with the error of Context if it is done.
+// It unwinds with a panic, so it is only called from the goroutine running the generation or learning,
+// where the deferred closes of the models still run.
+func Check() {
+	if err := Context.Err(); err != nil {
+		panic(stop{err: err})
+	}
+}
+
+// Interrupted returns true if Context is done. The learners stop ingesting articles when it is and return
+// what they have learned so far, so that the partial model is written before the command exits.
+func Interrupted() bool {
+	if !Canceled() {
+		return false
+	}
+	fmt.Println("interrupted, writing the articles learned so far")
+	return true
+}
@@ -0,0 +1,59 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestCancel(t *testing.T) {
+	model, err := GoldenModel(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := Context
+	defer func() {
+		Context = previous
+	}()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	Context = ctx
+	for _, mode := range GoldenModes {
+		var transcript []byte
+		err := Stopped(func() {
+			transcript = Transcript(model, mode)
+		})
+		if err != context.Canceled || len(transcript) != 0 {
+			t.Fatalf("%s should stop before emitting anything %v %q", mode.Name, err, transcript)
+		}
+	}
+	db, err := bolt.Open(model, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		t.Fatal("the canceled generations should close the model", err)
+	}
+	db.Close()
+}
+
+func TestInterrupted(t *testing.T) {
+	defer func() {
+		Context = context.Background()
+	}()
+	if Interrupted() {
+		t.Fatal("learning shouldn't be interrupted")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	Context = ctx
+	if !Interrupted() {
+		t.Fatal("learning should be interrupted")
+	}
+	if err := Stopped(Check); err != context.Canceled {
+		t.Fatal("the command should still exit as canceled after writing", err)
+	}
+}
@@ -0,0 +1,40 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	bolt "go.etcd.io/bbolt"
+)
+
+// Candidates returns the candidate next bytes of the input. With -candidate-floor the bytes seen fewer times than
+// the floor after the matched context of the input are pruned, so they aren't scored by the kernel.
+// Every byte is a candidate if the context isn't found or the floor would prune every byte.
+// With -alphabet-from-input the bytes outside of the alphabet of the prompt aren't candidates.
+func Candidates(db *bolt.DB, input []byte) []byte {
+	candidates := make([]byte, 0, 256)
+	floor := uint16(*FlagCandidateFloor)
+	if floor > 0 && len(input) >= Order {
+		symbol := Symbols{}
+		context := input[len(input)-Order:]
+		for j := range symbol {
+			symbol[j] = context[Indexes[j]]
+		}
+		if found, _, decoded := CachedLookup(db, symbol); found {
+			for i, count := range decoded[:256] {
+				if count >= floor {
+					candidates = append(candidates, byte(i))
+				}
+			}
+		}
+		candidates = InputAlphabet.Restrict(candidates)
+	}
+	if len(candidates) == 0 {
+		for i := 0; i < 256; i++ {
+			candidates = append(candidates, byte(i))
+		}
+		candidates = InputAlphabet.Restrict(candidates)
+	}
+	return candidates
+}
@@ -0,0 +1,39 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+func TestCandidates(t *testing.T) {
+	db := NewTestModel(t)
+	floor := *FlagCandidateFloor
+	defer func() {
+		*FlagCandidateFloor = floor
+	}()
+	input := []byte("it was the best of")
+	*FlagCandidateFloor = 0
+	if len(Candidates(db, input)) != 256 {
+		t.Fatal("every byte should be a candidate without a floor")
+	}
+	*FlagCandidateFloor = 1
+	candidates := Candidates(db, input)
+	if len(candidates) == 0 || len(candidates) > 256/4 {
+		t.Fatal("most candidates should be pruned", len(candidates))
+	}
+	if !bytes.Contains(candidates, []byte{' '}) {
+		t.Fatal("the observed next byte should be a candidate")
+	}
+	if len(Candidates(db, []byte("qqqqqqqqqqqqqqqq"))) != 256 {
+		t.Fatal("every byte should be a candidate for an unseen context")
+	}
+	*FlagCandidateFloor = math.MaxUint16
+	if len(Candidates(db, input)) != 256 {
+		t.Fatal("every byte should be a candidate if the floor prunes them all")
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/gob"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Checkpoint is the state of a learning run, it is saved periodically so that -resume continues the run
+// after a crash instead of starting over
+type Checkpoint struct {
+	// Position is the cursor of the learner into the data, the number of articles read or drawn
+	Position int
+	// Learned is the number of articles learned
+	Learned int
+	Model   map[Symbols][]uint8
+	Ends    map[Symbols]uint32
+}
+
+// CheckpointPath is the path of the checkpoint of the model being learned
+func CheckpointPath() string {
+	return *FlagModel + ".checkpoint"
+}
+
+// Sync writes the cached entries into the model and empties the cache, so the model is the whole state
+func (l *LRU) Sync() {
+	l.Close()
+	l.Head, l.Tail, l.Nodes = nil, nil, nil
+}
+
+// Save saves the checkpoint, the file is replaced atomically so a crash while saving keeps the last checkpoint
+func (c *Checkpoint) Save(path string) error {
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	if err := gob.NewEncoder(file).Encode(c); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+// LoadCheckpoint loads a checkpoint
+func LoadCheckpoint(path string) (*Checkpoint, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var checkpoint Checkpoint
+	if err := gob.NewDecoder(file).Decode(&checkpoint); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if checkpoint.Model == nil {
+		checkpoint.Model = make(map[Symbols][]uint8)
+	}
+	if checkpoint.Ends == nil {
+		checkpoint.Ends = make(map[Symbols]uint32)
+	}
+	return &checkpoint, nil
+}
+
+// Resume restores a learner from the checkpoint with -resume, it returns the position and the number
+// of articles learned, which are 0 if there is nothing to resume
+func (l *LRU) Resume() (position, learned int) {
+	if !*FlagResume {
+		return 0, 0
+	}
+	checkpoint, err := LoadCheckpoint(CheckpointPath())
+	if os.IsNotExist(err) {
+		fmt.Println("no checkpoint, starting over")
+		return 0, 0
+	} else if err != nil {
+		Fail(ExitData, err)
+	}
+	l.Model, l.Ends = checkpoint.Model, checkpoint.Ends
+	fmt.Printf("resuming after %d articles\n", checkpoint.Learned)
+	return checkpoint.Position, checkpoint.Learned
+}
+
+// Checkpoint saves the learner every -checkpoint articles
+func (l *LRU) Checkpoint(position, learned int) {
+	if *FlagCheckpoint <= 0 || learned%*FlagCheckpoint != 0 {
+		return
+	}
+	l.Sync()
+	checkpoint := Checkpoint{
+		Position: position,
+		Learned:  learned,
+		Model:    l.Model,
+		Ends:     l.Ends,
+	}
+	if err := checkpoint.Save(CheckpointPath()); err != nil {
+		Fail(ExitData, err)
+	}
+}
+
+// RemoveCheckpoint removes the checkpoint after the model is written
+func RemoveCheckpoint() {
+	if err := os.Remove(CheckpointPath()); err != nil && !os.IsNotExist(err) {
+		Fail(ExitData, err)
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckpoint(t *testing.T) {
+	half := len(Corpus) / 2
+	whole := NewLRU(64)
+	whole.Learn([]byte(Corpus[:half]))
+	whole.Learn([]byte(Corpus[half:]))
+	whole.Close()
+
+	resumed := NewLRU(64)
+	resumed.Learn([]byte(Corpus[:half]))
+	resumed.Sync()
+	path := filepath.Join(t.TempDir(), "model.bolt.checkpoint")
+	saved := Checkpoint{Position: 3, Learned: 1, Model: resumed.Model, Ends: resumed.Ends}
+	if err := saved.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	checkpoint, err := LoadCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checkpoint.Position != 3 || checkpoint.Learned != 1 {
+		t.Fatal("unexpected cursor", checkpoint.Position, checkpoint.Learned)
+	}
+	resumed = NewLRU(64)
+	resumed.Model, resumed.Ends = checkpoint.Model, checkpoint.Ends
+	resumed.Learn([]byte(Corpus[half:]))
+	resumed.Close()
+
+	if len(resumed.Model) != len(whole.Model) || len(resumed.Ends) != len(whole.Ends) {
+		t.Fatal("the resumed model should match", len(resumed.Model), len(whole.Model))
+	}
+	for key, count := range whole.Ends {
+		if resumed.Ends[key] != count {
+			t.Fatal("the resumed end counts should match", key)
+		}
+	}
+	for key, value := range whole.Model {
+		if !bytes.Equal(resumed.Model[key], value) {
+			t.Fatal("the resumed vectors should match", key)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"unicode"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/pointlander/lit/matrix"
+)
+
+// Entropies computes the self entropy of each context of the input
+func Entropies(db *bolt.DB, input []byte) []float64 {
+	if len(input) < Order {
+		return nil
+	}
+	weights, importance, _ := ContextVectors(db, input)
+	entropies := matrix.DirectSelfEntropyKernel(weights, weights, weights, importance)
+	for i := range entropies {
+		entropies[i] = -entropies[i]
+	}
+	return entropies
+}
+
+// Passages cuts a document into passages of about size bytes for retrieval. Each passage is cut on a word boundary
+// between half and one and a half of the size, where the context before the cut has the lowest self entropy,
+// so the passages end in stable predictable text instead of in the middle of a phrase.
+func Passages(db *bolt.DB, document []byte, size int) []Span {
+	passages := make([]Span, 0, len(document)/size+1)
+	start := 0
+	for len(document)-start > size+size/2 {
+		low, high := start+size/2, start+size+size/2
+		region := Entropies(db, document[start:high])
+		cut, least, found := start+size, 0.0, false
+		for i := low; i < high; i++ {
+			if !unicode.IsSpace(rune(document[i-1])) || unicode.IsSpace(rune(document[i])) {
+				continue
+			}
+			// the context ending at the cut
+			j := i - start - Order
+			if j < 0 || j >= len(region) {
+				continue
+			}
+			if !found || region[j] < least {
+				cut, least, found = i, region[j], true
+			}
+		}
+		passages = append(passages, Span{Start: start, End: cut})
+		start = cut
+	}
+	if start < len(document) {
+		passages = append(passages, Span{Start: start, End: len(document)})
+	}
+	return passages
+}
+
+// FixedPassages cuts a document into passages of size bytes, it is the baseline of Passages
+func FixedPassages(document []byte, size int) []Span {
+	passages := make([]Span, 0, len(document)/size+1)
+	for start := 0; start < len(document); start += size {
+		end := start + size
+		if end > len(document) {
+			end = len(document)
+		}
+		passages = append(passages, Span{Start: start, End: end})
+	}
+	return passages
+}
+
+// Retrieve returns the index of the passage with the highest mutual self entropy with the question,
+// H(question) + H(passage) - H(question passage), -1 if no passage is long enough
+func Retrieve(db *bolt.DB, document []byte, passages []Span, question []byte) int {
+	entropy := func(input []byte) float64 {
+		return SelfEntropy(db, input, nil)[0]
+	}
+	h := entropy(question)
+	best, mutual := -1, 0.0
+	for i, passage := range passages {
+		if passage.End-passage.Start < Order {
+			continue
+		}
+		candidate := document[passage.Start:passage.End]
+		joint := make([]byte, 0, len(question)+1+len(candidate))
+		joint = append(joint, question...)
+		joint = append(joint, ' ')
+		joint = append(joint, candidate...)
+		m := h + entropy(candidate) - entropy(joint)
+		if best < 0 || m > mutual {
+			best, mutual = i, m
+		}
+	}
+	return best
+}
+
+// RetrievalScore is the number of questions whose answer is in the retrieved passage
+type RetrievalScore struct {
+	Questions int
+	Entropy   int
+	Fixed     int
+}
+
+// BenchmarkRetrieval compares the retrieval of the answers of squad questions from entropy passages and fixed passages.
+// The paragraphs of each article are joined into one document, and a question is answered if the retrieved passage
+// contains its whole answer.
+func BenchmarkRetrieval(db *bolt.DB, squad *Squad, size int) RetrievalScore {
+	score := RetrievalScore{}
+	answered := func(passages []Span, document []byte, question []byte, start, end int) bool {
+		i := Retrieve(db, document, passages, question)
+		return i >= 0 && passages[i].Start <= start && end <= passages[i].End
+	}
+	for _, article := range squad.Data {
+		document, offsets := bytes.Buffer{}, make([]int, len(article.Paragraphs))
+		for i, paragraph := range article.Paragraphs {
+			if i > 0 {
+				document.WriteByte('\n')
+			}
+			offsets[i] = document.Len()
+			document.WriteString(paragraph.Context)
+		}
+		text := document.Bytes()
+		entropy, fixed := Passages(db, text, size), FixedPassages(text, size)
+		for i, paragraph := range article.Paragraphs {
+			for _, qa := range paragraph.Qas {
+				if qa.IsImpossible || len(qa.Answers) == 0 || len(qa.Question) < Order {
+					continue
+				}
+				start := offsets[i] + qa.Answers[0].AnswerStart
+				end := start + len(qa.Answers[0].Text)
+				score.Questions++
+				if answered(entropy, text, []byte(qa.Question), start, end) {
+					score.Entropy++
+				}
+				if answered(fixed, text, []byte(qa.Question), start, end) {
+					score.Fixed++
+				}
+			}
+		}
+	}
+	return score
+}
+
+func passages() {
+	if *FlagPassages < 2*Order {
+		Fail(ExitFlags, fmt.Errorf("the passage size should be at least %d bytes", 2*Order))
+	}
+	db := OpenModel(*FlagModel)
+	defer db.Close()
+
+	if *FlagRetrieval != "" {
+		data, err := ioutil.ReadFile(*FlagRetrieval)
+		if err != nil {
+			Fail(ExitData, err)
+		}
+		var squad Squad
+		if err := json.Unmarshal(data, &squad); err != nil {
+			Fail(ExitData, fmt.Errorf("%s: %w", *FlagRetrieval, err))
+		}
+		score := BenchmarkRetrieval(db, &squad, *FlagPassages)
+		if score.Questions == 0 {
+			fmt.Println("no answerable questions")
+			return
+		}
+		fmt.Printf("questions %d\n", score.Questions)
+		fmt.Printf("entropy passages %f\n", float64(score.Entropy)/float64(score.Questions))
+		fmt.Printf("fixed passages %f\n", float64(score.Fixed)/float64(score.Questions))
+		return
+	}
+
+	document, err := ioutil.ReadFile(*FlagContext)
+	if err != nil {
+		Fail(ExitData, err)
+	}
+	for _, passage := range Passages(db, document, *FlagPassages) {
+		fmt.Printf("%d %d %q\n", passage.Start, passage.End, document[passage.Start:passage.End])
+	}
+}
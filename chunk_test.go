@@ -0,0 +1,53 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+	"unicode"
+)
+
+func TestPassages(t *testing.T) {
+	db := NewTestModel(t)
+	document, size := []byte(Corpus), 64
+	check := func(passages []Span, words bool) {
+		end := 0
+		for i, passage := range passages {
+			if passage.Start != end || passage.End <= passage.Start {
+				t.Fatal("the passages should cover the document in order", passages)
+			}
+			end = passage.End
+			if i == len(passages)-1 {
+				continue
+			}
+			if passage.End-passage.Start > size+size/2 {
+				t.Fatal("the passage is too long", passage)
+			}
+			if words && !unicode.IsSpace(rune(document[passage.End-1])) {
+				t.Fatal("the passage should be cut after a space", passage)
+			}
+		}
+		if end != len(document) {
+			t.Fatal("the passages should cover the whole document", passages)
+		}
+	}
+	check(Passages(db, document, size), true)
+	check(FixedPassages(document, size), false)
+
+	squad := Squad{}
+	err := json.Unmarshal([]byte(`{"data": [{"paragraphs": [{"context": `+strconv.Quote(Corpus)+`, "qas": [
+		{"question": "what was it the age of?", "answers": [{"answer_start": `+strconv.Itoa(strings.Index(Corpus, "wisdom"))+`, "text": "wisdom"}]},
+		{"question": "what is impossible?", "is_impossible": true}]}]}]}`), &squad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	score := BenchmarkRetrieval(db, &squad, size)
+	if score.Questions != 1 || score.Entropy > 1 || score.Fixed > 1 {
+		t.Fatal("unexpected retrieval score", score)
+	}
+}
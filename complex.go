@@ -6,19 +6,20 @@ package main
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"math"
 	"math/cmplx"
 	"math/rand"
-	"path/filepath"
 	"runtime"
 	"sort"
 	"strings"
 
-	zim "github.com/akhenakh/gozim"
 	"github.com/k3a/html2text"
 	"github.com/pointlander/compress"
 	bolt "go.etcd.io/bbolt"
+
+	"github.com/pointlander/lit/matrix"
 )
 
 // ComplexSymbols is a set of ordered symbols
@@ -31,15 +32,8 @@ type ComplexSymbolVectors map[ComplexSymbols][]complex64
 func NewComplexSymbolVectors() ComplexSymbolVectors {
 	rnd := rand.New(rand.NewSource(1))
 	vectors := make(ComplexSymbolVectors)
-	data, err := filepath.Abs(*FlagData)
-	if err != nil {
-		panic(err)
-	}
-	reader, err := zim.NewReader(data, false)
-	if err != nil {
-		panic(err)
-	}
-	var m runtime.MemStats
+	reader := OpenData()
+	ingestion := NewIngestion(0)
 	i, articles := 0, reader.ListArticles()
 	for article := range articles {
 		url := article.FullURL()
@@ -48,10 +42,15 @@ func NewComplexSymbolVectors() ComplexSymbolVectors {
 			if err != nil {
 				panic(err)
 			}
-			plain := html2text.HTML2Text(string(html))
-			runtime.ReadMemStats(&m)
-			fmt.Printf("%5d %20d %s\n", m.Alloc/(1024*1024), len(vectors), url)
+			plain := Preprocess(html2text.HTML2Text(string(html)))
+			if plain == "" || ArticleDedup.Duplicate(url, plain) {
+				continue
+			}
+			if !Supervision.Next(nil) {
+				break
+			}
 			vectors.Learn(rnd, []byte(plain))
+			ingestion.Learned(url, len(plain), len(vectors))
 			if i%100 == 0 {
 				runtime.GC()
 			}
@@ -66,15 +65,8 @@ func NewComplexSymbolVectors() ComplexSymbolVectors {
 func NewComplexSymbolVectorsRandom() ComplexSymbolVectors {
 	rnd := rand.New(rand.NewSource(1))
 	vectors := make(ComplexSymbolVectors)
-	data, err := filepath.Abs(*FlagData)
-	if err != nil {
-		panic(err)
-	}
-	reader, err := zim.NewReader(data, false)
-	if err != nil {
-		panic(err)
-	}
-	var m runtime.MemStats
+	reader := OpenData()
+	ingestion := NewIngestion(*FlagScale*1024 + 1)
 	i, length := 0, reader.ArticleCount
 	for {
 		index := rnd.Intn(int(length))
@@ -91,10 +83,15 @@ func NewComplexSymbolVectorsRandom() ComplexSymbolVectors {
 			if err != nil {
 				panic(err)
 			}
-			plain := html2text.HTML2Text(string(html))
-			runtime.ReadMemStats(&m)
-			fmt.Printf("%5d %20d %s\n", m.Alloc/(1024*1024), len(vectors), url)
+			plain := Preprocess(html2text.HTML2Text(string(html)))
+			if plain == "" || ArticleDedup.Duplicate(url, plain) {
+				continue
+			}
+			if !Supervision.Next(nil) {
+				break
+			}
 			vectors.Learn(rnd, []byte(plain))
+			ingestion.Learned(url, len(plain), len(vectors))
 			if i%100 == 0 {
 				runtime.GC()
 			}
@@ -108,43 +105,75 @@ func NewComplexSymbolVectorsRandom() ComplexSymbolVectors {
 	return vectors
 }
 
+// Phase is the phase of the j'th symbol in the context
+func Phase(j int) complex128 {
+	switch *FlagComplexPhase {
+	case "linear":
+		return cmplx.Exp(1i * math.Pi * complex(float64(j), 0) / ComplexOrder)
+	case "full":
+		return cmplx.Exp(2i * math.Pi * complex(float64(j), 0) / ComplexOrder)
+	case "golden":
+		return cmplx.Exp(1i * math.Pi * (3 - complex(math.Sqrt(5), 0)) * complex(float64(j), 0))
+	}
+	Fail(ExitFlags, fmt.Errorf("unknown phase scheme %s", *FlagComplexPhase))
+	return 0
+}
+
+// ComplexParameters are the hyperparameters of the complex model
+type ComplexParameters struct {
+	Eta    float64
+	Passes int
+	Phase  string
+}
+
+// NewComplexParameters gets the complex model hyperparameters from the flags
+func NewComplexParameters() ComplexParameters {
+	return ComplexParameters{
+		Eta:    *FlagComplexEta,
+		Passes: *FlagComplexPasses,
+		Phase:  *FlagComplexPhase,
+	}
+}
+
 // Learn learns a markov model from data
 func (s ComplexSymbolVectors) Learn(rnd *rand.Rand, data []byte) {
-	const Eta = .1
-	var symbols ComplexSymbols
-	for i, symbol := range data[:len(data)-Order+1] {
-		for j := 0; j < ComplexOrder-1; j++ {
-			symbols := symbols
-			for k := 0; k < j; k++ {
-				symbols[k] = 0
-			}
-			vector := s[symbols]
-			if vector == nil {
-				vector = make([]complex64, 0, Width)
-				factor := math.Sqrt(2.0 / float64(Width))
-				for i := 0; i < Width; i++ {
-					vector = append(vector, complex(float32(rnd.NormFloat64()*factor), float32(rnd.NormFloat64()*factor)))
+	Eta := complex(*FlagComplexEta, 0)
+	for pass := 0; pass < *FlagComplexPasses; pass++ {
+		var symbols ComplexSymbols
+		for i, symbol := range data[:len(data)-Order+1] {
+			for j := 0; j < ComplexOrder-1; j++ {
+				symbols := symbols
+				for k := 0; k < j; k++ {
+					symbols[k] = 0
 				}
+				vector := s[symbols]
+				if vector == nil {
+					vector = make([]complex64, 0, Width)
+					factor := math.Sqrt(2.0 / float64(Width))
+					for i := 0; i < Width; i++ {
+						vector = append(vector, complex(float32(rnd.NormFloat64()*factor), float32(rnd.NormFloat64()*factor)))
+					}
+				}
+				inputs := make([]complex128, Width)
+				inputs[symbol] = cmplx.Exp(0i)
+				for j := 1; j < ComplexOrder; j++ {
+					inputs[data[i+j]] = Phase(j)
+				}
+				y := complex128(0)
+				for j, value := range inputs {
+					y += value * complex128(vector[j])
+				}
+				y = (y - 1) * (y - 1)
+				for j, value := range inputs {
+					vector[j] -= complex64(Eta * value * y)
+				}
+				s[symbols] = vector
 			}
-			inputs := make([]complex128, Width)
-			inputs[symbol] = cmplx.Exp(0i)
-			for j := 1; j < ComplexOrder; j++ {
-				inputs[data[i+j]] = cmplx.Exp(1i * math.Pi * complex(float64(j), 0) / ComplexOrder)
-			}
-			y := complex128(0)
-			for j, value := range inputs {
-				y += value * complex128(vector[j])
-			}
-			y = (y - 1) * (y - 1)
-			for j, value := range inputs {
-				vector[j] -= complex64(Eta * value * y)
+			for i, value := range symbols[1:] {
+				symbols[i] = value
 			}
-			s[symbols] = vector
-		}
-		for i, value := range symbols[1:] {
-			symbols[i] = value
+			symbols[ComplexOrder-1] = symbol
 		}
-		symbols[ComplexOrder-1] = symbol
 	}
 }
 
@@ -152,7 +181,7 @@ func (s ComplexSymbolVectors) Learn(rnd *rand.Rand, data []byte) {
 func ComplexSelfEntropy(db *bolt.DB, input []byte) (ax []float64) {
 	rnd := rand.New(rand.NewSource(1))
 	length := len(input)
-	weights := NewComplexMatrix(0, Width, length-Order+1)
+	weights := matrix.NewComplexMatrix(0, Width, length-Order+1)
 	orders := make([]int, length-Order+1)
 	for i := 0; i < length-Order+1; i++ {
 		symbol := Symbols{}
@@ -162,16 +191,16 @@ func ComplexSelfEntropy(db *bolt.DB, input []byte) (ax []float64) {
 		var decoded [Width]complex64
 		found, order := false, 0
 		db.View(func(tx *bolt.Tx) error {
-			b := tx.Bucket([]byte("markov"))
-			for j := 0; j < Order-1; j++ {
+			b := tx.Bucket(ModelBucket)
+			for j := Backoff(); j < Order-1; j++ {
 				symbol := symbol
 				for k := 0; k < j; k++ {
 					symbol[k] = 0
 				}
-				v := b.Get(symbol[:])
+				v := Get(b, symbol[:])
 				if v != nil {
 					found, order = true, j
-					index, buffer, output := 0, bytes.NewBuffer(v), make([]byte, 2*Width)
+					index, buffer, output := 0, bytes.NewBuffer(v), make([]byte, 8*Width)
 					compress.Mark1Decompress1(buffer, output)
 					for key := range decoded {
 						r := uint32(output[index])
@@ -232,29 +261,37 @@ func ComplexSelfEntropy(db *bolt.DB, input []byte) (ax []float64) {
 		}
 	}
 
-	importance := NewComplexMatrix(0, len(orders), 1)
+	importance := matrix.NewComplexMatrix(0, len(orders), 1)
 	for _, order := range orders {
 		importance.Data = append(importance.Data, complex(1/float32(Order-order), 0))
 	}
 
 	entropy := make([]float64, 1)
-	entropy[0] = FastComplexSelfEntropyKernel(weights, weights, weights, importance)
+	if *FlagComplex128 {
+		entropy[0] = matrix.FastComplexSelfEntropyKernel128(weights, weights, weights, importance)
+	} else {
+		kernel := Timed(PhaseKernel)
+		entropy[0] = matrix.FastComplexSelfEntropyKernel(weights, weights, weights, importance)
+		kernel()
+	}
 
 	return entropy
 }
 
 func markovComplexSelfEntropy() {
-	db, err := bolt.Open(*FlagModel, 0600, nil)
-	if err != nil {
-		panic(err)
-	}
+	db := OpenModel(*FlagModel)
 	defer db.Close()
+	RouteModel(db, []byte(*FlagInput))
 
 	in := []byte(*FlagInput)
 	var search func(depth int, input []byte, done chan Result)
 	search = func(depth int, input []byte, done chan Result) {
-		pathes := make([]Result, Width)
-		for i := 0; i < Width; i++ {
+		if Canceled() {
+			done <- Result{Output: input}
+			return
+		}
+		pathes := make([]Result, 256)
+		for i := 0; i < 256; i++ {
 			n := make([]byte, len(input))
 			copy(n, input)
 			n = append(n, byte(i))
@@ -266,9 +303,12 @@ func markovComplexSelfEntropy() {
 			}
 			pathes[i].Entropy = total
 		}
+		Exclude(pathes, true, len(in))
+		sorting := Timed(PhaseSort)
 		sort.Slice(pathes, func(i, j int) bool {
 			return pathes[i].Entropy < pathes[j].Entropy
 		})
+		sorting()
 		index := split(pathes)
 		/*for _, path := range pathes[:index] {
 			fmt.Println(path.Entropy,
@@ -283,13 +323,16 @@ func markovComplexSelfEntropy() {
 		if depth <= 1 {
 			min, output = pathes[0].Entropy, pathes[0].Output
 		} else {
-			next := make(chan Result, 8)
+			next := make(chan Result, index)
 			for _, path := range pathes[:index] {
-				go search(depth-1, path.Output, next)
+				path := path
+				Go(next, func() {
+					search(depth-1, path.Output, next)
+				})
 			}
 			for range pathes[:index] {
-				result := <-next
-				if result.Entropy < min {
+				result := Receive(next)
+				if Better(result, Result{Entropy: min, Output: output}, true) {
 					min, output = result.Entropy, result.Output
 				}
 			}
@@ -299,19 +342,85 @@ func markovComplexSelfEntropy() {
 			Output:  output,
 		}
 	}
-	padding := make([]byte, Order-2)
-	in = append(padding, in...)
+	in = Pad(in)
 	done := make(chan Result, 8)
-	go search(Depth, in, done)
+	search(Depth, in, done)
 	result := <-done
 	result.Output = result.Output[:len(result.Output)-Depth+1]
-	fmt.Println(result.Entropy, string(result.Output))
-	fmt.Printf("\n")
-	for i := 0; i < 128; i++ {
+	Emit(result)
+	for i := 0; i < *FlagSteps; i++ {
 		search(Depth, result.Output, done)
 		result = <-done
 		result.Output = result.Output[:len(result.Output)-Depth+1]
-		fmt.Println(result.Entropy, string(result.Output))
-		fmt.Printf("\n")
+		Emit(result)
+	}
+}
+
+// ComplexDiffusionEntropy computes the complex self entropy of a diffusion candidate. The candidate is
+// conditioned on a document by attending over the document and the candidate together, nil doesn't condition it.
+func ComplexDiffusionEntropy(db *bolt.DB, candidate, condition []byte) float64 {
+	if len(condition) > 0 {
+		candidate = append(append(make([]byte, 0, len(condition)+len(candidate)), condition...), candidate...)
+	}
+	total := 0.0
+	for _, value := range ComplexSelfEntropy(db, candidate) {
+		total += value
+	}
+	return total
+}
+
+func markovComplexSelfEntropyDiffusion() {
+	rnd := rand.New(rand.NewSource(1))
+
+	db := OpenModel(*FlagModel)
+	defer db.Close()
+	RouteModel(db, []byte(*FlagInput))
+	condition := ReadContextFile()
+
+	in := []byte(*FlagInput)
+	if *FlagRandomInput != 0 {
+		rnd := rand.New(rand.NewSource(int64(*FlagRandomInput)))
+		symbols := []byte("abcdefghijklmnopqrstuvwxyz")
+		for i := range in {
+			in[i] = symbols[rnd.Intn(len(symbols))]
+		}
+	}
+	search := func(idx int, input []byte, done chan Result) {
+		if Canceled() {
+			done <- Result{Output: input}
+			return
+		}
+		pathes := make([]Result, 256)
+		for i := 0; i < 256; i++ {
+			n := make([]byte, len(input))
+			copy(n, input)
+			n[idx] = byte(i)
+			pathes[i].Output = n
+			pathes[i].Entropy = ComplexDiffusionEntropy(db, n, condition)
+		}
+		Exclude(pathes, true, len(in))
+		sorting := Timed(PhaseSort)
+		sort.Slice(pathes, func(i, j int) bool {
+			return pathes[i].Entropy < pathes[j].Entropy
+		})
+		sorting()
+		done <- pathes[0]
+	}
+	size := len(in)
+	if size == 0 {
+		Fail(ExitFlags, errors.New("diffusion requires a non empty -input"))
+	}
+	in = Pad(in)
+	if len(in) < Order {
+		in = append(Padding(Order-len(in)), in...)
+	}
+	done := make(chan Result, 8)
+	search(len(in)-size+rnd.Intn(size), in, done)
+	result := <-done
+	Emit(result)
+	for i := 0; i < 4**FlagSteps; i++ {
+		search(len(in)-size+rnd.Intn(size), result.Output, done)
+		result = <-done
+		Emit(result)
 	}
 }
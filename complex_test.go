@@ -0,0 +1,92 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"math"
+	"math/rand"
+	"path/filepath"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/pointlander/lit/matrix"
+)
+
+func BenchmarkFastComplexSelfEntropyKernel(b *testing.B) {
+	rnd := rand.New(rand.NewSource(1))
+	weights, importance := matrix.NewRandComplexMatrix(rnd, 0, Width, Length), matrix.NewRandComplexMatrix(rnd, 0, Length, 1)
+	for n := 0; n < b.N; n++ {
+		matrix.FastComplexSelfEntropyKernel(weights, weights, weights, importance)
+	}
+}
+
+func BenchmarkFastComplexSelfEntropyKernel128(b *testing.B) {
+	rnd := rand.New(rand.NewSource(1))
+	weights, importance := matrix.NewRandComplexMatrix(rnd, 0, Width, Length), matrix.NewRandComplexMatrix(rnd, 0, Length, 1)
+	for n := 0; n < b.N; n++ {
+		matrix.FastComplexSelfEntropyKernel128(weights, weights, weights, importance)
+	}
+}
+
+func TestFastComplexSelfEntropyKernelPrecision(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for _, length := range []int{8, 32, 128} {
+		weights, importance := matrix.NewRandComplexMatrix(rnd, 0, Width, length), matrix.NewRandComplexMatrix(rnd, 0, length, 1)
+		a := matrix.FastComplexSelfEntropyKernel(weights, weights, weights, importance)
+		b := matrix.FastComplexSelfEntropyKernel128(weights, weights, weights, importance)
+		if math.IsNaN(b) || math.IsInf(b, 0) {
+			t.Fatal("complex128 kernel should be finite", length, b)
+		}
+		relative := math.Abs(a-b) / b
+		t.Logf("length %d complex64 %g complex128 %g relative error %g", length, a, b, relative)
+		if relative > 1e-3 {
+			t.Fatal("complex64 kernel diverges from complex128 kernel", length, relative)
+		}
+	}
+}
+
+func TestComplexDiffusion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "complex.bolt")
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucket(ModelBucket)
+		return err
+	})
+	WriteMetadata(db, "complex", NewComplexParameters())
+	a, b := ComplexDiffusionEntropy(db, Pad([]byte("it was")), nil), ComplexDiffusionEntropy(db, Pad([]byte("it was")), []byte(Corpus[:64]))
+	if math.IsNaN(a) || a == b {
+		t.Fatal("the condition should change the entropy", a, b)
+	}
+	db.Close()
+
+	diffusion, complexModel := *FlagDiffusion, *FlagComplex
+	defer func() {
+		*FlagDiffusion, *FlagComplex, Step = diffusion, complexModel, nil
+	}()
+	*FlagDiffusion, *FlagComplex = true, true
+	if ModeName() != "complex-diffusion" {
+		t.Fatal("unexpected mode", ModeName())
+	}
+	results := []Result{}
+	Step = func(result Result) error {
+		results = append(results, result)
+		return nil
+	}
+	Transcript(path, Mode{"complex-diffusion", Generator()})
+	padded := Pad([]byte(GoldenPrompt))
+	if len(results) != 4*GoldenSteps+1 {
+		t.Fatal("unexpected number of steps", len(results))
+	}
+	for _, result := range results {
+		if len(result.Output) != len(padded) || !bytes.Equal(result.Output[:len(padded)-len(GoldenPrompt)], padded[:len(padded)-len(GoldenPrompt)]) {
+			t.Fatal("only the prompt should be edited", result.Output)
+		}
+	}
+}
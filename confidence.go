@@ -0,0 +1,83 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"math"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/pointlander/lit/matrix"
+)
+
+// Masses computes the total count mass behind the lookup of each context of the input, zero if not found
+func Masses(db *bolt.DB, input []byte) []int {
+	length := len(input) - Order + 1
+	if length < 0 {
+		length = 0
+	}
+	masses := make([]int, length)
+	db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(ModelBucket)
+		for i := range masses {
+			symbol := Symbols{}
+			for j := range symbol {
+				symbol[j] = input[i+Indexes[j]]
+			}
+			found, _, decoded := Lookup(b, symbol)
+			if !found {
+				continue
+			}
+			for _, value := range decoded[:256] {
+				masses[i] += int(value)
+			}
+		}
+		return nil
+	})
+	return masses
+}
+
+// Score is an entropy score with a count based confidence
+type Score struct {
+	Entropy   float64
+	Deviation float64
+	Masses    []int
+}
+
+// Confidence computes the self entropy of the input and its standard deviation.
+// The entropy of each context is treated as having a variance that shrinks with its count mass,
+// so a high entropy caused by barely trained contexts has a large deviation.
+func Confidence(db *bolt.DB, input []byte) Score {
+	score := Score{}
+	if len(input) < Order {
+		return score
+	}
+	weights, importance, _ := ContextVectors(db, input)
+	entropies := matrix.DirectSelfEntropyKernel(weights, weights, weights, importance)
+	score.Masses = Masses(db, input)
+	variance := 0.0
+	for i, entropy := range entropies {
+		score.Entropy -= entropy
+		variance += entropy * entropy / float64(score.Masses[i]+1)
+	}
+	score.Deviation = math.Sqrt(variance)
+	return score
+}
+
+func confidence() {
+	db := OpenModel(*FlagModel)
+	defer db.Close()
+
+	input := []byte(*FlagInput)
+	if len(input) < Order {
+		input = append(Padding(Order-len(input)), input...)
+	}
+	score := Confidence(db, input)
+	fmt.Printf("entropy %f deviation %f\n", score.Entropy, score.Deviation)
+	for i, mass := range score.Masses {
+		fmt.Printf("%q mass %d\n", input[i:i+Order], mass)
+	}
+}
@@ -0,0 +1,26 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+)
+
+func TestConfidence(t *testing.T) {
+	db := NewTestModel(t)
+	trained := Confidence(db, []byte("it was the best of times"))
+	untrained := Confidence(db, []byte("zqxjv kwpfy zqxjv kwpfy"))
+	if len(trained.Masses) != 24-Order+1 {
+		t.Fatal("unexpected number of masses", len(trained.Masses))
+	}
+	for _, mass := range trained.Masses {
+		if mass == 0 {
+			t.Fatal("trained contexts should have mass")
+		}
+	}
+	if untrained.Deviation <= trained.Deviation {
+		t.Fatal("untrained input should be less certain", untrained.Deviation, trained.Deviation)
+	}
+}
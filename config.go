@@ -0,0 +1,98 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// ParseConfig parses a flat yaml or toml config of flag names and values.
+// Keys and values are separated by : or =, # starts a comment, and [sections] are ignored.
+func ParseConfig(r io.Reader) (map[string]string, error) {
+	values, scanner, line := make(map[string]string), bufio.NewScanner(r), 0
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+		if i := strings.Index(text, "#"); i >= 0 && !quoted(text[:i]) {
+			text = text[:i]
+		}
+		text = strings.TrimSpace(text)
+		if text == "" || text == "---" || strings.HasPrefix(text, "[") {
+			continue
+		}
+		i := strings.IndexAny(text, ":=")
+		if i < 0 {
+			return nil, fmt.Errorf("line %d: expected key: value", line)
+		}
+		key, value := strings.TrimSpace(text[:i]), strings.TrimSpace(text[i+1:])
+		key = strings.TrimLeft(key, "-")
+		if key == "" {
+			return nil, fmt.Errorf("line %d: missing key", line)
+		}
+		if length := len(value); length >= 2 && (value[0] == '"' || value[0] == '\'') && value[length-1] == value[0] {
+			value = value[1 : length-1]
+		}
+		values[key] = value
+	}
+	return values, scanner.Err()
+}
+
+// quoted returns true if the text ends inside a quoted string
+func quoted(text string) bool {
+	return strings.Count(text, "\"")%2 == 1 || strings.Count(text, "'")%2 == 1
+}
+
+// ApplyConfig sets the flags of a config file that weren't set on the command line
+func ApplyConfig(set *flag.FlagSet, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	values, err := ParseConfig(file)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	explicit := make(map[string]bool)
+	set.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+	for key, value := range values {
+		if key == "config" {
+			continue
+		}
+		if set.Lookup(key) == nil {
+			return fmt.Errorf("%s: unknown flag %s", path, key)
+		}
+		if explicit[key] {
+			continue
+		}
+		if err := set.Set(key, value); err != nil {
+			return fmt.Errorf("%s: %s: %w", path, key, err)
+		}
+	}
+	return nil
+}
+
+// SetMode sets the mode flag of a mode name
+func SetMode(set *flag.FlagSet, mode string) error {
+	if _, ok := Modes[mode]; !ok {
+		return fmt.Errorf("unknown mode %q", mode)
+	}
+	switch mode {
+	case "complex":
+		set.Set("complex", "true")
+		mode = "attention"
+	case "complex-diffusion":
+		set.Set("complex", "true")
+		mode = "diffusion"
+	}
+	return set.Set(mode, "true")
+}
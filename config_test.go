@@ -0,0 +1,56 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfig(t *testing.T) {
+	values, err := ParseConfig(strings.NewReader(`# experiment
+model: "test.bolt"
+depth = 3 # deeper
+[search]
+input: 'a # b'
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{"model": "test.bolt", "depth": "3", "input": "a # b"}
+	if len(values) != len(expected) {
+		t.Fatalf("got %v expected %v", values, expected)
+	}
+	for key, value := range expected {
+		if values[key] != value {
+			t.Fatalf("%s is %q expected %q", key, values[key], value)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "lit.yaml")
+	if err := os.WriteFile(path, []byte("model: file.bolt\nsteps: 7\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	set := flag.NewFlagSet("test", flag.ContinueOnError)
+	model, steps := set.String("model", "model.bolt", ""), set.Int("steps", 128, "")
+	if err := set.Parse([]string{"-model", "cli.bolt"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ApplyConfig(set, path); err != nil {
+		t.Fatal(err)
+	}
+	if *model != "cli.bolt" || *steps != 7 {
+		t.Fatalf("model is %s and steps are %d", *model, *steps)
+	}
+	if err := os.WriteFile(path, []byte("unknown: 1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ApplyConfig(set, path); err == nil {
+		t.Fatal("unknown flags should be an error")
+	}
+}
@@ -0,0 +1,178 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ControlStatus is the reply of the control socket to every command
+type ControlStatus struct {
+	Progress
+	Paused     bool
+	Finalizing bool
+	// Size is the size of the LRU cache of the learner, 0 before the first article
+	Size  int
+	Error string `json:",omitempty"`
+}
+
+// Supervisor is the state of a learning run that is managed through the control socket
+type Supervisor struct {
+	sync.Mutex
+	// resume is closed when a paused run is resumed, it is nil if the run isn't paused
+	resume   chan struct{}
+	finalize bool
+	size     int
+	resize   int
+	progress Progress
+}
+
+// Supervision supervises the learners, without a control socket nothing pauses or finalizes them
+var Supervision = &Supervisor{}
+
+// Report records the progress of the learning
+func (s *Supervisor) Report(p Progress) {
+	s.Lock()
+	defer s.Unlock()
+	s.progress = p
+}
+
+// Status returns the status of the learning
+func (s *Supervisor) Status() ControlStatus {
+	s.Lock()
+	defer s.Unlock()
+	size := s.size
+	if s.resize > 0 {
+		size = s.resize
+	}
+	return ControlStatus{
+		Progress:   s.progress,
+		Paused:     s.resume != nil,
+		Finalizing: s.finalize,
+		Size:       size,
+	}
+}
+
+// Command runs a control command: status, pause, resume, resize <entries> or finalize
+func (s *Supervisor) Command(line string) ControlStatus {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		status := s.Status()
+		status.Error = "empty command"
+		return status
+	}
+	err := func() error {
+		s.Lock()
+		defer s.Unlock()
+		switch fields[0] {
+		case "status":
+		case "pause":
+			if s.resume == nil {
+				s.resume = make(chan struct{})
+			}
+		case "resume":
+			if s.resume != nil {
+				close(s.resume)
+				s.resume = nil
+			}
+		case "resize":
+			if len(fields) != 2 {
+				return errors.New("resize takes the number of entries of the cache")
+			}
+			size, err := strconv.Atoi(fields[1])
+			if err != nil || size <= 0 {
+				return fmt.Errorf("invalid cache size %q", fields[1])
+			}
+			s.resize = size
+		case "finalize":
+			s.finalize = true
+			if s.resume != nil {
+				close(s.resume)
+				s.resume = nil
+			}
+		default:
+			return fmt.Errorf("unknown command %q, expected status, pause, resume, resize or finalize", fields[0])
+		}
+		return nil
+	}()
+	status := s.Status()
+	if err != nil {
+		status.Error = err.Error()
+	}
+	return status
+}
+
+// Next is called by a learner before each article, it returns false if the learner should stop and write
+// what it has learned, because the learning was interrupted or finalized early.
+// It blocks while the learning is paused and applies a requested resize to the cache of the learner, if it has one.
+func (s *Supervisor) Next(l *LRU) bool {
+	s.Lock()
+	resume := s.resume
+	s.Unlock()
+	if resume != nil {
+		select {
+		case <-resume:
+		case <-Context.Done():
+		}
+	}
+	if Interrupted() {
+		return false
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	if s.finalize {
+		fmt.Println("finalizing early, writing the articles learned so far")
+		return false
+	}
+	if l != nil {
+		if s.resize > 0 {
+			l.Size, s.resize = s.resize, 0
+			if len(l.Nodes) > l.Size {
+				l.Sync()
+			}
+		}
+		s.size = l.Size
+	}
+	return true
+}
+
+// Listen serves the control commands of the supervisor on a unix socket, one command per line
+// and a json status per reply. The listener should be closed when the learning is done.
+func (s *Supervisor) Listen(path string) (net.Listener, error) {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				scanner, encoder := bufio.NewScanner(conn), json.NewEncoder(conn)
+				for scanner.Scan() {
+					if err := encoder.Encode(s.Command(scanner.Text())); err != nil {
+						return
+					}
+				}
+			}(conn)
+		}
+	}()
+	return listener, nil
+}
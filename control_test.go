@@ -0,0 +1,80 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestControl(t *testing.T) {
+	supervisor := &Supervisor{}
+	listener, err := supervisor.Listen(filepath.Join(t.TempDir(), "control.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	conn, err := net.Dial("unix", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	decoder := json.NewDecoder(conn)
+	command := func(line string) ControlStatus {
+		if _, err := fmt.Fprintln(conn, line); err != nil {
+			t.Fatal(err)
+		}
+		var status ControlStatus
+		if err := decoder.Decode(&status); err != nil {
+			t.Fatal(err)
+		}
+		return status
+	}
+
+	lru := NewLRU(1024)
+	lru.Learn([]byte(Corpus))
+	supervisor.Report(Progress{Articles: 1})
+	if !supervisor.Next(&lru) {
+		t.Fatal("the learning should go on")
+	}
+	if status := command("status"); status.Articles != 1 || status.Size != 1024 || status.Paused {
+		t.Fatal("unexpected status", status)
+	}
+	if status := command("resize 0"); status.Error == "" {
+		t.Fatal("an empty cache should be refused")
+	}
+	if status := command("resize 16"); status.Size != 16 || status.Error != "" {
+		t.Fatal("unexpected status", status)
+	}
+	if status := command("pause"); !status.Paused {
+		t.Fatal("the learning should be paused")
+	}
+	next := make(chan bool)
+	go func() {
+		next <- supervisor.Next(&lru)
+	}()
+	select {
+	case <-next:
+		t.Fatal("a paused learner shouldn't go on")
+	case <-time.After(10 * time.Millisecond):
+	}
+	command("resume")
+	if !<-next || lru.Size != 16 || len(lru.Nodes) > 16 {
+		t.Fatal("the resumed learner should go on with the smaller cache", lru.Size, len(lru.Nodes))
+	}
+	if status := command("finalize"); !status.Finalizing {
+		t.Fatal("the learning should be finalizing")
+	}
+	if supervisor.Next(&lru) {
+		t.Fatal("a finalized learner should stop")
+	}
+	if status := command("train"); status.Error == "" {
+		t.Fatal("unknown commands should be refused")
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"math"
+	"math/rand"
+
+	"github.com/pointlander/compress"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/pointlander/lit/matrix"
+)
+
+// Backoff is the first backoff of the inference lookups, with -max-order the contexts longer than it are skipped
+func Backoff() int {
+	if *FlagMaxOrder <= 0 || *FlagMaxOrder >= Order {
+		return 0
+	}
+	return Order - *FlagMaxOrder
+}
+
+// Lookup looks up the vector of a context backing off to shorter contexts
+func Lookup(b *bolt.Bucket, symbol Symbols) (found bool, order int, decoded [Width]uint16) {
+	for j := Backoff(); j < len(Indexes)-1; j++ {
+		symbol := symbol
+		for k := 0; k < j; k++ {
+			symbol[k] = 0
+		}
+		lookup := Timed(PhaseLookup)
+		v := Get(b, symbol[:])
+		lookup()
+		if v != nil {
+			decompress := Timed(PhaseDecompress)
+			output := make([]byte, 2*Width)
+			compress.Mark1Decompress1(bytes.NewBuffer(v), output)
+			DecodeCounts(decoded[:], output)
+			decompress()
+			return true, j, decoded
+		}
+	}
+	return false, 0, decoded
+}
+
+// ContextVectors computes the unit context vectors, the importance, and the backoff order of each context of the input
+func ContextVectors(db *bolt.DB, input []byte) (weights, importance matrix.Matrix, orders []int) {
+	rnd := rand.New(rand.NewSource(1))
+	length := len(input) - Order + 1
+	weights, importance, orders = matrix.NewMatrix(0, 256, length), matrix.NewMatrix(0, length, 1), make([]int, 0, length)
+	db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(ModelBucket)
+		for i := 0; i < length; i++ {
+			symbol := Symbols{}
+			for j := range symbol {
+				symbol[j] = input[i+Indexes[j]]
+			}
+			found, order, decoded := Lookup(b, symbol)
+			vector := make([]float64, 256)
+			if !found {
+				order = Order - 1
+				sum := 0.0
+				for key := range vector {
+					v := rnd.Float64()
+					sum += v * v
+					vector[key] = v
+				}
+				length := math.Sqrt(sum)
+				for i, v := range vector {
+					vector[i] = v / length
+				}
+			} else {
+				UnitCounts(vector, decoded[:256])
+			}
+			weights.Data = append(weights.Data, vector...)
+			importance.Data = append(importance.Data, 1/float64(Order-order))
+			orders = append(orders, order)
+		}
+		return nil
+	})
+	return weights, importance, orders
+}
+
+// PromptVectors computes the context vectors of the prompt that the generated text attends to.
+// They are computed once per search, the result has no rows if the prompt is shorter than Order.
+func PromptVectors(db *bolt.DB, prompt []byte) matrix.Matrix {
+	if len(prompt) < Order {
+		return matrix.NewMatrix(0, 256, 0)
+	}
+	kv, _, _ := ContextVectors(db, prompt)
+	return kv
+}
+
+// CrossEntropy computes the entropy of the generated text attending to the prompt vectors
+func CrossEntropy(db *bolt.DB, generated []byte, kv matrix.Matrix) float64 {
+	if len(generated) < Order || kv.Rows == 0 {
+		return 0
+	}
+	q, importance, _ := ContextVectors(db, generated)
+	return matrix.CrossEntropyKernel(q, kv, kv, importance)
+}
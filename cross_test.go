@@ -0,0 +1,60 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"math"
+	"os"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestCrossEntropy(t *testing.T) {
+	db := NewTestModel(t)
+	prompt := PromptVectors(db, []byte("it was the season of Light"))
+	on := CrossEntropy(db, []byte("it was the season of Darkness"), prompt)
+	if math.IsNaN(on) || on <= 0 {
+		t.Fatal("invalid cross entropy", on)
+	}
+	if CrossEntropy(db, []byte("short"), prompt) != 0 {
+		t.Fatal("short generated text should have no cross entropy")
+	}
+	if CrossEntropy(db, []byte("it was the season of Darkness"), PromptVectors(db, []byte("short"))) != 0 {
+		t.Fatal("short prompt should have no cross entropy")
+	}
+}
+
+func TestMaxOrder(t *testing.T) {
+	db := NewTestModel(t)
+	symbol := Symbols{}
+	for j := range symbol {
+		symbol[j] = Corpus[Indexes[j]]
+	}
+	maxOrder := *FlagMaxOrder
+	defer func() {
+		*FlagMaxOrder = maxOrder
+	}()
+	for _, test := range []struct {
+		MaxOrder int
+		Order    int
+	}{{0, 0}, {Order, 0}, {4, Order - 4}, {2, Order - 2}} {
+		*FlagMaxOrder = test.MaxOrder
+		var found bool
+		var order int
+		db.View(func(tx *bolt.Tx) error {
+			found, order, _ = Lookup(tx.Bucket(ModelBucket), symbol)
+			return nil
+		})
+		if !found || order != test.Order {
+			t.Fatalf("-max-order %d should back off to %d not %d", test.MaxOrder, test.Order, order)
+		}
+	}
+	capped := CacheModel(os.Args[0])
+	*FlagMaxOrder = 0
+	if capped == CacheModel(os.Args[0]) {
+		t.Fatal("the cache identity should include the max order")
+	}
+}
@@ -0,0 +1,292 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	zim "github.com/akhenakh/gozim"
+	"github.com/k3a/html2text"
+	"github.com/pointlander/compress"
+	bolt "go.etcd.io/bbolt"
+)
+
+// ArticleText returns the preprocessed plain text of an article
+func ArticleText(reader *zim.ZimReader, index uint32) (url, plain string, ok bool) {
+	article, err := reader.ArticleAtURLIdx(index)
+	if err != nil {
+		return "", "", false
+	}
+	url = article.FullURL()
+	if !strings.HasSuffix(url, ".html") {
+		return url, "", false
+	}
+	html, err := article.Data()
+	if err != nil {
+		panic(err)
+	}
+	plain = Preprocess(html2text.HTML2Text(string(html)))
+	return url, plain, plain != ""
+}
+
+// SortedKeys returns the keys of the model sorted by shard and then key so that the model is written
+// deterministically, a shard at a time
+func SortedKeys(model map[Symbols][]uint8) []Symbols {
+	keys := make([]Symbols, 0, len(model))
+	for key := range model {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if a, b := Shard(keys[i][:])[0], Shard(keys[j][:])[0]; a != b {
+			return a < b
+		}
+		return bytes.Compare(keys[i][:], keys[j][:]) < 0
+	})
+	return keys
+}
+
+// WriteModel writes the learned markov model to a bucket of a bolt db
+func WriteModel(db *bolt.DB, bucket []byte, s *LRU) {
+	if ModelPrivacy != nil {
+		ModelPrivacy.Apply(s.Model)
+		ModelPrivacy.NoiseEnds(s.Ends)
+		WriteMetadata(db, "privacy", ModelPrivacy)
+	}
+	if ModelSmoother != nil {
+		ModelSmoother.Apply(s.Model)
+		WriteMetadata(db, "smoothing", ModelSmoother)
+	}
+	err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucket)
+		return err
+	})
+	if err != nil {
+		panic(err)
+	}
+	// each shard is written in its own transaction, bolt writes the new buckets of a transaction in map order
+	keys := SortedKeys(s.Model)
+	for len(keys) > 0 {
+		end := 1
+		for end < len(keys) && Shard(keys[end][:])[0] == Shard(keys[0][:])[0] {
+			end++
+		}
+		shard := keys[:end]
+		keys = keys[end:]
+		err := db.Update(func(tx *bolt.Tx) error {
+			put := Putter(tx.Bucket(bucket))
+			for _, key := range shard {
+				k := key
+				if err := put(k[:], s.Model[key]); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			panic(err)
+		}
+	}
+	WriteEnds(db, bucket, s.Ends)
+	WriteMetadata(db, "shape", CurrentShape())
+}
+
+// DecodeVector decodes a compressed model vector
+func DecodeVector(v []byte) (vector [Width]uint16) {
+	output := make([]byte, 2*Width)
+	compress.Mark1Decompress1(bytes.NewBuffer(v), output)
+	for key := range vector {
+		vector[key] = uint16(output[2*key]) | uint16(output[2*key+1])<<8
+	}
+	return vector
+}
+
+// EncodeVector compresses a model vector
+func EncodeVector(vector [Width]uint16) []byte {
+	data := make([]byte, 2*Width)
+	for key, value := range vector {
+		data[2*key] = byte(value & 0xff)
+		data[2*key+1] = byte(value >> 8)
+	}
+	buffer := bytes.Buffer{}
+	compress.Mark1Compress1(data, &buffer)
+	return buffer.Bytes()
+}
+
+// AddVectors adds two model vectors, the sum is halved until it fits
+func AddVectors(a, b [Width]uint16) [Width]uint16 {
+	wide := [Width]uint64{}
+	for key := range wide {
+		wide[key] = uint64(a[key]) + uint64(b[key])
+	}
+	return Narrow(wide)
+}
+
+// Narrow halves wide counts until they fit in a model vector
+func Narrow(wide [Width]uint64) (vector [Width]uint16) {
+	max := uint64(0)
+	for _, value := range wide {
+		if value > max {
+			max = value
+		}
+	}
+	shift := 0
+	for max>>shift > math.MaxUint16 {
+		shift++
+	}
+	for key, value := range wide {
+		vector[key] = uint16(value >> shift)
+	}
+	return vector
+}
+
+// MergeModel adds the learned markov model to the vectors and end counts of a bucket of a bolt db.
+// With smoothing the learned model is smoothed before it is added, so each merge adds its own smoothing.
+func MergeModel(db *bolt.DB, bucket []byte, s *LRU) {
+	if ModelPrivacy != nil {
+		ModelPrivacy.Apply(s.Model)
+		ModelPrivacy.NoiseEnds(s.Ends)
+		WriteMetadata(db, "privacy", ModelPrivacy)
+	}
+	if ModelSmoother != nil {
+		ModelSmoother.Apply(s.Model)
+		WriteMetadata(db, "smoothing", ModelSmoother)
+	}
+	err := db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(bucket)
+		if err != nil {
+			return err
+		}
+		if err := Denormalize(tx, bucket); err != nil {
+			return err
+		}
+		put := Putter(b)
+		for _, key := range SortedKeys(s.Model) {
+			k, value := key, s.Model[key]
+			if v := Get(b, k[:]); v != nil {
+				value = EncodeVector(AddVectors(DecodeVector(v), DecodeVector(value)))
+			}
+			if err := put(k[:], value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		panic(err)
+	}
+	MergeEnds(db, bucket, s.Ends)
+}
+
+// CurriculumMisses is the number of articles in a row that can be rejected before the selection gives up
+const CurriculumMisses = 1 << 16
+
+// Article is the preprocessed text of an article
+type Article struct {
+	URL   string
+	Plain string
+}
+
+// NewSymbolVectorsCurriculum makes new markov symbol vector model from random books ordered from easy to hard.
+// The difficulty of a book is its average self entropy under a bootstrap model learned from a sample of the books.
+// The text of the selected books is kept, so each book is decompressed and preprocessed once.
+func NewSymbolVectorsCurriculum() LRU {
+	const Sample = 1024
+	rnd := rand.New(rand.NewSource(1))
+	reader := OpenData()
+
+	articles, length, misses := make([]Article, 0, *FlagScale*1024+1), reader.ArticleCount, 0
+	for len(articles) <= *FlagScale*1024 {
+		if misses == CurriculumMisses {
+			Fail(ExitData, fmt.Errorf("%d articles in a row were rejected by the preprocessing", misses))
+		}
+		index := rnd.Intn(int(length))
+		if index == 0 {
+			continue
+		}
+		url, plain, ok := ArticleText(reader, uint32(index))
+		if !ok {
+			misses++
+			continue
+		}
+		misses = 0
+		articles = append(articles, Article{URL: url, Plain: plain})
+	}
+	fmt.Println("selected", len(articles))
+
+	bootstrap, size := NewLRU(*FlagLRU), *FlagBootstrap
+	if size > len(articles) {
+		size = len(articles)
+	}
+	ingestion := NewIngestion(len(articles))
+	for _, article := range articles[:size] {
+		if err := bootstrap.Learn([]byte(article.Plain)); err != nil {
+			ingestion.Skip(article.URL, err)
+		}
+	}
+	bootstrap.Close()
+	dir, err := os.MkdirTemp("", "bootstrap")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+	db, err := bolt.Open(filepath.Join(dir, "bootstrap.bolt"), 0600, nil)
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+	WriteModel(db, []byte("markov"), &bootstrap)
+	fmt.Println("bootstrap model learned")
+
+	difficulty := make([]float64, len(articles))
+	for i, article := range articles {
+		sample := []byte(article.Plain)
+		if len(sample) > Sample {
+			sample = sample[:Sample]
+		}
+		if len(sample) < Order {
+			continue
+		}
+		difficulty[i] = SelfEntropy(db, sample, nil)[0] / float64(len(sample))
+		if i%100 == 0 {
+			fmt.Printf("scored %d/%d\n", i, len(articles))
+		}
+	}
+	order := make([]int, len(articles))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return difficulty[order[i]] < difficulty[order[j]]
+	})
+
+	vectors := NewLRU(*FlagLRU)
+	for i, index := range order {
+		url, plain := articles[index].URL, articles[index].Plain
+		if ArticleDedup.Duplicate(url, plain) || LearnHoldout.Hold(url, plain) {
+			continue
+		}
+		if !Supervision.Next(&vectors) {
+			break
+		}
+		if err := vectors.Learn([]byte(plain)); err != nil {
+			ingestion.Skip(url, err)
+			continue
+		}
+		ingestion.Learned(url, len(plain), len(vectors.Model))
+		if i%100 == 0 {
+			runtime.GC()
+		}
+	}
+	fmt.Println("done")
+	return vectors
+}
@@ -0,0 +1,61 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestWriteModelDeterministic(t *testing.T) {
+	write := func(name string) []byte {
+		s := NewLRU(1024)
+		s.Learn([]byte(Corpus))
+		s.Close()
+		file := filepath.Join(t.TempDir(), name)
+		db, err := bolt.Open(file, 0600, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		WriteModel(db, []byte("markov"), &s)
+		db.Close()
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	if !bytes.Equal(write("a.bolt"), write("b.bolt")) {
+		t.Fatal("identical training should write identical models")
+	}
+}
+
+func TestMergeModel(t *testing.T) {
+	a, b := [Width]uint16{}, [Width]uint16{}
+	a[0], a[1], b[0] = math.MaxUint16, 2, 1
+	if sum := AddVectors(a, b); sum[0] != (math.MaxUint16+1)>>1 || sum[1] != 1 {
+		t.Fatal("vectors that overflow should be halved", sum[:2])
+	}
+
+	db := NewTestModel(t)
+	s := NewLRU(1024)
+	s.Learn([]byte(Corpus))
+	s.Close()
+	key := SortedKeys(s.Model)[0]
+	before := DecodeVector(s.Model[key])
+	MergeModel(db, []byte("markov"), &s)
+	db.View(func(tx *bolt.Tx) error {
+		after := DecodeVector(Get(tx.Bucket([]byte("markov")), key[:]))
+		if after != AddVectors(before, before) {
+			t.Fatal("merged vectors should be summed")
+		}
+		return nil
+	})
+}
@@ -0,0 +1,293 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// CorpusFile is the state of a file of a watched corpus when the model was learned
+type CorpusFile struct {
+	Size    int64
+	ModTime time.Time
+}
+
+// CorpusState are the files of a watched corpus by path, it is recorded in the metadata of the model as "corpus"
+type CorpusState map[string]CorpusFile
+
+// ScanCorpus returns the state of the regular files of a corpus directory
+func ScanCorpus(dir string) (CorpusState, error) {
+	state := make(CorpusState)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			state[path] = CorpusFile{Size: info.Size(), ModTime: info.ModTime().UTC()}
+		}
+		return nil
+	})
+	return state, err
+}
+
+// Changes returns the files that were added since the previous state, and true if a file was modified or removed,
+// in which case the model has to be learned again from the whole corpus
+func (s CorpusState) Changes(previous CorpusState) (added []string, rebuild bool) {
+	for path, file := range s {
+		old, ok := previous[path]
+		if !ok {
+			added = append(added, path)
+		} else if old.Size != file.Size || !old.ModTime.Equal(file.ModTime) {
+			rebuild = true
+		}
+	}
+	for path := range previous {
+		if _, ok := s[path]; !ok {
+			rebuild = true
+		}
+	}
+	sort.Strings(added)
+	return added, rebuild
+}
+
+// Daemon retrains a model from a watched corpus directory and swaps it in for the server
+type Daemon struct {
+	Corpus string
+	Model  string
+	// Generations is the number of previous models kept for rollback
+	Generations int
+	// Server is locked while the model is swapped, nil if nothing is served
+	Server *Server
+}
+
+// Retrain updates the model with the changes of the corpus, it returns false if nothing changed.
+// New files are merged into a copy of the model, a modified or removed file learns the model again from the whole corpus.
+// The new model replaces the model atomically, after the model is kept as a generation.
+func (d *Daemon) Retrain() (bool, error) {
+	state, err := ScanCorpus(d.Corpus)
+	if err != nil {
+		return false, err
+	}
+	previous, exists := CorpusState{}, false
+	err = d.locked(func() error {
+		if _, err := os.Stat(d.Model); err != nil {
+			return nil
+		}
+		db, err := bolt.Open(d.Model, 0600, &bolt.Options{Timeout: time.Second, ReadOnly: true})
+		if err != nil {
+			return err
+		}
+		exists = ReadMetadata(db, "corpus", &previous)
+		return db.Close()
+	})
+	if err != nil {
+		return false, err
+	}
+	added, rebuild := state.Changes(previous)
+	if !exists {
+		added, rebuild = nil, true
+	}
+	if !rebuild && len(added) == 0 {
+		return false, nil
+	}
+	if rebuild {
+		added = added[:0]
+		for path := range state {
+			added = append(added, path)
+		}
+		sort.Strings(added)
+	}
+
+	next := d.Model + ".next"
+	os.Remove(next)
+	if !rebuild {
+		if err := d.locked(func() error { return copyFile(d.Model, next) }); err != nil {
+			return false, err
+		}
+	}
+	db, err := bolt.Open(next, 0600, nil)
+	if err != nil {
+		return false, err
+	}
+	s := NewLRU(*FlagLRU)
+	for _, path := range added {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			db.Close()
+			return false, err
+		}
+		if err := s.Learn(data); err != nil && err != ErrEmptyInput {
+			db.Close()
+			return false, err
+		}
+	}
+	s.Close()
+	if rebuild {
+		WriteModel(db, ModelBucket, &s)
+	} else {
+		MergeModel(db, ModelBucket, &s)
+	}
+	WriteMetadata(db, "corpus", state)
+	if ModelGate != nil && exists {
+		err := d.locked(func() error {
+			current, err := bolt.Open(d.Model, 0600, &bolt.Options{Timeout: time.Second, ReadOnly: true})
+			if err != nil {
+				return err
+			}
+			defer current.Close()
+			_, _, err = ModelGate.Check(db, current)
+			return err
+		})
+		if errors.Is(err, ErrQualityRegressed) && *FlagForce {
+			fmt.Fprintln(os.Stderr, "swapping the model with -force:", err)
+		} else if err != nil {
+			db.Close()
+			os.Remove(next)
+			return false, err
+		}
+	}
+	if err := db.Close(); err != nil {
+		return false, err
+	}
+	return true, d.swap(next)
+}
+
+// locked runs f while the server isn't generating, the generations hold the model open
+func (d *Daemon) locked(f func() error) error {
+	if d.Server != nil {
+		d.Server.Lock()
+		defer d.Server.Unlock()
+	}
+	return f()
+}
+
+// swap keeps the model as a generation and renames the next model over it
+func (d *Daemon) swap(next string) error {
+	return d.locked(func() error {
+		if _, err := os.Stat(d.Model); err == nil {
+			generation := fmt.Sprintf("%s.%d", d.Model, time.Now().UnixNano())
+			if err := os.Link(d.Model, generation); err != nil {
+				if err := copyFile(d.Model, generation); err != nil {
+					return err
+				}
+			}
+		}
+		if err := os.Rename(next, d.Model); err != nil {
+			return err
+		}
+		// the cached lookups are of the previous model
+		if InferenceCache != nil {
+			InferenceCache = NewCache(CacheModel(d.Model), *FlagCacheSize)
+		}
+		if VectorCache != nil {
+			VectorCache.Reset(string(ModelBucket))
+		}
+		return d.prune()
+	})
+}
+
+// ModelGenerations returns the kept generations of a model from the oldest to the newest
+func ModelGenerations(model string) ([]string, error) {
+	matches, err := filepath.Glob(model + ".*")
+	if err != nil {
+		return nil, err
+	}
+	generations := make([]string, 0, len(matches))
+	for _, match := range matches {
+		suffix := strings.TrimPrefix(match, model+".")
+		if suffix != "" && strings.Trim(suffix, "0123456789") == "" {
+			generations = append(generations, match)
+		}
+	}
+	sort.Slice(generations, func(i, j int) bool {
+		if len(generations[i]) != len(generations[j]) {
+			return len(generations[i]) < len(generations[j])
+		}
+		return generations[i] < generations[j]
+	})
+	return generations, nil
+}
+
+// prune removes the oldest generations beyond the number kept
+func (d *Daemon) prune() error {
+	generations, err := ModelGenerations(d.Model)
+	if err != nil {
+		return err
+	}
+	for len(generations) > d.Generations {
+		if err := os.Remove(generations[0]); err != nil {
+			return err
+		}
+		generations = generations[1:]
+	}
+	return nil
+}
+
+// copyFile copies a file
+func copyFile(from, to string) error {
+	in, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(to)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// Run retrains the model every interval until Context is done
+func (d *Daemon) Run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		changed, err := d.Retrain()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "retraining failed:", err)
+		} else if changed {
+			fmt.Println("retrained", d.Model)
+		}
+		select {
+		case <-ticker.C:
+		case <-Context.Done():
+			return
+		}
+	}
+}
+
+func daemon() {
+	if *FlagGenerations < 0 {
+		Fail(ExitFlags, fmt.Errorf("the number of generations can't be negative"))
+	}
+	if *FlagInterval <= 0 {
+		Fail(ExitFlags, fmt.Errorf("the retraining interval should be positive"))
+	}
+	d := &Daemon{
+		Corpus:      *FlagWatch,
+		Model:       *FlagModel,
+		Generations: *FlagGenerations,
+	}
+	if *FlagServe == "" {
+		d.Run(*FlagInterval)
+		return
+	}
+	d.Server = NewServer()
+	go d.Run(*FlagInterval)
+	listen(d.Server)
+}
@@ -0,0 +1,68 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDaemon(t *testing.T) {
+	dir := t.TempDir()
+	corpus := filepath.Join(dir, "corpus")
+	if err := os.Mkdir(corpus, 0755); err != nil {
+		t.Fatal(err)
+	}
+	write := func(name, text string) {
+		if err := os.WriteFile(filepath.Join(corpus, name), []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entries := func(model string) int {
+		db := OpenModel(model)
+		defer db.Close()
+		count := 0
+		if err := ScanShards(db, ModelBucket, func(_ int, _, _ []byte) error {
+			count++
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		return count
+	}
+	d := &Daemon{Corpus: corpus, Model: filepath.Join(dir, "model.bolt"), Generations: 1}
+	write("a.txt", Corpus[:200])
+	if changed, err := d.Retrain(); err != nil || !changed {
+		t.Fatal("the first retraining should learn the corpus", changed, err)
+	}
+	first := entries(d.Model)
+	if changed, err := d.Retrain(); err != nil || changed {
+		t.Fatal("an unchanged corpus shouldn't be retrained", changed, err)
+	}
+	write("b.txt", Corpus[200:])
+	if changed, err := d.Retrain(); err != nil || !changed {
+		t.Fatal("a new file should be merged", changed, err)
+	}
+	if entries(d.Model) <= first {
+		t.Fatal("the new file should be learned")
+	}
+	if err := os.Remove(filepath.Join(corpus, "b.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := d.Retrain(); err != nil || !changed {
+		t.Fatal("a removed file should rebuild the model", changed, err)
+	}
+	if entries(d.Model) != first {
+		t.Fatal("the rebuilt model should only have the remaining file")
+	}
+	generations, err := ModelGenerations(d.Model)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(generations) != 1 || entries(generations[0]) <= first {
+		t.Fatal("the previous model should be kept as the only generation", generations)
+	}
+}
@@ -0,0 +1,37 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"unsafe"
+
+	"github.com/pointlander/lit/matrix"
+)
+
+// DecodeCounts decodes the little endian uint16 counts of a decompressed vector.
+// The supported architectures are little endian, so the buffer is copied as is instead of byte by byte.
+func DecodeCounts(counts []uint16, output []byte) {
+	if len(output) < 2 {
+		return
+	}
+	copy(counts, unsafe.Slice((*uint16)(unsafe.Pointer(&output[0])), len(output)/2))
+}
+
+// UnitCounts converts counts to a unit vector
+func UnitCounts(vector []float64, counts []uint16) {
+	for key, count := range counts {
+		vector[key] = float64(count)
+	}
+	matrix.Unit(vector)
+}
+
+// UnitBytes converts the little endian counts of a decompressed buffer directly to a unit vector
+func UnitBytes(vector []float64, output []byte) {
+	counts := unsafe.Slice((*uint16)(unsafe.Pointer(&output[0])), len(output)/2)
+	for key := range vector {
+		vector[key] = float64(counts[key])
+	}
+	matrix.Unit(vector)
+}
@@ -0,0 +1,47 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestDecodeCounts(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	output := make([]byte, 2*Width)
+	rnd.Read(output)
+	counts := make([]uint16, Width)
+	DecodeCounts(counts, output)
+	for key, count := range counts {
+		if expected := uint16(output[2*key]) | uint16(output[2*key+1])<<8; count != expected {
+			t.Fatal("invalid count", key, count, expected)
+		}
+	}
+	unit, vector := Unit(counts[:256]), make([]float64, 256)
+	UnitBytes(vector, output[:512])
+	norm := 0.0
+	for key, value := range vector {
+		if math.Abs(value-unit[key]) > 1e-12 {
+			t.Fatal("the unit vectors of the bytes and the counts should be the same", key, value, unit[key])
+		}
+		norm += value * value
+	}
+	if math.Abs(norm-1) > 1e-9 {
+		t.Fatal("the vector should have unit length", norm)
+	}
+	if zero := Unit(make([]uint16, 256)); zero[0] != 0 {
+		t.Fatal("a zero histogram should stay zero")
+	}
+}
+
+func BenchmarkUnitBytes(b *testing.B) {
+	output, vector := make([]byte, 2*Width), make([]float64, 256)
+	rand.New(rand.NewSource(1)).Read(output)
+	for n := 0; n < b.N; n++ {
+		UnitBytes(vector, output[:512])
+	}
+}
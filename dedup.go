@@ -0,0 +1,132 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strings"
+	"unicode"
+)
+
+const (
+	// ShingleWords is the number of words of a shingle
+	ShingleWords = 5
+	// DedupBands is the number of bands of a minhash signature, an article is compared with the articles
+	// that share a band
+	DedupBands = 16
+	// DedupRows is the number of minhashes of a band
+	DedupRows = 8
+)
+
+// Deduplicator detects near duplicate articles during ingestion, so mirrored and repeated articles are learned once.
+// An article is a set of word shingles, its minhash signature estimates the jaccard similarity with other articles,
+// and the bands of the signatures are hashed so only the articles that share a band are compared.
+type Deduplicator struct {
+	// Threshold is the estimated jaccard similarity above which an article is a duplicate
+	Threshold  float64
+	signatures [][DedupBands * DedupRows]uint32
+	urls       []string
+	bands      map[uint64][]int
+	// Duplicates is the number of duplicate articles found
+	Duplicates int
+}
+
+// ArticleDedup deduplicates the learned articles with -dedup, nil learns every article
+var ArticleDedup *Deduplicator
+
+// NewDeduplicator creates a deduplicator with a similarity threshold
+func NewDeduplicator(threshold float64) (*Deduplicator, error) {
+	if threshold <= 0 || threshold > 1 {
+		return nil, errors.New("the duplicate similarity threshold should be in (0, 1]")
+	}
+	return &Deduplicator{
+		Threshold: threshold,
+		bands:     make(map[uint64][]int),
+	}, nil
+}
+
+// mix is the splitmix64 finalizer, it derives the independent hashes of a shingle
+func mix(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// Signature computes the minhash signature of the lower case word shingles of a text
+func Signature(text string) (signature [DedupBands * DedupRows]uint32) {
+	for i := range signature {
+		signature[i] = math.MaxUint32
+	}
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	shingles := len(words) - ShingleWords + 1
+	if shingles < 1 {
+		shingles = 1
+	}
+	for i := 0; i < shingles && i < len(words); i++ {
+		end := i + ShingleWords
+		if end > len(words) {
+			end = len(words)
+		}
+		h := fnv.New64a()
+		h.Write([]byte(strings.Join(words[i:end], " ")))
+		shingle := h.Sum64()
+		for j := range signature {
+			if value := uint32(mix(shingle+uint64(j)*0x9e3779b97f4a7c15) >> 32); value < signature[j] {
+				signature[j] = value
+			}
+		}
+	}
+	return signature
+}
+
+// Similarity estimates the jaccard similarity of two articles from their signatures
+func Similarity(a, b *[DedupBands * DedupRows]uint32) float64 {
+	same := 0
+	for i := range a {
+		if a[i] == b[i] {
+			same++
+		}
+	}
+	return float64(same) / float64(len(a))
+}
+
+// Duplicate returns true if the article is a near duplicate of an article seen before, otherwise the article is recorded.
+// A nil deduplicator never finds duplicates.
+func (d *Deduplicator) Duplicate(url, plain string) bool {
+	if d == nil {
+		return false
+	}
+	signature := Signature(plain)
+	keys := make([]uint64, DedupBands)
+	for band := range keys {
+		h := fnv.New64a()
+		h.Write([]byte{byte(band)})
+		for _, value := range signature[band*DedupRows : (band+1)*DedupRows] {
+			h.Write([]byte{byte(value), byte(value >> 8), byte(value >> 16), byte(value >> 24)})
+		}
+		keys[band] = h.Sum64()
+		for _, candidate := range d.bands[keys[band]] {
+			if Similarity(&signature, &d.signatures[candidate]) >= d.Threshold {
+				d.Duplicates++
+				fmt.Printf("duplicate of %s: %s\n", d.urls[candidate], url)
+				return true
+			}
+		}
+	}
+	index := len(d.signatures)
+	d.signatures, d.urls = append(d.signatures, signature), append(d.urls, url)
+	for _, key := range keys {
+		d.bands[key] = append(d.bands[key], index)
+	}
+	return false
+}
@@ -0,0 +1,40 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDedup(t *testing.T) {
+	if _, err := NewDeduplicator(0); err == nil {
+		t.Fatal("a zero threshold should be invalid")
+	}
+	dedup, err := NewDeduplicator(.8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mirror := strings.Replace(Corpus, "Heaven", "heaven!", 1)
+	if a, b := Signature(Corpus), Signature(mirror); Similarity(&a, &b) < .8 {
+		t.Fatal("the mirror should be similar", Similarity(&a, &b))
+	}
+	if dedup.Duplicate("a", Corpus) {
+		t.Fatal("the first article isn't a duplicate")
+	}
+	if !dedup.Duplicate("b", mirror) {
+		t.Fatal("the mirrored article should be a duplicate")
+	}
+	if dedup.Duplicate("c", "It is a far, far better thing that I do, than I have ever done; it is a far, far better rest that I go to") {
+		t.Fatal("a different article isn't a duplicate")
+	}
+	if dedup.Duplicates != 1 {
+		t.Fatal("one duplicate should be found", dedup.Duplicates)
+	}
+	var none *Deduplicator
+	if none.Duplicate("a", Corpus) {
+		t.Fatal("without -dedup nothing is a duplicate")
+	}
+}
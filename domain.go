@@ -0,0 +1,141 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"os"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Domain is a domain sub-model
+type Domain struct {
+	Name    string
+	Pattern *regexp.Regexp
+}
+
+// DomainBucket is the bolt bucket of a domain sub-model
+func DomainBucket(name string) []byte {
+	return Bucket("markov." + name)
+}
+
+// ParseDomains parses comma separated name=regexp domains
+func ParseDomains(domains string) []Domain {
+	parsed := make([]Domain, 0, 8)
+	for _, domain := range strings.Split(domains, ",") {
+		parts := strings.SplitN(domain, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			Fail(ExitFlags, fmt.Errorf("invalid domain %q", domain))
+		}
+		pattern, err := regexp.Compile(parts[1])
+		if err != nil {
+			Fail(ExitFlags, fmt.Errorf("domain %s: %w", parts[0], err))
+		}
+		parsed = append(parsed, Domain{
+			Name:    parts[0],
+			Pattern: pattern,
+		})
+	}
+	return parsed
+}
+
+// NewDomainSymbolVectorsRandom makes a general markov symbol vector model from random books
+// and a sub-model for each domain from the books with a matching url
+func NewDomainSymbolVectorsRandom(domains []Domain) map[string]*LRU {
+	rnd := rand.New(rand.NewSource(1))
+	models := make(map[string]*LRU, len(domains)+1)
+	general := NewLRU(*FlagLRU)
+	models[""] = &general
+	for _, domain := range domains {
+		model := NewLRU(*FlagLRU)
+		models[domain.Name] = &model
+	}
+	reader := OpenData()
+	ingestion := NewIngestion(*FlagScale*1024 + 1)
+	i, length := 0, reader.ArticleCount
+	for {
+		index := rnd.Intn(int(length))
+		if index == 0 {
+			continue
+		}
+		url, plain, ok := ArticleText(reader, uint32(index))
+		if !ok || ArticleDedup.Duplicate(url, plain) {
+			continue
+		}
+		if !Supervision.Next(&general) {
+			break
+		}
+		if err := general.Learn([]byte(plain)); err != nil {
+			ingestion.Skip(url, err)
+			continue
+		}
+		ingestion.Learned(url, len(plain), len(general.Model))
+		for _, domain := range domains {
+			if domain.Pattern.MatchString(url) {
+				if err := models[domain.Name].Learn([]byte(plain)); err != nil {
+					ingestion.Skip(url, err)
+				}
+			}
+		}
+		if i%100 == 0 {
+			runtime.GC()
+		}
+		if i == *FlagScale*1024 {
+			break
+		}
+		i++
+	}
+	for _, model := range models {
+		model.Close()
+	}
+	fmt.Println("done")
+	return models
+}
+
+// Route finds the model bucket that best predicts the input, the bucket with the fewest bits per byte of the input.
+// The general model is also learned from the articles of the domains, so a bucket can't be scored by how little it
+// backs off. On a tie the domain sub-model is picked, as it explains the input as well and is more specific.
+func Route(db *bolt.DB, input []byte) []byte {
+	type Candidate struct {
+		Bucket []byte
+		Bits   float64
+	}
+	candidates := make([]Candidate, 0, 8)
+	for _, name := range ModelBuckets(db) {
+		bucket := []byte(name)
+		candidates = append(candidates, Candidate{
+			Bucket: bucket,
+			Bits:   BucketBits(db, bucket, input, MixtureWeights),
+		})
+	}
+	if len(candidates) == 0 {
+		return ModelBucket
+	}
+	general := Bucket("markov")
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].Bits != candidates[j].Bits {
+			return candidates[i].Bits < candidates[j].Bits
+		}
+		return !bytes.Equal(candidates[i].Bucket, general) && bytes.Equal(candidates[j].Bucket, general)
+	})
+	return candidates[0].Bucket
+}
+
+// RouteModel sets the model bucket to the domain sub-model that best matches the input if -route is set
+// The choice is reported on stderr, so it does not mix with the generated output
+func RouteModel(db *bolt.DB, input []byte) {
+	if !*FlagRoute {
+		return
+	}
+	ModelBucket = Route(db, input)
+	fmt.Fprintln(os.Stderr, "routed to", string(ModelBucket))
+}
@@ -0,0 +1,45 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestRoute(t *testing.T) {
+	db := NewTestModel(t)
+	domain := NewLRU(1024)
+	domain.Learn([]byte(strings.Repeat("the quick brown fox jumps over the lazy dog. ", 8)))
+	domain.Close()
+	WriteModel(db, DomainBucket("fox"), &domain)
+	if bucket := string(Route(db, []byte("the quick brown fox jumps"))); bucket != "markov.fox" {
+		t.Fatal("should route to the fox domain", bucket)
+	}
+	if bucket := string(Route(db, []byte("it was the best of times"))); bucket != "markov" {
+		t.Fatal("should route to the general model", bucket)
+	}
+
+	// the general model is also learned from the articles of the domain
+	general := NewLRU(1024)
+	general.Learn([]byte(Corpus + strings.Repeat("the quick brown fox jumps over the lazy dog. ", 8)))
+	general.Close()
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "general.bolt"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	WriteModel(db, ModelBucket, &general)
+	WriteModel(db, DomainBucket("fox"), &domain)
+	if bucket := string(Route(db, []byte("the quick brown fox jumps"))); bucket != "markov.fox" {
+		t.Fatal("should route to the fox domain learned by the general model too", bucket)
+	}
+	if bucket := string(Route(db, []byte("it was the best of times"))); bucket != "markov" {
+		t.Fatal("should route to the general model", bucket)
+	}
+}
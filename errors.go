@@ -0,0 +1,143 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	zim "github.com/akhenakh/gozim"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// ExitInternal is the exit code for internal errors
+	ExitInternal = 1
+	// ExitFlags is the exit code for invalid flags, the same as the flag package uses
+	ExitFlags = 2
+	// ExitModelNotFound is the exit code for a model that doesn't exist
+	ExitModelNotFound = 3
+	// ExitCorruptModel is the exit code for a model that can't be read
+	ExitCorruptModel = 4
+	// ExitData is the exit code for training data or input files that can't be read
+	ExitData = 5
+	// ExitRegression is the exit code for a benchmark regression or a model that fails the quality gate
+	ExitRegression = 6
+	// ExitScorer is the exit code for an external scorer that fails
+	ExitScorer = 7
+	// ExitCanceled is the exit code for an interrupted or timed out command
+	ExitCanceled = 8
+	// ExitPostProcess is the exit code for a post-processing command that fails with -post-policy fail
+	ExitPostProcess = 9
+)
+
+// Classes are the names of the exit codes
+var Classes = map[int]string{
+	ExitInternal:      "internal",
+	ExitFlags:         "flags",
+	ExitModelNotFound: "model_not_found",
+	ExitCorruptModel:  "corrupt_model",
+	ExitData:          "data",
+	ExitRegression:    "regression",
+	ExitScorer:        "scorer",
+	ExitCanceled:      "canceled",
+	ExitPostProcess:   "post_process",
+}
+
+// Error is an error with an exit code
+type Error struct {
+	Code int
+	Err  error
+}
+
+// Error returns the error message
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %v", Classes[e.Code], e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Fail panics with an error with an exit code
+func Fail(code int, err error) {
+	panic(&Error{Code: code, Err: err})
+}
+
+// Handle recovers a panic and exits with a json error on stderr, it should be deferred first in main
+func Handle() {
+	r := recover()
+	if r == nil {
+		return
+	}
+	code, message := ExitInternal, fmt.Sprint(r)
+	switch err := r.(type) {
+	case *Error:
+		code, message = err.Code, err.Err.Error()
+	case stop:
+		code, message = ExitCanceled, err.err.Error()
+		if e, ok := err.err.(*Error); ok {
+			code, message = e.Code, e.Err.Error()
+		}
+	case error:
+		message = err.Error()
+	}
+	data, err := json.Marshal(struct {
+		Error   string `json:"error"`
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}{
+		Error:   Classes[code],
+		Code:    code,
+		Message: message,
+	})
+	if err != nil {
+		panic(err)
+	}
+	fmt.Fprintln(os.Stderr, string(data))
+	os.Exit(code)
+}
+
+// OpenModel opens a learned model for inference
+func OpenModel(path string) *bolt.DB {
+	if _, err := os.Stat(path); err != nil {
+		Fail(ExitModelNotFound, err)
+	}
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		Fail(ExitCorruptModel, fmt.Errorf("%s: %w", path, err))
+	}
+	found := false
+	db.View(func(tx *bolt.Tx) error {
+		found = tx.Bucket(ModelBucket) != nil
+		return nil
+	})
+	if !found {
+		db.Close()
+		Fail(ExitCorruptModel, fmt.Errorf("%s: bucket %s not found", path, ModelBucket))
+	}
+	if err := CheckShape(db); err != nil {
+		db.Close()
+		Fail(ExitCorruptModel, fmt.Errorf("%s: %w", path, err))
+	}
+	return db
+}
+
+// OpenData opens the training data
+func OpenData() *zim.ZimReader {
+	data, err := filepath.Abs(*FlagData)
+	if err != nil {
+		Fail(ExitData, err)
+	}
+	reader, err := zim.NewReader(data, false)
+	if err != nil {
+		Fail(ExitData, fmt.Errorf("%s: %w", data, err))
+	}
+	return reader
+}
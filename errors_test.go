@@ -0,0 +1,31 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestOpenModel(t *testing.T) {
+	expect := func(code int, path string) {
+		defer func() {
+			err, ok := recover().(*Error)
+			if !ok || err.Code != code {
+				t.Fatal("expected exit code", code, err)
+			}
+		}()
+		OpenModel(path)
+	}
+	dir := t.TempDir()
+	expect(ExitModelNotFound, dir+"/missing.bolt")
+	db, err := bolt.Open(dir+"/empty.bolt", 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	expect(ExitCorruptModel, dir+"/empty.bolt")
+}
@@ -0,0 +1,129 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/pointlander/lit/matrix"
+)
+
+// Metrics are the generation quality metrics of a model
+type Metrics struct {
+	BitsPerByte float64
+	Accuracy    float64
+	Count       int
+}
+
+// InputScorer computes the entropy of an input, lower is better
+type InputScorer func(input []byte) float64
+
+// Evaluate computes the bits per byte and next byte accuracy of a scorer over a text.
+// The entropies of the candidate next bytes are turned into a distribution with a softmax.
+func Evaluate(score InputScorer, text []byte, context int) Metrics {
+	metrics := Metrics{}
+	padded := append(Padding(Order-2), text...)
+	entropies := make([]float64, 256)
+	bits, correct := 0.0, 0
+	for i := Order - 2; i < len(padded); i++ {
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+		prefix := padded[start:i]
+		best := 0
+		for j := range entropies {
+			n := make([]byte, len(prefix), len(prefix)+1)
+			copy(n, prefix)
+			n = append(n, byte(j))
+			entropies[j] = -score(n)
+			if entropies[j] > entropies[best] {
+				best = j
+			}
+		}
+		matrix.SoftmaxValues(entropies)
+		p := entropies[padded[i]]
+		if p < 1e-300 {
+			p = 1e-300
+		}
+		bits -= math.Log2(p)
+		if best == int(padded[i]) {
+			correct++
+		}
+		metrics.Count++
+	}
+	if metrics.Count > 0 {
+		metrics.BitsPerByte = bits / float64(metrics.Count)
+		metrics.Accuracy = float64(correct) / float64(metrics.Count)
+	}
+	return metrics
+}
+
+// EvaluateFile evaluates a scorer over the lines of a file
+func EvaluateFile(score InputScorer, file string) Metrics {
+	in, err := os.Open(file)
+	if err != nil {
+		Fail(ExitData, err)
+	}
+	defer in.Close()
+
+	total := Metrics{}
+	bits, correct := 0.0, 0.0
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		metrics := Evaluate(score, line, *FlagEvalContext)
+		bits += metrics.BitsPerByte * float64(metrics.Count)
+		correct += metrics.Accuracy * float64(metrics.Count)
+		total.Count += metrics.Count
+	}
+	if err := scanner.Err(); err != nil {
+		panic(err)
+	}
+	if total.Count > 0 {
+		total.BitsPerByte = bits / float64(total.Count)
+		total.Accuracy = correct / float64(total.Count)
+	}
+	return total
+}
+
+// RealScorer scores inputs with the real model
+func RealScorer(db *bolt.DB) InputScorer {
+	return func(input []byte) float64 {
+		return SelfEntropy(db, input, nil)[0]
+	}
+}
+
+// ComplexScorer scores inputs with the complex model
+func ComplexScorer(db *bolt.DB) InputScorer {
+	return func(input []byte) float64 {
+		return ComplexSelfEntropy(db, input)[0]
+	}
+}
+
+func eval() {
+	db := OpenModel(*FlagModel)
+	defer db.Close()
+
+	metrics := EvaluateFile(RealScorer(db), *FlagEval)
+	fmt.Printf("real    bits/byte %f accuracy %f bytes %d\n", metrics.BitsPerByte, metrics.Accuracy, metrics.Count)
+	if !*FlagComplex {
+		return
+	}
+
+	complexDB := OpenModel(*FlagComplexModel)
+	defer complexDB.Close()
+
+	metrics = EvaluateFile(ComplexScorer(complexDB), *FlagEval)
+	fmt.Printf("complex bits/byte %f accuracy %f bytes %d\n", metrics.BitsPerByte, metrics.Accuracy, metrics.Count)
+}
@@ -0,0 +1,24 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestEvaluate(t *testing.T) {
+	db := NewTestModel(t)
+	metrics := Evaluate(RealScorer(db), []byte("it was the age"), 16)
+	if metrics.Count != 14 {
+		t.Fatal("every byte should be evaluated", metrics.Count)
+	}
+	if metrics.Accuracy < 0 || metrics.Accuracy > 1 {
+		t.Fatal("invalid accuracy", metrics.Accuracy)
+	}
+	if math.IsNaN(metrics.BitsPerByte) || metrics.BitsPerByte <= 0 {
+		t.Fatal("invalid bits per byte", metrics.BitsPerByte)
+	}
+}
@@ -0,0 +1,182 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/pointlander/lit/matrix"
+)
+
+// Window is the inspection of a context window
+type Window struct {
+	Context []byte
+	Order   int
+	Entropy float64
+}
+
+// Inspect computes the backoff order and entropy of each context window of the input
+func Inspect(db *bolt.DB, input []byte) []Window {
+	if len(input) < Order {
+		return nil
+	}
+	weights, importance, orders := ContextVectors(db, input)
+	entropies := matrix.DirectSelfEntropyKernel(weights, weights, weights, importance)
+	windows := make([]Window, 0, len(orders))
+	for i, order := range orders {
+		windows = append(windows, Window{
+			Context: input[i : i+Order],
+			Order:   order,
+			Entropy: -entropies[i],
+		})
+	}
+	return windows
+}
+
+// Prediction is a predicted next byte
+type Prediction struct {
+	Symbol  byte
+	Entropy float64
+}
+
+// Predict finds the k next bytes with the lowest self entropy
+func Predict(db *bolt.DB, input []byte, k int) []Prediction {
+	if len(input)+1 < Order {
+		input = append(Padding(Order-1-len(input)), input...)
+	}
+	predictions := make([]Prediction, 256)
+	for i := range predictions {
+		n := make([]byte, len(input), len(input)+1)
+		copy(n, input)
+		n = append(n, byte(i))
+		predictions[i].Symbol = byte(i)
+		predictions[i].Entropy = SelfEntropy(db, n, nil)[0]
+	}
+	sort.SliceStable(predictions, func(i, j int) bool {
+		return predictions[i].Entropy < predictions[j].Entropy
+	})
+	if k < len(predictions) {
+		predictions = predictions[:k]
+	}
+	return predictions
+}
+
+// Report describes the context windows of the buffer and its most likely next bytes, one line per item
+func Report(db *bolt.DB, buffer []byte) []string {
+	const Top = 5
+	report := []string{fmt.Sprintf("buffer %q", buffer)}
+	for _, window := range Inspect(db, buffer) {
+		report = append(report, fmt.Sprintf("%-14q order %d entropy %f", window.Context, window.Order, window.Entropy))
+	}
+	predictions := make([]string, 0, Top)
+	for _, prediction := range Predict(db, buffer, Top) {
+		predictions = append(predictions, fmt.Sprintf("%q %f", prediction.Symbol, prediction.Entropy))
+	}
+	return append(report, "next "+strings.Join(predictions, ", "))
+}
+
+// Explore is an interactive explorer of the model, each line of input is appended to the buffer.
+// An empty line clears the buffer.
+func Explore(db *bolt.DB, in io.Reader, out io.Writer) {
+	buffer, scanner := []byte{}, bufio.NewScanner(in)
+	fmt.Fprint(out, "> ")
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			buffer = buffer[:0]
+			fmt.Fprint(out, "cleared\n> ")
+			continue
+		}
+		if len(buffer) > 0 {
+			buffer = append(buffer, ' ')
+		}
+		buffer = append(buffer, line...)
+		fmt.Fprintf(out, "%s\n> ", strings.Join(Report(db, buffer), "\n"))
+	}
+	fmt.Fprintln(out)
+}
+
+// Keys of the live explorer
+const (
+	KeyInterrupt = 0x03
+	KeyEOF       = 0x04
+	KeyBackspace = 0x08
+	KeyTab       = 0x09
+	KeyKill      = 0x15
+	KeyEscape    = 0x1b
+	KeyDelete    = 0x7f
+)
+
+// ExploreLive is an interactive explorer of the model for a raw mode terminal, the report of the buffer is redrawn
+// on every key. Backspace deletes a byte, tab appends the most likely next byte, ctrl-u clears the buffer and
+// ctrl-c or ctrl-d quits. Escape sequences, such as the arrow keys, are ignored.
+func ExploreLive(db *bolt.DB, in io.Reader, out io.Writer) {
+	buffer, reader := []byte{}, bufio.NewReader(in)
+	draw := func() {
+		// the raw terminal doesn't return the carriage on a new line
+		fmt.Fprint(out, "\x1b[H\x1b[2J")
+		fmt.Fprint(out, strings.Join(Report(db, buffer), "\r\n"))
+		fmt.Fprintf(out, "\r\n> %s", buffer)
+	}
+	draw()
+	for {
+		key, err := reader.ReadByte()
+		if err != nil || key == KeyInterrupt || key == KeyEOF {
+			break
+		}
+		switch key {
+		case KeyBackspace, KeyDelete:
+			if len(buffer) > 0 {
+				buffer = buffer[:len(buffer)-1]
+			}
+		case KeyTab:
+			if predictions := Predict(db, buffer, 1); len(predictions) > 0 {
+				buffer = append(buffer, predictions[0].Symbol)
+			}
+		case KeyKill:
+			buffer = buffer[:0]
+		case KeyEscape:
+			// a control sequence ends with a byte from @ to ~
+			if next, err := reader.ReadByte(); err == nil && next == '[' {
+				for {
+					final, err := reader.ReadByte()
+					if err != nil || (final >= '@' && final <= '~') {
+						break
+					}
+				}
+			}
+			continue
+		case '\r':
+			buffer = append(buffer, '\n')
+		default:
+			if key < ' ' {
+				continue
+			}
+			buffer = append(buffer, key)
+		}
+		draw()
+	}
+	fmt.Fprint(out, "\r\n")
+}
+
+func explore() {
+	db := OpenModel(*FlagModel)
+	defer db.Close()
+	restore, err := RawTerminal(int(os.Stdin.Fd()))
+	if err != nil {
+		// the input isn't a terminal, so it is explored line by line
+		Explore(db, os.Stdin, os.Stdout)
+		return
+	}
+	defer restore()
+	ExploreLive(db, os.Stdin, os.Stdout)
+}
@@ -0,0 +1,43 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestExplore(t *testing.T) {
+	db := NewTestModel(t)
+	windows := Inspect(db, []byte("it was the age"))
+	if len(windows) != 14-Order+1 {
+		t.Fatal("unexpected number of windows", len(windows))
+	}
+	predictions := Predict(db, []byte("it was"), 3)
+	if len(predictions) != 3 || predictions[0].Entropy > predictions[2].Entropy {
+		t.Fatal("invalid predictions", predictions)
+	}
+	out := bytes.Buffer{}
+	Explore(db, strings.NewReader("it was the\n\n"), &out)
+	if !strings.Contains(out.String(), "next ") || !strings.Contains(out.String(), "cleared") {
+		t.Fatal("unexpected output", out.String())
+	}
+
+	out.Reset()
+	ExploreLive(db, strings.NewReader("it wz\x7fas\x1b[Dthe\x15it was\t\x04"), &out)
+	frames := strings.Split(out.String(), "\x1b[H\x1b[2J")
+	if len(frames) != 21 {
+		t.Fatal("every key but the escape sequence should redraw", len(frames))
+	}
+	if !strings.Contains(frames[9], `buffer "it was"`) || !strings.Contains(frames[12], `buffer "it wasthe"`) ||
+		!strings.Contains(frames[13], `buffer ""`) {
+		t.Fatal("unexpected frames", frames[9], frames[12], frames[13])
+	}
+	last := frames[len(frames)-1]
+	if !strings.Contains(last, "next ") || !strings.Contains(last, `buffer "it was`+string(predictions[0].Symbol)+`"`) {
+		t.Fatal("tab should append the most likely next byte", last)
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"unicode"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Span is a span of a passage
+type Span struct {
+	Start, End int
+	Mutual     float64
+}
+
+// Spans finds the candidate spans of a passage which start and end on word boundaries
+func Spans(passage []byte, min, max int) []Span {
+	starts, ends := make([]int, 0, 8), make([]int, 0, 8)
+	for i := range passage {
+		space := unicode.IsSpace(rune(passage[i]))
+		if !space && (i == 0 || unicode.IsSpace(rune(passage[i-1]))) {
+			starts = append(starts, i)
+		}
+		if !space && (i == len(passage)-1 || unicode.IsSpace(rune(passage[i+1]))) {
+			ends = append(ends, i+1)
+		}
+	}
+	spans := make([]Span, 0, 8)
+	for _, start := range starts {
+		for _, end := range ends {
+			if end-start < min {
+				continue
+			}
+			if end-start > max {
+				break
+			}
+			spans = append(spans, Span{Start: start, End: end})
+		}
+	}
+	return spans
+}
+
+// Extract finds the span of the passage with the highest mutual self entropy with the question.
+// The mutual self entropy is H(question) + H(span) - H(question span).
+func Extract(db *bolt.DB, passage, question []byte, max int) Span {
+	entropy := func(input []byte) float64 {
+		return SelfEntropy(db, input, nil)[0]
+	}
+	h := entropy(question)
+	best := Span{Start: -1}
+	for _, span := range Spans(passage, Order, max) {
+		candidate := passage[span.Start:span.End]
+		joint := make([]byte, 0, len(question)+1+len(candidate))
+		joint = append(joint, question...)
+		joint = append(joint, ' ')
+		joint = append(joint, candidate...)
+		span.Mutual = h + entropy(candidate) - entropy(joint)
+		if best.Start < 0 || span.Mutual > best.Mutual {
+			best = span
+		}
+	}
+	return best
+}
+
+func extract() {
+	db := OpenModel(*FlagModel)
+	defer db.Close()
+
+	passage, err := ioutil.ReadFile(*FlagContext)
+	if err != nil {
+		Fail(ExitData, err)
+	}
+	question := []byte(*FlagQuestion)
+	if len(question) < Order {
+		Fail(ExitFlags, fmt.Errorf("question should be at least %d bytes", Order))
+	}
+	span := Extract(db, passage, question, *FlagMaxSpan)
+	if span.Start < 0 {
+		fmt.Println("no span found")
+		return
+	}
+	fmt.Println(span.Mutual, string(passage[span.Start:span.End]))
+}
@@ -0,0 +1,22 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+)
+
+func TestExtract(t *testing.T) {
+	spans := Spans([]byte("the age of wisdom"), 1, 10)
+	if len(spans) != 8 {
+		t.Fatal("unexpected number of spans", len(spans), spans)
+	}
+	db := NewTestModel(t)
+	passage := []byte("it was the age of wisdom, we had everything before us")
+	span := Extract(db, passage, []byte("what did we have before us?"), 24)
+	if span.Start < 0 || span.End-span.Start > 24 || span.End-span.Start < Order {
+		t.Fatal("invalid span", span)
+	}
+}
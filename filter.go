@@ -0,0 +1,173 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"regexp"
+	"strings"
+	"sync/atomic"
+)
+
+// Filter is a filter for generated output
+type Filter struct {
+	Patterns []*regexp.Regexp
+}
+
+// OutputFilter is the filter applied to generated output
+var OutputFilter *Filter
+
+// NewFilter loads a filter from a file with one word or regular expression per line.
+// Lines starting with re: are regular expressions, lines starting with # are comments,
+// and other lines are case insensitive words.
+func NewFilter(file string) *Filter {
+	in, err := os.Open(file)
+	if err != nil {
+		Fail(ExitData, err)
+	}
+	defer in.Close()
+
+	filter := &Filter{}
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var pattern *regexp.Regexp
+		if strings.HasPrefix(line, "re:") {
+			pattern, err = regexp.Compile(strings.TrimPrefix(line, "re:"))
+			if err != nil {
+				Fail(ExitData, fmt.Errorf("%s: %w", file, err))
+			}
+		} else {
+			pattern = regexp.MustCompile(`(?i)\b` + regexp.QuoteMeta(line) + `\b`)
+		}
+		filter.Patterns = append(filter.Patterns, pattern)
+	}
+	if err := scanner.Err(); err != nil {
+		panic(err)
+	}
+	return filter
+}
+
+// Match returns true if the data matches the filter
+func (f *Filter) Match(data []byte) bool {
+	if f == nil {
+		return false
+	}
+	for _, pattern := range f.Patterns {
+		if pattern.Match(data) {
+			return true
+		}
+	}
+	return false
+}
+
+// Redact replaces the matches of the filter with asterisks
+func (f *Filter) Redact(data []byte) []byte {
+	if f == nil {
+		return data
+	}
+	for _, pattern := range f.Patterns {
+		data = pattern.ReplaceAllFunc(data, func(match []byte) []byte {
+			return bytes.Repeat([]byte("*"), len(match))
+		})
+	}
+	return data
+}
+
+// Repetition counts the earlier occurrences of the trailing n-gram of the output within the window
+func Repetition(output []byte, n, window int) int {
+	if n <= 0 || len(output) <= n {
+		return 0
+	}
+	history, gram := output[:len(output)-1], output[len(output)-n:]
+	if window > 0 && len(history) > window {
+		history = history[len(history)-window:]
+	}
+	return bytes.Count(history, gram)
+}
+
+// Penalize makes the pathes whose trailing n-gram repeats worse by -repetition for each repetition
+func Penalize(pathes []Result, less bool) {
+	if *FlagRepetition <= 0 {
+		return
+	}
+	for i := range pathes {
+		penalty := *FlagRepetition * float64(Repetition(pathes[i].Output, *FlagRepetitionNGram, *FlagRepetitionWindow))
+		if less {
+			pathes[i].Entropy += penalty
+		} else {
+			pathes[i].Entropy -= penalty
+		}
+	}
+}
+
+// Exclude moves the filtered pathes to the end of the search when -refilter is set
+// and the pathes that leave the vocabulary, schema or alphabet when -vocab, -schema or -alphabet-from-input are set.
+// The outputs start with the padded prompt of the given length. The filter, the vocabulary and the schema only see
+// the generated continuation, so a prompt that matches the filter or has words outside of the vocabulary doesn't
+// exclude every path.
+// Every search calls it with its candidates, so it also counts the expansions and penalizes the repetitions.
+func Exclude(pathes []Result, less bool, prompt int) {
+	atomic.AddUint64(&Expansions, uint64(len(pathes)))
+	Penalize(pathes, less)
+	refilter := OutputFilter != nil && *FlagRefilter
+	if !refilter && Vocabulary == nil && OutputSchema == nil && InputAlphabet == nil {
+		return
+	}
+	for i := range pathes {
+		output, generated := pathes[i].Output, []byte(nil)
+		if prompt < len(output) {
+			generated = output[prompt:]
+		}
+		if (refilter && OutputFilter.Match(generated)) || !Vocabulary.Allowed(generated) || !OutputSchema.Allowed(generated) ||
+			!InputAlphabet.Allowed(output) {
+			if less {
+				pathes[i].Entropy = math.MaxFloat64
+			} else {
+				pathes[i].Entropy = -math.MaxFloat64
+			}
+		}
+	}
+}
+
+// Output is where generated output is written
+var Output io.Writer = os.Stdout
+
+// Emit prints a search result with the output filter and the -post-cmd command applied, with -json it is printed as a record.
+// The result is also passed to Step, and the generation is stopped if Step returns an error or Context is done.
+func Emit(result Result) {
+	Check()
+	Emitted = result.Output
+	if GenerationProfile != nil {
+		GenerationProfile.Emitted()
+	}
+	output, ok := PostProcess.Apply(OutputFilter.Redact(result.Output))
+	if !ok {
+		return
+	}
+	if Step != nil {
+		if err := Step(Result{Entropy: result.Entropy, Output: append([]byte(nil), output...)}); err != nil {
+			panic(stop{err: err})
+		}
+	}
+	if *FlagJSON {
+		EmitRecord(Record{
+			Entropy: result.Entropy,
+			Text:    string(output),
+			Bytes:   output,
+		})
+		return
+	}
+	fmt.Fprintln(Output, result.Entropy, string(output))
+	fmt.Fprintln(Output)
+}
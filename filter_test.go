@@ -0,0 +1,81 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFilter(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "filter.txt")
+	err := os.WriteFile(file, []byte("# comment\nDarn\nre:[0-9]{3}-[0-9]{4}\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filter := NewFilter(file)
+	if len(filter.Patterns) != 2 {
+		t.Fatal("there should be 2 patterns", len(filter.Patterns))
+	}
+	if !filter.Match([]byte("oh darn it")) {
+		t.Fatal("word should match")
+	}
+	if filter.Match([]byte("darning")) {
+		t.Fatal("partial word shouldn't match")
+	}
+	if output := string(filter.Redact([]byte("call 555-1234 darn"))); output != "call ******** ****" {
+		t.Fatal("unexpected redaction", output)
+	}
+	var none *Filter
+	if none.Match([]byte("darn")) || string(none.Redact([]byte("darn"))) != "darn" {
+		t.Fatal("nil filter should pass everything")
+	}
+}
+
+func TestRefilter(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "filter.txt")
+	if err := os.WriteFile(file, []byte("worst\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	defer func(filter *Filter, refilter bool) {
+		OutputFilter, *FlagRefilter = filter, refilter
+	}(OutputFilter, *FlagRefilter)
+	OutputFilter, *FlagRefilter = NewFilter(file), true
+	prompt := Pad([]byte("it was the worst"))
+	pathes := []Result{{Output: append(append([]byte(nil), prompt...), " of"...)}, {Output: append(append([]byte(nil), prompt...), " worst"...)}}
+	Exclude(pathes, true, len(prompt))
+	if pathes[0].Entropy == math.MaxFloat64 || pathes[1].Entropy != math.MaxFloat64 {
+		t.Fatal("only the pathes whose continuation matches the filter should be excluded", pathes)
+	}
+}
+
+func TestRepetition(t *testing.T) {
+	if count := Repetition([]byte("the cat the cat the"), 3, 0); count != 2 {
+		t.Fatal("the trailing n-gram repeats twice", count)
+	}
+	if count := Repetition([]byte("the cat the cat the"), 3, 10); count != 1 {
+		t.Fatal("the window should only see one repetition", count)
+	}
+	if count := Repetition([]byte("the cat sat"), 4, 0); count != 0 {
+		t.Fatal("there are no repetitions", count)
+	}
+
+	penalty, ngram := *FlagRepetition, *FlagRepetitionNGram
+	defer func() {
+		*FlagRepetition, *FlagRepetitionNGram = penalty, ngram
+	}()
+	*FlagRepetition, *FlagRepetitionNGram = 1.5, 3
+	pathes := []Result{{Entropy: 1, Output: []byte("the cat the")}, {Entropy: 1, Output: []byte("the cat sat")}}
+	Penalize(pathes, true)
+	if pathes[0].Entropy != 2.5 || pathes[1].Entropy != 1 {
+		t.Fatal("the repeating path should have a higher entropy", pathes)
+	}
+	Penalize(pathes, false)
+	if pathes[0].Entropy != 1 {
+		t.Fatal("the repeating path should have a lower score", pathes)
+	}
+}
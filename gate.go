@@ -0,0 +1,60 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// ErrQualityRegressed is returned by a quality gate for a model that is worse than its source
+var ErrQualityRegressed = errors.New("the model quality regressed")
+
+// QualityGate checks the models written by the commands that transform a model with the bits per byte
+// of held out text, a model worse than its source by more than the threshold isn't written
+type QualityGate struct {
+	// Text is the held out text
+	Text []byte
+	// Threshold is the tolerated relative increase of the bits per byte
+	Threshold float64
+}
+
+// ModelGate is the quality gate of -gate, nil if the transformed models aren't checked
+var ModelGate *QualityGate
+
+// NewQualityGate creates a quality gate with the held out text of a file
+func NewQualityGate(path string, threshold float64) (*QualityGate, error) {
+	if threshold < 0 {
+		return nil, errors.New("the quality threshold can't be negative")
+	}
+	text, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(text) == 0 {
+		return nil, fmt.Errorf("%s: the held out text is empty", path)
+	}
+	return &QualityGate{Text: text, Threshold: threshold}, nil
+}
+
+// Check computes the hard backoff bits per byte of the held out text with the output model and the best of
+// the source models, ErrQualityRegressed is returned if the output is worse by more than the threshold
+func (g *QualityGate) Check(output *bolt.DB, sources ...*bolt.DB) (before, after float64, err error) {
+	before = math.Inf(1)
+	for _, source := range sources {
+		if bits := MixtureBits(source, g.Text, nil); bits < before {
+			before = bits
+		}
+	}
+	after = MixtureBits(output, g.Text, nil)
+	if after > before*(1+g.Threshold) {
+		return before, after, fmt.Errorf("%w: %f bits/byte on the held out text, %f before", ErrQualityRegressed, after, before)
+	}
+	return before, after, nil
+}
@@ -0,0 +1,47 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestQualityGate(t *testing.T) {
+	dir := t.TempDir()
+	held := filepath.Join(dir, "held.txt")
+	if err := os.WriteFile(held, []byte("it was the age of wisdom, it was the season of Light"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewQualityGate(held, -1); err == nil {
+		t.Fatal("a negative threshold should be invalid")
+	}
+	gate, err := NewQualityGate(held, .01)
+	if err != nil {
+		t.Fatal(err)
+	}
+	good := NewTestModel(t)
+	bad, err := bolt.Open(filepath.Join(dir, "bad.bolt"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bad.Close()
+	s := NewLRU(1024)
+	s.Learn([]byte(strings.Repeat("zq xv jk ", 64)))
+	s.Close()
+	WriteModel(bad, ModelBucket, &s)
+
+	if before, after, err := gate.Check(bad, good); !errors.Is(err, ErrQualityRegressed) || after <= before {
+		t.Fatal("a worse model should fail the gate", before, after, err)
+	}
+	if before, after, err := gate.Check(good, bad, good); err != nil || after != before {
+		t.Fatal("the model should be compared with the best source", before, after, err)
+	}
+}
@@ -6,7 +6,13 @@ require (
 	github.com/akhenakh/gozim v0.0.0-20211220135114-45d8f5cbe57c
 	github.com/k3a/html2text v1.1.0
 	github.com/pointlander/compress v1.1.1-0.20230129195249-46dfb34ef5b9
+	github.com/pointlander/gradient v0.0.0-20230114050126-69977707af34
+	github.com/pointlander/pagerank v0.0.0-20210619221740-830548a59275
+	github.com/ziutek/blas v0.0.0-20190227122918-da4ca23e90bb
 	go.etcd.io/bbolt v1.3.6
+	golang.org/x/sys v0.7.0
+	gonum.org/v1/plot v0.13.0
+	google.golang.org/grpc v1.56.3
 )
 
 require (
@@ -20,17 +26,14 @@ require (
 	github.com/go-latex/latex v0.0.0-20230307184459-12ec69307ad9 // indirect
 	github.com/go-pdf/fpdf v0.8.0 // indirect
 	github.com/golang/freetype v0.0.0-20170609003504-e2365dfdc4a0 // indirect
-	github.com/golang/protobuf v1.4.2 // indirect
+	github.com/golang/protobuf v1.5.3 // indirect
 	github.com/hashicorp/golang-lru v0.5.4 // indirect
 	github.com/klauspost/compress v1.13.6 // indirect
-	github.com/pointlander/gradient v0.0.0-20230114050126-69977707af34 // indirect
-	github.com/pointlander/pagerank v0.0.0-20210619221740-830548a59275 // indirect
 	github.com/remyoudompheng/go-liblzma v0.0.0-20190506200333-81bf2d431b96 // indirect
 	github.com/ulikunitz/xz v0.5.10 // indirect
-	github.com/ziutek/blas v0.0.0-20190227122918-da4ca23e90bb // indirect
 	golang.org/x/image v0.7.0 // indirect
-	golang.org/x/sys v0.7.0 // indirect
+	golang.org/x/net v0.9.0 // indirect
 	golang.org/x/text v0.9.0 // indirect
-	gonum.org/v1/plot v0.13.0 // indirect
-	google.golang.org/protobuf v1.24.0 // indirect
+	google.golang.org/genproto v0.0.0-20230410155749-daa745c078e1 // indirect
+	google.golang.org/protobuf v1.30.0 // indirect
 )
@@ -0,0 +1,118 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// GoldenCorpus is the tiny training corpus of the golden model, the tests and the benchmarks
+const GoldenCorpus = `It was the best of times, it was the worst of times, it was the age of wisdom,
+it was the age of foolishness, it was the epoch of belief, it was the epoch of incredulity,
+it was the season of Light, it was the season of Darkness, it was the spring of hope,
+it was the winter of despair, we had everything before us, we had nothing before us,
+we were all going direct to Heaven, we were all going direct the other way.`
+
+const (
+	// GoldenPrompt is the prompt of the golden transcripts
+	GoldenPrompt = "it was the"
+	// GoldenSteps is the number of generation steps of the golden transcripts
+	GoldenSteps = 2
+)
+
+// Mode is a named decoding mode
+type Mode struct {
+	Name     string
+	Generate func()
+}
+
+// GoldenModes are the decoding modes that have golden transcripts
+var GoldenModes = []Mode{
+	{"markov", markov},
+	{"attention", markovSelfEntropy},
+	{"mutual", markovMutualSelfEntropy},
+	{"meta", markovDirectSelfEntropy},
+	{"diffusion", markovSelfEntropyDiffusion},
+}
+
+// GoldenFile is the transcript file of a mode
+func GoldenFile(dir string, mode Mode) string {
+	return filepath.Join(dir, mode.Name+".txt")
+}
+
+// Transcript runs a mode deterministically with the golden prompt against a model file
+func Transcript(model string, mode Mode) []byte {
+	flags := []*string{FlagModel, FlagInput}
+	values := []string{*FlagModel, *FlagInput}
+	steps, deterministic, output := *FlagSteps, *FlagDeterministic, Output
+	defer func() {
+		for i, flag := range flags {
+			*flag = values[i]
+		}
+		*FlagSteps, *FlagDeterministic, Output = steps, deterministic, output
+	}()
+	*FlagModel, *FlagInput = model, GoldenPrompt
+	*FlagSteps, *FlagDeterministic = GoldenSteps, true
+	buffer := bytes.Buffer{}
+	Output = &buffer
+	mode.Generate()
+	return buffer.Bytes()
+}
+
+// OpenGoldenModel learns the golden model from the golden corpus and writes it to a file
+func OpenGoldenModel(path string) (*bolt.DB, error) {
+	s := NewLRU(1024)
+	s.Learn([]byte(GoldenCorpus))
+	s.Close()
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		return nil, err
+	}
+	WriteModel(db, []byte("markov"), &s)
+	return db, nil
+}
+
+// GoldenModel writes the tiny corpus model to a directory and returns its path
+func GoldenModel(dir string) (string, error) {
+	path := filepath.Join(dir, "golden.bolt")
+	db, err := OpenGoldenModel(path)
+	if err != nil {
+		return "", err
+	}
+	return path, db.Close()
+}
+
+func golden() {
+	dir, err := os.MkdirTemp("", "golden")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+	model, err := GoldenModel(dir)
+	if err != nil {
+		panic(err)
+	}
+	if err := os.MkdirAll(*FlagGolden, 0755); err != nil {
+		panic(err)
+	}
+	for _, mode := range GoldenModes {
+		transcript := Transcript(model, mode)
+		file := GoldenFile(*FlagGolden, mode)
+		if previous, err := os.ReadFile(file); err == nil {
+			if divergence := Divergence(previous, transcript); divergence >= 0 {
+				fmt.Printf("%s changed at byte %d\n", mode.Name, divergence)
+			}
+		}
+		if err := os.WriteFile(file, transcript, 0644); err != nil {
+			panic(err)
+		}
+		fmt.Printf("wrote %s\n", file)
+	}
+}
@@ -0,0 +1,28 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGolden(t *testing.T) {
+	model, err := GoldenModel(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mode := range GoldenModes {
+		expected, err := os.ReadFile(GoldenFile(filepath.Join("testdata", "golden"), mode))
+		if err != nil {
+			t.Fatal(err)
+		}
+		transcript := Transcript(model, mode)
+		if divergence := Divergence(expected, transcript); divergence >= 0 {
+			t.Errorf("%s transcript changed at byte %d, regenerate with -golden testdata/golden if intended", mode.Name, divergence)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"unicode/utf8"
+
+	"gonum.org/v1/plot/palette/moreland"
+)
+
+// Heatmap writes an html page that colors each character of the input by its self entropy, from blue for the
+// least to red for the most surprising. A multi-byte character has the mean entropy of its bytes, and the title
+// of each character shows its position, backoff order and entropy.
+func Heatmap(w io.Writer, input []byte, positions []PositionEntropy) error {
+	colors := moreland.SmoothBlueRed()
+	low, high := 0.0, 1.0
+	for i, position := range positions {
+		if i == 0 || position.Entropy < low {
+			low = position.Entropy
+		}
+		if i == 0 || position.Entropy > high {
+			high = position.Entropy
+		}
+	}
+	if high <= low {
+		high = low + 1
+	}
+	colors.SetMin(low)
+	colors.SetMax(high)
+
+	out := bufio.NewWriter(w)
+	fmt.Fprintln(out, "<!DOCTYPE html>")
+	fmt.Fprintln(out, `<html><head><meta charset="utf-8"><title>entropy heatmap</title></head><body>`)
+	fmt.Fprintf(out, "<p>entropy from %f (blue) to %f (red)</p>\n", low, high)
+	fmt.Fprint(out, `<pre style="white-space: pre-wrap; font-size: 16px">`)
+	for i := 0; i < len(input); {
+		_, size := utf8.DecodeRune(input[i:])
+		entropy := 0.0
+		for _, position := range positions[i : i+size] {
+			entropy += position.Entropy
+		}
+		entropy /= float64(size)
+		color, err := colors.At(entropy)
+		if err != nil {
+			return err
+		}
+		r, g, b, _ := color.RGBA()
+		fmt.Fprintf(out, `<span style="background-color: #%02x%02x%02x" title="position %d order %d entropy %f">%s</span>`,
+			r>>8, g>>8, b>>8, i, positions[i].Order, entropy, html.EscapeString(string(input[i:i+size])))
+		i += size
+	}
+	fmt.Fprintln(out, "</pre></body></html>")
+	return out.Flush()
+}
+
+func heatmap() {
+	db := OpenModel(*FlagModel)
+	defer db.Close()
+	RouteModel(db, []byte(*FlagInput))
+
+	input := []byte(*FlagInput)
+	if len(input) == 0 {
+		Fail(ExitFlags, fmt.Errorf("the heatmap colors the characters of a non empty -input"))
+	}
+	out, err := os.Create(*FlagHeatmap + ".html")
+	if err != nil {
+		Fail(ExitData, err)
+	}
+	defer out.Close()
+	if err := Heatmap(out, input, PositionEntropies(db, input)); err != nil {
+		Fail(ExitData, err)
+	}
+	fmt.Printf("wrote %s.html\n", *FlagHeatmap)
+}
@@ -0,0 +1,28 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestHeatmap(t *testing.T) {
+	db := NewTestModel(t)
+	input := []byte("it was <the> é")
+	out := bytes.Buffer{}
+	if err := Heatmap(&out, input, PositionEntropies(db, input)); err != nil {
+		t.Fatal(err)
+	}
+	page := out.String()
+	if strings.Count(page, "<span") != utf8.RuneCount(input) {
+		t.Fatal("each character should have a span", page)
+	}
+	if !strings.Contains(page, "&lt;") || !strings.Contains(page, ">é</span>") {
+		t.Fatal("the characters should be escaped and multi-byte characters kept whole", page)
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// HoldoutBytes is the number of bytes of the held out articles that are kept for the evaluation
+	HoldoutBytes = 1 << 20
+	// HoldoutChunk is the size of the pieces of the held out articles that the self entropy is computed on,
+	// the self entropy of a piece is quadratic in its length
+	HoldoutChunk = 256
+)
+
+// Holdout holds out a fraction of the articles from learning and evaluates the written model on them,
+// so models learned with different orders, indexes and scales can be compared on text they haven't seen.
+// An article is held out by the hash of its url, so the split is the same for every run over the same data.
+type Holdout struct {
+	// Fraction is the fraction of the articles that are held out
+	Fraction float64
+	// Articles are the held out articles kept for the evaluation
+	Articles []string
+	// Held is the number of held out articles
+	Held  int
+	bytes int
+}
+
+// LearnHoldout is the holdout of -holdout, nil learns every article
+var LearnHoldout *Holdout
+
+// NewHoldout creates a holdout of a fraction of the articles
+func NewHoldout(fraction float64) (*Holdout, error) {
+	if fraction <= 0 || fraction >= 1 {
+		return nil, errors.New("the held out fraction should be in (0, 1)")
+	}
+	return &Holdout{Fraction: fraction}, nil
+}
+
+// Hold returns true if the article is held out and shouldn't be learned, the first HoldoutBytes of the
+// held out articles are kept. A nil holdout holds out nothing.
+func (h *Holdout) Hold(url, plain string) bool {
+	if h == nil {
+		return false
+	}
+	hash := fnv.New64a()
+	hash.Write([]byte(url))
+	if float64(mix(hash.Sum64())>>11)/(1<<53) >= h.Fraction {
+		return false
+	}
+	h.Held++
+	if h.bytes < HoldoutBytes {
+		if len(plain) > HoldoutBytes-h.bytes {
+			plain = plain[:HoldoutBytes-h.bytes]
+		}
+		h.Articles = append(h.Articles, plain)
+		h.bytes += len(plain)
+	}
+	return true
+}
+
+// HoldoutScore is the evaluation of a model on the held out articles
+type HoldoutScore struct {
+	Articles int
+	Bytes    int
+	// Entropy is the average self entropy of a byte
+	Entropy float64
+	// Bits is the bits per byte with the mixture weights of the model, or hard backoff without them
+	Bits       float64
+	Perplexity float64
+}
+
+// Evaluate computes the average self entropy, the bits per byte and the perplexity of the held out articles
+func (h *Holdout) Evaluate(db *bolt.DB) HoldoutScore {
+	score := HoldoutScore{Articles: h.Held}
+	weights := LoadMixture(db)
+	entropy, contexts, bits, predicted := 0.0, 0, 0.0, 0
+	for _, article := range h.Articles {
+		Check()
+		text := []byte(article)
+		score.Bytes += len(text)
+		for start := 0; start < len(text); start += HoldoutChunk {
+			end := start + HoldoutChunk
+			if end > len(text) {
+				end = len(text)
+			}
+			for _, e := range Entropies(db, text[start:end]) {
+				entropy += e
+				contexts++
+			}
+		}
+		if n := len(text) - 1; n > 0 {
+			bits += MixtureBits(db, text, weights) * float64(n)
+			predicted += n
+		}
+	}
+	if contexts > 0 {
+		score.Entropy = entropy / float64(contexts)
+	}
+	if predicted > 0 {
+		score.Bits = bits / float64(predicted)
+		score.Perplexity = math.Pow(2, score.Bits)
+	}
+	return score
+}
+
+// Report evaluates the written model on the held out articles, prints the scores and writes them to the
+// metadata of the model. A nil holdout does nothing.
+func (h *Holdout) Report(db *bolt.DB) {
+	if h == nil {
+		return
+	}
+	if len(h.Articles) == 0 {
+		fmt.Println("no articles were held out")
+		return
+	}
+	score := h.Evaluate(db)
+	fmt.Printf("held out %d articles, evaluated %d bytes\n", score.Articles, score.Bytes)
+	fmt.Printf("self entropy %f per byte, %f bits per byte, perplexity %f\n", score.Entropy, score.Bits, score.Perplexity)
+	WriteMetadata(db, "holdout", score)
+}
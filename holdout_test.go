@@ -0,0 +1,45 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestHoldout(t *testing.T) {
+	if _, err := NewHoldout(1); err == nil {
+		t.Fatal("holding out every article should be an error")
+	}
+	holdout, err := NewHoldout(.25)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 1000; i++ {
+		url := fmt.Sprintf("A/%d.html", i)
+		if held := holdout.Hold(url, Corpus); held != (&Holdout{Fraction: .25}).Hold(url, Corpus) {
+			t.Fatal("the split should be the same for every run", url)
+		}
+	}
+	if holdout.Held < 150 || holdout.Held > 350 {
+		t.Fatal("about a quarter of the articles should be held out", holdout.Held)
+	}
+	var none *Holdout
+	if none.Hold("A/0.html", Corpus) {
+		t.Fatal("without -holdout nothing is held out")
+	}
+
+	db := NewTestModel(t)
+	seen := &Holdout{Articles: []string{Corpus}, Held: 1}
+	unseen := &Holdout{Articles: []string{"zq xj vk wp qz jx kv pw zq xj vk wp"}, Held: 1}
+	a, b := seen.Evaluate(db), unseen.Evaluate(db)
+	if a.Bytes != len(Corpus) || a.Bits <= 0 || math.Abs(a.Perplexity-math.Pow(2, a.Bits)) > 1e-9 {
+		t.Fatal("invalid score", a)
+	}
+	if a.Bits >= b.Bits {
+		t.Fatal("learned text should have fewer bits per byte than unseen text", a.Bits, b.Bits)
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"time"
+)
+
+// Progress is the progress of learning from the training data
+type Progress struct {
+	// Articles is the number of articles learned
+	Articles int
+	// Total is the number of articles that will be learned, 0 if it isn't known
+	Total int
+	// Bytes is the number of bytes of plain text learned
+	Bytes uint64
+	// Skipped is the number of articles that weren't learned
+	Skipped int
+	// Entries is the number of entries of the model
+	Entries int
+	// Memory is the allocated memory in megabytes
+	Memory uint64
+	// URL is the url of the last article
+	URL string
+	// Elapsed is the time since the learning started
+	Elapsed time.Duration
+	// ETA is the estimated time until the learning is done, 0 if the total isn't known
+	ETA time.Duration
+}
+
+// OnProgress is called with the progress of the learning after each article, it prints the progress by default
+var OnProgress = PrintProgress
+
+// PrintProgress prints the progress as a line
+func PrintProgress(p Progress) {
+	eta := "-"
+	if p.Total > 0 {
+		eta = p.ETA.Round(time.Second).String()
+	}
+	fmt.Printf("%5d %5d %20d %8s %s\n", p.Articles, p.Memory, p.Entries, eta, p.URL)
+}
+
+// Ingestion tracks the progress of learning from the training data
+type Ingestion struct {
+	Progress Progress
+	Start    time.Time
+	// Callback is called with the progress after each article, nothing is called if it is nil
+	Callback func(Progress)
+}
+
+// NewIngestion starts tracking the progress of learning a total number of articles, 0 if it isn't known.
+// The progress is reported to OnProgress.
+func NewIngestion(total int) *Ingestion {
+	return &Ingestion{
+		Progress: Progress{Total: total},
+		Start:    time.Now(),
+		Callback: OnProgress,
+	}
+}
+
+// Learned records a learned article with its plain text size and the number of entries of the model after it
+func (i *Ingestion) Learned(url string, size, entries int) {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	p := &i.Progress
+	p.Articles++
+	p.Bytes += uint64(size)
+	p.Entries, p.Memory, p.URL = entries, m.Alloc/(1024*1024), url
+	p.Elapsed = time.Since(i.Start)
+	p.ETA = 0
+	if p.Total > p.Articles {
+		p.ETA = p.Elapsed / time.Duration(p.Articles) * time.Duration(p.Total-p.Articles)
+	}
+	if i.Callback != nil {
+		i.Callback(*p)
+	}
+}
+
+// Skip records an article that wasn't learned, it is reported on stderr
+func (i *Ingestion) Skip(url string, err error) {
+	i.Progress.Skipped++
+	fmt.Fprintf(os.Stderr, "skipped %s: %v\n", url, err)
+}
@@ -0,0 +1,43 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIngestion(t *testing.T) {
+	ingestion, reports := NewIngestion(4), make([]Progress, 0, 2)
+	ingestion.Callback = func(p Progress) {
+		reports = append(reports, p)
+	}
+	ingestion.Start = time.Now().Add(-time.Second)
+	ingestion.Learned("a.html", 10, 5)
+	ingestion.Learned("b.html", 20, 8)
+	if len(reports) != 2 {
+		t.Fatal("there should be a report for each article", len(reports))
+	}
+	last := reports[1]
+	if last.Articles != 2 || last.Bytes != 30 || last.Entries != 8 || last.URL != "b.html" {
+		t.Fatal("unexpected progress", last)
+	}
+	if last.ETA < last.Elapsed/2 || last.ETA > 2*last.Elapsed {
+		t.Fatal("half of the articles should be left", last.ETA, last.Elapsed)
+	}
+	unknown := NewIngestion(0)
+	unknown.Callback = nil
+	unknown.Learned("a.html", 10, 5)
+	if unknown.Progress.ETA != 0 {
+		t.Fatal("the eta should be unknown without a total")
+	}
+	empty := NewLRU(16)
+	if err := empty.Learn(nil); err != nil {
+		unknown.Skip("empty.html", err)
+	}
+	if unknown.Progress.Skipped != 1 || unknown.Progress.Articles != 1 {
+		t.Fatal("the empty article should be skipped", unknown.Progress)
+	}
+}
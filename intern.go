@@ -0,0 +1,81 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"math"
+)
+
+// interned is a unit vector shared by the cached windows with the number of windows sharing it
+type interned struct {
+	Vector     []float64
+	References int
+}
+
+// Interned stores the identical unit vectors of the cached windows once.
+// Windows that back off to the same context, like the whitespace dominated ones, have identical vectors.
+// It isn't thread safe, the vector cache interns under its lock.
+type Interned map[uint64]*interned
+
+// Hash is the fnv-1a hash of the bits of a vector
+func Hash(vector []float64) uint64 {
+	hash := uint64(14695981039346656037)
+	for _, value := range vector {
+		bits := math.Float64bits(value)
+		for i := 0; i < 64; i += 8 {
+			hash ^= (bits >> i) & 0xff
+			hash *= 1099511628211
+		}
+	}
+	return hash
+}
+
+// equal returns true if two vectors are identical
+func equal(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i, value := range a {
+		if value != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Intern returns the shared copy of a vector, the vector becomes the shared copy if there isn't one.
+// A vector that collides with a different vector isn't interned.
+func (t Interned) Intern(vector []float64) []float64 {
+	if len(vector) == 0 {
+		return vector
+	}
+	hash := Hash(vector)
+	shared := t[hash]
+	if shared == nil {
+		t[hash] = &interned{Vector: vector, References: 1}
+		return vector
+	}
+	if !equal(shared.Vector, vector) {
+		return vector
+	}
+	shared.References++
+	return shared.Vector
+}
+
+// Release releases a vector returned by Intern, the shared copy is removed when no window references it
+func (t Interned) Release(vector []float64) {
+	if len(vector) == 0 {
+		return
+	}
+	hash := Hash(vector)
+	shared := t[hash]
+	if shared == nil || &shared.Vector[0] != &vector[0] {
+		return
+	}
+	shared.References--
+	if shared.References == 0 {
+		delete(t, hash)
+	}
+}
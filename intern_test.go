@@ -0,0 +1,38 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+)
+
+func TestInterned(t *testing.T) {
+	cache := NewVectorLRU(2 * VectorBytes)
+	vector := func(value float64) []float64 {
+		v := make([]float64, 256)
+		for i := range v {
+			v[i] = value
+		}
+		return v
+	}
+	window := func(key byte, value float64) WindowVector {
+		return WindowVector{Entry: Entry{Key: Symbols{key}, Found: true}, Weight: vector(value)}
+	}
+	cache.Put(window(1, 1))
+	cache.Put(window(2, 1))
+	a, _ := cache.Get(Symbols{1})
+	b, _ := cache.Get(Symbols{2})
+	if &a.Weight[0] != &b.Weight[0] || len(cache.Interned) != 1 {
+		t.Fatal("identical vectors should share storage", len(cache.Interned))
+	}
+	cache.Put(window(3, 2))
+	if len(cache.Interned) != 2 || cache.Interned[Hash(vector(1))].References != 1 {
+		t.Fatal("the evicted window should release its vector", len(cache.Interned))
+	}
+	cache.Put(window(4, 2))
+	if len(cache.Interned) != 1 || cache.Interned[Hash(vector(2))].References != 2 {
+		t.Fatal("unreferenced vectors should be removed", len(cache.Interned))
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	bolt "go.etcd.io/bbolt"
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/palette/moreland"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/vg"
+)
+
+// place places candidate bytes at positions of the prompt, extending the prompt if needed
+func place(prompt []byte, positions []int, symbols []byte) []byte {
+	length := len(prompt)
+	for _, position := range positions {
+		if position+1 > length {
+			length = position + 1
+		}
+	}
+	text := append(Padding(Order-2), make([]byte, length)...)
+	copy(text[Order-2:], prompt)
+	for i, position := range positions {
+		text[Order-2+position] = symbols[i]
+	}
+	return text
+}
+
+// landscapeEntropy is the self entropy of a text as used by the search
+func landscapeEntropy(db *bolt.DB, text []byte) float64 {
+	total := 0.0
+	for _, value := range SelfEntropy(db, text, nil) {
+		total += value
+	}
+	return total
+}
+
+// Landscape computes the self entropy of each of the 256 candidate bytes at a position of the prompt
+func Landscape(db *bolt.DB, prompt []byte, position int) []float64 {
+	landscape := make([]float64, 256)
+	for i := range landscape {
+		text := place(prompt, []int{position}, []byte{byte(i)})
+		landscape[i] = landscapeEntropy(db, text)
+	}
+	return landscape
+}
+
+// JointLandscape computes the self entropy of each pair of candidate bytes at two positions of the prompt
+func JointLandscape(db *bolt.DB, prompt []byte, a, b int) [][]float64 {
+	landscape := make([][]float64, 256)
+	for i := range landscape {
+		landscape[i] = make([]float64, 256)
+		for j := range landscape[i] {
+			text := place(prompt, []int{a, b}, []byte{byte(i), byte(j)})
+			landscape[i][j] = landscapeEntropy(db, text)
+		}
+	}
+	return landscape
+}
+
+// WriteLandscape writes a landscape as csv
+func WriteLandscape(w io.Writer, landscape []float64) error {
+	out := csv.NewWriter(w)
+	out.Write([]string{"byte", "entropy"})
+	for i, entropy := range landscape {
+		out.Write([]string{strconv.Itoa(i), strconv.FormatFloat(entropy, 'g', -1, 64)})
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// WriteJointLandscape writes a joint landscape as a csv grid, rows are the first position
+func WriteJointLandscape(w io.Writer, landscape [][]float64) error {
+	out := csv.NewWriter(w)
+	header := []string{"byte"}
+	for j := range landscape {
+		header = append(header, strconv.Itoa(j))
+	}
+	out.Write(header)
+	for i, row := range landscape {
+		record := []string{strconv.Itoa(i)}
+		for _, entropy := range row {
+			record = append(record, strconv.FormatFloat(entropy, 'g', -1, 64))
+		}
+		out.Write(record)
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// Grid is a joint landscape as a heat map grid
+type Grid [][]float64
+
+// Dims returns the dimensions of the grid
+func (g Grid) Dims() (c, r int) {
+	return len(g), len(g)
+}
+
+// Z returns the entropy of a cell
+func (g Grid) Z(c, r int) float64 {
+	return g[r][c]
+}
+
+// X returns the byte of a column
+func (g Grid) X(c int) float64 {
+	return float64(c)
+}
+
+// Y returns the byte of a row
+func (g Grid) Y(r int) float64 {
+	return float64(r)
+}
+
+func landscape() {
+	db := OpenModel(*FlagModel)
+	defer db.Close()
+
+	prompt := []byte(*FlagInput)
+	position := *FlagPosition
+	if position < 0 {
+		position = len(prompt)
+	}
+	if *FlagPosition2 == position {
+		Fail(ExitFlags, errors.New("the joint positions should be different"))
+	}
+
+	out, err := os.Create(*FlagLandscape + ".csv")
+	if err != nil {
+		panic(err)
+	}
+	defer out.Close()
+
+	p := plot.New()
+	p.X.Label.Text = fmt.Sprintf("byte at %d", position)
+	if *FlagPosition2 < 0 {
+		values := Landscape(db, prompt, position)
+		if err := WriteLandscape(out, values); err != nil {
+			panic(err)
+		}
+		points := make(plotter.XYs, 0, len(values))
+		for i, value := range values {
+			points = append(points, plotter.XY{X: float64(i), Y: value})
+		}
+		p.Title.Text = "entropy landscape"
+		p.Y.Label.Text = "entropy"
+		line, err := plotter.NewLine(points)
+		if err != nil {
+			panic(err)
+		}
+		p.Add(line)
+	} else {
+		values := JointLandscape(db, prompt, position, *FlagPosition2)
+		if err := WriteJointLandscape(out, values); err != nil {
+			panic(err)
+		}
+		p.Title.Text = "joint entropy landscape"
+		p.Y.Label.Text = fmt.Sprintf("byte at %d", *FlagPosition2)
+		p.Add(plotter.NewHeatMap(Grid(values), moreland.SmoothBlueRed().Palette(256)))
+	}
+	err = p.Save(8*vg.Inch, 8*vg.Inch, *FlagLandscape+".png")
+	if err != nil {
+		panic(err)
+	}
+}
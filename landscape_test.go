@@ -0,0 +1,34 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestLandscape(t *testing.T) {
+	if text := place([]byte("abc"), []int{1, 4}, []byte("xy")); string(text[Order-2:]) != "axc\x00y" {
+		t.Fatalf("unexpected placement %q", text[Order-2:])
+	}
+	db := NewTestModel(t)
+	prompt := []byte("it was the")
+	landscape := Landscape(db, prompt, len(prompt))
+	if len(landscape) != 256 {
+		t.Fatal("the landscape should cover every byte")
+	}
+	text := append(make([]byte, Order-2), "it was the "...)
+	if landscape[' '] != landscapeEntropy(db, text) {
+		t.Fatal("the landscape should match the search entropy")
+	}
+	out := bytes.Buffer{}
+	if err := WriteLandscape(&out, landscape); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(out.String(), "\n"); lines != 257 {
+		t.Fatal("unexpected number of csv lines", lines)
+	}
+}
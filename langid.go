@@ -0,0 +1,93 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// LanguageModel is the model of a language for the language identification
+type LanguageModel struct {
+	Name string
+	Path string
+}
+
+// ParseLanguageModels parses comma separated name=path language models
+func ParseLanguageModels(models string) []LanguageModel {
+	parsed, names := make([]LanguageModel, 0, 8), make(map[string]bool)
+	for _, model := range strings.Split(models, ",") {
+		parts := strings.SplitN(model, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			Fail(ExitFlags, fmt.Errorf("invalid language model %q", model))
+		}
+		if names[parts[0]] {
+			Fail(ExitFlags, fmt.Errorf("language %s has several models", parts[0]))
+		}
+		names[parts[0]] = true
+		parsed = append(parsed, LanguageModel{
+			Name: parts[0],
+			Path: parts[1],
+		})
+	}
+	return parsed
+}
+
+// LanguageScore is the self entropy per byte of a text under the model of a language
+type LanguageScore struct {
+	Language string  `json:"language"`
+	Entropy  float64 `json:"entropy"`
+}
+
+// IdentifyLanguage scores a text with the model of each language, the language whose model is the least
+// surprised by the text is first. The models are opened one at a time, so only one is in memory.
+func IdentifyLanguage(models []LanguageModel, text []byte, chunk, overlap int) []LanguageScore {
+	input := text
+	if len(input) < Order {
+		input = append(Padding(Order-len(input)), input...)
+	}
+	scores := make([]LanguageScore, 0, len(models))
+	for _, model := range models {
+		Check()
+		db := OpenModel(model.Path)
+		total, _ := ChunkedSelfEntropy(db, input, chunk, overlap)
+		db.Close()
+		scores = append(scores, LanguageScore{
+			Language: model.Name,
+			Entropy:  total / float64(len(text)),
+		})
+	}
+	sort.SliceStable(scores, func(i, j int) bool {
+		return scores[i].Entropy < scores[j].Entropy
+	})
+	return scores
+}
+
+func langid() {
+	text := []byte(*FlagInput)
+	if len(text) == 0 {
+		Fail(ExitFlags, fmt.Errorf("the language of a non empty -input is identified"))
+	}
+	chunk := *FlagChunk
+	if chunk == 0 {
+		chunk = ScoreChunk
+	}
+	scores := IdentifyLanguage(ParseLanguageModels(*FlagLangID), text, chunk, *FlagOverlap)
+	if *FlagJSON {
+		encoder := json.NewEncoder(Output)
+		for _, score := range scores {
+			if err := encoder.Encode(score); err != nil {
+				Fail(ExitData, err)
+			}
+		}
+		return
+	}
+	fmt.Println("language", scores[0].Language)
+	for _, score := range scores {
+		fmt.Printf("%s %f\n", score.Language, score.Entropy)
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestIdentifyLanguage(t *testing.T) {
+	const French = `C'était le meilleur des temps, c'était le pire des temps, c'était l'âge de la sagesse,
+c'était l'âge de la folie, c'était l'époque de la foi, c'était l'époque de l'incrédulité,
+c'était la saison de la Lumière, c'était la saison des Ténèbres, c'était le printemps de l'espoir,
+c'était l'hiver du désespoir, nous avions tout devant nous, nous n'avions rien devant nous.`
+	dir := t.TempDir()
+	english, err := OpenGoldenModel(filepath.Join(dir, "en.bolt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	english.Close()
+	s := NewLRU(1024)
+	s.Learn([]byte(French))
+	s.Close()
+	french, err := bolt.Open(filepath.Join(dir, "fr.bolt"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	WriteModel(french, ModelBucket, &s)
+	french.Close()
+
+	models := ParseLanguageModels("en=" + filepath.Join(dir, "en.bolt") + ",fr=" + filepath.Join(dir, "fr.bolt"))
+	if len(models) != 2 || models[1].Name != "fr" {
+		t.Fatal("invalid language models", models)
+	}
+	for text, language := range map[string]string{
+		"it was the season of hope":     "en",
+		"c'était la saison de l'espoir": "fr",
+		"we had everything before us":   "en",
+		"nous avions tout devant nous":  "fr",
+	} {
+		scores := IdentifyLanguage(models, []byte(text), ScoreChunk, 0)
+		if len(scores) != 2 || scores[0].Language != language || scores[0].Entropy > scores[1].Entropy {
+			t.Fatal("invalid language", text, scores)
+		}
+	}
+}
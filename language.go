@@ -0,0 +1,111 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Languages are the most common trigrams of each language
+var Languages = map[string][]string{
+	"en": {" th", "the", "he ", "and", " an", "nd ", " of", "of ", " to", "to ", "ing", "ng ", " in", "in ", "ed ",
+		"is ", "er ", "ion", " a ", "re ", "on ", "at ", "es ", "hat", "tha", "as ", "it ", "for", " wa", "was",
+		" he", "his", "ent", " be", "her", " hi", "ere", "tio", "ter", "all", " wh", "ou ", "hin", " it", "wit"},
+	"fr": {" de", "de ", "es ", "ent", " le", "le ", "la ", " la", "les", " et", "et ", "ion", "nt ", " qu", "que",
+		"ue ", "re ", "on ", "des", "e d", " pa", "ait", "ne ", "it ", "s d", "e l", "ur ", "ons", "par", " un",
+		"un ", "ans", " en", "en ", "ais", "lle", "eur", " co", "men", "ous", "est", " so", "pou", "our", "qui"},
+	"de": {"en ", "er ", "der", " de", "ie ", "ich", "die", " di", "ein", "und", " un", "nd ", "sch", "che", "ch ",
+		"in ", " ei", "den", "cht", "te ", "ine", "gen", "ten", " ge", "ung", "nde", "ver", " be", "ber", "lic",
+		"nen", " zu", "ent", "auf", " au", "ht ", "ern", "sie", " si", "ges", "ist", " is", "mit", " mi", "eit"},
+	"es": {" de", "de ", "os ", " la", "la ", "el ", " el", "es ", "que", " qu", "ue ", "en ", " en", "as ", "ent",
+		"del", " co", "ado", "ar ", "nte", "con", "los", " lo", "ra ", "er ", "ion", "por", " po", "ien", "ció",
+		" se", "se ", "ero", " ha", "o d", "a d", "mos", "par", "est", "nto", "ada", "una", " un", "na ", "sta"},
+	"it": {" di", "di ", "la ", "che", " ch", "he ", " la", "to ", "re ", "ell", "del", "lla", " de", "ne ", "one",
+		"no ", "per", " pe", "ent", "le ", "ato", " co", "on ", "ere", "ion", "il ", " il", " in", "in ", "nte",
+		"are", "a d", "o d", "con", "sta", "ra ", "ta ", "ess", " so", "non", " no", "gli", "ame", "ali", "io "},
+	"nl": {"en ", "de ", " de", "an ", "van", " va", "het", " he", "et ", "een", " ee", "er ", "ij ", "ing", "ng ",
+		" in", "in ", "at ", "oor", "aar", "and", "te ", "den", " te", "ver", "ie ", "ch ", "sch", "gen", "erd",
+		"nd ", " we", "dat", " da", "ten", "ijn", "zij", " zi", " ge", "ter", "ook", "met", " me", "wer", "nde"},
+	"pt": {" de", "de ", "os ", "do ", " do", " a ", "que", " qu", "ue ", "ent", " co", "da ", " da", "as ", "ao ",
+		"nte", "es ", "com", "em ", " em", "ra ", "o d", "a d", "est", "men", "par", " pa", " se", "ar ", "ara",
+		"dos", "ção", "ão ", "ado", "ica", "ist", " um", "um ", "uma", " no", "nto", "era", "res", "eu ", "ele"},
+}
+
+// trigrams counts the letter trigrams of a text
+func trigrams(text string) (counts map[string]int, total, letters, latin int) {
+	counts = make(map[string]int)
+	window := make([]rune, 0, 3)
+	space := true
+	for _, r := range strings.ToLower(text) {
+		if unicode.IsLetter(r) {
+			letters++
+			if r < unicode.MaxLatin1 || unicode.Is(unicode.Latin, r) {
+				latin++
+			}
+			space = false
+		} else {
+			if space {
+				continue
+			}
+			r, space = ' ', true
+		}
+		if len(window) == 3 {
+			copy(window, window[1:])
+			window = window[:2]
+		}
+		window = append(window, r)
+		if len(window) == 3 {
+			counts[string(window)]++
+			total++
+		}
+	}
+	return counts, total, letters, latin
+}
+
+// DetectLanguage detects the language of a text using rank weighted trigram profiles, an empty string is returned
+// if the language can't be detected
+func DetectLanguage(text string) (language string, score float64) {
+	counts, total, letters, latin := trigrams(" " + text + " ")
+	if total == 0 || letters == 0 {
+		return "", 0
+	}
+	if float64(latin)/float64(letters) < .5 {
+		return "", 0
+	}
+	for name, profile := range Languages {
+		sum := 0
+		for rank, trigram := range profile {
+			sum += counts[trigram] * (len(profile) - rank)
+		}
+		s := float64(sum) / float64(total*len(profile))
+		if s > score || (s == score && name < language) {
+			language, score = name, s
+		}
+	}
+	return language, score
+}
+
+// FilterLanguage filters a text to the language, per paragraph if paragraphs is true
+func FilterLanguage(text, language string, paragraphs bool) string {
+	const MinLength = 64
+	if !paragraphs {
+		if detected, _ := DetectLanguage(text); detected != language {
+			return ""
+		}
+		return text
+	}
+	var output strings.Builder
+	for _, paragraph := range strings.Split(text, "\n\n") {
+		if len(paragraph) >= MinLength {
+			if detected, _ := DetectLanguage(paragraph); detected != language {
+				continue
+			}
+		}
+		output.WriteString(paragraph)
+		output.WriteString("\n\n")
+	}
+	return output.String()
+}
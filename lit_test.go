@@ -5,20 +5,24 @@
 package main
 
 import (
+	"math"
 	"math/rand"
+	"os"
+	"path/filepath"
 	"testing"
-)
 
-// Length is the length of the matrix
-const Length = 128
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/pointlander/lit/matrix"
+)
 
 func BenchmarkSelfEntropy(b *testing.B) {
 	rnd := rand.New(rand.NewSource(1))
-	weights, importance := NewRandMatrix(rnd, 0, Width, Length), NewRandMatrix(rnd, 0, Length, 1)
+	weights, importance := matrix.NewRandMatrix(rnd, 0, Width, Length), matrix.NewRandMatrix(rnd, 0, Length, 1)
 	for n := 0; n < b.N; n++ {
-		l1 := Softmax(Mul(weights, weights))
-		l2 := Softmax(Mul(T(weights), l1))
-		entropy := H(Entropy(l2), importance)
+		l1 := matrix.Softmax(matrix.Mul(weights, weights))
+		l2 := matrix.Softmax(matrix.Mul(matrix.T(weights), l1))
+		entropy := matrix.H(matrix.Entropy(l2), importance)
 		sum := 0.0
 		for _, value := range entropy.Data {
 			sum += value
@@ -28,16 +32,94 @@ func BenchmarkSelfEntropy(b *testing.B) {
 
 func BenchmarkSelfEntropyKernel(b *testing.B) {
 	rnd := rand.New(rand.NewSource(1))
-	weights, importance := NewRandMatrix(rnd, 0, Width, Length), NewRandMatrix(rnd, 0, Length, 1)
+	weights, importance := matrix.NewRandMatrix(rnd, 0, Width, Length), matrix.NewRandMatrix(rnd, 0, Length, 1)
 	for n := 0; n < b.N; n++ {
-		SelfEntropyKernel(weights, weights, weights, importance)
+		matrix.SelfEntropyKernel(weights, weights, weights, importance)
 	}
 }
 
 func BenchmarkFastSelfEntropyKernel(b *testing.B) {
 	rnd := rand.New(rand.NewSource(1))
-	weights, importance := NewRandMatrix(rnd, 0, Width, Length), NewRandMatrix(rnd, 0, Length, 1)
+	weights, importance := matrix.NewRandMatrix(rnd, 0, Width, Length), matrix.NewRandMatrix(rnd, 0, Length, 1)
 	for n := 0; n < b.N; n++ {
-		FastSelfEntropyKernel(weights, weights, weights, importance)
+		matrix.FastSelfEntropyKernel(weights, weights, weights, importance)
+	}
+}
+
+// Corpus is a small training corpus for tests, the corpus of the golden model
+const Corpus = GoldenCorpus
+
+// NewTestModel learns a model from the test corpus
+func NewTestModel(t testing.TB) *bolt.DB {
+	db, err := OpenGoldenModel(filepath.Join(t.TempDir(), "model.bolt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+	})
+	return db
+}
+
+func TestChunkedSelfEntropy(t *testing.T) {
+	db := NewTestModel(t)
+	input := []byte(Corpus)
+	total, windows := ChunkedSelfEntropy(db, input, 64, 16)
+	if len(windows) != (len(input)-16+47)/48 {
+		t.Fatal("unexpected number of windows", len(windows))
+	}
+	if math.IsNaN(total) || total <= 0 {
+		t.Fatal("invalid total", total)
+	}
+	small, windows := ChunkedSelfEntropy(db, input[:32], 64, 16)
+	if len(windows) != 1 || small != SelfEntropy(db, input[:32], nil)[0] {
+		t.Fatal("short input should be a single window")
+	}
+}
+
+func TestLearnBoundaries(t *testing.T) {
+	s := NewLRU(1024)
+	s.Learn([]byte("short"))
+	s.Close()
+	if len(s.Model) == 0 {
+		t.Fatal("short inputs should be learned")
+	}
+	begin := Symbols{}
+	if _, ok := s.Model[begin]; !ok {
+		t.Fatal("the beginning of the text should be learned")
+	}
+	if len(s.Ends) != 1 {
+		t.Fatal("the end of the text should be counted")
+	}
+}
+
+func TestContextFile(t *testing.T) {
+	file := *FlagContextFile
+	defer func() {
+		*FlagContextFile = file
+	}()
+	*FlagContextFile = ""
+	if ContextFile() != nil {
+		t.Fatal("there should be no context without a file")
+	}
+	dir := t.TempDir()
+	*FlagContextFile = filepath.Join(dir, "context.txt")
+	if err := os.WriteFile(*FlagContextFile, []byte(Corpus), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if string(ContextFile()) != Corpus {
+		t.Fatal("the context should be the file")
+	}
+	if err := os.WriteFile(*FlagContextFile, []byte("short"), 0600); err != nil {
+		t.Fatal(err)
 	}
+	func() {
+		defer func() {
+			err, ok := recover().(*Error)
+			if !ok || err.Code != ExitFlags {
+				t.Fatal("a short context should be a flags error", err)
+			}
+		}()
+		ContextFile()
+	}()
 }
@@ -7,6 +7,7 @@ package main
 import (
 	"bytes"
 	"runtime"
+	"sync"
 
 	"github.com/pointlander/compress"
 )
@@ -24,6 +25,10 @@ type LRU struct {
 	Head, Tail *Node
 	Nodes      map[Symbols]*Node
 	Model      map[Symbols][]uint8
+	// Ends counts the contexts that end an article
+	Ends map[Symbols]uint32
+	// Store streams the evicted vectors into a model bucket, they are kept in Model if it is nil
+	Store *Store
 }
 
 // NewLRU creates a new LRU cache
@@ -34,6 +39,7 @@ func NewLRU(size int) LRU {
 	return LRU{
 		Size:  size,
 		Model: make(map[Symbols][]uint8),
+		Ends:  make(map[Symbols]uint32),
 	}
 }
 
@@ -93,9 +99,19 @@ func (l *LRU) Flush() *Node {
 		l.Model[n.Key] = n.Value
 	}
 	node.F.B, l.Tail, node.F = nil, node.F, nil
+	l.stream()
 	return node
 }
 
+// stream writes the evicted vectors to the store
+func (l *LRU) stream() {
+	if l.Store == nil {
+		return
+	}
+	l.Store.Write(l.Model)
+	l.Model = make(map[Symbols][]uint8)
+}
+
 // Flush flush the oldest entries in the cache
 func (l *LRU) Close() {
 	node := l.Tail
@@ -116,6 +132,7 @@ func (l *LRU) Close() {
 		write()
 		node = node.F
 	}
+	l.stream()
 }
 
 // Get gets an entry and sets it as the most recent
@@ -137,15 +154,13 @@ func (l *LRU) Get(key Symbols) (*Node, bool) {
 	}
 
 	node, compressed := &Node{Key: key}, l.Model[key]
+	if compressed == nil && l.Store != nil {
+		compressed = l.Store.Get(key)
+	}
 	if compressed != nil {
-		decoded, index, buffer, output := make([]uint16, Width), 0, bytes.NewBuffer(compressed), make([]byte, 2*Width)
-		compress.Mark1Decompress1(buffer, output)
-		for key := range decoded {
-			decoded[key] = uint16(output[index])
-			index++
-			decoded[key] |= uint16(output[index]) << 8
-			index++
-		}
+		decoded, output := make([]uint16, Width), make([]byte, 2*Width)
+		compress.Mark1Decompress1(bytes.NewBuffer(compressed), output)
+		DecodeCounts(decoded, output)
 		node.Value = decoded
 	} else {
 		node.Value = make([]uint16, Width)
@@ -160,3 +175,108 @@ func (l *LRU) Get(key Symbols) (*Node, bool) {
 	l.Nodes[key] = node
 	return node, false
 }
+
+// VectorNode is an entry in the vector LRU cache
+type VectorNode struct {
+	F, B   *VectorNode
+	Window WindowVector
+}
+
+// VectorLRU is a thread safe least recently used cache of looked up windows.
+// The unit vectors of the windows are interned, so identical vectors are stored once.
+type VectorLRU struct {
+	sync.Mutex
+	Size       int
+	Bucket     string
+	Head, Tail *VectorNode
+	Nodes      map[Symbols]*VectorNode
+	Interned   Interned
+}
+
+// VectorBytes is the approximate memory used by a cached window
+const VectorBytes = 2*Width + 8*Width + 128
+
+// NewVectorLRU creates a new vector LRU cache with a memory budget in bytes
+func NewVectorLRU(budget int) *VectorLRU {
+	size := budget / VectorBytes
+	if size < 1 {
+		panic("the vector cache budget should fit at least one window")
+	}
+	return &VectorLRU{
+		Size:     size,
+		Bucket:   string(ModelBucket),
+		Nodes:    make(map[Symbols]*VectorNode, size),
+		Interned: make(Interned),
+	}
+}
+
+// Reset empties the cache for a bucket
+func (l *VectorLRU) Reset(bucket string) {
+	l.Lock()
+	defer l.Unlock()
+	l.Bucket, l.Head, l.Tail = bucket, nil, nil
+	l.Nodes = make(map[Symbols]*VectorNode, l.Size)
+	l.Interned = make(Interned)
+}
+
+// Get gets a window and sets it as the most recent
+func (l *VectorLRU) Get(key Symbols) (WindowVector, bool) {
+	l.Lock()
+	defer l.Unlock()
+	node := l.Nodes[key]
+	if node == nil {
+		return WindowVector{}, false
+	}
+	l.remove(node)
+	l.push(node)
+	return node.Window, true
+}
+
+// Put adds a window as the most recent, evicting the least recent window if the cache is full
+func (l *VectorLRU) Put(window WindowVector) {
+	l.Lock()
+	defer l.Unlock()
+	if node := l.Nodes[window.Key]; node != nil {
+		l.remove(node)
+		l.push(node)
+		return
+	}
+	if len(l.Nodes) >= l.Size {
+		tail := l.Tail
+		l.remove(tail)
+		delete(l.Nodes, tail.Window.Key)
+		l.Interned.Release(tail.Window.Weight)
+		l.Interned.Release(tail.Window.HMM)
+	}
+	window.Weight, window.HMM = l.Interned.Intern(window.Weight), l.Interned.Intern(window.HMM)
+	node := &VectorNode{Window: window}
+	l.Nodes[window.Key] = node
+	l.push(node)
+}
+
+// remove unlinks a node
+func (l *VectorLRU) remove(node *VectorNode) {
+	if node.F != nil {
+		node.F.B = node.B
+	} else {
+		l.Head = node.B
+	}
+	if node.B != nil {
+		node.B.F = node.F
+	} else {
+		l.Tail = node.F
+	}
+	node.F, node.B = nil, nil
+}
+
+// push links a node as the head
+func (l *VectorLRU) push(node *VectorNode) {
+	node.B = l.Head
+	if l.Head != nil {
+		l.Head.F = node
+	}
+	l.Head = node
+	if l.Tail == nil {
+		l.Tail = node
+	}
+}
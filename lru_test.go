@@ -5,7 +5,11 @@
 package main
 
 import (
+	"bytes"
+	"path/filepath"
 	"testing"
+
+	bolt "go.etcd.io/bbolt"
 )
 
 func TestLRU(t *testing.T) {
@@ -97,3 +101,46 @@ func TestLRU(t *testing.T) {
 	check(1, []uint8{1})
 	check(1, []uint8{1})
 }
+
+func TestLRUStore(t *testing.T) {
+	memory := NewLRU(64)
+	memory.Learn([]byte(Corpus))
+	memory.Learn([]byte(Corpus))
+	memory.Close()
+
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "model.bolt"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	store, err := NewStore(db, []byte("markov"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		streamed := NewLRU(64)
+		streamed.Store = store
+		streamed.Learn([]byte(Corpus))
+		streamed.Close()
+		if len(streamed.Model) != 0 {
+			t.Fatal("the streamed vectors shouldn't be kept in memory")
+		}
+	}
+
+	entries := 0
+	err = ScanShards(db, []byte("markov"), func(_ int, k, v []byte) error {
+		key := Symbols{}
+		copy(key[:], k)
+		if !bytes.Equal(memory.Model[key], v) {
+			t.Errorf("the streamed vector of %v should match", key)
+		}
+		entries++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries != len(memory.Model) {
+		t.Fatal("the stored model should match the model learned in memory", entries, len(memory.Model))
+	}
+}
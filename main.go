@@ -6,13 +6,17 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"math"
 	"math/rand"
 	"os"
+	"os/signal"
+	"runtime"
 	"sort"
 	"strings"
 	"time"
@@ -26,6 +30,8 @@ import (
 	"gonum.org/v1/plot/vg/draw"
 
 	bolt "go.etcd.io/bbolt"
+
+	"github.com/pointlander/lit/matrix"
 )
 
 const (
@@ -33,19 +39,31 @@ const (
 	Order = 9
 	// ComplexOrder is the order of the markov word complex vector model
 	ComplexOrder = 2
-	// Depth is the depth of the search
-	Depth = 2
-	// Size is the number of histograms
+	// Size is the number of histograms.
+	// With Size 2 each context also learns a histogram of the Lookahead bytes following the next byte,
+	// and the self entropy of those histograms is added to the self entropy of the next byte histograms.
+	// The size is recorded in the model shape, so a model only opens with the size it was learned with.
 	Size = 1
 	// Width is the width of the probability distribution
 	Width = Size * 256
+	// Lookahead is the number of bytes of the second histogram
+	Lookahead = 32
 )
 
+// Depth is the depth of the search
+var Depth = 2
+
 // Indexes are the context indexes for the markov model
 var Indexes = [Order]int{0, 1, 2, 3, 4, 5, 6, 7, 8}
 
 //var Indexes = [5]int{0, 3, 5, 7, 8}
 
+// SquareOffsets are the pair offsets of the square markov model context
+var SquareOffsets = []int{-4, -3, -2, 2, 3, 4}
+
+// ModelBucket is the bolt bucket the model is read from
+var ModelBucket = []byte("markov")
+
 var (
 	// FlagSquare uses square markov model
 	FlagSquare = flag.Bool("square", false, "square markov model")
@@ -60,7 +78,9 @@ var (
 	// FlagDiffusion is a diffusion based model
 	FlagDiffusion = flag.Bool("diffusion", false, "diffusion mode")
 	// FlagInput is the input into the markov model
-	FlagInput = flag.String("input", "What color is the sky?", "input into the markov model")
+	FlagInput = flag.String("input", "What color is the sky?", "input into the markov model, - reads it from stdin")
+	// FlagInputFile is a file the input into the markov model is read from
+	FlagInputFile = flag.String("inputFile", "", "file the input into the markov model is read from")
 	// FlagRandomInput use random input
 	FlagRandomInput = flag.Int("randomInput", 0, "random string")
 	// FlagPagerank page rank mode
@@ -68,7 +88,7 @@ var (
 	// FlagLearn learn a model
 	FlagLearn = flag.Bool("learn", false, "learns a model")
 	// FlagData is the path to the training data
-	FlagData = flag.String("data", "gutenberg_en_all_2022-04.zim", "path to the training data")
+	FlagData = flag.String("data", "gutenberg_en_all_2022-04.zim", "path to the training data: a comma separated list of zim files, common crawl .warc or .wet files, text files, directories and globs, interleaved while learning")
 	// FlagModel is the model for inference
 	FlagModel = flag.String("model", "model.bolt", "the learned model")
 	// FlagEntropy calculate the self entropy of a string
@@ -79,12 +99,280 @@ var (
 	FlagScale = flag.Int("scale", 8, "the scaling factor for the amount of samples")
 	// FlagComplex complex number model
 	FlagComplex = flag.Bool("complex", false, "complex model")
+	// FlagComplex128 accumulates the complex kernels in complex128
+	FlagComplex128 = flag.Bool("complex128", false, "accumulate the complex kernels in complex128")
+	// FlagDeterministic uses deterministic reductions and tie breaking in parallel code
+	FlagDeterministic = flag.Bool("deterministic", false, "deterministic parallel reductions and search tie breaking")
+	// FlagKahan uses compensated summation for the entropy sums
+	FlagKahan = flag.Bool("kahan", false, "use compensated summation for the entropy sums")
+	// FlagPositions prints the entropy of each position of -entropy
+	FlagPositions = flag.Bool("positions", false, "print the direct self entropy of each position of the -entropy string as tab separated values, or json lines with -json")
+	// FlagExportEntropy exports the per position entropies of the documents of -data to a parquet file
+	FlagExportEntropy = flag.String("export-entropy", "", "write the per position entropy and backoff order of the documents of -data to a parquet file")
+	// FlagScore scores the lines of a file with the self entropy
+	FlagScore = flag.String("score", "", "report the total and per line self entropy per byte of a file, - for stdin")
+	// FlagAnomalies flags the lines of a file with an outlier self entropy
+	FlagAnomalies = flag.String("anomalies", "", "report the lines of a file whose self entropy per byte is an outlier, - for stdin")
+	// FlagZScore is the z-score beyond which a line is an anomaly
+	FlagZScore = flag.Float64("zscore", 3, "number of standard deviations from the mean beyond which a line is an anomaly")
+	// FlagLangID identifies the language of the input with a model per language
+	FlagLangID = flag.String("langid", "", "identify the language of the input with comma separated name=path models of each language")
+	// FlagChunk is the window size for chunked self entropy
+	FlagChunk = flag.Int("chunk", 0, "window size for chunked self entropy, 0 disables chunking")
+	// FlagOverlap is the overlap between windows for chunked self entropy
+	FlagOverlap = flag.Int("overlap", 0, "overlap between windows for chunked self entropy")
+	// FlagFilter is a file of words and regular expressions to filter from the output
+	FlagFilter = flag.String("filter", "", "file of words and regular expressions to filter from the output")
+	// FlagRefilter excludes filtered continuations from the search instead of redacting them
+	FlagRefilter = flag.Bool("refilter", false, "exclude filtered continuations from the search")
+	// FlagStrip strips the gutenberg license boilerplate from the training data
+	FlagStrip = flag.String("strip", "auto", "strip gutenberg boilerplate: auto, on, or off")
+	// FlagLang only learns from articles in the language
+	FlagLang = flag.String("lang", "", "only learn from articles in this language, e.g. en")
+	// FlagLangParagraphs filters the language per paragraph instead of per article
+	FlagLangParagraphs = flag.Bool("langparagraphs", false, "filter the language per paragraph instead of per article")
+	// FlagCurriculum learns from random books ordered from easy to hard
+	FlagCurriculum = flag.Bool("curriculum", false, "learn from random books ordered from easy to hard")
+	// FlagBootstrap is the number of books in the curriculum bootstrap model
+	FlagBootstrap = flag.Int("bootstrap", 64, "number of books in the curriculum bootstrap model")
+	// FlagDomains learns sub-models for articles with urls matching the domain regular expressions
+	FlagDomains = flag.String("domains", "", "comma separated name=regexp url patterns for domain sub-models")
+	// FlagRoute routes the input to the best matching domain sub-model
+	FlagRoute = flag.Bool("route", false, "route the input to the best matching domain sub-model")
+	// FlagEval evaluates the models on the lines of a file
+	FlagEval = flag.String("eval", "", "evaluate bits per byte and next byte accuracy on the lines of a file")
+	// FlagComplexModel is the complex model for evaluation
+	FlagComplexModel = flag.String("complexmodel", "complex.bolt", "the learned complex model for evaluation")
+	// FlagEvalContext is the number of bytes of context used for evaluation
+	FlagEvalContext = flag.Int("eval-context", 64, "number of bytes of context used for evaluation")
+	// FlagComplexEta is the learning rate of the complex model
+	FlagComplexEta = flag.Float64("complexeta", .1, "learning rate of the complex model")
+	// FlagComplexPasses is the number of learning passes per article for the complex model
+	FlagComplexPasses = flag.Int("complexpasses", 1, "number of learning passes per article for the complex model")
+	// FlagComplexPhase is the phase spacing scheme of the complex model: linear, full, or golden
+	FlagComplexPhase = flag.String("complexphase", "linear", "phase spacing scheme of the complex model: linear, full, or golden")
+	// FlagOffsets are the comma separated pair offsets of the square markov model context
+	FlagOffsets = flag.String("offsets", "-4,-3,-2,2,3,4", "comma separated pair offsets of the square markov model context")
+	// FlagSquareModel is the saved square markov model, it is learned and saved if it doesn't exist
+	FlagSquareModel = flag.String("squaremodel", "", "the saved square markov model, learned and saved if it doesn't exist, auto is in the cache directory")
+	// FlagPromptAdherence weights the cross entropy of the generated text attending to the prompt
+	FlagPromptAdherence = flag.Float64("prompt-adherence", 0, "weight of the cross entropy between the generated text and the prompt")
+	// FlagExtract extracts the span of the context that best answers the question
+	FlagExtract = flag.Bool("extract", false, "extract the span of the context that best answers the question")
+	// FlagContext is the passage file to extract answers from
+	FlagContext = flag.String("context", "", "passage file to extract answers from")
+	// FlagQuestion is the question to extract the answer to
+	FlagQuestion = flag.String("question", "", "question to extract the answer to")
+	// FlagMaxSpan is the maximum length of an extracted span in bytes
+	FlagMaxSpan = flag.Int("max-span", 40, "maximum length of an extracted span in bytes")
+	// FlagBench runs the comma separated benchmarks or all of them
+	FlagBench = flag.String("bench", "", "run the comma separated benchmarks, or all")
+	// FlagBaseline is the benchmark baseline file, it is written if it doesn't exist
+	FlagBaseline = flag.String("baseline", "", "benchmark baseline file to compare against, written if it doesn't exist, auto is in the cache directory")
+	// FlagThreshold is the ratio over the baseline that is a regression
+	FlagThreshold = flag.Float64("threshold", 1.2, "ratio over the benchmark baseline that is a regression")
+	// FlagAudit runs the generation twice and verifies the output is identical
+	FlagAudit = flag.Bool("audit", false, "run the generation twice and verify the output is identical")
+	// FlagWhy reports where the generations of -prompt-a and -prompt-b diverge
+	FlagWhy = flag.Bool("why", false, "generate from -prompt-a and -prompt-b with the same seed and report where they diverge")
+	// FlagPromptA is the first prompt file of -why
+	FlagPromptA = flag.String("prompt-a", "", "first prompt file of -why")
+	// FlagPromptB is the second prompt file of -why
+	FlagPromptB = flag.String("prompt-b", "", "second prompt file of -why")
+	// FlagExplore interactively explores the model
+	FlagExplore = flag.Bool("explore", false, "interactively explore the context windows and predictions of the model, redrawn on every key in a terminal")
+	// FlagVocab is a file of words that generation is restricted to
+	FlagVocab = flag.String("vocab", "", "file of words, one per line, that generation is restricted to")
+	// FlagSchema is a json skeleton that generation is constrained to
+	FlagSchema = flag.String("schema", "", "json skeleton file with fixed keys and generated values that generation is constrained to")
+	// FlagMixture learns the weights of the backoff orders on held out text, they are used by the markov mode
+	FlagMixture = flag.String("mixture", "", "learn the weights of the backoff orders on a held out text file, used by the markov mode, the self entropy modes keep the hard backoff")
+	// FlagWhiten samples contexts of the model and stores a whitening transform of their vectors
+	FlagWhiten = flag.Int("whiten", 0, "sample this many contexts of the model and store a whitening transform of their vectors that inference applies before the kernel, 0 disables")
+	// FlagConfidence prints the entropy of the input with a count based confidence
+	FlagConfidence = flag.Bool("confidence", false, "print the entropy of the input with its count based standard deviation")
+	// FlagScan reports corpus statistics and projected training costs
+	FlagScan = flag.Bool("scan", false, "report corpus statistics and the projected model size and training time")
+	// FlagRecommend recommends a training configuration
+	FlagRecommend = flag.Bool("recommend", false, "recommend the scale and lru size for a target model size and available memory")
+	// FlagTargetSize is the target model size in megabytes
+	FlagTargetSize = flag.Int("targetsize", 1024, "the target model size in megabytes for -recommend")
+	// FlagRAM is the available memory in megabytes
+	FlagRAM = flag.Int("ram", 8*1024, "the available memory in megabytes for -recommend")
+	// FlagLRU is the number of entries of the lru cache used for learning
+	FlagLRU = flag.Int("lru", 1024*1024, "number of entries of the lru cache used for learning, -recommend suggests one")
+	// FlagHeatmap writes an html heatmap of the entropy of each character of the prompt to name.html
+	FlagHeatmap = flag.String("heatmap", "", "write an html heatmap coloring each character of the input by its self entropy to name.html")
+	// FlagLandscape exports the entropy landscape of the prompt to name.csv and name.png
+	FlagLandscape = flag.String("landscape", "", "export the entropy landscape of the input to name.csv and name.png")
+	// FlagPosition is the position of the landscape, the end of the prompt if negative
+	FlagPosition = flag.Int("position", -1, "position of the landscape, the end of the input if negative")
+	// FlagPosition2 is the second position of a joint landscape
+	FlagPosition2 = flag.Int("position2", -1, "second position for a joint 256x256 landscape")
+	// FlagStop is the end of text probability at which generation stops
+	FlagStop = flag.Float64("stop", 0, "stop generating when the probability of the end of the text reaches this value, 0 disables")
+	// FlagPad is the padding symbol that marks the beginning of a text
+	FlagPad = flag.Int("pad", 0, "the byte used to pad the beginning of texts when learning and generating")
+	// FlagSteps is the number of generation steps
+	FlagSteps = flag.Int("steps", 128, "the number of generation steps, diffusion runs 4 times as many")
+	// FlagQuickstart learns, generates and evaluates the bundled corpus in a directory
+	FlagQuickstart = flag.String("quickstart", "", "learn a model from the bundled corpus, generate and evaluate it, and write the artifacts to a directory")
+	// FlagGolden regenerates the golden transcripts in a directory
+	FlagGolden = flag.String("golden", "", "regenerate the golden generation transcripts in a directory")
+	// FlagServe serves generation requests over http
+	FlagServe = flag.String("serve", "", "serve generation requests over http on an address, e.g. :8080")
+	// FlagQuotaBytes is the number of bytes each server client can generate
+	FlagQuotaBytes = flag.Uint64("quotabytes", 0, "the number of bytes each server client, by remote address, can generate, 0 is unlimited")
+	// FlagQuotaExpansions is the number of search expansions each server client can use
+	FlagQuotaExpansions = flag.Uint64("quotaexpansions", 0, "the number of search expansions each server client, by remote address, can use, 0 is unlimited")
+	// FlagCache is the sidecar file the inference cache is loaded from and saved to
+	FlagCache = flag.String("cache", "", "sidecar file the inference cache is loaded from at startup and saved to on exit, auto is in the cache directory")
+	// FlagCacheSize is the maximum number of entries of the inference cache
+	FlagCacheSize = flag.Int("cachesize", 1<<16, "the maximum number of entries of the inference cache")
+	// FlagEntropyMeasure is the entropy functional of the kernels
+	FlagEntropyMeasure = flag.String("entropy-measure", "shannon", "the entropy functional of the kernels: shannon, renyi:alpha, or tsallis:q")
+	// FlagGRPC serves the gRPC api
+	FlagGRPC = flag.String("grpc", "", "serve the gRPC api defined in lit.proto on an address, e.g. :9090")
+	// FlagBroadcast allows element wise matrix operations to broadcast smaller operands
+	FlagBroadcast = flag.Bool("broadcast", false, "broadcast smaller operands in element wise matrix operations")
+	// FlagProjection is the dimension the square model vectors are randomly projected to
+	FlagProjection = flag.Int("projection", 0, "randomly project the square model vectors to this dimension before the kernel, 0 disables")
+	// FlagParallelRows is the number of rows above which the self entropy kernel runs in parallel
+	FlagParallelRows = flag.Int("parallelrows", 256, "run the self entropy kernel in parallel above this many rows, 0 disables")
+	// FlagConcurrency is the number of concurrent beam search goroutines
+	FlagConcurrency = flag.Int("concurrency", runtime.NumCPU(), "the number of concurrent beam search goroutines, 0 searches serially")
+	// FlagContextFile is a reference document the attention mode is conditioned on
+	FlagContextFile = flag.String("context-file", "", "reference document the attention mode is conditioned on through the second histograms, and the complex diffusion mode by attending over it")
+	// FlagWorkers is the number of goroutines that look up the windows of a long text
+	FlagWorkers = flag.Int("workers", runtime.NumCPU(), "the number of goroutines that look up the context windows of a long text")
+	// FlagHalfLife is the distance in bytes from the end of the input at which the importance of a window halves
+	FlagHalfLife = flag.Float64("halflife", 0, "halve the importance of the windows every this many bytes from the end of the input, 0 disables")
+	// FlagVectorCache is the memory budget in megabytes of the cache of looked up window vectors
+	FlagVectorCache = flag.Int("vectorcache", 64, "memory budget in megabytes of the cache of looked up window vectors shared by the search, 0 disables")
+	// FlagNormalize writes the unit float32 vectors of the model for inference
+	FlagNormalize = flag.Bool("normalize", false, "write the unit float32 vectors of the model so inference doesn't normalize every lookup")
+	// FlagCandidateFloor prunes the candidate bytes seen fewer times after the context
+	FlagCandidateFloor = flag.Int("candidate-floor", 0, "skip candidate bytes seen fewer than this many times after the matched context, 0 disables")
+	// FlagPostCmd is an external command each emitted output is piped through
+	FlagPostCmd = flag.String("post-cmd", "", "command each emitted output is piped through, its standard output replaces the output")
+	// FlagPostTimeout is the timeout of the post-processing command
+	FlagPostTimeout = flag.Duration("post-timeout", 5*time.Second, "timeout of each run of the -post-cmd command")
+	// FlagPostPolicy is what happens to the output when the post-processing command fails
+	FlagPostPolicy = flag.String("post-policy", PostKeep, "when the -post-cmd command fails or times out: keep the output, drop it, or fail")
+	// FlagPrefilter is the number of candidates the fast kernel keeps for the full kernel to rescore
+	FlagPrefilter = flag.Int("prefilter", 0, "keep the candidates with the lowest entropy under the fast spherical kernel and rescore only them with the full kernel in the attention and meta modes, 0 disables")
+	// FlagSmoothing smooths the histograms of the learned model
+	FlagSmoothing = flag.String("smoothing", "", "smooth the histograms of the learned model with add-k or good-turing")
+	// FlagPrivacyEpsilon is the privacy budget of the noise added to the counts of the learned model
+	FlagPrivacyEpsilon = flag.Float64("dp-epsilon", 0, "add laplace noise with this privacy budget for a change of one byte to the counts of the learned model, the observed contexts aren't hidden, 0 disables")
+	// FlagPrivacyThreshold is the smallest noisy count kept
+	FlagPrivacyThreshold = flag.Int("dp-threshold", 5, "drop the noisy counts of the learned model below this count")
+	// FlagSmoothingK is the count added to every byte of an observed histogram by add-k smoothing
+	FlagSmoothingK = flag.Int("smoothing-k", 1, "count added to every byte of an observed histogram by add-k smoothing")
+	// FlagNBest is the number of completed paths of the attention mode printed as json
+	FlagNBest = flag.Int("nbest", 0, "print the n completed paths of the attention mode with the lowest entropy as json lines, 0 prints the best path")
+	// FlagDiversity penalizes n-best paths sharing long prefixes with better paths
+	FlagDiversity = flag.Float64("diversity", 0, "with -nbest keep n paths at every step, penalizing each by this times the longest generated prefix it shares with a better path, 0 disables")
+	// FlagJSON prints json records instead of text
+	FlagJSON = flag.Bool("json", false, "print generation, entropy and pagerank results as json lines")
+	// FlagScorer is an external scorer combined with the entropy of the attention mode
+	FlagScorer = flag.String("scorer", "", "http url or command of an external scorer of the candidate bytes combined with the entropy of the attention mode")
+	// FlagScorerWeight is the weight of the external scorer in the combined score
+	FlagScorerWeight = flag.Float64("scorer-weight", 0.5, "weight in [0, 1] of the external scorer, the entropy has the rest")
+	// FlagSample samples the next byte of the attention mode instead of taking the best path
+	FlagSample = flag.Bool("sample", false, "sample the next byte of the attention mode from the candidate entropies instead of taking the best path")
+	// FlagTemperature is the temperature of the sampled distribution
+	FlagTemperature = flag.Float64("temperature", 1, "the temperature of the sampled distribution, lower is closer to the best path")
+	// FlagTopK only samples from the k best candidates
+	FlagTopK = flag.Int("topk", 0, "only sample from the k best candidates, 0 disables")
+	// FlagTopP only samples from the most likely candidates with a total probability of p
+	FlagTopP = flag.Float64("topp", 1, "only sample from the most likely candidates with a total probability of p")
+	// FlagSeed is the seed of the sampler
+	FlagSeed = flag.Int64("seed", 0, "the seed of the sampler, 0 seeds it with the time")
+	// FlagRepetition is the penalty added to the entropy of a candidate for each repetition of its trailing n-gram
+	FlagRepetition = flag.Float64("repetition", 0, "penalty added to the entropy of a candidate for each earlier occurrence of its trailing n-gram, 0 disables")
+	// FlagRepetitionNGram is the length of the n-grams of the repetition penalty
+	FlagRepetitionNGram = flag.Int("repetition-ngram", 4, "length of the trailing n-gram of the repetition penalty")
+	// FlagRepetitionWindow is the number of bytes before the trailing n-gram searched for repetitions
+	FlagRepetitionWindow = flag.Int("repetition-window", 0, "number of bytes of the output searched for repetitions of the trailing n-gram, 0 searches all of it")
+	// FlagConfig is a config file of flag values, flags on the command line override it
+	FlagConfig = flag.String("config", "", "yaml or toml file of flag values, flags on the command line override it")
+	// FlagMode is the generation mode by name
+	FlagMode = flag.String("mode", "", "the generation mode: markov, attention, mutual, meta, diffusion, complex, or complex-diffusion")
+	// FlagDepth is the depth of the search
+	FlagDepth = flag.Int("depth", 2, "the depth of the search")
+	// FlagOffline forbids network access
+	FlagOffline = flag.Bool("offline", false, "forbid network access, http scorers and any other requests fail")
+	// FlagCacheDir is the directory of the cached artifacts
+	FlagCacheDir = flag.String("cachedir", "", "the directory of the models, baselines and feature caches of auto artifact flags, defaults to lit in the user cache directory")
+	// FlagTimeout cancels the command after a duration
+	FlagTimeout = flag.Duration("timeout", 0, "cancel generation and learning after this duration, e.g. 10m, 0 disables")
+	// FlagMaxPrompt is the maximum prompt length in bytes
+	FlagMaxPrompt = flag.Int("maxprompt", 1<<16, "the maximum length of a prompt in bytes, 0 is unlimited")
+	// FlagBatch is a file of prompts, one per line, that are generated from in a batch
+	FlagBatch = flag.String("batch", "", "generate from each line of a prompts file with the mode flags and write json lines")
+	// FlagBatchOut is the json lines file of the batch results
+	FlagBatchOut = flag.String("batchout", "", "the json lines file the batch results are written to, stdout if empty")
+	// FlagMaxOrder caps the context length of the inference lookups
+	FlagMaxOrder = flag.Int("max-order", 0, "the longest context the inference lookups use, shorter than the trained order backs off sooner, 0 uses the trained order")
+	// FlagCheckpoint checkpoints learning periodically
+	FlagCheckpoint = flag.Int("checkpoint", 0, "checkpoint -learn to the model path with a .checkpoint suffix every this many articles, 0 disables")
+	// FlagResume resumes learning from the checkpoint
+	FlagResume = flag.Bool("resume", false, "resume -learn from the checkpoint of the model, if there is one")
+	// FlagStream streams the learned model into the bolt file
+	FlagStream = flag.Bool("stream", false, "stream the evicted vectors of -learn into the model file instead of keeping the model in memory, an existing model is added to")
+	// FlagRedact are the delimiters of the spans of the training data that aren't learned
+	FlagRedact = flag.String("redact", "", "skip the spans of the training data between an open and close delimiter separated by a comma, e.g. ␂,␃")
+	// FlagNamespace selects a named model of the model file
+	FlagNamespace = flag.String("namespace", "", "learn, generate and evaluate a named model of the model file, so many models share one file")
+	// FlagShard learns a shard of the articles
+	FlagShard = flag.String("shard", "", "learn the i/n shard of the articles, e.g. 3/8, so shards can be learned separately and merged")
+	// FlagMerge merges models
+	FlagMerge = flag.Bool("merge", false, "merge the model files given as arguments into a new -model by summing their histograms")
+	// FlagWatch is the corpus directory the daemon retrains from
+	FlagWatch = flag.String("watch", "", "retrain -model from the files of a corpus directory every -interval, serving it with -serve")
+	// FlagInterval is the retraining interval of the daemon
+	FlagInterval = flag.Duration("interval", 24*time.Hour, "the interval between the retrainings of -watch")
+	// FlagGenerations is the number of previous models kept by the daemon
+	FlagGenerations = flag.Int("generations", 3, "the number of previous models -watch keeps for rollback, named after the model with a timestamp suffix")
+	// FlagPassages cuts the -context file into passages of about this many bytes at entropy minima
+	FlagPassages = flag.Int("passages", 0, "cut the -context file into passages of about this many bytes at entropy minima")
+	// FlagRetrieval benchmarks the retrieval of squad answers from the passages against fixed size passages
+	FlagRetrieval = flag.String("retrieval", "", "squad file to benchmark the retrieval of answers from -passages against fixed size passages")
+	// FlagProfileGen writes the time of each phase of the search for each emitted byte in folded stack format
+	FlagProfileGen = flag.String("profile-gen", "", "write the time of each phase of the search for each emitted byte to a folded stack file for flame graph tools")
+	// FlagAlphabetFromInput restricts the generated bytes to the bytes of the prompt, whitespace and punctuation
+	FlagAlphabetFromInput = flag.Bool("alphabet-from-input", false, "restrict the generated bytes to the bytes of the prompt, whitespace and punctuation")
+	// FlagAMP runs the dot products of the self entropy kernel in float32 with the entropies in float64
+	FlagAMP = flag.Bool("amp", false, "run the dot products of the self entropy kernel in float32, checked against float64")
+	// FlagAMPTolerance is the relative error of the mixed precision kernel above which it falls back to float64
+	FlagAMPTolerance = flag.Float64("amp-tolerance", 1e-4, "relative error of the mixed precision kernel above which it falls back to float64")
+	// FlagAMPInterval is the number of mixed precision evaluations between float64 reference evaluations
+	FlagAMPInterval = flag.Int("amp-interval", 100, "number of mixed precision evaluations between float64 reference evaluations")
+	// FlagGate is the held out text of the quality gate of the commands that transform a model
+	FlagGate = flag.String("gate", "", "held out text file, a merged or retrained model with worse bits per byte than its source isn't written")
+	// FlagGateThreshold is the tolerated relative increase of the held out bits per byte
+	FlagGateThreshold = flag.Float64("gate-threshold", .01, "tolerated relative increase of the held out bits per byte of the quality gate")
+	// FlagForce writes a model that fails the quality gate
+	FlagForce = flag.Bool("force", false, "write a model that fails the quality gate")
+	// FlagDedup learns the near duplicate articles only once
+	FlagDedup = flag.Bool("dedup", false, "learn the near duplicate articles only once, they are found with minhash signatures of word shingles")
+	// FlagDedupThreshold is the estimated jaccard similarity above which an article is a duplicate
+	FlagDedupThreshold = flag.Float64("dedup-threshold", .8, "estimated jaccard similarity of the word shingles above which an article is a duplicate")
+	// FlagHoldout is the fraction of the articles held out from learning to evaluate the model on
+	FlagHoldout = flag.Float64("holdout", 0, "hold out a fraction of the articles from learning and report the self entropy and perplexity of the model on them")
+	// FlagControl is the control socket of -learn
+	FlagControl = flag.String("control", "", "serve status, pause, resume, resize <entries> and finalize commands for -learn on a unix socket")
+	// FlagArtifacts manages the cached artifacts
+	FlagArtifacts = flag.String("artifacts", "", "ls lists the cached artifacts, clean or clean:kind,... removes them")
 )
 
 type Result struct {
 	Entropy float64
 	Symbols []float64
 	Output  []byte
+	// Panic is the panic of the search goroutine that computed the result
+	Panic interface{}
 }
 
 const (
@@ -96,10 +384,349 @@ const (
 	Eta = .00001
 )
 
+func init() {
+	matrix.Broadcast, matrix.Kahan, matrix.Deterministic = FlagBroadcast, FlagKahan, FlagDeterministic
+	matrix.ParallelRows = FlagParallelRows
+}
+
+// ModeName returns the name of the mode of the mode flags, empty if no mode is set
+func ModeName() string {
+	switch {
+	case *FlagMarkov:
+		return "markov"
+	case *FlagAttention && *FlagComplex:
+		return "complex"
+	case *FlagAttention:
+		return "attention"
+	case *FlagMutual:
+		return "mutual"
+	case *FlagMeta:
+		return "meta"
+	case *FlagDiffusion && *FlagComplex:
+		return "complex-diffusion"
+	case *FlagDiffusion:
+		return "diffusion"
+	}
+	return ""
+}
+
+// Generator returns the generation function for the mode flags
+func Generator() func() {
+	return Modes[ModeName()]
+}
+
 func main() {
+	defer Handle()
 	flag.Parse()
 
-	if *FlagMarkov {
+	if *FlagConfig != "" {
+		if err := ApplyConfig(flag.CommandLine, *FlagConfig); err != nil {
+			Fail(ExitFlags, err)
+		}
+	}
+	if *FlagMode != "" {
+		if err := SetMode(flag.CommandLine, *FlagMode); err != nil {
+			Fail(ExitFlags, err)
+		}
+	}
+	ctx, restore := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer restore()
+	go func(interrupted context.Context) {
+		// after the first interrupt the default handling is restored, so a second one exits right away
+		<-interrupted.Done()
+		restore()
+	}(ctx)
+	if *FlagTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *FlagTimeout)
+		defer cancel()
+	}
+	Context = ctx
+	if err := SetNamespace(*FlagNamespace); err != nil {
+		Fail(ExitFlags, err)
+	}
+	if *FlagOffline {
+		Offline()
+	}
+	if err := ResolveArtifacts(); err != nil {
+		Fail(ExitData, err)
+	}
+	if *FlagArtifacts != "" {
+		artifacts()
+		return
+	}
+	if err := SetConcurrency(*FlagConcurrency); err != nil {
+		Fail(ExitFlags, err)
+	}
+	if err := SetWorkers(*FlagWorkers); err != nil {
+		Fail(ExitFlags, err)
+	}
+	if *FlagLRU < 1 {
+		Fail(ExitFlags, errors.New("the lru size should be at least 1"))
+	}
+	if *FlagVectorCache > 0 {
+		VectorCache = NewVectorLRU(*FlagVectorCache << 20)
+	}
+	if *FlagAMP {
+		if *FlagAMPTolerance < 0 || *FlagAMPInterval < 1 {
+			Fail(ExitFlags, errors.New("the mixed precision tolerance can't be negative and the interval should be at least 1"))
+		}
+		matrix.AMP = matrix.NewPrecision(*FlagAMPTolerance, *FlagAMPInterval)
+		defer func() {
+			amp := matrix.AMP
+			amp.Lock()
+			defer amp.Unlock()
+			fmt.Fprintf(os.Stderr, "mixed precision: %d evaluations, %d checks, max relative error %g\n",
+				amp.Evaluations, amp.Checks, amp.MaxError)
+			if amp.Fallback {
+				fmt.Fprintln(os.Stderr, "mixed precision fell back to float64, the error exceeded the tolerance")
+			}
+		}()
+	}
+	if *FlagDedup {
+		dedup, err := NewDeduplicator(*FlagDedupThreshold)
+		if err != nil {
+			Fail(ExitFlags, err)
+		}
+		ArticleDedup = dedup
+	}
+	if *FlagGate != "" {
+		gate, err := NewQualityGate(*FlagGate, *FlagGateThreshold)
+		if err != nil {
+			Fail(ExitFlags, err)
+		}
+		ModelGate = gate
+	}
+	if *FlagProfileGen != "" {
+		GenerationProfile = NewProfile()
+		defer func() {
+			if err := GenerationProfile.Save(*FlagProfileGen); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+		}()
+	}
+	if *FlagCandidateFloor < 0 || *FlagCandidateFloor > math.MaxUint16 {
+		Fail(ExitFlags, errors.New("the candidate floor should be a count"))
+	}
+	if *FlagNBest < 0 {
+		Fail(ExitFlags, errors.New("the n-best output should be a number of paths"))
+	}
+	if *FlagDiversity < 0 {
+		Fail(ExitFlags, errors.New("the diversity penalty can't be negative"))
+	}
+	if *FlagScorer != "" {
+		if *FlagScorerWeight < 0 || *FlagScorerWeight > 1 {
+			Fail(ExitFlags, errors.New("the scorer weight should be in [0, 1]"))
+		}
+		scorer, err := NewScorer(*FlagScorer)
+		if err != nil {
+			Fail(ExitScorer, err)
+		}
+		ExternalScorer = scorer
+	}
+	if *FlagPostCmd != "" {
+		post, err := NewPostProcessor(*FlagPostCmd, *FlagPostTimeout, *FlagPostPolicy)
+		if err != nil {
+			Fail(ExitFlags, err)
+		}
+		PostProcess = post
+	}
+	if *FlagPrefilter < 0 {
+		Fail(ExitFlags, errors.New("the prefilter should be a number of candidates"))
+	}
+	if *FlagPrivacyEpsilon != 0 {
+		privacy, err := NewPrivacy(*FlagPrivacyEpsilon, *FlagPrivacyThreshold, PrivacySource())
+		if err != nil {
+			Fail(ExitFlags, err)
+		}
+		ModelPrivacy = privacy
+	}
+	if *FlagRedact != "" {
+		redaction, err := ParseRedaction(*FlagRedact)
+		if err != nil {
+			Fail(ExitFlags, err)
+		}
+		LearnRedaction = redaction
+	}
+	if *FlagSmoothing != "" {
+		smoother, err := NewSmoother(*FlagSmoothing, *FlagSmoothingK)
+		if err != nil {
+			Fail(ExitFlags, err)
+		}
+		ModelSmoother = smoother
+	}
+	if *FlagSample {
+		sampler, err := NewSampler(*FlagSeed, *FlagTemperature, *FlagTopK, *FlagTopP)
+		if err != nil {
+			Fail(ExitFlags, err)
+		}
+		OutputSampler = sampler
+	}
+	if *FlagDepth < 1 {
+		Fail(ExitFlags, errors.New("the depth of the search should be at least 1"))
+	}
+	Depth = *FlagDepth
+	if (*FlagResume || *FlagCheckpoint > 0) && (*FlagCurriculum || *FlagComplex || *FlagDomains != "") {
+		Fail(ExitFlags, errors.New("only the sequential and random learners can be checkpointed"))
+	}
+	if *FlagShard != "" {
+		if *FlagCurriculum || *FlagComplex || *FlagDomains != "" {
+			Fail(ExitFlags, errors.New("only the sequential and random learners can learn a shard"))
+		}
+		shard, err := ParseArticleShard(*FlagShard)
+		if err != nil {
+			Fail(ExitFlags, err)
+		}
+		LearnShard = shard
+	}
+	if *FlagHoldout != 0 {
+		if *FlagComplex || *FlagDomains != "" {
+			Fail(ExitFlags, errors.New("only the markov learners can hold out articles"))
+		}
+		holdout, err := NewHoldout(*FlagHoldout)
+		if err != nil {
+			Fail(ExitFlags, err)
+		}
+		LearnHoldout = holdout
+	}
+	if *FlagLearn && SourceData() && (*FlagRandom || *FlagCurriculum || *FlagComplex || *FlagDomains != "" || *FlagShard != "") {
+		Fail(ExitFlags, errors.New("several data sources, WARC and text data are learned sequentially, the other learners need the articles of one zim file"))
+	}
+	if *FlagStream && (*FlagCurriculum || *FlagComplex || *FlagDomains != "") {
+		Fail(ExitFlags, errors.New("only the sequential and random learners can stream"))
+	}
+	if *FlagStream && (*FlagResume || *FlagCheckpoint > 0 || *FlagSmoothing != "" || *FlagPrivacyEpsilon != 0) {
+		Fail(ExitFlags, errors.New("a streamed model can't be checkpointed, smoothed or noised, it is never whole in memory"))
+	}
+	if *FlagLangID != "" && (*FlagCache != "" || *FlagRoute) {
+		Fail(ExitFlags, errors.New("the language models can't share an inference cache or be routed"))
+	}
+	if *FlagZScore <= 0 {
+		Fail(ExitFlags, errors.New("the anomaly z-score should be positive"))
+	}
+	if *FlagMaxOrder != 0 && (*FlagMaxOrder < 2 || *FlagMaxOrder > Order) {
+		Fail(ExitFlags, fmt.Errorf("the max order should be in [2, %d]", Order))
+	}
+	if *FlagFilter != "" {
+		OutputFilter = NewFilter(*FlagFilter)
+	}
+	if err := SetPadSymbol(*FlagPad); err != nil {
+		Fail(ExitFlags, err)
+	}
+	prompt, err := ReadPrompt(os.Stdin)
+	if err != nil {
+		Fail(ExitData, err)
+	}
+	if prompt, err = NormalizePrompt(prompt); err != nil {
+		Fail(ExitFlags, err)
+	}
+	*FlagInput = string(prompt)
+	measure, err := matrix.ParseMeasure(*FlagEntropyMeasure)
+	if err != nil {
+		Fail(ExitFlags, err)
+	}
+	matrix.EntropyMeasure = measure
+	if *FlagVocab != "" {
+		Vocabulary = NewVocabulary(*FlagVocab)
+	}
+	if *FlagSchema != "" {
+		OutputSchema = NewSchema(*FlagSchema)
+	}
+	if *FlagAlphabetFromInput {
+		InputAlphabet = NewAlphabet(prompt)
+	}
+
+	if *FlagCache != "" {
+		InferenceCache = LoadCache(*FlagCache, CacheModel(*FlagModel), *FlagCacheSize)
+		defer func() {
+			if err := InferenceCache.Save(*FlagCache); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+		}()
+	}
+
+	if *FlagControl != "" {
+		if !*FlagLearn {
+			Fail(ExitFlags, errors.New("the control socket supervises -learn"))
+		}
+		listener, err := Supervision.Listen(*FlagControl)
+		if err != nil {
+			Fail(ExitData, err)
+		}
+		defer listener.Close()
+		progress := OnProgress
+		OnProgress = func(p Progress) {
+			Supervision.Report(p)
+			progress(p)
+		}
+	}
+	if *FlagWatch != "" {
+		daemon()
+		return
+	} else if *FlagGRPC != "" {
+		serveRPC()
+		return
+	} else if *FlagServe != "" {
+		serve()
+		return
+	} else if *FlagNormalize {
+		normalize()
+		return
+	} else if *FlagGolden != "" {
+		golden()
+		return
+	} else if *FlagQuickstart != "" {
+		quickstart()
+		return
+	} else if *FlagMerge {
+		merge()
+		return
+	} else if *FlagBatch != "" {
+		batch()
+		return
+	} else if *FlagAudit {
+		audit(Generator())
+		return
+	} else if *FlagWhy {
+		why(Generator())
+		return
+	} else if *FlagBench != "" {
+		bench()
+		return
+	} else if *FlagExplore {
+		explore()
+		return
+	} else if *FlagEval != "" {
+		eval()
+		return
+	} else if *FlagHeatmap != "" {
+		heatmap()
+		return
+	} else if *FlagLandscape != "" {
+		landscape()
+		return
+	} else if *FlagRecommend {
+		recommend()
+		return
+	} else if *FlagScan {
+		scan()
+		return
+	} else if *FlagConfidence {
+		confidence()
+		return
+	} else if *FlagMixture != "" {
+		mixture()
+		return
+	} else if *FlagWhiten > 0 {
+		whiten()
+		return
+	} else if *FlagExtract {
+		extract()
+		return
+	} else if *FlagPassages != 0 {
+		passages()
+		return
+	} else if *FlagMarkov {
 		markov()
 		return
 	} else if *FlagAttention && *FlagComplex {
@@ -112,68 +739,31 @@ func main() {
 	} else if *FlagMeta {
 		markovDirectSelfEntropy()
 		return
+	} else if *FlagDiffusion && *FlagComplex {
+		markovComplexSelfEntropyDiffusion()
+		return
 	} else if *FlagDiffusion {
 		markovSelfEntropyDiffusion()
 		return
 	} else if *FlagPageRank {
-		db, err := bolt.Open(*FlagModel, 0600, nil)
-		if err != nil {
-			panic(err)
-		}
+		db := OpenModel(*FlagModel)
 		defer db.Close()
 
-		lookup := func(symbol Symbols) (found bool, vector []float64) {
-			var decoded [Width]uint16
-			db.View(func(tx *bolt.Tx) error {
-				b := tx.Bucket([]byte("markov"))
-				v := b.Get(symbol[:])
-				if v != nil {
-					found = true
-					index, buffer, output := 0, bytes.NewBuffer(v), make([]byte, 2*Width)
-					compress.Mark1Decompress1(buffer, output)
-					for key := range decoded {
-						decoded[key] = uint16(output[index])
-						index++
-						decoded[key] |= uint16(output[index]) << 8
-						index++
-					}
-					return nil
-				}
-				return nil
-			})
-			if !found {
-				return found, nil
-			}
-			vector, sum := make([]float64, Width), float64(0.0)
-			for key, value := range decoded {
-				v := float64(value)
-				sum += v * v
-				vector[key] = v
-			}
-			length := math.Sqrt(sum)
-			for i, v := range vector {
-				vector[i] = v / length
-			}
-			return found, vector
+		vectors, err := BigramVectors(db)
+		if err != nil {
+			Fail(ExitCorruptModel, err)
+		}
+		contexts := make([]int, 0, len(vectors))
+		for key := range vectors {
+			contexts = append(contexts, key)
 		}
+		sort.Ints(contexts)
 
 		graph := pagerank.NewGraph64()
-		for i := 0; i < Width*Width; i++ {
-			x := Symbols{}
-			x[len(Indexes)-2] = byte(i >> 8)
-			x[len(Indexes)-1] = byte(i & 0xff)
-			found, a := lookup(x)
-			if !found {
-				continue
-			}
-			for j := 0; j < Width*Width; j++ {
-				y := Symbols{}
-				y[len(Indexes)-2] = byte(j >> 8)
-				y[len(Indexes)-1] = byte(j & 0xff)
-				found, b := lookup(y)
-				if !found {
-					continue
-				}
+		for _, i := range contexts {
+			a := vectors[i]
+			for _, j := range contexts {
+				b := vectors[j]
 				sum := 0.0
 				for k, value := range a {
 					sum += value * b[k]
@@ -181,7 +771,9 @@ func main() {
 				graph.Link(uint64(i), uint64(j), sum)
 			}
 		}
-		fmt.Println("graph built")
+		if !*FlagJSON {
+			fmt.Println("graph built")
+		}
 		type Node struct {
 			Node int
 			Rank float64
@@ -193,11 +785,29 @@ func main() {
 				Rank: rank,
 			})
 		})
-		fmt.Println("ranking done")
+		if !*FlagJSON {
+			fmt.Println("ranking done")
+		}
 		sort.Slice(nodes, func(i, j int) bool {
 			return nodes[i].Rank > nodes[j].Rank
 		})
-		fmt.Println("sorting done")
+		if !*FlagJSON {
+			fmt.Println("sorting done")
+		}
+		if *FlagJSON {
+			encoder := json.NewEncoder(Output)
+			for _, node := range nodes {
+				err := encoder.Encode(struct {
+					Node    int     `json:"node"`
+					Rank    float64 `json:"rank"`
+					Elapsed float64 `json:"elapsed"`
+				}{node.Node, node.Rank, time.Since(Start).Seconds()})
+				if err != nil {
+					panic(err)
+				}
+			}
+			return
+		}
 		output, err := os.Create("output.txt")
 		if err != nil {
 			panic(err)
@@ -222,19 +832,31 @@ func main() {
 		}
 		defer db.Close()
 		db.Update(func(tx *bolt.Tx) error {
-			_, err := tx.CreateBucket([]byte("markov"))
+			_, err := tx.CreateBucket(ModelBucket)
 			if err != nil {
 				panic(err)
 			}
 			return nil
 		})
+		WriteMetadata(db, "complex", NewComplexParameters())
 		fmt.Println("write file")
 		type Pair struct {
 			Key   []byte
 			Value []byte
 		}
 		length, count, i, pairs := len(s), 0, 0, [1024]Pair{}
-		for key, value := range s {
+		keys := make([]ComplexSymbols, 0, len(s))
+		for key := range s {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			if a, b := Shard(keys[i][:])[0], Shard(keys[j][:])[0]; a != b {
+				return a < b
+			}
+			return bytes.Compare(keys[i][:], keys[j][:]) < 0
+		})
+		for n, key := range keys {
+			value := s[key]
 			k := make([]byte, len(key))
 			copy(k, key[:])
 			pairs[i].Key = k
@@ -264,13 +886,14 @@ func main() {
 			delete(s, key)
 			i++
 			count++
-			if i == len(pairs) {
+			// the pairs are flushed at the end of each shard, so a transaction writes one shard deterministically
+			if i == len(pairs) || (n+1 < len(keys) && Shard(keys[n+1][:])[0] != Shard(key[:])[0]) {
 				db.Update(func(tx *bolt.Tx) error {
-					b := tx.Bucket([]byte("markov"))
-					for _, pair := range pairs {
+					put := Putter(tx.Bucket(ModelBucket))
+					for _, pair := range pairs[:i] {
 						buffer := bytes.Buffer{}
 						compress.Mark1Compress1(pair.Value, &buffer)
-						err := b.Put(pair.Key, buffer.Bytes())
+						err := put(pair.Key, buffer.Bytes())
 						if err != nil {
 							return err
 						}
@@ -283,11 +906,11 @@ func main() {
 		}
 		if i > 0 {
 			db.Update(func(tx *bolt.Tx) error {
-				b := tx.Bucket([]byte("markov"))
+				put := Putter(tx.Bucket(ModelBucket))
 				for _, pair := range pairs[:i] {
 					buffer := bytes.Buffer{}
 					compress.Mark1Compress1(pair.Value, &buffer)
-					err := b.Put(pair.Key, buffer.Bytes())
+					err := put(pair.Key, buffer.Bytes())
 					if err != nil {
 						return err
 					}
@@ -296,15 +919,72 @@ func main() {
 			})
 		}
 		fmt.Println("done writing file")
+		Check()
+		return
+	} else if *FlagLearn && *FlagDomains != "" {
+		models := NewDomainSymbolVectorsRandom(ParseDomains(*FlagDomains))
+		db, err := bolt.Open(*FlagModel, 0666, nil)
+		if err != nil {
+			panic(err)
+		}
+		defer db.Close()
+		for name, model := range models {
+			bucket := ModelBucket
+			if name != "" {
+				bucket = DomainBucket(name)
+			}
+			fmt.Println("write", string(bucket))
+			WriteModel(db, bucket, model)
+		}
+		fmt.Println("done writing file")
+		Check()
+		return
+	} else if *FlagLearn && *FlagStream {
+		db, err := bolt.Open(*FlagModel, 0666, nil)
+		if err != nil {
+			panic(err)
+		}
+		defer db.Close()
+		if err := CheckShape(db); err != nil {
+			Fail(ExitCorruptModel, fmt.Errorf("%s: %w", *FlagModel, err))
+		}
+		if ModelStore, err = NewStore(db, ModelBucket); err != nil {
+			panic(err)
+		}
+		var s LRU
+		if SourceData() {
+			s = NewSymbolVectorsSources()
+		} else if *FlagRandom {
+			s = NewSymbolVectorsRandom()
+		} else {
+			s = NewSymbolVectors()
+		}
+		s.Close()
+		MergeEnds(db, ModelBucket, s.Ends)
+		WriteMetadata(db, "shape", CurrentShape())
+		fmt.Println("done writing file")
+		LearnHoldout.Report(db)
+		Check()
 		return
 	} else if *FlagLearn {
 		var s LRU
-		if *FlagRandom {
+		if SourceData() {
+			s = NewSymbolVectorsSources()
+		} else if *FlagCurriculum {
+			s = NewSymbolVectorsCurriculum()
+		} else if *FlagRandom {
 			s = NewSymbolVectorsRandom()
 		} else {
 			s = NewSymbolVectors()
 		}
 		s.Close()
+		if ModelPrivacy != nil {
+			ModelPrivacy.Apply(s.Model)
+			ModelPrivacy.NoiseEnds(s.Ends)
+		}
+		if ModelSmoother != nil {
+			ModelSmoother.Apply(s.Model)
+		}
 
 		fmt.Println("done building")
 		db, err := bolt.Open(*FlagModel, 0666, nil)
@@ -313,7 +993,13 @@ func main() {
 		}
 		defer db.Close()
 		db.Update(func(tx *bolt.Tx) error {
-			_, err := tx.CreateBucket([]byte("markov"))
+			// a resumed run may have crashed while writing, the checkpoint has the whole model
+			if *FlagResume {
+				if err := tx.DeleteBucket(ModelBucket); err != nil && err != bolt.ErrBucketNotFound {
+					panic(err)
+				}
+			}
+			_, err := tx.CreateBucket(ModelBucket)
 			if err != nil {
 				panic(err)
 			}
@@ -325,7 +1011,9 @@ func main() {
 			Value []byte
 		}
 		length, count, i, pairs := len(s.Model), 0, 0, [1024]Pair{}
-		for key, value := range s.Model {
+		keys := SortedKeys(s.Model)
+		for n, key := range keys {
+			value := s.Model[key]
 			k := make([]byte, len(key))
 			copy(k, key[:])
 			pairs[i].Key = k
@@ -333,11 +1021,12 @@ func main() {
 			delete(s.Model, key)
 			i++
 			count++
-			if i == len(pairs) {
+			// the pairs are flushed at the end of each shard, so a transaction writes one shard deterministically
+			if i == len(pairs) || (n+1 < len(keys) && Shard(keys[n+1][:])[0] != Shard(key[:])[0]) {
 				db.Update(func(tx *bolt.Tx) error {
-					b := tx.Bucket([]byte("markov"))
-					for _, pair := range pairs {
-						err := b.Put(pair.Key, pair.Value)
+					put := Putter(tx.Bucket(ModelBucket))
+					for _, pair := range pairs[:i] {
+						err := put(pair.Key, pair.Value)
 						if err != nil {
 							return err
 						}
@@ -350,9 +1039,9 @@ func main() {
 		}
 		if i > 0 {
 			db.Update(func(tx *bolt.Tx) error {
-				b := tx.Bucket([]byte("markov"))
+				put := Putter(tx.Bucket(ModelBucket))
 				for _, pair := range pairs[:i] {
-					err := b.Put(pair.Key, pair.Value)
+					err := put(pair.Key, pair.Value)
 					if err != nil {
 						return err
 					}
@@ -360,29 +1049,97 @@ func main() {
 				return nil
 			})
 		}
+		WriteEnds(db, ModelBucket, s.Ends)
+		WriteMetadata(db, "shape", CurrentShape())
+		if ModelPrivacy != nil {
+			WriteMetadata(db, "privacy", ModelPrivacy)
+		}
+		if ModelSmoother != nil {
+			WriteMetadata(db, "smoothing", ModelSmoother)
+		}
+		if !Canceled() {
+			RemoveCheckpoint()
+		}
 		fmt.Println("done writing file")
+		LearnHoldout.Report(db)
+		Check()
 		return
 	} else if *FlagSquare {
-		s := NewSquareRandom()
-		s.markovSelfEntropy()
-		return
-	} else if *FlagEntropy != "" {
-		db, err := bolt.Open(*FlagModel, 0600, nil)
+		SquareOffsets = ParseOffsets(*FlagOffsets)
+		if *FlagSquareModel == "" {
+			s := NewSquareRandom()
+			if *FlagProjection > 0 {
+				s.Projection = matrix.NewProjection(1, 1<<16, *FlagProjection)
+			}
+			s.markovSelfEntropy()
+			return
+		}
+		_, err := os.Stat(*FlagSquareModel)
+		exists := err == nil
+		db, err := bolt.Open(*FlagSquareModel, 0600, nil)
 		if err != nil {
 			panic(err)
 		}
 		defer db.Close()
+		var s *Square
+		if exists {
+			s = LoadSquare(db)
+			if s.Projection == nil && *FlagProjection > 0 {
+				s.Projection = matrix.NewProjection(1, 1<<16, *FlagProjection)
+			}
+		} else {
+			s = NewSquareRandom()
+			if *FlagProjection > 0 {
+				s.Projection = matrix.NewProjection(1, 1<<16, *FlagProjection)
+			}
+			s.Save(db)
+		}
+		s.markovSelfEntropy()
+		return
+	} else if *FlagExportEntropy != "" {
+		exportEntropy()
+		return
+	} else if *FlagScore != "" {
+		score()
+	} else if *FlagAnomalies != "" {
+		anomalies()
+	} else if *FlagLangID != "" {
+		langid()
+		return
+	} else if *FlagEntropy != "" {
+		db := OpenModel(*FlagModel)
+		defer db.Close()
+		RouteModel(db, []byte(*FlagEntropy))
 
 		input := []byte(*FlagEntropy)
+		if *FlagPositions {
+			if err := WritePositions(Output, PositionEntropies(db, input), *FlagJSON); err != nil {
+				panic(err)
+			}
+			return
+		}
+		if *FlagChunk > 0 {
+			total, windows := ChunkedSelfEntropy(db, input, *FlagChunk, *FlagOverlap)
+			if *FlagJSON {
+				EmitRecord(Record{Entropy: total / float64(len(input)), Scores: windows})
+				return
+			}
+			for i, entropy := range windows {
+				fmt.Println(i, entropy)
+			}
+			fmt.Println(total / float64(len(input)))
+			return
+		}
 		entropy := SelfEntropy(db, input, nil)
+		if *FlagJSON {
+			EmitRecord(Record{Entropy: entropy[0] / float64(len(input)), Scores: DirectSelfEntropy(db, input, nil)})
+			return
+		}
 		fmt.Println(entropy[0] / float64(len(input)))
 		return
 	}
 
-	db, err := bolt.Open(*FlagModel, 0600, nil)
-	if err != nil {
-		panic(err)
-	}
+	db := OpenModel(*FlagModel)
 	defer db.Close()
 
 	data, err := ioutil.ReadFile("train-v2.0.json")
@@ -423,7 +1180,7 @@ func main() {
 	for _, w := range set.Weights {
 		if strings.HasPrefix(w.N, "b") {
 			w.X = w.X[:cap(w.X)]
-			w.States = make([][]float32, StateTotal)
+			w.States = make([][]float32, matrix.StateTotal)
 			for i := range w.States {
 				w.States[i] = make([]float32, len(w.X))
 			}
@@ -433,7 +1190,7 @@ func main() {
 		for i := 0; i < cap(w.X); i++ {
 			w.X = append(w.X, float32((2*rnd.Float64()-1)*factor))
 		}
-		w.States = make([][]float32, StateTotal)
+		w.States = make([][]float32, matrix.StateTotal)
 		for i := range w.States {
 			w.States[i] = make([]float32, len(w.X))
 		}
@@ -502,10 +1259,10 @@ func main() {
 		for j, w := range set.Weights {
 			for k, d := range w.D {
 				g := d * scaling
-				m := B1*w.States[StateM][k] + (1-B1)*g
-				v := B2*w.States[StateV][k] + (1-B2)*g*g
-				w.States[StateM][k] = m
-				w.States[StateV][k] = v
+				m := B1*w.States[matrix.StateM][k] + (1-B1)*g
+				v := B2*w.States[matrix.StateV][k] + (1-B2)*g*g
+				w.States[matrix.StateM][k] = m
+				w.States[matrix.StateV][k] = v
 				mhat := m / (1 - b1)
 				vhat := v / (1 - b2)
 				set.Weights[j].X[k] -= Eta * mhat / (float32(math.Sqrt(float64(vhat))) + 1e-8)
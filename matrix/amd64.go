@@ -5,7 +5,7 @@
 //go:build amd64
 // +build amd64
 
-package main
+package matrix
 
 import (
 	"github.com/ziutek/blas"
@@ -15,6 +15,14 @@ func dot(X, Y []float64) float64 {
 	return blas.Ddot(len(X), X, 1, Y, 1)
 }
 
+func sdot(X, Y []float32) float32 {
+	return blas.Sdot(len(X), X, 1, Y, 1)
+}
+
+func scal(alpha float64, X []float64) {
+	blas.Dscal(len(X), alpha, X, 1)
+}
+
 func axpy(alpha float64, X []float64, Y []float64) {
 	blas.Daxpy(len(X), alpha, X, 1, Y, 1)
 }
@@ -2,7 +2,8 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
-package main
+// Package matrix implements the matrices and self entropy attention kernels
+package matrix
 
 import (
 	"fmt"
@@ -14,6 +15,17 @@ import (
 	"github.com/pointlander/pagerank"
 )
 
+var (
+	// Broadcast allows element wise operations to broadcast the second matrix over the first
+	Broadcast = new(bool)
+	// Kahan uses compensated summation in the kernels
+	Kahan = new(bool)
+	// Deterministic sums values in a fixed order independent of the partitioning across goroutines
+	Deterministic = new(bool)
+	// ParallelRows is the number of rows above which SelfEntropyKernel runs in parallel, 0 disables
+	ParallelRows = new(int)
+)
+
 const (
 	// S is the scaling factor for the softmax
 	S = 1.0 - 1e-300
@@ -77,7 +89,8 @@ func (m Matrix) Size() int {
 	return m.Cols * m.Rows
 }
 
-func softmax(values []float64) {
+// SoftmaxValues computes the softmax of values in place
+func SoftmaxValues(values []float64) {
 	max := 0.0
 	for _, v := range values {
 		if v > max {
@@ -95,9 +108,46 @@ func softmax(values []float64) {
 	}
 }
 
-// SelfEntropyKernel computes the self entropy of Q, K V
+// Accumulator is a running sum, with Kahan it uses compensated summation
+type Accumulator struct {
+	Sum          float64
+	compensation float64
+}
+
+// Add adds a value to the accumulator
+func (a *Accumulator) Add(value float64) {
+	if !*Kahan {
+		a.Sum += value
+		return
+	}
+	y := value - a.compensation
+	t := a.Sum + y
+	a.compensation = (t - a.Sum) - y
+	a.Sum = t
+}
+
+// SelfEntropyKernel computes the self entropy of Q, K V, in mixed precision if AMP is set
 func SelfEntropyKernel(Q, K, V, I Matrix) float64 {
-	entropies, values, sum := make([]float64, V.Cols), make([]float64, K.Rows), 0.0
+	if *ParallelRows > 0 && K.Rows > *ParallelRows {
+		return SelfEntropyKernelParallel(Q, K, V, I)
+	}
+	if AMP != nil {
+		if mixed, check := AMP.next(); mixed {
+			result := selfEntropyKernel32(Q, K, V, I)
+			if !check {
+				return result
+			}
+			reference := selfEntropyKernel64(Q, K, V, I)
+			AMP.record(result, reference)
+			return reference
+		}
+	}
+	return selfEntropyKernel64(Q, K, V, I)
+}
+
+// selfEntropyKernel64 computes the self entropy of Q, K, V in float64
+func selfEntropyKernel64(Q, K, V, I Matrix) float64 {
+	entropies, values, sum := make([]float64, V.Cols), make([]float64, K.Rows), Accumulator{}
 	V = T(V)
 	for i := 0; i < K.Rows; i++ {
 		K := K.Data[i*K.Cols : (i+1)*K.Cols]
@@ -105,21 +155,66 @@ func SelfEntropyKernel(Q, K, V, I Matrix) float64 {
 			Q := Q.Data[j*Q.Cols : (j+1)*Q.Cols]
 			values[j] = dot(K, Q)
 		}
-		softmax(values)
+		SoftmaxValues(values)
 
 		for j := 0; j < V.Rows; j++ {
 			V := V.Data[j*V.Cols : (j+1)*V.Cols]
 			entropies[j] = dot(values, V)
 		}
-		softmax(entropies)
+		SoftmaxValues(entropies)
 
-		entropy := 0.0
-		for _, e := range entropies {
-			entropy += e * math.Log(e)
-		}
-		sum -= entropy * I.Data[i]
+		sum.Add(-EntropyMeasure.Negentropy(entropies) * I.Data[i])
 	}
-	return sum
+	return sum.Sum
+}
+
+// SelfEntropyKernelParallel computes the self entropy of Q, K, V with the rows sharded across GOMAXPROCS workers.
+// The partial sums of the workers are added as the workers finish, so the result can change in the last bits from
+// run to run. With Deterministic the row entropies are summed with Sum, so the result doesn't depend on the
+// number of workers or the order they finish in.
+func SelfEntropyKernelParallel(Q, K, V, I Matrix) float64 {
+	results := make([]float64, K.Rows)
+	V = T(V)
+	workers := runtime.GOMAXPROCS(0)
+	if workers > K.Rows {
+		workers = K.Rows
+	}
+	shard, done := (K.Rows+workers-1)/workers, make(chan float64, workers)
+	for w := 0; w < workers; w++ {
+		end := (w + 1) * shard
+		if end > K.Rows {
+			end = K.Rows
+		}
+		go func(begin, end int) {
+			entropies, values, partial := make([]float64, V.Rows), make([]float64, Q.Rows), Accumulator{}
+			for i := begin; i < end; i++ {
+				K := K.Data[i*K.Cols : (i+1)*K.Cols]
+				for j := 0; j < Q.Rows; j++ {
+					Q := Q.Data[j*Q.Cols : (j+1)*Q.Cols]
+					values[j] = dot(K, Q)
+				}
+				SoftmaxValues(values)
+
+				for j := 0; j < V.Rows; j++ {
+					V := V.Data[j*V.Cols : (j+1)*V.Cols]
+					entropies[j] = dot(values, V)
+				}
+				SoftmaxValues(entropies)
+
+				results[i] = -EntropyMeasure.Negentropy(entropies) * I.Data[i]
+				partial.Add(results[i])
+			}
+			done <- partial.Sum
+		}(w*shard, end)
+	}
+	sum := Accumulator{}
+	for w := 0; w < workers; w++ {
+		sum.Add(<-done)
+	}
+	if *Deterministic {
+		return Sum(results)
+	}
+	return sum.Sum
 }
 
 // DirectSelfEntropyKernel computes the self entropy of Q, K, V
@@ -132,18 +227,15 @@ func DirectSelfEntropyKernel(Q, K, V, I Matrix) []float64 {
 			Q := Q.Data[j*Q.Cols : (j+1)*Q.Cols]
 			values[j] = dot(K, Q)
 		}
-		softmax(values)
+		SoftmaxValues(values)
 
 		for j := 0; j < V.Rows; j++ {
 			V := V.Data[j*V.Cols : (j+1)*V.Cols]
 			entropies[j] = dot(values, V)
 		}
-		softmax(entropies)
+		SoftmaxValues(entropies)
 
-		entropy := 0.0
-		for _, e := range entropies {
-			entropy += e * math.Log(e)
-		}
+		entropy := EntropyMeasure.Negentropy(entropies)
 		results = append(results, entropy)
 	}
 	if len(I.Data) > 0 {
@@ -156,27 +248,25 @@ func DirectSelfEntropyKernel(Q, K, V, I Matrix) []float64 {
 
 // DirectSelfEntropyKernelParallel computes the self entropy of Q, K, V in parallel
 func DirectSelfEntropyKernelParallel(Q, K, V, I Matrix) []float64 {
-	entropies, values, results := make([]float64, V.Cols), make([]float64, K.Rows), make([]float64, K.Rows)
+	results := make([]float64, K.Rows)
 	V = T(V)
 	done := make(chan bool, 8)
 	row := func(i int) {
+		entropies, values := make([]float64, V.Rows), make([]float64, Q.Rows)
 		K := K.Data[i*K.Cols : (i+1)*K.Cols]
 		for j := 0; j < Q.Rows; j++ {
 			Q := Q.Data[j*Q.Cols : (j+1)*Q.Cols]
 			values[j] = dot(K, Q)
 		}
-		softmax(values)
+		SoftmaxValues(values)
 
 		for j := 0; j < V.Rows; j++ {
 			V := V.Data[j*V.Cols : (j+1)*V.Cols]
 			entropies[j] = dot(values, V)
 		}
-		softmax(entropies)
+		SoftmaxValues(entropies)
 
-		entropy := 0.0
-		for _, e := range entropies {
-			entropy += e * math.Log(e)
-		}
+		entropy := EntropyMeasure.Negentropy(entropies)
 		results[i] = entropy
 		done <- true
 	}
@@ -204,6 +294,42 @@ func DirectSelfEntropyKernelParallel(Q, K, V, I Matrix) []float64 {
 	return results
 }
 
+// Unit scales a vector to unit length in place, the reciprocal of the norm is computed once
+// and the vector is scaled by it. A zero vector is left as is.
+func Unit(X []float64) {
+	sum := dot(X, X)
+	if sum == 0 {
+		return
+	}
+	scal(1/math.Sqrt(sum), X)
+}
+
+// Sum sums values, with Deterministic the values are summed in a fixed pairwise tree order
+// so that the result doesn't depend on how the values were partitioned across goroutines
+func Sum(values []float64) float64 {
+	if !*Deterministic {
+		sum := 0.0
+		for _, value := range values {
+			sum += value
+		}
+		return sum
+	}
+	return pairwise(values)
+}
+
+func pairwise(values []float64) float64 {
+	const Block = 8
+	if len(values) <= Block {
+		sum := 0.0
+		for _, value := range values {
+			sum += value
+		}
+		return sum
+	}
+	half := len(values) / 2
+	return pairwise(values[:half]) + pairwise(values[half:])
+}
+
 // https://arxiv.org/abs/1511.05042
 func spherical(values []float64) {
 	sum := 0.0
@@ -216,6 +342,29 @@ func spherical(values []float64) {
 	}
 }
 
+// CrossEntropyKernel computes the entropy of the queries Q attending to the keys K and values V
+func CrossEntropyKernel(Q, K, V, I Matrix) float64 {
+	entropies, values, sum := make([]float64, V.Cols), make([]float64, K.Rows), Accumulator{}
+	V = T(V)
+	for i := 0; i < Q.Rows; i++ {
+		Q := Q.Data[i*Q.Cols : (i+1)*Q.Cols]
+		for j := 0; j < K.Rows; j++ {
+			K := K.Data[j*K.Cols : (j+1)*K.Cols]
+			values[j] = dot(Q, K)
+		}
+		SoftmaxValues(values)
+
+		for j := 0; j < V.Rows; j++ {
+			V := V.Data[j*V.Cols : (j+1)*V.Cols]
+			entropies[j] = dot(values, V)
+		}
+		SoftmaxValues(entropies)
+
+		sum.Add(-EntropyMeasure.Negentropy(entropies) * I.Data[i])
+	}
+	return sum.Sum
+}
+
 // FastSelfEntropyKernel computes the fast self entropy of Q, K V
 func FastSelfEntropyKernel(Q, K, V, I Matrix) float64 {
 	entropies, values, sum := make([]float64, V.Cols), make([]float64, K.Rows), 0.0
@@ -243,11 +392,35 @@ func FastSelfEntropyKernel(Q, K, V, I Matrix) float64 {
 	return sum
 }
 
+// checkSize verifies the number of values of a matrix matches its shape
+func checkSize(op, name string, cols, rows, size int) {
+	if size != cols*rows {
+		panic(fmt.Errorf("%s: %s has %d values but is %dx%d", op, name, size, cols, rows))
+	}
+}
+
+// checkShape verifies the shapes of two matrices for an element wise operation
+func checkShape(op string, mCols, mRows, mSize, nCols, nRows, nSize int) {
+	checkSize(op, "m", mCols, mRows, mSize)
+	checkSize(op, "n", nCols, nRows, nSize)
+	if *Broadcast {
+		if nSize == 0 || mSize%nSize != 0 {
+			panic(fmt.Errorf("%s: can't broadcast n %dx%d over m %dx%d", op, nCols, nRows, mCols, mRows))
+		}
+		return
+	}
+	if mCols != nCols || mRows != nRows {
+		panic(fmt.Errorf("%s: m is %dx%d but n is %dx%d", op, mCols, mRows, nCols, nRows))
+	}
+}
+
 // Mul multiplies two matrices
 func Mul(m Matrix, n Matrix) Matrix {
 	if m.Cols != n.Cols {
-		panic(fmt.Errorf("%d != %d", m.Cols, n.Cols))
+		panic(fmt.Errorf("Mul: m.Cols %d != n.Cols %d", m.Cols, n.Cols))
 	}
+	checkSize("Mul", "m", m.Cols, m.Rows, len(m.Data))
+	checkSize("Mul", "n", n.Cols, n.Rows, len(n.Data))
 	columns := m.Cols
 	o := Matrix{
 		Cols: m.Rows,
@@ -267,10 +440,8 @@ func Mul(m Matrix, n Matrix) Matrix {
 
 // H element wise multiplies two matrices
 func H(m Matrix, n Matrix) Matrix {
-	lena, lenb := len(m.Data), len(n.Data)
-	if lena%lenb != 0 {
-		panic(fmt.Errorf("%d %% %d != 0", lena, lenb))
-	}
+	checkShape("H", m.Cols, m.Rows, len(m.Data), n.Cols, n.Rows, len(n.Data))
+	lenb := len(n.Data)
 
 	o := Matrix{
 		Cols: m.Cols,
@@ -285,10 +456,8 @@ func H(m Matrix, n Matrix) Matrix {
 
 // Add adds two matrices
 func Add(m Matrix, n Matrix) Matrix {
-	lena, lenb := len(m.Data), len(n.Data)
-	if lena%lenb != 0 {
-		panic(fmt.Errorf("%d %% %d != 0", lena, lenb))
-	}
+	checkShape("Add", m.Cols, m.Rows, len(m.Data), n.Cols, n.Rows, len(n.Data))
+	lenb := len(n.Data)
 
 	o := Matrix{
 		Cols: m.Cols,
@@ -303,10 +472,8 @@ func Add(m Matrix, n Matrix) Matrix {
 
 // Sub subtracts two matrices
 func Sub(m Matrix, n Matrix) Matrix {
-	lena, lenb := len(m.Data), len(n.Data)
-	if lena%lenb != 0 {
-		panic(fmt.Errorf("%d %% %d != 0", lena, lenb))
-	}
+	checkShape("Sub", m.Cols, m.Rows, len(m.Data), n.Cols, n.Rows, len(n.Data))
+	lenb := len(n.Data)
 
 	o := Matrix{
 		Cols: m.Cols,
@@ -566,6 +733,14 @@ func FastComplexSelfEntropyKernel(Q, K, V, I ComplexMatrix) float64 {
 		}
 		complexSpherical(entropies)
 
+		if EntropyMeasure.Kind != Shannon {
+			widened := make([]complex128, len(entropies))
+			for j, e := range entropies {
+				widened[j] = complex128(e)
+			}
+			sum -= complex64(EntropyMeasure.ComplexNegentropy(widened)) * I.Data[i]
+			continue
+		}
 		entropy := complex64(0.0)
 		for _, e := range entropies {
 			entropy += e * complex64(cmplx.Log(complex128(e)))
@@ -575,11 +750,52 @@ func FastComplexSelfEntropyKernel(Q, K, V, I ComplexMatrix) float64 {
 	return cmplx.Abs(complex128(sum))
 }
 
+// https://arxiv.org/abs/1511.05042
+func complexSpherical128(values []complex128) {
+	sum := complex128(0.0)
+	for j, value := range values {
+		values[j] = value*value/2 + value + 1
+		sum += values[j]
+	}
+	for j, value := range values {
+		values[j] = value / sum
+	}
+}
+
+// FastComplexSelfEntropyKernel128 computes the fast complex self entropy of Q, K V accumulating in complex128
+func FastComplexSelfEntropyKernel128(Q, K, V, I ComplexMatrix) float64 {
+	entropies, values, sum := make([]complex128, V.Cols), make([]complex128, K.Rows), complex128(0.0)
+	V = ComplexT(V)
+	for i := 0; i < K.Rows; i++ {
+		K := K.Data[i*K.Cols : (i+1)*K.Cols]
+		for j := 0; j < Q.Rows; j++ {
+			Q := Q.Data[j*Q.Cols : (j+1)*Q.Cols]
+			for k, value := range K {
+				values[j] += complex128(value) * complex128(Q[k])
+			}
+		}
+		complexSpherical128(values)
+
+		for j := 0; j < V.Rows; j++ {
+			V := V.Data[j*V.Cols : (j+1)*V.Cols]
+			for k, value := range values {
+				entropies[j] += value * complex128(V[k])
+			}
+		}
+		complexSpherical128(entropies)
+
+		sum -= EntropyMeasure.ComplexNegentropy(entropies) * complex128(I.Data[i])
+	}
+	return cmplx.Abs(sum)
+}
+
 // ComplexMul multiplies two complex matrices
 func ComplexMul(m ComplexMatrix, n ComplexMatrix) ComplexMatrix {
 	if m.Cols != n.Cols {
-		panic(fmt.Errorf("%d != %d", m.Cols, n.Cols))
+		panic(fmt.Errorf("ComplexMul: m.Cols %d != n.Cols %d", m.Cols, n.Cols))
 	}
+	checkSize("ComplexMul", "m", m.Cols, m.Rows, len(m.Data))
+	checkSize("ComplexMul", "n", n.Cols, n.Rows, len(n.Data))
 	columns := m.Cols
 	o := ComplexMatrix{
 		Cols: m.Rows,
@@ -602,10 +818,8 @@ func ComplexMul(m ComplexMatrix, n ComplexMatrix) ComplexMatrix {
 
 // ComplexH element wise multiplies two complex matrices
 func ComplexH(m ComplexMatrix, n ComplexMatrix) ComplexMatrix {
-	lena, lenb := len(m.Data), len(n.Data)
-	if lena%lenb != 0 {
-		panic(fmt.Errorf("%d %% %d != 0", lena, lenb))
-	}
+	checkShape("ComplexH", m.Cols, m.Rows, len(m.Data), n.Cols, n.Rows, len(n.Data))
+	lenb := len(n.Data)
 
 	o := ComplexMatrix{
 		Cols: m.Cols,
@@ -620,10 +834,8 @@ func ComplexH(m ComplexMatrix, n ComplexMatrix) ComplexMatrix {
 
 // ComplexAdd adds two complex matrices
 func ComplexAdd(m ComplexMatrix, n ComplexMatrix) ComplexMatrix {
-	lena, lenb := len(m.Data), len(n.Data)
-	if lena%lenb != 0 {
-		panic(fmt.Errorf("%d %% %d != 0", lena, lenb))
-	}
+	checkShape("ComplexAdd", m.Cols, m.Rows, len(m.Data), n.Cols, n.Rows, len(n.Data))
+	lenb := len(n.Data)
 
 	o := ComplexMatrix{
 		Cols: m.Cols,
@@ -638,10 +850,8 @@ func ComplexAdd(m ComplexMatrix, n ComplexMatrix) ComplexMatrix {
 
 // ComplexSub subtracts two complex matrices
 func ComplexSub(m ComplexMatrix, n ComplexMatrix) ComplexMatrix {
-	lena, lenb := len(m.Data), len(n.Data)
-	if lena%lenb != 0 {
-		panic(fmt.Errorf("%d %% %d != 0", lena, lenb))
-	}
+	checkShape("ComplexSub", m.Cols, m.Rows, len(m.Data), n.Cols, n.Rows, len(n.Data))
+	lenb := len(n.Data)
 
 	o := ComplexMatrix{
 		Cols: m.Cols,
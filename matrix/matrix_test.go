@@ -0,0 +1,340 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package matrix
+
+import (
+	"math"
+	"math/big"
+	"math/rand"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestShapeChecking(t *testing.T) {
+	expect := func(message string, f func()) {
+		defer func() {
+			r := recover()
+			if r == nil {
+				t.Fatal("expected panic", message)
+			}
+			if err, ok := r.(error); !ok || !strings.Contains(err.Error(), message) {
+				t.Fatal("unexpected panic", r)
+			}
+		}()
+		f()
+	}
+	rnd := rand.New(rand.NewSource(1))
+	a, b := NewRandMatrix(rnd, 0, 4, 2), NewRandMatrix(rnd, 0, 4, 1)
+	expect("H: m is 4x2 but n is 4x1", func() {
+		H(a, b)
+	})
+	expect("Mul: m.Cols 4 != n.Cols 2", func() {
+		Mul(a, T(a))
+	})
+	c := a
+	c.Data = c.Data[:7]
+	expect("Add: m has 7 values but is 4x2", func() {
+		Add(c, a)
+	})
+
+	*Broadcast = true
+	defer func() {
+		*Broadcast = false
+	}()
+	o := H(a, b)
+	for i, value := range o.Data {
+		if value != a.Data[i]*b.Data[i%4] {
+			t.Fatal("invalid broadcast", i)
+		}
+	}
+	expect("Sub: can't broadcast n 3x1 over m 4x2", func() {
+		Sub(a, NewRandMatrix(rnd, 0, 3, 1))
+	})
+}
+
+func TestDirectSelfEntropyKernelParallel(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	weights, importance := NewRandMatrix(rnd, 0, 256, 32), NewRandMatrix(rnd, 0, 32, 1)
+	a := DirectSelfEntropyKernel(weights, weights, weights, importance)
+	b := DirectSelfEntropyKernelParallel(weights, weights, weights, importance)
+	for i, value := range a {
+		if value != b[i] {
+			t.Fatal("parallel kernel doesn't match", i, value, b[i])
+		}
+	}
+}
+
+func TestSum(t *testing.T) {
+	*Deterministic = true
+	defer func() {
+		*Deterministic = false
+	}()
+	rnd := rand.New(rand.NewSource(1))
+	values := make([]float64, 1000)
+	for i := range values {
+		values[i] = rnd.Float64() * 1e-3
+	}
+	a := Sum(values)
+	for i := 0; i < 8; i++ {
+		if b := Sum(values); a != b {
+			t.Fatal("sum should be deterministic", a, b)
+		}
+	}
+	if a != pairwise(values) {
+		t.Fatal("deterministic sum should be pairwise")
+	}
+}
+
+func TestAccumulator(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	values := make([]float64, 1<<16)
+	exact := new(big.Float).SetPrec(256)
+	for i := range values {
+		values[i] = rnd.Float64() * 1e-16
+		if i == 0 {
+			values[i] = 1
+		}
+		exact.Add(exact, new(big.Float).SetFloat64(values[i]))
+	}
+	reference, _ := exact.Float64()
+	sum := func() float64 {
+		var a Accumulator
+		for _, value := range values {
+			a.Add(value)
+		}
+		return a.Sum
+	}
+	naive := sum()
+	*Kahan = true
+	defer func() {
+		*Kahan = false
+	}()
+	kahan := sum()
+	t.Logf("naive error %g kahan error %g", math.Abs(naive-reference), math.Abs(kahan-reference))
+	if math.Abs(kahan-reference) >= math.Abs(naive-reference) {
+		t.Fatal("compensated summation should be more accurate", naive, kahan, reference)
+	}
+}
+
+func TestWhitening(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	const n, samples = 16, 4096
+	rows := NewMatrix(0, n, samples)
+	for i := 0; i < samples; i++ {
+		common := rnd.NormFloat64()
+		for j := 0; j < n; j++ {
+			// the dimensions are correlated by the common factor and have different variances
+			rows.Data = append(rows.Data, float64(j+1)*(common+rnd.NormFloat64())+float64(j))
+		}
+	}
+	w := NewWhitening(rows, 0)
+	for j, mean := range w.Mean {
+		if math.Abs(mean-float64(j)) > .5 {
+			t.Fatal("invalid mean", j, mean)
+		}
+	}
+	whitened := make([][]float64, samples)
+	for i := range whitened {
+		centered := append([]float64(nil), rows.Data[i*n:(i+1)*n]...)
+		axpy(-1, w.Mean, centered)
+		whitened[i] = make([]float64, n)
+		for j := range whitened[i] {
+			whitened[i][j] = dot(w.Matrix.Data[j*n:(j+1)*n], centered)
+		}
+	}
+	for a := 0; a < n; a++ {
+		for b := 0; b < n; b++ {
+			covariance := 0.0
+			for _, row := range whitened {
+				covariance += row[a] * row[b]
+			}
+			covariance /= samples
+			expected := 0.0
+			if a == b {
+				expected = 1
+			}
+			if math.Abs(covariance-expected) > 1e-6 {
+				t.Fatal("the whitened covariance should be the identity", a, b, covariance)
+			}
+		}
+	}
+	if unit := w.Whiten(rows.Data[:n]); math.Abs(dot(unit, unit)-1) > 1e-9 {
+		t.Fatal("a whitened vector should be a unit vector")
+	}
+	var none *Whitening
+	if vector := none.Whiten(rows.Data[:n]); &vector[0] != &rows.Data[0] {
+		t.Fatal("a nil whitening should return the vector")
+	}
+}
+
+func TestEigenSym(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	const n = 32
+	a := NewMatrix(0, n, n)
+	a.Data = a.Data[:n*n]
+	for i := 0; i < n; i++ {
+		for j := i; j < n; j++ {
+			value := rnd.NormFloat64()
+			a.Data[i*n+j], a.Data[j*n+i] = value, value
+		}
+	}
+	values, vectors := EigenSym(a)
+	for k, value := range values {
+		for i := 0; i < n; i++ {
+			product := 0.0
+			for j := 0; j < n; j++ {
+				product += a.Data[i*n+j] * vectors.Data[j*n+k]
+			}
+			if math.Abs(product-value*vectors.Data[i*n+k]) > 1e-9 {
+				t.Fatal("A v should be λ v", k, i, product, value*vectors.Data[i*n+k])
+			}
+		}
+	}
+}
+
+func TestMeasure(t *testing.T) {
+	uniform := []float64{.25, .25, .25, .25}
+	skewed := []float64{.7, .1, .1, .1}
+	for _, name := range []string{"shannon", "renyi:2", "renyi:.5", "tsallis:2"} {
+		measure, err := ParseMeasure(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if -measure.Negentropy(uniform) <= -measure.Negentropy(skewed) {
+			t.Fatal(name, "the uniform distribution should have the most entropy")
+		}
+	}
+	renyi, _ := ParseMeasure("renyi:2")
+	if math.Abs(-renyi.Negentropy(uniform)-math.Log(4)) > 1e-12 {
+		t.Fatal("the renyi entropy of a uniform distribution should be log n")
+	}
+	for _, name := range []string{"shannon", "renyi:2", "renyi:.5", "tsallis:2"} {
+		measure, _ := ParseMeasure(name)
+		p := make([]complex128, len(skewed))
+		for i, e := range skewed {
+			p[i] = complex(e, 0)
+		}
+		if e := measure.ComplexNegentropy(p); math.Abs(real(e)-measure.Negentropy(skewed)) > 1e-12 || imag(e) != 0 {
+			t.Fatal(name, "the complex entropy of a real distribution should be its entropy", e)
+		}
+	}
+	for _, name := range []string{"renyi:1", "tsallis:-1", "shannon:2", "gini"} {
+		if _, err := ParseMeasure(name); err == nil {
+			t.Fatal(name, "should be invalid")
+		}
+	}
+}
+
+func TestProjection(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	p := NewProjection(1, 4096, 512)
+	a, b := make([]float64, 4096), make([]float64, 4096)
+	for i := range a {
+		if rnd.Intn(8) == 0 {
+			a[i] = rnd.Float64()
+		}
+		b[i] = a[i]
+		if rnd.Intn(4) == 0 {
+			b[i] = rnd.Float64()
+		}
+	}
+	cosine := func(x, y []float64) float64 {
+		return dot(x, y) / math.Sqrt(dot(x, x)*dot(y, y))
+	}
+	expected, projected := cosine(a, b), cosine(p.Project(a), p.Project(b))
+	if math.Abs(expected-projected) > .1 {
+		t.Fatalf("projected cosine %f is too far from %f", projected, expected)
+	}
+	q := &Projection{Seed: p.Seed, In: p.In, Out: p.Out}
+	q.Init()
+	for i, v := range q.Matrix.Data {
+		if v != p.Matrix.Data[i] {
+			t.Fatal("the projection should be determined by its seed")
+		}
+	}
+}
+
+func TestSelfEntropyKernelParallel(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for _, rows := range []int{1, 7, 64, 129} {
+		weights, importance := NewRandMatrix(rnd, 0, 256, rows), NewRandMatrix(rnd, 0, rows, 1)
+		serial := SelfEntropyKernel(weights, weights, weights, importance)
+		parallel := SelfEntropyKernelParallel(weights, weights, weights, importance)
+		if math.Abs(serial-parallel) > 1e-12*math.Abs(serial) {
+			t.Fatalf("%d rows: parallel %v != serial %v", rows, parallel, serial)
+		}
+	}
+}
+
+func TestSelfEntropyKernelParallelDeterministic(t *testing.T) {
+	*Deterministic = true
+	defer func(procs int) {
+		*Deterministic = false
+		runtime.GOMAXPROCS(procs)
+	}(runtime.GOMAXPROCS(0))
+	rnd := rand.New(rand.NewSource(1))
+	weights, importance := NewRandMatrix(rnd, 0, 256, 129), NewRandMatrix(rnd, 0, 129, 1)
+	expected := -Sum(DirectSelfEntropyKernel(weights, weights, weights, importance))
+	for _, procs := range []int{1, 3, 8} {
+		runtime.GOMAXPROCS(procs)
+		if parallel := SelfEntropyKernelParallel(weights, weights, weights, importance); parallel != expected {
+			t.Fatalf("%d workers: deterministic parallel %v != %v", procs, parallel, expected)
+		}
+	}
+}
+
+func TestAMP(t *testing.T) {
+	defer func(amp *Precision) {
+		AMP = amp
+	}(AMP)
+	rnd := rand.New(rand.NewSource(1))
+	weights, importance := NewRandMatrix(rnd, 0, 256, 32), NewRandMatrix(rnd, 0, 32, 1)
+	reference := SelfEntropyKernel(weights, weights, weights, importance)
+
+	AMP = NewPrecision(1e-3, 2)
+	checked := SelfEntropyKernel(weights, weights, weights, importance)
+	mixed := SelfEntropyKernel(weights, weights, weights, importance)
+	if checked != reference {
+		t.Fatal("a checked evaluation should return the reference", checked, reference)
+	}
+	if mixed == reference || math.Abs(mixed-reference) > 1e-3*math.Abs(reference) {
+		t.Fatal("the mixed precision should be close to the reference", mixed, reference)
+	}
+	if AMP.Evaluations != 2 || AMP.Checks != 1 || AMP.MaxError == 0 || AMP.Fallback {
+		t.Fatal("unexpected mixed precision state", AMP)
+	}
+
+	AMP = NewPrecision(0, 1)
+	SelfEntropyKernel(weights, weights, weights, importance)
+	if !AMP.Fallback {
+		t.Fatal("an error above the tolerance should fall back")
+	}
+	if SelfEntropyKernel(weights, weights, weights, importance) != reference || AMP.Evaluations != 1 {
+		t.Fatal("the kernel should run in float64 after falling back")
+	}
+}
+
+func benchmarkSelfEntropyKernel(b *testing.B, parallel int) {
+	rnd := rand.New(rand.NewSource(1))
+	weights, importance := NewRandMatrix(rnd, 0, 256, 1024), NewRandMatrix(rnd, 0, 1024, 1)
+	rows := *ParallelRows
+	*ParallelRows = parallel
+	defer func() {
+		*ParallelRows = rows
+	}()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		SelfEntropyKernel(weights, weights, weights, importance)
+	}
+}
+
+func BenchmarkSelfEntropyKernelSerial(b *testing.B) {
+	benchmarkSelfEntropyKernel(b, 0)
+}
+
+func BenchmarkSelfEntropyKernelParallel(b *testing.B) {
+	benchmarkSelfEntropyKernel(b, 1)
+}
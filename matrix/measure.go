@@ -0,0 +1,101 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package matrix
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+	"strconv"
+	"strings"
+)
+
+// MeasureKind is a kind of entropy functional
+type MeasureKind int
+
+const (
+	// Shannon is the Shannon entropy
+	Shannon MeasureKind = iota
+	// Renyi is the Rényi entropy of order alpha
+	Renyi
+	// Tsallis is the Tsallis entropy with index alpha
+	Tsallis
+)
+
+// Measure is an entropy functional
+type Measure struct {
+	Kind  MeasureKind
+	Alpha float64
+}
+
+// EntropyMeasure is the entropy functional used by the kernels
+var EntropyMeasure Measure
+
+// ParseMeasure parses shannon, renyi:alpha, or tsallis:q
+func ParseMeasure(measure string) (Measure, error) {
+	name, parameter, hasParameter := strings.Cut(measure, ":")
+	switch name {
+	case "shannon":
+		if hasParameter {
+			return Measure{}, fmt.Errorf("shannon entropy has no parameter")
+		}
+		return Measure{Kind: Shannon}, nil
+	case "renyi", "tsallis":
+		alpha, err := strconv.ParseFloat(parameter, 64)
+		if err != nil {
+			return Measure{}, fmt.Errorf("invalid %s parameter %q", name, parameter)
+		}
+		if alpha <= 0 || alpha == 1 {
+			return Measure{}, fmt.Errorf("%s parameter should be positive and not 1", name)
+		}
+		if name == "renyi" {
+			return Measure{Kind: Renyi, Alpha: alpha}, nil
+		}
+		return Measure{Kind: Tsallis, Alpha: alpha}, nil
+	}
+	return Measure{}, fmt.Errorf("unknown entropy measure %q", measure)
+}
+
+// Negentropy computes the negative entropy of a distribution, for Shannon entropy this is sum p log p
+func (m Measure) Negentropy(p []float64) float64 {
+	var sum Accumulator
+	switch m.Kind {
+	case Renyi:
+		for _, e := range p {
+			sum.Add(math.Pow(e, m.Alpha))
+		}
+		return -math.Log(sum.Sum) / (1 - m.Alpha)
+	case Tsallis:
+		for _, e := range p {
+			sum.Add(math.Pow(e, m.Alpha))
+		}
+		return -(1 - sum.Sum) / (m.Alpha - 1)
+	}
+	for _, e := range p {
+		sum.Add(e * math.Log(e))
+	}
+	return sum.Sum
+}
+
+// ComplexNegentropy computes the negative entropy of a complex distribution with the principal branches of log and pow
+func (m Measure) ComplexNegentropy(p []complex128) complex128 {
+	sum := complex128(0.0)
+	switch m.Kind {
+	case Renyi:
+		for _, e := range p {
+			sum += cmplx.Pow(e, complex(m.Alpha, 0))
+		}
+		return -cmplx.Log(sum) / complex(1-m.Alpha, 0)
+	case Tsallis:
+		for _, e := range p {
+			sum += cmplx.Pow(e, complex(m.Alpha, 0))
+		}
+		return -(1 - sum) / complex(m.Alpha-1, 0)
+	}
+	for _, e := range p {
+		sum += e * cmplx.Log(e)
+	}
+	return sum
+}
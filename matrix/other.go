@@ -5,7 +5,7 @@
 //go:build 386 || arm || arm64
 // +build 386 arm arm64
 
-package main
+package matrix
 
 func dot(X, Y []float64) float64 {
 	var sum float64
@@ -15,6 +15,20 @@ func dot(X, Y []float64) float64 {
 	return sum
 }
 
+func sdot(X, Y []float32) float32 {
+	var sum float32
+	for i, x := range X {
+		sum += x * Y[i]
+	}
+	return sum
+}
+
+func scal(alpha float64, X []float64) {
+	for i, x := range X {
+		X[i] = alpha * x
+	}
+}
+
 func axpy(alpha float64, X []float64, Y []float64) {
 	for i, y := range Y {
 		Y[i] = alpha*X[i] + y
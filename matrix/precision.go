@@ -0,0 +1,109 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package matrix
+
+import (
+	"math"
+	"sync"
+)
+
+// Precision is the automatic mixed precision of SelfEntropyKernel. The dot products run in float32
+// while the softmax and the entropies are accumulated in float64. Every Interval evaluations the kernel
+// is also evaluated in float64 as a reference, and once the relative error exceeds the Tolerance
+// the kernel falls back to float64.
+type Precision struct {
+	sync.Mutex
+	Tolerance float64
+	Interval  int
+	// Evaluations is the number of evaluations in mixed precision
+	Evaluations int
+	// Checks is the number of evaluations checked against the float64 reference
+	Checks int
+	// MaxError is the max relative error of the checks
+	MaxError float64
+	// Fallback is true once the error exceeded the tolerance
+	Fallback bool
+}
+
+// AMP is the mixed precision of the kernel, nil runs it in float64
+var AMP *Precision
+
+// NewPrecision creates a mixed precision that checks every interval evaluations against the tolerance
+func NewPrecision(tolerance float64, interval int) *Precision {
+	return &Precision{
+		Tolerance: tolerance,
+		Interval:  interval,
+	}
+}
+
+// next returns true if the next evaluation runs in mixed precision, and if it is checked
+func (p *Precision) next() (mixed, check bool) {
+	p.Lock()
+	defer p.Unlock()
+	if p.Fallback {
+		return false, false
+	}
+	check = p.Evaluations%p.Interval == 0
+	p.Evaluations++
+	return true, check
+}
+
+// record records the relative error of a mixed precision evaluation against its reference
+func (p *Precision) record(mixed, reference float64) {
+	relative := math.Abs(mixed - reference)
+	if reference != 0 {
+		relative /= math.Abs(reference)
+	}
+	p.Lock()
+	defer p.Unlock()
+	p.Checks++
+	if relative > p.MaxError {
+		p.MaxError = relative
+	}
+	if relative > p.Tolerance {
+		p.Fallback = true
+	}
+}
+
+// float32s converts values to float32
+func float32s(values []float64) []float32 {
+	converted := make([]float32, len(values))
+	for i, value := range values {
+		converted[i] = float32(value)
+	}
+	return converted
+}
+
+// selfEntropyKernel32 computes the self entropy of Q, K, V with float32 dot products
+func selfEntropyKernel32(Q, K, V, I Matrix) float64 {
+	q := float32s(Q.Data)
+	k := q
+	if len(K.Data) != len(Q.Data) || len(K.Data) > 0 && &K.Data[0] != &Q.Data[0] {
+		k = float32s(K.Data)
+	}
+	V = T(V)
+	v := float32s(V.Data)
+	entropies, values, weights, sum := make([]float64, V.Rows), make([]float64, Q.Rows), make([]float32, Q.Rows), Accumulator{}
+	for i := 0; i < K.Rows; i++ {
+		K := k[i*K.Cols : (i+1)*K.Cols]
+		for j := 0; j < Q.Rows; j++ {
+			Q := q[j*Q.Cols : (j+1)*Q.Cols]
+			values[j] = float64(sdot(K, Q))
+		}
+		SoftmaxValues(values)
+		for j, value := range values {
+			weights[j] = float32(value)
+		}
+
+		for j := 0; j < V.Rows; j++ {
+			V := v[j*V.Cols : (j+1)*V.Cols]
+			entropies[j] = float64(sdot(weights, V))
+		}
+		SoftmaxValues(entropies)
+
+		sum.Add(-EntropyMeasure.Negentropy(entropies) * I.Data[i])
+	}
+	return sum.Sum
+}
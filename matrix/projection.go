@@ -0,0 +1,54 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package matrix
+
+import (
+	"math"
+	"math/rand"
+)
+
+// Projection is a random gaussian projection of vectors to a lower dimension.
+// It is determined by its seed and dimensions so only those need to be stored.
+type Projection struct {
+	Seed int64
+	In   int
+	Out  int
+	// Matrix has a row of Out columns for each of the In dimensions
+	Matrix Matrix `json:"-"`
+}
+
+// NewProjection creates a new random projection from in to out dimensions
+func NewProjection(seed int64, in, out int) *Projection {
+	p := &Projection{
+		Seed: seed,
+		In:   in,
+		Out:  out,
+	}
+	p.Init()
+	return p
+}
+
+// Init generates the projection matrix from the seed and dimensions
+func (p *Projection) Init() {
+	rnd := rand.New(rand.NewSource(p.Seed))
+	p.Matrix = NewMatrix(0, p.Out, p.In)
+	factor := 1 / math.Sqrt(float64(p.Out))
+	for i := 0; i < p.In*p.Out; i++ {
+		p.Matrix.Data = append(p.Matrix.Data, rnd.NormFloat64()*factor)
+	}
+}
+
+// Project projects a vector, zeros are skipped so sparse vectors are fast
+func (p *Projection) Project(vector []float64) []float64 {
+	checkSize("Project", "vector", p.In, 1, len(vector))
+	projected := make([]float64, p.Out)
+	for i, value := range vector {
+		if value == 0 {
+			continue
+		}
+		axpy(value, p.Matrix.Data[i*p.Out:(i+1)*p.Out], projected)
+	}
+	return projected
+}
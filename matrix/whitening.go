@@ -0,0 +1,157 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package matrix
+
+import (
+	"math"
+)
+
+// EigenSym computes the eigenvalues and eigenvectors of a symmetric matrix with the cyclic Jacobi method,
+// the eigenvectors are the columns of the returned matrix
+func EigenSym(a Matrix) (values []float64, vectors Matrix) {
+	n := a.Cols
+	checkSize("EigenSym", "a", n, n, len(a.Data))
+	m := append([]float64(nil), a.Data...)
+	vectors = NewMatrix(0, n, n)
+	vectors.Data = vectors.Data[:n*n]
+	for i := 0; i < n; i++ {
+		vectors.Data[i*n+i] = 1
+	}
+	v := vectors.Data
+	norm := 0.0
+	for _, value := range m {
+		norm += value * value
+	}
+	for sweep := 0; sweep < 64; sweep++ {
+		off := 0.0
+		for p := 0; p < n; p++ {
+			for q := p + 1; q < n; q++ {
+				off += m[p*n+q] * m[p*n+q]
+			}
+		}
+		if off <= 1e-30*norm {
+			break
+		}
+		for p := 0; p < n-1; p++ {
+			for q := p + 1; q < n; q++ {
+				apq := m[p*n+q]
+				if apq == 0 {
+					continue
+				}
+				// the rotation in the p, q plane that zeros m[p][q]
+				theta := (m[q*n+q] - m[p*n+p]) / (2 * apq)
+				t := 1 / (math.Abs(theta) + math.Sqrt(theta*theta+1))
+				if theta < 0 {
+					t = -t
+				}
+				c := 1 / math.Sqrt(t*t+1)
+				s := t * c
+				for k := 0; k < n; k++ {
+					kp, kq := m[k*n+p], m[k*n+q]
+					m[k*n+p], m[k*n+q] = c*kp-s*kq, s*kp+c*kq
+				}
+				for k := 0; k < n; k++ {
+					pk, qk := m[p*n+k], m[q*n+k]
+					m[p*n+k], m[q*n+k] = c*pk-s*qk, s*pk+c*qk
+				}
+				for k := 0; k < n; k++ {
+					kp, kq := v[k*n+p], v[k*n+q]
+					v[k*n+p], v[k*n+q] = c*kp-s*kq, s*kp+c*kq
+				}
+			}
+		}
+	}
+	values = make([]float64, n)
+	for i := range values {
+		values[i] = m[i*n+i]
+	}
+	return values, vectors
+}
+
+// Whitening is a ZCA whitening transform that decorrelates the dimensions of vectors and equalizes their
+// variance, while keeping the whitened dimensions aligned with the original ones
+type Whitening struct {
+	Mean []float64
+	// Matrix is the symmetric whitening matrix
+	Matrix Matrix
+}
+
+// NewWhitening computes the whitening transform of the rows of a matrix. The eigenvalues of the covariance
+// are regularized by epsilon times the mean variance, so the dimensions without variance aren't amplified.
+func NewWhitening(rows Matrix, epsilon float64) *Whitening {
+	n := rows.Cols
+	checkSize("NewWhitening", "rows", n, rows.Rows, len(rows.Data))
+	w := &Whitening{
+		Mean: make([]float64, n),
+	}
+	for i := 0; i < rows.Rows; i++ {
+		axpy(1, rows.Data[i*n:(i+1)*n], w.Mean)
+	}
+	for i := range w.Mean {
+		w.Mean[i] /= float64(rows.Rows)
+	}
+
+	covariance := NewMatrix(0, n, n)
+	covariance.Data = covariance.Data[:n*n]
+	centered := make([]float64, n)
+	for i := 0; i < rows.Rows; i++ {
+		copy(centered, rows.Data[i*n:(i+1)*n])
+		axpy(-1, w.Mean, centered)
+		for j, value := range centered {
+			if value != 0 {
+				axpy(value/float64(rows.Rows), centered, covariance.Data[j*n:(j+1)*n])
+			}
+		}
+	}
+
+	values, vectors := EigenSym(covariance)
+	mean := 0.0
+	for _, value := range values {
+		mean += value
+	}
+	mean /= float64(n)
+	// the whitening matrix is U diag(1/sqrt(λ + ε)) Uᵀ
+	scales := make([]float64, n)
+	for i, value := range values {
+		if value < 0 {
+			value = 0
+		}
+		scales[i] = 1 / math.Sqrt(value+epsilon*mean)
+	}
+	w.Matrix = NewMatrix(0, n, n)
+	w.Matrix.Data = w.Matrix.Data[:n*n]
+	u := vectors.Data
+	for i := 0; i < n; i++ {
+		for j := i; j < n; j++ {
+			sum := 0.0
+			for k, scale := range scales {
+				sum += u[i*n+k] * scale * u[j*n+k]
+			}
+			w.Matrix.Data[i*n+j], w.Matrix.Data[j*n+i] = sum, sum
+		}
+	}
+	return w
+}
+
+// Whiten centers and whitens a vector and scales it to unit length, a nil whitening returns the vector
+func (w *Whitening) Whiten(vector []float64) []float64 {
+	if w == nil {
+		return vector
+	}
+	n := w.Matrix.Cols
+	checkSize("Whiten", "vector", n, 1, len(vector))
+	centered := append([]float64(nil), vector...)
+	axpy(-1, w.Mean, centered)
+	whitened := make([]float64, n)
+	for i := range whitened {
+		whitened[i] = dot(w.Matrix.Data[i*n:(i+1)*n], centered)
+	}
+	if norm := math.Sqrt(dot(whitened, whitened)); norm > 0 {
+		for i := range whitened {
+			whitened[i] /= norm
+		}
+	}
+	return whitened
+}
@@ -0,0 +1,238 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// ArticleShard is a range of the articles of the training data that is learned on its own,
+// so a model can be learned in shards on separate machines and merged
+type ArticleShard struct {
+	// Index is the index of the shard starting from 1
+	Index int
+	Count int
+}
+
+// LearnShard is the shard of the articles that is learned with -shard, nil learns every article
+var LearnShard *ArticleShard
+
+// ParseArticleShard parses a shard such as 3/8, the third of eight shards
+func ParseArticleShard(shard string) (*ArticleShard, error) {
+	parts := strings.Split(shard, "/")
+	if len(parts) == 2 {
+		index, err := strconv.Atoi(parts[0])
+		if err == nil {
+			count, err := strconv.Atoi(parts[1])
+			if err == nil && index >= 1 && index <= count {
+				return &ArticleShard{Index: index, Count: count}, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("invalid shard %q, should be i/n with 1 <= i <= n", shard)
+}
+
+// Range returns the range of article indexes of the shard, every article if the shard is nil
+func (a *ArticleShard) Range(articles int) (start, end int) {
+	if a == nil {
+		return 0, articles
+	}
+	return (a.Index - 1) * articles / a.Count, a.Index * articles / a.Count
+}
+
+// Contains returns true if the article index is in the shard
+func (a *ArticleShard) Contains(index, articles int) bool {
+	start, end := a.Range(articles)
+	return index >= start && index < end
+}
+
+// entry is a copied entry of a model bucket
+type entry struct {
+	Key   Symbols
+	Value []byte
+}
+
+// shardEntries copies the entries of a shard of a model bucket
+func shardEntries(b *bolt.Bucket, shard byte) (entries []entry) {
+	add := func(k, v []byte) error {
+		if len(k) != len(Symbols{}) || v == nil || Shard(k)[0] != shard {
+			return nil
+		}
+		e := entry{Value: append([]byte{}, v...)}
+		copy(e.Key[:], k)
+		entries = append(entries, e)
+		return nil
+	}
+	if !Sharded(b) {
+		b.ForEach(add)
+	} else if s := b.Bucket([]byte{shard}); s != nil {
+		s.ForEach(add)
+	}
+	return entries
+}
+
+// MergeModels sums the histograms and end counts of the model buckets of the inputs into the output.
+// The counts are summed in 64 bits and halved until they fit, so a saturated histogram keeps its shape.
+// Each shard of a bucket is merged in its own transaction, so only one shard of the inputs is in memory.
+// The output is added to, so it should be a new model.
+func MergeModels(output *bolt.DB, inputs []*bolt.DB) error {
+	buckets := make(map[string]bool)
+	for _, input := range inputs {
+		if err := CheckShape(input); err != nil {
+			return fmt.Errorf("%s: %w", input.Path(), err)
+		}
+		for _, bucket := range ModelBuckets(input) {
+			buckets[bucket] = true
+		}
+	}
+	if len(buckets) == 0 {
+		return errors.New("the inputs don't have a model")
+	}
+	names := make([]string, 0, len(buckets))
+	for bucket := range buckets {
+		names = append(names, bucket)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		bucket := []byte(name)
+		err := output.Update(func(tx *bolt.Tx) error {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+			return Denormalize(tx, bucket)
+		})
+		if err != nil {
+			return err
+		}
+		for shard := 0; shard < Shards; shard++ {
+			lists := make([][]entry, 0, len(inputs))
+			for _, input := range inputs {
+				input.View(func(tx *bolt.Tx) error {
+					if b := tx.Bucket(bucket); b != nil {
+						lists = append(lists, shardEntries(b, byte(shard)))
+					}
+					return nil
+				})
+			}
+			err := output.Update(func(tx *bolt.Tx) error {
+				b := tx.Bucket(bucket)
+				put := Putter(b)
+				// the entries of each input are in key order, so the inputs are merged a key at a time
+				for {
+					var next *Symbols
+					for _, list := range lists {
+						if len(list) > 0 && (next == nil || bytes.Compare(list[0].Key[:], next[:]) < 0) {
+							next = &list[0].Key
+						}
+					}
+					if next == nil {
+						return nil
+					}
+					key, sum := *next, [Width]uint64{}
+					add := func(v []byte) {
+						for i, value := range DecodeVector(v) {
+							sum[i] += uint64(value)
+						}
+					}
+					for i, list := range lists {
+						if len(list) > 0 && list[0].Key == key {
+							add(list[0].Value)
+							lists[i] = list[1:]
+						}
+					}
+					if v := Get(b, key[:]); v != nil {
+						add(v)
+					}
+					if err := put(key[:], EncodeVector(Narrow(sum))); err != nil {
+						return err
+					}
+				}
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		ends := make(map[Symbols]uint64)
+		for _, input := range append([]*bolt.DB{output}, inputs...) {
+			input.View(func(tx *bolt.Tx) error {
+				e := tx.Bucket(EndBucket(bucket))
+				if e == nil {
+					return nil
+				}
+				return e.ForEach(func(k, v []byte) error {
+					key := Symbols{}
+					copy(key[:], k)
+					ends[key] += uint64(binary.BigEndian.Uint32(v))
+					return nil
+				})
+			})
+		}
+		saturated := make(map[Symbols]uint32, len(ends))
+		for key, count := range ends {
+			saturated[key] = uint32(math.Min(float64(count), math.MaxUint32))
+		}
+		WriteEnds(output, bucket, saturated)
+	}
+	WriteMetadata(output, "shape", CurrentShape())
+	return nil
+}
+
+func merge() {
+	inputs := flag.Args()
+	if len(inputs) == 0 {
+		Fail(ExitFlags, errors.New("merge takes the model files to merge as arguments"))
+	}
+	if _, err := os.Stat(*FlagModel); err == nil {
+		Fail(ExitFlags, fmt.Errorf("%s already exists, merge writes a new model", *FlagModel))
+	}
+	dbs := make([]*bolt.DB, 0, len(inputs))
+	for _, input := range inputs {
+		db := OpenModel(input)
+		defer db.Close()
+		dbs = append(dbs, db)
+	}
+	// the merged model is written next to the output, and renamed after it passes the quality gate
+	next := *FlagModel + ".next"
+	os.Remove(next)
+	output, err := bolt.Open(next, 0666, nil)
+	if err != nil {
+		Fail(ExitData, err)
+	}
+	if err := MergeModels(output, dbs); err != nil {
+		output.Close()
+		os.Remove(next)
+		Fail(ExitCorruptModel, err)
+	}
+	if ModelGate != nil {
+		before, after, err := ModelGate.Check(output, dbs...)
+		if err != nil && !*FlagForce {
+			output.Close()
+			os.Remove(next)
+			Fail(ExitRegression, err)
+		} else if err != nil {
+			fmt.Fprintln(os.Stderr, "writing the model with -force:", err)
+		}
+		fmt.Printf("held out bits/byte %f, %f for the best input\n", after, before)
+	}
+	if err := output.Close(); err != nil {
+		Fail(ExitData, err)
+	}
+	if err := os.Rename(next, *FlagModel); err != nil {
+		Fail(ExitData, err)
+	}
+	fmt.Printf("merged %d models into %s\n", len(dbs), *FlagModel)
+}
@@ -0,0 +1,97 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"path/filepath"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestMerge(t *testing.T) {
+	for _, invalid := range []string{"0/8", "9/8", "3", "a/b"} {
+		if _, err := ParseArticleShard(invalid); err == nil {
+			t.Fatal("the shard should be invalid", invalid)
+		}
+	}
+	covered := 0
+	for i := 1; i <= 3; i++ {
+		shard, err := ParseArticleShard(fmt.Sprintf("%d/3", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		start, end := shard.Range(100)
+		if start != covered {
+			t.Fatal("the shards should be contiguous", start, covered)
+		}
+		covered = end
+	}
+	if covered != 100 {
+		t.Fatal("the shards should cover every article", covered)
+	}
+
+	dir, half := t.TempDir(), len(Corpus)/2
+	whole := NewLRU(1024)
+	whole.Learn([]byte(Corpus[:half]))
+	whole.Learn([]byte(Corpus[half:]))
+	whole.Close()
+	inputs := make([]*bolt.DB, 0, 2)
+	for i, text := range []string{Corpus[:half], Corpus[half:]} {
+		s := NewLRU(1024)
+		s.Learn([]byte(text))
+		s.Close()
+		db, err := bolt.Open(filepath.Join(dir, fmt.Sprintf("shard%d.bolt", i)), 0600, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		WriteModel(db, []byte("markov"), &s)
+		inputs = append(inputs, db)
+	}
+	output, err := bolt.Open(filepath.Join(dir, "model.bolt"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer output.Close()
+	if err := MergeModels(output, inputs); err != nil {
+		t.Fatal(err)
+	}
+	entries := 0
+	err = ScanShards(output, []byte("markov"), func(_ int, k, v []byte) error {
+		key := Symbols{}
+		copy(key[:], k)
+		if DecodeVector(v) != DecodeVector(whole.Model[key]) {
+			t.Errorf("the merged vector of %q should be the sum", k)
+		}
+		entries++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries != len(whole.Model) {
+		t.Fatal("the merged model should have the entries of both shards", entries, len(whole.Model))
+	}
+	ends := 0
+	output.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(EndBucket([]byte("markov"))).ForEach(func(k, v []byte) error {
+			ends += int(binary.BigEndian.Uint32(v))
+			return nil
+		})
+	})
+	if ends != 2 {
+		t.Fatal("the end counts should be summed", ends)
+	}
+
+	saturated := [Width]uint64{}
+	saturated['a'], saturated['b'] = 3*math.MaxUint16, math.MaxUint16
+	if narrow := Narrow(saturated); narrow['a'] < 3*narrow['b']-3 || narrow['a'] == 0 {
+		t.Fatal("a saturated sum should keep its shape", narrow['a'], narrow['b'])
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// MetadataBucket is the bolt bucket for the model metadata
+var MetadataBucket = []byte("metadata")
+
+// WriteMetadata writes a json encoded metadata value to the model, the key is in the namespace of the model
+func WriteMetadata(db *bolt.DB, key string, value interface{}) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		panic(err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(MetadataBucket)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(Namespace+key), data)
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+// ReadMetadata reads a json encoded metadata value from the model, false is returned if it isn't found
+func ReadMetadata(db *bolt.DB, key string, value interface{}) bool {
+	var data []byte
+	db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(MetadataBucket)
+		if b == nil {
+			return nil
+		}
+		if v := b.Get([]byte(Namespace + key)); v != nil {
+			data = append(data, v...)
+		}
+		return nil
+	})
+	if data == nil {
+		return false
+	}
+	if err := json.Unmarshal(data, value); err != nil {
+		panic(err)
+	}
+	return true
+}
+
+// Shape is the shape of a markov model
+type Shape struct {
+	Order   int
+	Size    int
+	Width   int
+	Indexes []int
+}
+
+// CurrentShape is the shape of the markov models lit is built for
+func CurrentShape() Shape {
+	return Shape{
+		Order:   Order,
+		Size:    Size,
+		Width:   Width,
+		Indexes: Indexes[:],
+	}
+}
+
+// Equal returns true if two shapes are the same
+func (s Shape) Equal(t Shape) bool {
+	if s.Order != t.Order || s.Size != t.Size || s.Width != t.Width || len(s.Indexes) != len(t.Indexes) {
+		return false
+	}
+	for i, index := range s.Indexes {
+		if t.Indexes[i] != index {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckShape returns an error if the model was learned with a different shape, models without a shape are assumed to match
+func CheckShape(db *bolt.DB) error {
+	var shape Shape
+	if !ReadMetadata(db, "shape", &shape) {
+		return nil
+	}
+	if current := CurrentShape(); !shape.Equal(current) {
+		return fmt.Errorf("model has order %d size %d width %d indexes %v but lit is built for order %d size %d width %d indexes %v",
+			shape.Order, shape.Size, shape.Width, shape.Indexes, current.Order, current.Size, current.Width, current.Indexes)
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+)
+
+func TestMetadata(t *testing.T) {
+	db := NewTestModel(t)
+	var parameters ComplexParameters
+	if ReadMetadata(db, "complex", &parameters) {
+		t.Fatal("metadata shouldn't be found")
+	}
+	WriteMetadata(db, "complex", NewComplexParameters())
+	if !ReadMetadata(db, "complex", &parameters) {
+		t.Fatal("metadata should be found")
+	}
+	if parameters != NewComplexParameters() {
+		t.Fatal("metadata doesn't match", parameters)
+	}
+}
+
+func TestShape(t *testing.T) {
+	db := NewTestModel(t)
+	if err := CheckShape(db); err != nil {
+		t.Fatal(err)
+	}
+	shape := CurrentShape()
+	shape.Order++
+	WriteMetadata(db, "shape", shape)
+	if err := CheckShape(db); err == nil {
+		t.Fatal("a model with a different shape should be detected")
+	}
+}
@@ -0,0 +1,187 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"os"
+
+	"github.com/pointlander/compress"
+	bolt "go.etcd.io/bbolt"
+)
+
+// MixtureIterations is the number of expectation maximization iterations used to learn the mixture weights
+const MixtureIterations = 16
+
+// MixtureWeights are the weights of the backoff orders, nil means hard backoff.
+// They are loaded by the markov mode, the self entropy modes score with the vectors of the hard backoff.
+var MixtureWeights []float64
+
+// Histograms looks up the smoothed distributions of a context at every backoff order,
+// nil is returned for the orders that aren't found or are longer than -max-order
+func Histograms(b *bolt.Bucket, symbol Symbols) [][]float64 {
+	histograms := make([][]float64, len(Indexes)-1)
+	output := make([]byte, 2*Width)
+	for j := Backoff(); j < len(histograms); j++ {
+		symbol := symbol
+		for k := 0; k < j; k++ {
+			symbol[k] = 0
+		}
+		v := Get(b, symbol[:])
+		if v == nil {
+			continue
+		}
+		compress.Mark1Decompress1(bytes.NewBuffer(v), output)
+		histogram, sum := make([]float64, 256), 0.0
+		for key := range histogram {
+			histogram[key] = float64(uint16(output[2*key]) | uint16(output[2*key+1])<<8)
+			sum += histogram[key]
+		}
+		for key, value := range histogram {
+			histogram[key] = (value + .5) / (sum + .5*256)
+		}
+		histograms[j] = histogram
+	}
+	return histograms
+}
+
+// Mix blends the histograms with the weights of the orders that are found.
+// Without weights the first order found is used. nil is returned if no order is found
+func Mix(histograms [][]float64, weights []float64) []float64 {
+	if weights == nil {
+		for _, histogram := range histograms {
+			if histogram != nil {
+				return histogram
+			}
+		}
+		return nil
+	}
+	var mixed []float64
+	total := 0.0
+	for j, histogram := range histograms {
+		if histogram == nil {
+			continue
+		}
+		if mixed == nil {
+			mixed = make([]float64, 256)
+		}
+		for key, value := range histogram {
+			mixed[key] += weights[j] * value
+		}
+		total += weights[j]
+	}
+	if mixed == nil || total == 0 {
+		return nil
+	}
+	for key := range mixed {
+		mixed[key] /= total
+	}
+	return mixed
+}
+
+// contexts computes the histograms of every context of a text in a model bucket and the byte that follows it
+func contexts(db *bolt.DB, bucket, text []byte) (histograms [][][]float64, next []byte) {
+	padded := append(Padding(Order-1), text...)
+	db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucket)
+		for i := 0; i+Order < len(padded); i++ {
+			symbol := Symbols{}
+			for j := range symbol {
+				symbol[j] = padded[i+Indexes[j]]
+			}
+			histograms = append(histograms, Histograms(b, symbol))
+			next = append(next, padded[i+Order])
+		}
+		return nil
+	})
+	return histograms, next
+}
+
+// MixtureBits computes the bits per byte of a text with the mixture weights, nil weights is hard backoff
+func MixtureBits(db *bolt.DB, text []byte, weights []float64) float64 {
+	return BucketBits(db, ModelBucket, text, weights)
+}
+
+// BucketBits computes the bits per byte of a text under a model bucket with the mixture weights
+func BucketBits(db *bolt.DB, bucket, text []byte, weights []float64) float64 {
+	histograms, next := contexts(db, bucket, text)
+	if len(next) == 0 {
+		return 0
+	}
+	bits := 0.0
+	for i, h := range histograms {
+		p := 1.0 / 256
+		if mixed := Mix(h, weights); mixed != nil {
+			p = mixed[next[i]]
+		}
+		bits -= math.Log2(p)
+	}
+	return bits / float64(len(next))
+}
+
+// LearnMixture learns the weights of the backoff orders on held out text with expectation maximization
+func LearnMixture(db *bolt.DB, text []byte, iterations int) []float64 {
+	histograms, next := contexts(db, ModelBucket, text)
+	weights := make([]float64, len(Indexes)-1)
+	for j := range weights {
+		weights[j] = 1 / float64(len(weights))
+	}
+	responsibilities := make([]float64, len(weights))
+	for iteration := 0; iteration < iterations; iteration++ {
+		counts, total := make([]float64, len(weights)), 0.0
+		for i, h := range histograms {
+			sum := 0.0
+			for j, histogram := range h {
+				responsibilities[j] = 0
+				if histogram != nil {
+					responsibilities[j] = weights[j] * histogram[next[i]]
+					sum += responsibilities[j]
+				}
+			}
+			if sum == 0 {
+				continue
+			}
+			for j, r := range responsibilities {
+				counts[j] += r / sum
+			}
+			total++
+		}
+		if total == 0 {
+			break
+		}
+		for j := range weights {
+			weights[j] = counts[j] / total
+		}
+	}
+	return weights
+}
+
+// LoadMixture loads the mixture weights from the model metadata, nil is returned if there are none
+func LoadMixture(db *bolt.DB) []float64 {
+	var weights []float64
+	if !ReadMetadata(db, "mixture", &weights) || len(weights) != len(Indexes)-1 {
+		return nil
+	}
+	return weights
+}
+
+func mixture() {
+	db := OpenModel(*FlagModel)
+	defer db.Close()
+
+	text, err := os.ReadFile(*FlagMixture)
+	if err != nil {
+		Fail(ExitData, err)
+	}
+	weights := LearnMixture(db, text, MixtureIterations)
+	fmt.Printf("backoff bits/byte %f\n", MixtureBits(db, text, nil))
+	fmt.Printf("mixture bits/byte %f\n", MixtureBits(db, text, weights))
+	for j, weight := range weights {
+		fmt.Printf("order %d weight %f\n", Order-j, weight)
+	}
+	WriteMetadata(db, "mixture", weights)
+}
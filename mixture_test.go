@@ -0,0 +1,31 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMixture(t *testing.T) {
+	db := NewTestModel(t)
+	text := []byte("it was the best of times, it was the worst of times")
+	weights := LearnMixture(db, text, MixtureIterations)
+	sum := 0.0
+	for _, weight := range weights {
+		sum += weight
+	}
+	if math.Abs(sum-1) > 1e-9 {
+		t.Fatal("mixture weights should sum to one", weights)
+	}
+	backoff, mixed := MixtureBits(db, text, nil), MixtureBits(db, text, weights)
+	if mixed > backoff {
+		t.Fatal("the mixture should not be worse than hard backoff", mixed, backoff)
+	}
+	WriteMetadata(db, "mixture", weights)
+	if loaded := LoadMixture(db); len(loaded) != len(weights) {
+		t.Fatal("mixture weights should be loaded")
+	}
+}
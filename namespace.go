@@ -0,0 +1,44 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Namespace is the prefix of the buckets and metadata of the model selected with -namespace,
+// so many named models share one bolt file. It is empty for the default model.
+var Namespace string
+
+// validNamespace matches the names of namespaces
+var validNamespace = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// NamespacePrefix returns the prefix of the buckets of a named model, empty for the default model
+func NamespacePrefix(name string) (string, error) {
+	if name == "" {
+		return "", nil
+	}
+	if !validNamespace.MatchString(name) {
+		return "", fmt.Errorf("invalid namespace %q, it should be letters, digits, '.', '-' and '_'", name)
+	}
+	return "ns/" + name + "/", nil
+}
+
+// SetNamespace selects a named model, the model bucket is the markov bucket of the namespace
+func SetNamespace(name string) error {
+	prefix, err := NamespacePrefix(name)
+	if err != nil {
+		return err
+	}
+	Namespace = prefix
+	ModelBucket = Bucket("markov")
+	return nil
+}
+
+// Bucket returns the name of a bucket of the selected model
+func Bucket(name string) []byte {
+	return []byte(Namespace + name)
+}
@@ -0,0 +1,62 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestNamespace(t *testing.T) {
+	if err := SetNamespace("a/b"); err == nil {
+		t.Fatal("a namespace can't contain a slash")
+	}
+	model := filepath.Join(t.TempDir(), "models.bolt")
+	db, err := bolt.Open(model, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer SetNamespace("")
+	for _, name := range []string{"books", "letters"} {
+		if err := SetNamespace(name); err != nil {
+			t.Fatal(err)
+		}
+		s := NewLRU(1024)
+		s.Learn([]byte(Corpus))
+		s.Close()
+		WriteModel(db, ModelBucket, &s)
+	}
+	SetNamespace("")
+	var shape Shape
+	if ReadMetadata(db, "shape", &shape) {
+		t.Fatal("the metadata of the named models shouldn't be in the default namespace")
+	}
+	SetNamespace("letters")
+	if !ReadMetadata(db, "shape", &shape) || string(ModelBucket) != "ns/letters/markov" {
+		t.Fatal("the named model should have its own metadata and buckets", string(ModelBucket))
+	}
+	SetNamespace("")
+	db.Close()
+
+	request := GenerateRequest{Mode: "markov", Prompt: GoldenPrompt, Steps: 2, Depth: 1, Namespace: "books"}
+	usage, err := Generate(context.Background(), model, request, func(step Result) error {
+		return nil
+	})
+	if err != nil || usage.Bytes != 3 {
+		t.Fatal("the named model should generate", err, usage)
+	}
+	if string(ModelBucket) != "markov" || Namespace != "" {
+		t.Fatal("the namespace should be restored after the request")
+	}
+	request.Namespace = "missing"
+	if _, err := Generate(context.Background(), model, request, func(step Result) error {
+		return nil
+	}); err == nil {
+		t.Fatal("a missing namespace should be an error")
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"sort"
+)
+
+// Candidate is a completed path of the n-best output
+type Candidate struct {
+	Rank    int     `json:"rank"`
+	Entropy float64 `json:"entropy"`
+	Output  string  `json:"output"`
+}
+
+// NBest returns the n branches of the search with the lowest entropy, excluded branches are skipped
+func NBest(branches []Result, n int) []Result {
+	best := make([]Result, 0, len(branches))
+	for _, branch := range branches {
+		if branch.Entropy != math.MaxFloat64 {
+			best = append(best, branch)
+		}
+	}
+	sort.SliceStable(best, func(i, j int) bool {
+		if best[i].Entropy != best[j].Entropy {
+			return best[i].Entropy < best[j].Entropy
+		}
+		return bytes.Compare(best[i].Output, best[j].Output) < 0
+	})
+	if n < len(best) {
+		best = best[:n]
+	}
+	return best
+}
+
+// EmitNBest prints the completed paths as json lines ranked from the lowest entropy, with the output filter applied
+func EmitNBest(completed []Result) {
+	sort.SliceStable(completed, func(i, j int) bool {
+		return completed[i].Entropy < completed[j].Entropy
+	})
+	encoder := json.NewEncoder(Output)
+	for i, result := range completed {
+		err := encoder.Encode(Candidate{
+			Rank:    i + 1,
+			Entropy: result.Entropy,
+			Output:  string(OutputFilter.Redact(result.Output)),
+		})
+		if err != nil {
+			panic(err)
+		}
+	}
+}
+
+// Shared returns the length of the common prefix of two outputs
+func Shared(a, b []byte) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
+
+// Diverse selects n of the paths with the lowest entropy plus lambda times the longest prefix a path shares
+// with the already selected paths, the first start bytes of the outputs are the prompt and aren't counted
+func Diverse(pathes []Result, n int, lambda float64, start int) []Result {
+	pathes = NBest(pathes, len(pathes))
+	selected, used := make([]Result, 0, n), make([]bool, len(pathes))
+	for len(selected) < n {
+		best, min := -1, math.MaxFloat64
+		for i, path := range pathes {
+			if used[i] {
+				continue
+			}
+			shared := 0
+			for _, s := range selected {
+				if length := Shared(path.Output[start:], s.Output[start:]); length > shared {
+					shared = length
+				}
+			}
+			if score := path.Entropy + lambda*float64(shared); score < min {
+				best, min = i, score
+			}
+		}
+		if best < 0 {
+			break
+		}
+		used[best] = true
+		selected = append(selected, pathes[best])
+	}
+	return selected
+}
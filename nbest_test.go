@@ -0,0 +1,75 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestNBest(t *testing.T) {
+	model, err := GoldenModel(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	nbest := *FlagNBest
+	defer func() {
+		*FlagNBest = nbest
+	}()
+	*FlagNBest = 3
+	lines := strings.Split(strings.TrimSpace(string(Transcript(model, Mode{"attention", markovSelfEntropy}))), "\n")
+	if len(lines) != 3 {
+		t.Fatal("there should be a line for each path", len(lines))
+	}
+	seen := make(map[string]bool)
+	for i, line := range lines {
+		var candidate Candidate
+		if err := json.Unmarshal([]byte(line), &candidate); err != nil {
+			t.Fatal(err)
+		}
+		if candidate.Rank != i+1 || seen[candidate.Output] {
+			t.Fatal("the paths should be ranked and distinct", line)
+		}
+		seen[candidate.Output] = true
+	}
+
+	best := NBest([]Result{{Entropy: 2}, {Entropy: math.MaxFloat64}, {Entropy: 1}}, 5)
+	if len(best) != 2 || best[0].Entropy != 1 {
+		t.Fatal("excluded branches should be skipped and the rest sorted", best)
+	}
+}
+
+func TestDiverse(t *testing.T) {
+	pathes := []Result{
+		{Entropy: 1, Output: []byte("> aaaa")},
+		{Entropy: 1.5, Output: []byte("> aaab")},
+		{Entropy: 3, Output: []byte("> bbbb")},
+	}
+	if selected := Diverse(pathes, 2, 0, 2); string(selected[1].Output) != "> aaab" {
+		t.Fatal("without a penalty the lowest entropy paths should be selected", string(selected[1].Output))
+	}
+	if selected := Diverse(pathes, 2, 1, 2); string(selected[1].Output) != "> bbbb" {
+		t.Fatal("the penalty should select the distinct path", string(selected[1].Output))
+	}
+	if len(Diverse(pathes, 5, 1, 2)) != 3 {
+		t.Fatal("every path should be selected if there are fewer than n")
+	}
+
+	model, err := GoldenModel(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	nbest, diversity := *FlagNBest, *FlagDiversity
+	defer func() {
+		*FlagNBest, *FlagDiversity = nbest, diversity
+	}()
+	*FlagNBest, *FlagDiversity = 3, 1
+	lines := strings.Split(strings.TrimSpace(string(Transcript(model, Mode{"attention", markovSelfEntropy}))), "\n")
+	if len(lines) != 3 {
+		t.Fatal("there should be a line for each path", len(lines))
+	}
+}
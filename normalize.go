@@ -0,0 +1,208 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// UnitBucket is the bucket of the unit float32 vectors of a model bucket
+func UnitBucket(bucket []byte) []byte {
+	return append([]byte("unit."), bucket...)
+}
+
+// EncodeUnit encodes the histograms of a vector as little endian float32 unit vectors
+func EncodeUnit(vector [Width]uint16) []byte {
+	data := make([]byte, 4*Width)
+	for i := 0; i < Width; i += 256 {
+		for j, v := range Unit(vector[i : i+256]) {
+			binary.LittleEndian.PutUint32(data[4*(i+j):], math.Float32bits(float32(v)))
+		}
+	}
+	return data
+}
+
+// DecodeUnit decodes the unit vectors of the histograms, the second is nil unless Size is 2
+func DecodeUnit(data []byte) (weight, hmm []float64) {
+	if len(data) != 4*Width {
+		panic(fmt.Errorf("unit vector has %d bytes but should have %d", len(data), 4*Width))
+	}
+	vector := make([]float64, Width)
+	for i := range vector {
+		vector[i] = float64(math.Float32frombits(binary.LittleEndian.Uint32(data[4*i:])))
+	}
+	weight = vector[:256]
+	if Size == 2 {
+		hmm = vector[256:]
+	}
+	return weight, hmm
+}
+
+// unit is a model bucket
+type unit struct {
+	db     *bolt.DB
+	bucket string
+}
+
+// units caches whether model buckets are normalized
+var units sync.Map
+
+// Normalized returns true if the unit metadata records that the model bucket has been normalized
+func Normalized(db *bolt.DB) bool {
+	key := unit{db: db, bucket: string(ModelBucket)}
+	if normalized, ok := units.Load(key); ok {
+		return normalized.(bool)
+	}
+	var buckets []string
+	ReadMetadata(db, "unit", &buckets)
+	normalized := false
+	for _, bucket := range buckets {
+		if bucket == key.bucket {
+			normalized = true
+		}
+	}
+	units.Store(key, normalized)
+	return normalized
+}
+
+// UnitLookup looks up the unit vectors of a context backing off to shorter contexts.
+// It returns false if the model bucket hasn't been normalized.
+func UnitLookup(db *bolt.DB, window *WindowVector) bool {
+	if !Normalized(db) {
+		return false
+	}
+	normalized := false
+	lookup := func(tx *bolt.Tx) {
+		b := tx.Bucket(UnitBucket(ModelBucket))
+		if b == nil {
+			return
+		}
+		normalized = true
+		for j := Backoff(); j < len(Indexes)-1; j++ {
+			symbol := window.Key
+			for k := 0; k < j; k++ {
+				symbol[k] = 0
+			}
+			lookup := Timed(PhaseLookup)
+			v := b.Get(symbol[:])
+			lookup()
+			if v != nil {
+				window.Found, window.Order = true, j
+				decompress := Timed(PhaseDecompress)
+				window.Weight, window.HMM = DecodeUnit(v)
+				decompress()
+				return
+			}
+		}
+	}
+	read := Read(db, func(b *bolt.Bucket) {
+		lookup(b.Tx())
+	})
+	if !read {
+		db.View(func(tx *bolt.Tx) error {
+			lookup(tx)
+			return nil
+		})
+	}
+	return normalized
+}
+
+// ModelBuckets returns the names of the markov model buckets, the model and the domain sub-models
+func ModelBuckets(db *bolt.DB) (buckets []string) {
+	db.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, _ *bolt.Bucket) error {
+			if n := string(name); n == string(Bucket("markov")) || strings.HasPrefix(n, string(Bucket("markov."))) {
+				buckets = append(buckets, n)
+			}
+			return nil
+		})
+	})
+	return buckets
+}
+
+// Normalize writes the unit float32 vectors of a model bucket, so that inference reads them instead of
+// normalizing the histograms of every lookup. The normalized buckets are recorded in the unit metadata.
+func Normalize(db *bolt.DB, bucket []byte) error {
+	err := db.Update(func(tx *bolt.Tx) error {
+		counts := tx.Bucket(bucket)
+		if counts == nil {
+			return fmt.Errorf("bucket %s not found", bucket)
+		}
+		if tx.Bucket(UnitBucket(bucket)) != nil {
+			if err := tx.DeleteBucket(UnitBucket(bucket)); err != nil {
+				return err
+			}
+		}
+		units, err := tx.CreateBucket(UnitBucket(bucket))
+		if err != nil {
+			return err
+		}
+		return ForEach(counts, func(k, v []byte) error {
+			return units.Put(k, EncodeUnit(DecodeVector(v)))
+		})
+	})
+	if err != nil {
+		return err
+	}
+	var normalized []string
+	ReadMetadata(db, "unit", &normalized)
+	for _, name := range normalized {
+		if name == string(bucket) {
+			return nil
+		}
+	}
+	WriteMetadata(db, "unit", append(normalized, string(bucket)))
+	units.Delete(unit{db: db, bucket: string(bucket)})
+	return nil
+}
+
+// Denormalize removes the unit vectors of a model bucket after its histograms change
+func Denormalize(tx *bolt.Tx, bucket []byte) error {
+	if tx.Bucket(UnitBucket(bucket)) == nil {
+		return nil
+	}
+	if err := tx.DeleteBucket(UnitBucket(bucket)); err != nil {
+		return err
+	}
+	units.Delete(unit{db: tx.DB(), bucket: string(bucket)})
+	metadata := tx.Bucket(MetadataBucket)
+	if metadata == nil {
+		return nil
+	}
+	var normalized, kept []string
+	if data := metadata.Get([]byte(Namespace + "unit")); data != nil {
+		if err := json.Unmarshal(data, &normalized); err != nil {
+			return err
+		}
+	}
+	for _, name := range normalized {
+		if name != string(bucket) {
+			kept = append(kept, name)
+		}
+	}
+	data, err := json.Marshal(kept)
+	if err != nil {
+		return err
+	}
+	return metadata.Put([]byte(Namespace+"unit"), data)
+}
+
+func normalize() {
+	db := OpenModel(*FlagModel)
+	defer db.Close()
+	for _, bucket := range ModelBuckets(db) {
+		if err := Normalize(db, []byte(bucket)); err != nil {
+			Fail(ExitCorruptModel, err)
+		}
+		fmt.Println("normalized", bucket)
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"math"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestNormalize(t *testing.T) {
+	db := NewTestModel(t)
+	text := append([]byte(Corpus[:64]), 'x')
+	expected := SelfEntropy(db, text, nil)[0]
+	if Normalized(db) {
+		t.Fatal("the model shouldn't be normalized")
+	}
+	if err := Normalize(db, ModelBucket); err != nil {
+		t.Fatal(err)
+	}
+	if !Normalized(db) {
+		t.Fatal("the model should be normalized")
+	}
+	window := WindowVector{}
+	copy(window.Key[:], text)
+	if !UnitLookup(db, &window) || !window.Found || len(window.Weight) != 256 {
+		t.Fatal("the unit vectors should be found")
+	}
+	entropy := SelfEntropy(db, text, nil)[0]
+	if math.Abs(entropy-expected) > 1e-6*math.Abs(expected) {
+		t.Fatalf("normalized entropy %v is too far from %v", entropy, expected)
+	}
+
+	s := NewLRU(1024)
+	s.Learn([]byte(Corpus))
+	s.Close()
+	MergeModel(db, ModelBucket, &s)
+	if Normalized(db) {
+		t.Fatal("merging should remove the stale unit vectors")
+	}
+	db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket(UnitBucket(ModelBucket)) != nil {
+			t.Fatal("the unit bucket should be deleted")
+		}
+		return nil
+	})
+}
@@ -0,0 +1,45 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrEmptyInput is returned when there is no data to learn
+var ErrEmptyInput = errors.New("empty input")
+
+// PadSymbol is the symbol that marks the beginning of a text
+var PadSymbol byte
+
+// SetPadSymbol sets the padding symbol, it must be a byte
+func SetPadSymbol(symbol int) error {
+	if symbol < 0 || symbol > 255 {
+		return fmt.Errorf("padding symbol %d is not a byte", symbol)
+	}
+	PadSymbol = byte(symbol)
+	return nil
+}
+
+// Padding returns n padding symbols
+func Padding(n int) []byte {
+	padding := make([]byte, n)
+	if PadSymbol != 0 {
+		for i := range padding {
+			padding[i] = PadSymbol
+		}
+	}
+	return padding
+}
+
+// Pad pads a prompt with the beginning of text so that the prompt and a candidate byte fill a context
+func Pad(prompt []byte) []byte {
+	n := Order - 2
+	if len(prompt)+n < Order-1 {
+		n = Order - 1 - len(prompt)
+	}
+	return append(Padding(n), prompt...)
+}
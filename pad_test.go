@@ -0,0 +1,30 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPad(t *testing.T) {
+	if len(Pad(nil)) != Order-1 || len(Pad([]byte("a"))) != Order-1 || len(Pad([]byte("ab"))) != Order {
+		t.Fatal("prompts should be padded to fill a context")
+	}
+	if err := SetPadSymbol(256); err == nil {
+		t.Fatal("the padding symbol should be a byte")
+	}
+	if err := SetPadSymbol(' '); err != nil {
+		t.Fatal(err)
+	}
+	defer SetPadSymbol(0)
+	if !bytes.Equal(Pad([]byte("ab")), append(bytes.Repeat([]byte(" "), Order-2), "ab"...)) {
+		t.Fatal("prompts should be padded with the padding symbol")
+	}
+	s := NewLRU(1024)
+	if err := s.Learn(nil); err != ErrEmptyInput {
+		t.Fatal("empty input should be an error", err)
+	}
+}
@@ -0,0 +1,44 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+
+	"github.com/pointlander/compress"
+	bolt "go.etcd.io/bbolt"
+)
+
+// BigramVectors returns the unit vectors of the contexts of the model bucket that only have their last two bytes,
+// indexed by the two bytes. The shards are scanned concurrently, each into its own map.
+func BigramVectors(db *bolt.DB) (map[int][]float64, error) {
+	shards := make([]map[int][]float64, Shards)
+	for i := range shards {
+		shards[i] = make(map[int][]float64)
+	}
+	err := ScanShards(db, ModelBucket, func(shard int, k, v []byte) error {
+		if len(k) != len(Symbols{}) {
+			return nil
+		}
+		for _, symbol := range k[:len(k)-2] {
+			if symbol != 0 {
+				return nil
+			}
+		}
+		output := make([]byte, 2*Width)
+		compress.Mark1Decompress1(bytes.NewBuffer(v), output)
+		vector := make([]float64, Width)
+		UnitBytes(vector, output)
+		shards[shard][int(k[len(k)-2])<<8|int(k[len(k)-1])] = vector
+		return nil
+	})
+	vectors := make(map[int][]float64)
+	for _, shard := range shards {
+		for node, vector := range shard {
+			vectors[node] = vector
+		}
+	}
+	return vectors, err
+}
@@ -0,0 +1,39 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"math"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestBigramVectors(t *testing.T) {
+	db := NewTestModel(t)
+	vectors, err := BigramVectors(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vectors) == 0 {
+		t.Fatal("the model should have bigram contexts")
+	}
+	for key, vector := range vectors {
+		symbol := Symbols{}
+		symbol[len(symbol)-2], symbol[len(symbol)-1] = byte(key>>8), byte(key)
+		found := false
+		db.View(func(tx *bolt.Tx) error {
+			found = Get(tx.Bucket(ModelBucket), symbol[:]) != nil
+			return nil
+		})
+		sum := 0.0
+		for _, value := range vector {
+			sum += value * value
+		}
+		if !found || math.Abs(sum-1) > 1e-9 {
+			t.Fatal("unexpected bigram vector", key, found, sum)
+		}
+	}
+}
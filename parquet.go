@@ -0,0 +1,342 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"runtime"
+)
+
+const (
+	// ParquetMagic starts and ends a parquet file
+	ParquetMagic = "PAR1"
+	// ParquetRowGroup is the number of rows of a row group, the rows of a group are buffered in memory
+	ParquetRowGroup = 1 << 20
+)
+
+// the thrift compact protocol types used by the parquet metadata
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// the parquet physical types, repetition, encodings and page types
+const (
+	parquetInt32     = 1
+	parquetDouble    = 5
+	parquetByteArray = 6
+	parquetRequired  = 0
+	parquetUTF8      = 0
+	parquetPlain     = 0
+	parquetRLE       = 3
+	parquetDataPage  = 0
+)
+
+// compact encodes thrift structs with the compact protocol
+type compact struct {
+	bytes.Buffer
+	// last are the last field ids of the open structs
+	last []int16
+}
+
+func (c *compact) varint(v uint64) {
+	for v >= 0x80 {
+		c.WriteByte(byte(v) | 0x80)
+		v >>= 7
+	}
+	c.WriteByte(byte(v))
+}
+
+func (c *compact) zigzag(v int64) {
+	c.varint(uint64((v << 1) ^ (v >> 63)))
+}
+
+func (c *compact) field(id int16, kind byte) {
+	last := &c.last[len(c.last)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		c.WriteByte(byte(delta)<<4 | kind)
+	} else {
+		c.WriteByte(kind)
+		c.zigzag(int64(id))
+	}
+	*last = id
+}
+
+// begin begins a struct, a field of the struct or an element of a list of structs
+func (c *compact) begin() {
+	c.last = append(c.last, 0)
+}
+
+// end ends a struct with the stop field
+func (c *compact) end() {
+	c.WriteByte(0)
+	c.last = c.last[:len(c.last)-1]
+}
+
+func (c *compact) i32(id int16, v int32) {
+	c.field(id, thriftI32)
+	c.zigzag(int64(v))
+}
+
+func (c *compact) i64(id int16, v int64) {
+	c.field(id, thriftI64)
+	c.zigzag(v)
+}
+
+func (c *compact) text(v string) {
+	c.varint(uint64(len(v)))
+	c.WriteString(v)
+}
+
+func (c *compact) binary(id int16, v string) {
+	c.field(id, thriftBinary)
+	c.text(v)
+}
+
+func (c *compact) list(id int16, kind byte, size int) {
+	c.field(id, thriftList)
+	if size < 15 {
+		c.WriteByte(byte(size)<<4 | kind)
+		return
+	}
+	c.WriteByte(0xf0 | kind)
+	c.varint(uint64(size))
+}
+
+func (c *compact) structure(id int16) {
+	c.field(id, thriftStruct)
+	c.begin()
+}
+
+// parquetColumn is a column of the entropy table
+type parquetColumn struct {
+	Name string
+	Type int32
+	UTF8 bool
+}
+
+// EntropyColumns are the columns of the exported entropy table
+var EntropyColumns = []parquetColumn{
+	{Name: "document", Type: parquetByteArray, UTF8: true},
+	{Name: "position", Type: parquetInt32},
+	{Name: "symbol", Type: parquetInt32},
+	{Name: "order", Type: parquetInt32},
+	{Name: "entropy", Type: parquetDouble},
+}
+
+// parquetChunk is the metadata of a written column chunk
+type parquetChunk struct {
+	Offset, Size int64
+}
+
+// parquetGroup is the metadata of a written row group
+type parquetGroup struct {
+	Rows   int64
+	Chunks []parquetChunk
+}
+
+// EntropyWriter writes the per position entropies of documents as a parquet file, one row per position with
+// the document, position, symbol, backoff order and entropy columns. The columns are required and plain encoded
+// without compression, so the file is read by DuckDB, Pandas and Arrow without a bespoke parser.
+type EntropyWriter struct {
+	w         io.Writer
+	offset    int64
+	documents bytes.Buffer
+	integers  [3]bytes.Buffer
+	entropies bytes.Buffer
+	rows      int64
+	groups    []parquetGroup
+}
+
+// NewEntropyWriter creates an entropy writer and writes the leading magic
+func NewEntropyWriter(w io.Writer) (*EntropyWriter, error) {
+	e := &EntropyWriter{w: w}
+	if err := e.write([]byte(ParquetMagic)); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (e *EntropyWriter) write(data []byte) error {
+	n, err := e.w.Write(data)
+	e.offset += int64(n)
+	return err
+}
+
+// Write adds the positions of a document, a full row group is written out
+func (e *EntropyWriter) Write(document string, positions []PositionEntropy) error {
+	var buffer [8]byte
+	for _, position := range positions {
+		binary.LittleEndian.PutUint32(buffer[:4], uint32(len(document)))
+		e.documents.Write(buffer[:4])
+		e.documents.WriteString(document)
+		for i, value := range []int{position.Position, int(position.Symbol[0]), position.Order} {
+			binary.LittleEndian.PutUint32(buffer[:4], uint32(value))
+			e.integers[i].Write(buffer[:4])
+		}
+		binary.LittleEndian.PutUint64(buffer[:], math.Float64bits(position.Entropy))
+		e.entropies.Write(buffer[:])
+		e.rows++
+		if e.rows == ParquetRowGroup {
+			if err := e.flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// flush writes the buffered rows as a row group with a data page per column
+func (e *EntropyWriter) flush() error {
+	if e.rows == 0 {
+		return nil
+	}
+	group := parquetGroup{Rows: e.rows}
+	for _, data := range []*bytes.Buffer{&e.documents, &e.integers[0], &e.integers[1], &e.integers[2], &e.entropies} {
+		header := compact{}
+		header.begin()
+		header.i32(1, parquetDataPage)
+		header.i32(2, int32(data.Len()))
+		header.i32(3, int32(data.Len()))
+		header.structure(5)
+		header.i32(1, int32(e.rows))
+		header.i32(2, parquetPlain)
+		header.i32(3, parquetRLE)
+		header.i32(4, parquetRLE)
+		header.end()
+		header.end()
+		chunk := parquetChunk{Offset: e.offset, Size: int64(header.Len() + data.Len())}
+		if err := e.write(header.Bytes()); err != nil {
+			return err
+		}
+		if err := e.write(data.Bytes()); err != nil {
+			return err
+		}
+		data.Reset()
+		group.Chunks = append(group.Chunks, chunk)
+	}
+	e.groups, e.rows = append(e.groups, group), 0
+	return nil
+}
+
+// Close writes the last row group and the footer, the underlying writer isn't closed
+func (e *EntropyWriter) Close() error {
+	if err := e.flush(); err != nil {
+		return err
+	}
+	rows := int64(0)
+	for _, group := range e.groups {
+		rows += group.Rows
+	}
+	footer := compact{}
+	footer.begin()
+	footer.i32(1, 1)
+	footer.list(2, thriftStruct, len(EntropyColumns)+1)
+	footer.begin()
+	footer.binary(4, "schema")
+	footer.i32(5, int32(len(EntropyColumns)))
+	footer.end()
+	for _, column := range EntropyColumns {
+		footer.begin()
+		footer.i32(1, column.Type)
+		footer.i32(3, parquetRequired)
+		footer.binary(4, column.Name)
+		if column.UTF8 {
+			footer.i32(6, parquetUTF8)
+		}
+		footer.end()
+	}
+	footer.i64(3, rows)
+	footer.list(4, thriftStruct, len(e.groups))
+	for _, group := range e.groups {
+		footer.begin()
+		footer.list(1, thriftStruct, len(group.Chunks))
+		size := int64(0)
+		for i, chunk := range group.Chunks {
+			size += chunk.Size
+			footer.begin()
+			footer.i64(2, chunk.Offset)
+			footer.structure(3)
+			footer.i32(1, EntropyColumns[i].Type)
+			footer.list(2, thriftI32, 2)
+			footer.zigzag(parquetPlain)
+			footer.zigzag(parquetRLE)
+			footer.list(3, thriftBinary, 1)
+			footer.text(EntropyColumns[i].Name)
+			footer.i32(4, 0)
+			footer.i64(5, group.Rows)
+			footer.i64(6, chunk.Size)
+			footer.i64(7, chunk.Size)
+			footer.i64(9, chunk.Offset)
+			footer.end()
+			footer.end()
+		}
+		footer.i64(2, size)
+		footer.i64(3, group.Rows)
+		footer.end()
+	}
+	footer.binary(6, "lit")
+	footer.end()
+	length := [4]byte{}
+	binary.LittleEndian.PutUint32(length[:], uint32(footer.Len()))
+	for _, data := range [][]byte{footer.Bytes(), length[:], []byte(ParquetMagic)} {
+		if err := e.write(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func exportEntropy() {
+	db := OpenModel(*FlagModel)
+	defer db.Close()
+	defer BeginRead(db)()
+
+	file, err := os.Create(*FlagExportEntropy)
+	if err != nil {
+		Fail(ExitData, err)
+	}
+	defer file.Close()
+	writer, err := NewEntropyWriter(file)
+	if err != nil {
+		Fail(ExitData, err)
+	}
+	source := OpenSources()
+	defer source.Close()
+	documents := 0
+	for {
+		url, plain, err := source.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			Fail(ExitData, err)
+		}
+		if plain == "" {
+			continue
+		}
+		Check()
+		if err := writer.Write(url, PositionEntropies(db, []byte(plain))); err != nil {
+			Fail(ExitData, err)
+		}
+		documents++
+		if documents%100 == 0 {
+			fmt.Println("exported", documents, "documents")
+			runtime.GC()
+		}
+	}
+	if err := writer.Close(); err != nil {
+		Fail(ExitData, err)
+	}
+	fmt.Println("exported", documents, "documents to", *FlagExportEntropy)
+}
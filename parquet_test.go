@@ -0,0 +1,202 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"testing"
+)
+
+// thriftReader decodes the thrift compact protocol as the parquet specification defines it,
+// structs are decoded into maps of the field ids and lists into slices
+type thriftReader struct {
+	data   []byte
+	offset int
+	err    error
+}
+
+func (r *thriftReader) byte() byte {
+	if r.offset >= len(r.data) {
+		r.err = errors.New("unexpected end of the thrift data")
+		return 0
+	}
+	r.offset++
+	return r.data[r.offset-1]
+}
+
+func (r *thriftReader) varint() uint64 {
+	v := uint64(0)
+	for shift := 0; shift < 64 && r.err == nil; shift += 7 {
+		b := r.byte()
+		v |= uint64(b&0x7f) << shift
+		if b < 0x80 {
+			return v
+		}
+	}
+	return v
+}
+
+func (r *thriftReader) zigzag() int64 {
+	v := r.varint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (r *thriftReader) bytes(n int) []byte {
+	if n < 0 || r.offset+n > len(r.data) {
+		r.err = errors.New("thrift binary out of range")
+		return nil
+	}
+	r.offset += n
+	return r.data[r.offset-n : r.offset]
+}
+
+func (r *thriftReader) value(kind byte) interface{} {
+	switch kind {
+	case 1:
+		return true
+	case 2:
+		return false
+	case 3:
+		return int64(int8(r.byte()))
+	case 4, thriftI32, thriftI64:
+		return r.zigzag()
+	case 7:
+		return math.Float64frombits(binary.LittleEndian.Uint64(r.bytes(8)))
+	case thriftBinary:
+		return string(r.bytes(int(r.varint())))
+	case thriftList:
+		header := r.byte()
+		size, element := int(header>>4), header&0x0f
+		if size == 15 {
+			size = int(r.varint())
+		}
+		list := make([]interface{}, 0, size)
+		for i := 0; i < size && r.err == nil; i++ {
+			list = append(list, r.value(element))
+		}
+		return list
+	case thriftStruct:
+		return r.structure()
+	}
+	r.err = errors.New("unknown thrift type")
+	return nil
+}
+
+func (r *thriftReader) structure() map[int16]interface{} {
+	fields, last := make(map[int16]interface{}), int16(0)
+	for r.err == nil {
+		header := r.byte()
+		if header == 0 {
+			break
+		}
+		if delta := int16(header >> 4); delta != 0 {
+			last += delta
+		} else {
+			last = int16(r.zigzag())
+		}
+		fields[last] = r.value(header & 0x0f)
+	}
+	return fields
+}
+
+func TestEntropyWriter(t *testing.T) {
+	db := NewTestModel(t)
+	out := bytes.Buffer{}
+	writer, err := NewEntropyWriter(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, b := PositionEntropies(db, []byte("it was the best")), PositionEntropies(db, []byte("zq"))
+	writer.Write("a", a)
+	writer.Write("b", b)
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data := out.Bytes()
+	if !bytes.HasPrefix(data, []byte(ParquetMagic)) || !bytes.HasSuffix(data, []byte(ParquetMagic)) {
+		t.Fatal("the file should start and end with the magic")
+	}
+	length := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	if length <= 0 || length > len(data)-12 {
+		t.Fatal("invalid footer length", length)
+	}
+	footer := thriftReader{data: data[len(data)-8-length : len(data)-8]}
+	meta := footer.structure()
+	if footer.err != nil || footer.offset != length {
+		t.Fatal("the footer should be one thrift struct", footer.err, footer.offset, length)
+	}
+
+	positions := append(a, b...)
+	if meta[1] != int64(1) || meta[3] != int64(len(positions)) {
+		t.Fatal("unexpected version or number of rows", meta[1], meta[3])
+	}
+	schema := meta[2].([]interface{})
+	if len(schema) != len(EntropyColumns)+1 || schema[0].(map[int16]interface{})[5] != int64(len(EntropyColumns)) {
+		t.Fatal("the schema should have a root with the columns", schema)
+	}
+	for i, column := range EntropyColumns {
+		element := schema[i+1].(map[int16]interface{})
+		if element[4] != column.Name || element[1] != int64(column.Type) || element[3] != int64(parquetRequired) {
+			t.Fatal("unexpected schema element", element)
+		}
+	}
+
+	groups := meta[4].([]interface{})
+	if len(groups) != 1 {
+		t.Fatal("the rows should be in one row group", len(groups))
+	}
+	group := groups[0].(map[int16]interface{})
+	chunks := group[1].([]interface{})
+	if group[3] != int64(len(positions)) || len(chunks) != len(EntropyColumns) {
+		t.Fatal("unexpected row group", group)
+	}
+	columns := make([][]interface{}, len(EntropyColumns))
+	for i, chunk := range chunks {
+		metadata := chunk.(map[int16]interface{})[3].(map[int16]interface{})
+		offset := int(metadata[9].(int64))
+		if metadata[5] != int64(len(positions)) || metadata[4] != int64(0) {
+			t.Fatal("unexpected column chunk", metadata)
+		}
+		page := thriftReader{data: data[offset:]}
+		header := page.structure()
+		if page.err != nil || header[1] != int64(parquetDataPage) {
+			t.Fatal("the column chunk should start with a data page header", page.err, header)
+		}
+		if size := int64(page.offset) + header[3].(int64); size != metadata[7] {
+			t.Fatal("the chunk size should be the header and the page", size, metadata[7])
+		}
+		values := thriftReader{data: page.bytes(int(header[3].(int64)))}
+		for range positions {
+			switch EntropyColumns[i].Type {
+			case parquetByteArray:
+				n := int(binary.LittleEndian.Uint32(values.bytes(4)))
+				columns[i] = append(columns[i], string(values.bytes(n)))
+			case parquetInt32:
+				columns[i] = append(columns[i], int(int32(binary.LittleEndian.Uint32(values.bytes(4)))))
+			case parquetDouble:
+				columns[i] = append(columns[i], math.Float64frombits(binary.LittleEndian.Uint64(values.bytes(8))))
+			}
+		}
+		if values.err != nil || values.offset != len(values.data) {
+			t.Fatal("the page should have a plain value for each row", EntropyColumns[i].Name, values.err)
+		}
+	}
+
+	for i, position := range positions {
+		document := "a"
+		if i >= len(a) {
+			document = "b"
+		}
+		row := []interface{}{document, position.Position, int(position.Symbol[0]), position.Order, position.Entropy}
+		for j, value := range row {
+			if columns[j][i] != value {
+				t.Fatalf("row %d column %s is %v not %v", i, EntropyColumns[j].Name, columns[j][i], value)
+			}
+		}
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// PositionChunk is the number of positions whose entropies are computed together, the self entropy
+// of a chunk is quadratic in its length
+const PositionChunk = 1024
+
+// PositionEntropy is the entropy contribution of a byte of a text
+type PositionEntropy struct {
+	Position int    `json:"position"`
+	Symbol   string `json:"symbol"`
+	// Order is the backoff of the context window that ends with the byte, 0 for the full context and Order-1 if it isn't found
+	Order   int     `json:"order"`
+	Entropy float64 `json:"entropy"`
+}
+
+// PositionEntropies computes the direct self entropy of each byte of the input, the entropy of the context
+// window that ends with the byte. The input is padded so the first bytes have a window. Long inputs are
+// computed in chunks of PositionChunk bytes, each window keeps its context across the chunks.
+func PositionEntropies(db *bolt.DB, input []byte) []PositionEntropy {
+	positions := make([]PositionEntropy, 0, len(input))
+	for start := 0; start < len(input); start += PositionChunk {
+		end := start + PositionChunk
+		if end > len(input) {
+			end = len(input)
+		}
+		chunk := Padding(Order - 1)
+		if start > 0 {
+			chunk = append(chunk[:0], input[start-Order+1:start]...)
+		}
+		entropies, orders := DirectSelfEntropyOrders(db, append(chunk, input[start:end]...), nil)
+		for i, symbol := range input[start:end] {
+			positions = append(positions, PositionEntropy{
+				Position: start + i,
+				Symbol:   string([]byte{symbol}),
+				Order:    orders[i],
+				Entropy:  entropies[i],
+			})
+		}
+	}
+	return positions
+}
+
+// WritePositions writes the entropy of each position as json lines, or as tab separated values with a header
+func WritePositions(w io.Writer, positions []PositionEntropy, asJSON bool) error {
+	if asJSON {
+		encoder := json.NewEncoder(w)
+		for _, position := range positions {
+			if err := encoder.Encode(position); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if _, err := fmt.Fprintln(w, "position\tsymbol\torder\tentropy"); err != nil {
+		return err
+	}
+	for _, position := range positions {
+		if _, err := fmt.Fprintf(w, "%d\t%s\t%d\t%f\n", position.Position, strconv.Quote(position.Symbol), position.Order, position.Entropy); err != nil {
+			return err
+		}
+	}
+	return nil
+}
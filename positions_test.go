@@ -0,0 +1,40 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestPositionEntropies(t *testing.T) {
+	db := NewTestModel(t)
+	input := []byte("it was the zqxj")
+	positions := PositionEntropies(db, input)
+	if len(positions) != len(input) || positions[3].Symbol != "w" || positions[3].Position != 3 {
+		t.Fatal("every byte should have an entropy", positions)
+	}
+	direct := DirectSelfEntropy(db, append(Padding(Order-1), input...), nil)
+	if positions[len(input)-1].Entropy != direct[len(direct)-1] {
+		t.Fatal("the last position should have the entropy of the last window")
+	}
+	out := bytes.Buffer{}
+	if err := WritePositions(&out, positions, false); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(out.String()), "\n"); len(lines) != len(input)+1 || lines[0] != "position\tsymbol\torder\tentropy" {
+		t.Fatal("unexpected tab separated values", out.String())
+	}
+	out.Reset()
+	if err := WritePositions(&out, positions, true); err != nil {
+		t.Fatal(err)
+	}
+	var position PositionEntropy
+	if err := json.Unmarshal(bytes.Split(out.Bytes(), []byte("\n"))[1], &position); err != nil || position.Symbol != "t" {
+		t.Fatal("unexpected json", position, err)
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const (
+	// PostKeep emits the unprocessed output when the post-processing command fails
+	PostKeep = "keep"
+	// PostDrop doesn't emit the output when the post-processing command fails
+	PostDrop = "drop"
+	// PostFail stops the generation when the post-processing command fails
+	PostFail = "fail"
+)
+
+// PostProcessor pipes each emitted output through an external command, the standard output of the command
+// replaces the output. It integrates detokenizers, translators and validators with the generation.
+type PostProcessor struct {
+	Args    []string
+	Timeout time.Duration
+	// Policy is what happens to the output when the command fails or times out: keep, drop or fail
+	Policy string
+}
+
+// PostProcess is the post-processor of -post-cmd, nil emits the output as is
+var PostProcess *PostProcessor
+
+// NewPostProcessor creates a post-processor, the command is split on spaces
+func NewPostProcessor(command string, timeout time.Duration, policy string) (*PostProcessor, error) {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return nil, fmt.Errorf("the post-processing command is empty")
+	}
+	if timeout <= 0 {
+		return nil, fmt.Errorf("the post-processing timeout should be positive")
+	}
+	switch policy {
+	case PostKeep, PostDrop, PostFail:
+	default:
+		return nil, fmt.Errorf("unknown post-processing policy %q, it should be keep, drop or fail", policy)
+	}
+	return &PostProcessor{
+		Args:    args,
+		Timeout: timeout,
+		Policy:  policy,
+	}, nil
+}
+
+// Run runs the command with the output as its standard input and returns its standard output.
+// A trailing newline the command adds to an output without one is removed.
+func (p *PostProcessor) Run(output []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(Context, p.Timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, p.Args[0], p.Args[1:]...)
+	stdout, stderr := bytes.Buffer{}, bytes.Buffer{}
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = bytes.NewReader(output), &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			err = fmt.Errorf("timed out after %s", p.Timeout)
+		}
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			err = fmt.Errorf("%w: %s", err, message)
+		}
+		return nil, fmt.Errorf("post-processing command %s: %w", p.Args[0], err)
+	}
+	processed := stdout.Bytes()
+	if !bytes.HasSuffix(output, []byte("\n")) {
+		processed = bytes.TrimSuffix(processed, []byte("\n"))
+	}
+	return processed, nil
+}
+
+// Apply post-processes an output and returns false if it shouldn't be emitted.
+// With the fail policy a failure of the command stops the generation. A nil post-processor returns the output.
+func (p *PostProcessor) Apply(output []byte) ([]byte, bool) {
+	if p == nil {
+		return output, true
+	}
+	processed, err := p.Run(output)
+	if err == nil {
+		return processed, true
+	}
+	switch p.Policy {
+	case PostDrop:
+		fmt.Fprintln(os.Stderr, err, "dropping the output")
+		return nil, false
+	case PostFail:
+		panic(stop{err: &Error{Code: ExitPostProcess, Err: err}})
+	}
+	fmt.Fprintln(os.Stderr, err, "keeping the output")
+	return output, true
+}
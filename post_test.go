@@ -0,0 +1,71 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPostProcessCommand(t *testing.T) {
+	switch os.Getenv("LIT_POST_PROCESS") {
+	case "upper":
+		data, _ := io.ReadAll(os.Stdin)
+		os.Stdout.Write(append(bytes.ToUpper(data), '\n'))
+		os.Exit(0)
+	case "fail":
+		os.Stderr.WriteString("invalid output")
+		os.Exit(1)
+	case "sleep":
+		time.Sleep(time.Minute)
+		os.Exit(0)
+	}
+	t.Skip("run as the subprocess of TestPostProcess")
+}
+
+func TestPostProcess(t *testing.T) {
+	if _, err := NewPostProcessor(os.Args[0], time.Second, "ignore"); err == nil {
+		t.Fatal("an unknown policy should be an error")
+	}
+	defer os.Unsetenv("LIT_POST_PROCESS")
+	command := os.Args[0] + " -test.run=^TestPostProcessCommand$"
+	os.Setenv("LIT_POST_PROCESS", "upper")
+	post, err := NewPostProcessor(command, 10*time.Second, PostFail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output, ok := post.Apply([]byte("it was")); !ok || string(output) != "IT WAS" {
+		t.Fatal("the output should be replaced by the output of the command", string(output))
+	}
+
+	os.Setenv("LIT_POST_PROCESS", "fail")
+	post.Policy = PostKeep
+	if output, ok := post.Apply([]byte("it was")); !ok || string(output) != "it was" {
+		t.Fatal("the keep policy should emit the unprocessed output", string(output))
+	}
+	post.Policy = PostDrop
+	if _, ok := post.Apply([]byte("it was")); ok {
+		t.Fatal("the drop policy shouldn't emit the output")
+	}
+	post.Policy = PostFail
+	err = Stopped(func() {
+		post.Apply([]byte("it was"))
+	})
+	var e *Error
+	if !errors.As(err, &e) || e.Code != ExitPostProcess || !strings.Contains(err.Error(), "invalid output") {
+		t.Fatal("the fail policy should stop the generation with the error of the command", err)
+	}
+
+	os.Setenv("LIT_POST_PROCESS", "sleep")
+	post.Timeout = 100 * time.Millisecond
+	if _, err := post.Run([]byte("it was")); err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatal("the command should time out", err)
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/pointlander/lit/matrix"
+)
+
+// WindowVectors returns the unit vectors and the backoff order of a looked up window.
+// Windows that aren't found get random vectors drawn from rnd, the second vector is nil unless Size is 2.
+func WindowVectors(rnd *rand.Rand, window WindowVector) (weight, hmm []float64, order int) {
+	if window.Found {
+		return window.Weight, window.HMM, window.Order
+	}
+	random := func() []float64 {
+		vector, sum := make([]float64, 256), 0.0
+		for key := range vector {
+			v := rnd.Float64()
+			sum += v * v
+			vector[key] = v
+		}
+		length := math.Sqrt(sum)
+		for i, v := range vector {
+			vector[i] = v / length
+		}
+		return vector
+	}
+	weight = random()
+	if Size == 2 {
+		hmm = random()
+	}
+	return weight, hmm, Order - 1
+}
+
+// Prefix caches the window vectors of a text, so that the self entropy of the text extended by a byte
+// only looks up the new window
+type Prefix struct {
+	DB     *bolt.DB
+	Text   []byte
+	Orders []int
+	// Weights and HMM are the vectors of the windows of the text
+	Weights, HMM []float64
+	// Fallback and FallbackHMM are the random vectors of the new window if it isn't found
+	Fallback, FallbackHMM []float64
+}
+
+// NewPrefix computes the window vectors of a text, the text should be at least Order-1 bytes
+func NewPrefix(db *bolt.DB, text []byte) *Prefix {
+	rnd := rand.New(rand.NewSource(1))
+	p := &Prefix{
+		DB:   db,
+		Text: text,
+	}
+	for _, window := range Windows(db, text) {
+		weight, hmm, order := WindowVectors(rnd, window)
+		p.Orders = append(p.Orders, order)
+		p.Weights = append(p.Weights, weight...)
+		p.HMM = append(p.HMM, hmm...)
+	}
+	p.Fallback, p.FallbackHMM, _ = WindowVectors(rnd, WindowVector{})
+	return p
+}
+
+// SelfEntropy computes the self entropy of the text extended by a symbol, it is the same as
+// SelfEntropy(db, append(text, symbol), nil)
+func (p *Prefix) SelfEntropy(symbol byte) []float64 {
+	return p.Score(symbol, matrix.SelfEntropyKernel)
+}
+
+// Prefilter keeps the k candidates with the lowest self entropy under the fast spherical kernel,
+// so the full kernel only rescores those. The candidates are returned in their original order.
+func (p *Prefix) Prefilter(candidates []byte, k int) []byte {
+	if k <= 0 || k >= len(candidates) {
+		return candidates
+	}
+	scores := make([]float64, 256)
+	ranked := make([]byte, len(candidates))
+	copy(ranked, candidates)
+	for _, candidate := range ranked {
+		for _, value := range p.Score(candidate, matrix.FastSelfEntropyKernel) {
+			scores[candidate] += value
+		}
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return scores[ranked[i]] < scores[ranked[j]]
+	})
+	keep := [256]bool{}
+	for _, candidate := range ranked[:k] {
+		keep[candidate] = true
+	}
+	filtered := make([]byte, 0, k)
+	for _, candidate := range candidates {
+		if keep[candidate] {
+			filtered = append(filtered, candidate)
+		}
+	}
+	return filtered
+}
+
+// Score computes the self entropy of the text extended by a symbol with the given kernel
+func (p *Prefix) Score(symbol byte, kernel func(Q, K, V, I matrix.Matrix) float64) []float64 {
+	var key Symbols
+	window := append(append(make([]byte, 0, Order), p.Text[len(p.Text)-Order+1:]...), symbol)
+	for j := range key {
+		key[j] = window[Indexes[j]]
+	}
+	weight, hmm, order := p.Fallback, p.FallbackHMM, Order-1
+	if window := LookupWindow(p.DB, key); window.Found {
+		weight, hmm, order = WindowVectors(nil, window)
+	}
+
+	rows := len(p.Orders) + 1
+	weights := matrix.NewMatrix(0, 256, rows)
+	weights.Data = append(append(weights.Data, p.Weights...), weight...)
+	importance := matrix.NewMatrix(0, rows, 1)
+	for i, order := range p.Orders {
+		importance.Data = append(importance.Data, Recency(i, rows)/float64(Order-order))
+	}
+	importance.Data = append(importance.Data, Recency(rows-1, rows)/float64(Order-order))
+
+	entropy := make([]float64, 1)
+	entropy[0] = kernel(weights, weights, weights, importance)
+	if Size == 2 {
+		second := matrix.NewMatrix(0, 256, rows)
+		second.Data = append(append(second.Data, p.HMM...), hmm...)
+		entropy[0] += kernel(second, second, second, importance)
+	}
+	return entropy
+}
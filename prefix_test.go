@@ -0,0 +1,77 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/pointlander/lit/matrix"
+)
+
+func TestPrefix(t *testing.T) {
+	db := NewTestModel(t)
+	for _, text := range []string{"it was t", "it was the best of", "qqqqqqqqqqqqq"} {
+		prefix := NewPrefix(db, []byte(text))
+		for _, symbol := range []byte{'h', ' ', 'q', 0} {
+			expected := SelfEntropy(db, append([]byte(text), symbol), nil)[0]
+			if entropy := prefix.SelfEntropy(symbol)[0]; entropy != expected {
+				t.Fatalf("%q+%q: prefix entropy %v != %v", text, symbol, entropy, expected)
+			}
+		}
+	}
+}
+
+func BenchmarkPrefix(b *testing.B) {
+	db, text := NewTestModel(b), []byte(Corpus[:256])
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		prefix := NewPrefix(db, text)
+		for i := 0; i < 256; i++ {
+			prefix.SelfEntropy(byte(i))
+		}
+	}
+}
+
+func BenchmarkNoPrefix(b *testing.B) {
+	db, text := NewTestModel(b), []byte(Corpus[:256])
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for i := 0; i < 256; i++ {
+			SelfEntropy(db, append(text[:len(text):len(text)], byte(i)), nil)
+		}
+	}
+}
+
+func TestPrefilter(t *testing.T) {
+	db := NewTestModel(t)
+	prefix := NewPrefix(db, []byte("it was the best of"))
+	candidates := Candidates(db, []byte("it was the best of"))
+	if len(prefix.Prefilter(candidates, 0)) != len(candidates) {
+		t.Fatal("a zero prefilter should keep every candidate")
+	}
+	filtered := prefix.Prefilter(candidates, 8)
+	if len(filtered) != 8 {
+		t.Fatal("the prefilter should keep k candidates", len(filtered))
+	}
+	kept, pruned := 0.0, math.MaxFloat64
+	for _, candidate := range candidates {
+		fast := prefix.Score(candidate, matrix.FastSelfEntropyKernel)[0]
+		if bytes.IndexByte(filtered, candidate) >= 0 {
+			kept = math.Max(kept, fast)
+		} else {
+			pruned = math.Min(pruned, fast)
+		}
+	}
+	if kept > pruned {
+		t.Fatal("a pruned candidate has a lower fast entropy than a kept one", kept, pruned)
+	}
+	for i := 1; i < len(filtered); i++ {
+		if filtered[i-1] >= filtered[i] {
+			t.Fatal("the filtered candidates should stay in order")
+		}
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// GutenbergStart are the markers for the end of the gutenberg header
+var GutenbergStart = []string{
+	"*** START OF THE PROJECT GUTENBERG EBOOK",
+	"*** START OF THIS PROJECT GUTENBERG EBOOK",
+	"***START OF THE PROJECT GUTENBERG EBOOK",
+}
+
+// GutenbergEnd are the markers for the start of the gutenberg footer
+var GutenbergEnd = []string{
+	"*** END OF THE PROJECT GUTENBERG EBOOK",
+	"*** END OF THIS PROJECT GUTENBERG EBOOK",
+	"***END OF THE PROJECT GUTENBERG EBOOK",
+	"End of the Project Gutenberg EBook",
+	"End of Project Gutenberg's",
+}
+
+// StripGutenberg strips the gutenberg license header and footer from a text
+func StripGutenberg(text string) string {
+	upper := strings.ToUpper(text)
+	for _, marker := range GutenbergStart {
+		if index := strings.Index(upper, strings.ToUpper(marker)); index >= 0 {
+			end := strings.IndexByte(text[index:], '\n')
+			if end < 0 {
+				return ""
+			}
+			text, upper = text[index+end+1:], upper[index+end+1:]
+			break
+		}
+	}
+	for _, marker := range GutenbergEnd {
+		if index := strings.Index(upper, strings.ToUpper(marker)); index >= 0 {
+			text = text[:index]
+			break
+		}
+	}
+	return text
+}
+
+// Strip returns true if the gutenberg boilerplate should be stripped from the training data at path
+func Strip(path string) bool {
+	switch *FlagStrip {
+	case "on":
+		return true
+	case "off":
+		return false
+	case "auto":
+	default:
+		Fail(ExitFlags, fmt.Errorf("invalid strip %s", *FlagStrip))
+	}
+	return strings.HasPrefix(filepath.Base(path), "gutenberg")
+}
+
+// Preprocess prepares the plain text of an article for learning, an empty result means the article should be skipped
+func Preprocess(plain string) string {
+	return PreprocessSource(*FlagData, plain)
+}
+
+// PreprocessSource prepares the plain text of an article of the data source at path
+func PreprocessSource(path, plain string) string {
+	if Strip(path) {
+		plain = StripGutenberg(plain)
+	}
+	if *FlagLang != "" {
+		plain = FilterLanguage(plain, *FlagLang, *FlagLangParagraphs)
+	}
+	return plain
+}
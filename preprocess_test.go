@@ -0,0 +1,45 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+)
+
+func TestStripGutenberg(t *testing.T) {
+	text := "The Project Gutenberg eBook of Test\nlicense\n" +
+		"*** START OF THE PROJECT GUTENBERG EBOOK TEST ***\n" +
+		"It was a dark and stormy night.\n" +
+		"*** END OF THE PROJECT GUTENBERG EBOOK TEST ***\nmore license\n"
+	if stripped := StripGutenberg(text); stripped != "It was a dark and stormy night.\n" {
+		t.Fatalf("unexpected text %q", stripped)
+	}
+	if stripped := StripGutenberg("no markers"); stripped != "no markers" {
+		t.Fatalf("text without markers should be unchanged %q", stripped)
+	}
+}
+
+func TestDetectLanguage(t *testing.T) {
+	tests := []struct {
+		Text     string
+		Language string
+	}{
+		{"It was the best of times, it was the worst of times, and the age of wisdom was with them.", "en"},
+		{"Il était une fois une petite fille de village, la plus jolie qu'on eût su voir et que sa mère aimait.", "fr"},
+		{"Es war einmal ein kleines Mädchen, das hatte jedermann lieb, der sie nur ansah, und die Großmutter.", "de"},
+		{"En un lugar de la Mancha, de cuyo nombre no quiero acordarme, no ha mucho tiempo que vivía un hidalgo.", "es"},
+		{"Нет, я не могу писать по-английски, и это очень плохо для меня.", ""},
+	}
+	for _, test := range tests {
+		if language, _ := DetectLanguage(test.Text); language != test.Language {
+			t.Fatalf("expected %q got %q for %q", test.Language, language, test.Text)
+		}
+	}
+	text := "It was the best of times, it was the worst of times, it was the age of wisdom.\n\n" +
+		"Es war einmal ein kleines Mädchen, das hatte jedermann lieb, der sie nur ansah."
+	if filtered := FilterLanguage(text, "en", true); filtered != "It was the best of times, it was the worst of times, it was the age of wisdom.\n\n" {
+		t.Fatalf("unexpected filtered text %q", filtered)
+	}
+}
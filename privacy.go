@@ -0,0 +1,132 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	crand "crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+// Privacy adds laplace noise to the histograms of a learned model before it is written and drops the small counts,
+// so the model can be shared without revealing the rare sequences of private training text.
+// The noise is calibrated to the L1 sensitivity of the counts to a change of one byte of the training text,
+// which protects single bytes and not whole documents. Only the counts are noised, the contexts that are kept
+// are contexts that occurred in the training text, so this isn't differential privacy over the contexts.
+// It is recorded in the metadata of the model as "privacy", without the seed of the noise.
+type Privacy struct {
+	Mechanism   string
+	Epsilon     float64
+	Sensitivity float64
+	// Threshold is the smallest noisy count that is kept
+	Threshold uint16
+	// Contexts is what the kept contexts reveal, the observed contexts aren't hidden
+	Contexts string
+	rnd      *rand.Rand
+}
+
+// PrivacySensitivity is the L1 sensitivity of the learned counts to a change of one byte of the training text.
+// A window of the text counts its next byte and the Order-1 bytes after it into every backoff key,
+// and with Size 2 the Lookahead bytes after the context into the second histogram. A byte is in the
+// context or the counted bytes of Order+span windows, and changing it moves at most all of their counts.
+// The end of text count of the last context moves too.
+func PrivacySensitivity() float64 {
+	span, counts := Order, Order
+	if Size == 2 {
+		if Lookahead > span {
+			span = Lookahead
+		}
+		counts += Lookahead
+	}
+	return float64(2*(Order+span)*(len(Indexes)-1)*counts + 2)
+}
+
+// ModelPrivacy noises the learned models when -dp-epsilon is set
+var ModelPrivacy *Privacy
+
+// NewPrivacy creates the noising of a model for a privacy budget epsilon, the noise is drawn from rnd
+func NewPrivacy(epsilon float64, threshold int, rnd *rand.Rand) (*Privacy, error) {
+	if epsilon <= 0 || math.IsInf(epsilon, 0) || math.IsNaN(epsilon) {
+		return nil, fmt.Errorf("the privacy epsilon should be positive")
+	}
+	if threshold < 0 || threshold > math.MaxUint16 {
+		return nil, fmt.Errorf("the privacy threshold should be a count")
+	}
+	return &Privacy{
+		Mechanism:   "laplace",
+		Epsilon:     epsilon,
+		Sensitivity: PrivacySensitivity(),
+		Threshold:   uint16(threshold),
+		Contexts:    "observed",
+		rnd:         rnd,
+	}, nil
+}
+
+// PrivacySource is a source of noise seeded from the system's secure random number generator,
+// so the noise can't be reproduced and subtracted
+func PrivacySource() *rand.Rand {
+	seed := make([]byte, 8)
+	if _, err := crand.Read(seed); err != nil {
+		panic(err)
+	}
+	return rand.New(rand.NewSource(int64(binary.LittleEndian.Uint64(seed))))
+}
+
+// Laplace draws laplace noise with the scale of the privacy budget
+func (p *Privacy) Laplace() float64 {
+	u := p.rnd.Float64() - .5
+	return -p.Sensitivity / p.Epsilon * math.Copysign(1, u) * math.Log(1-2*math.Abs(u))
+}
+
+// Noise noises the observed histograms of a model vector, counts below the threshold are dropped
+func (p *Privacy) Noise(vector [Width]uint16) [Width]uint16 {
+	noisy := vector
+	Sections(&vector, func(start int, section []uint16) {
+		for i, count := range section {
+			value := math.Round(float64(count) + p.Laplace())
+			switch {
+			case value < float64(p.Threshold) || value <= 0:
+				noisy[start+i] = 0
+			case value > math.MaxUint16:
+				noisy[start+i] = math.MaxUint16
+			default:
+				noisy[start+i] = uint16(value)
+			}
+		}
+	})
+	return noisy
+}
+
+// Apply noises every vector of the model, the contexts left without counts are dropped
+func (p *Privacy) Apply(model map[Symbols][]uint8) {
+	for _, key := range SortedKeys(model) {
+		noisy, empty := p.Noise(DecodeVector(model[key])), true
+		for _, count := range noisy {
+			if count != 0 {
+				empty = false
+				break
+			}
+		}
+		if empty {
+			delete(model, key)
+			continue
+		}
+		model[key] = EncodeVector(noisy)
+	}
+}
+
+// NoiseEnds noises the end of text counts, the contexts left without counts are dropped
+func (p *Privacy) NoiseEnds(ends map[Symbols]uint32) {
+	for _, key := range SortedEndKeys(ends) {
+		value := math.Round(float64(ends[key]) + p.Laplace())
+		if value < float64(p.Threshold) || value <= 0 {
+			delete(ends, key)
+			continue
+		}
+		ends[key] = uint32(math.Min(value, math.MaxUint32))
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"math"
+	"math/rand"
+	"path/filepath"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestPrivacy(t *testing.T) {
+	if _, err := NewPrivacy(0, 5, rand.New(rand.NewSource(1))); err == nil {
+		t.Fatal("the privacy budget should be positive")
+	}
+	// a budget of the sensitivity draws noise with a scale of one count
+	privacy, err := NewPrivacy(PrivacySensitivity(), 5, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rare, common := [Width]uint16{}, [Width]uint16{}
+	rare['a'], common['a'] = 1, 1000
+	if privacy.Noise(rare)['a'] != 0 {
+		t.Fatal("a single occurrence should be dropped")
+	}
+	if count := privacy.Noise(common)['a']; count < 980 || count > 1020 {
+		t.Fatal("a common count should survive with a little noise", count)
+	}
+
+	s := NewLRU(1024)
+	s.Learn([]byte(Corpus))
+	s.Close()
+	entries := len(s.Model)
+	ModelPrivacy = privacy
+	defer func() {
+		ModelPrivacy = nil
+	}()
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "model.bolt"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	WriteModel(db, []byte("markov"), &s)
+	if len(s.Model) >= entries {
+		t.Fatal("the rare contexts should be dropped", len(s.Model), entries)
+	}
+	stored := Privacy{}
+	if !ReadMetadata(db, "privacy", &stored) || stored.Epsilon != PrivacySensitivity() || stored.Threshold != 5 ||
+		stored.Sensitivity != PrivacySensitivity() || stored.Contexts != "observed" {
+		t.Fatal("the privacy should be recorded in the metadata", stored)
+	}
+}
+
+func TestPrivacySensitivity(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	text := make([]byte, 4*Order+Lookahead)
+	for i := range text {
+		text[i] = byte('a' + rnd.Intn(4))
+	}
+	learn := func(text []byte) LRU {
+		s := NewLRU(1 << 20)
+		s.Learn(text)
+		s.Close()
+		return s
+	}
+	a := learn(text)
+	for _, position := range []int{0, Order, len(text) / 2, len(text) - 1} {
+		changed := append([]byte{}, text...)
+		changed[position] = 'z'
+		b, distance := learn(changed), 0.0
+		for _, key := range SortedKeys(a.Model) {
+			x, y := DecodeVector(a.Model[key]), [Width]uint16{}
+			if v, ok := b.Model[key]; ok {
+				y = DecodeVector(v)
+			}
+			for i := range x {
+				distance += math.Abs(float64(x[i]) - float64(y[i]))
+			}
+		}
+		for _, key := range SortedKeys(b.Model) {
+			if _, ok := a.Model[key]; !ok {
+				for _, count := range DecodeVector(b.Model[key]) {
+					distance += float64(count)
+				}
+			}
+		}
+		for key, count := range a.Ends {
+			distance += math.Abs(float64(count) - float64(b.Ends[key]))
+		}
+		for key, count := range b.Ends {
+			if _, ok := a.Ends[key]; !ok {
+				distance += float64(count)
+			}
+		}
+		if distance == 0 || distance > PrivacySensitivity() {
+			t.Fatal("the change of a byte should move at most the sensitivity", position, distance, PrivacySensitivity())
+		}
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// The phases of the search that are timed for each emitted byte
+const (
+	PhaseLookup     = "lookup"
+	PhaseDecompress = "decompress"
+	PhaseNormalize  = "normalize"
+	PhaseKernel     = "kernel"
+	PhaseSort       = "sort"
+	// PhaseGoroutine is the time a search waits between being started and running in its goroutine
+	PhaseGoroutine = "goroutine"
+)
+
+// Profile records where the time of a generation goes for each emitted byte.
+// The phases of the concurrent searches are summed, so the phases of a byte can take longer than the byte.
+type Profile struct {
+	sync.Mutex
+	// Byte is the index of the byte being generated, it advances when a byte is emitted
+	Byte int
+	// Phases are the time of each phase by byte
+	Phases []map[string]time.Duration
+	// Wall is the elapsed time of each byte
+	Wall []time.Duration
+	last time.Time
+}
+
+// GenerationProfile profiles the generation with -profile-gen, nil if it is disabled
+var GenerationProfile *Profile
+
+// NewProfile creates a profile that starts timing the first byte
+func NewProfile() *Profile {
+	return &Profile{last: time.Now()}
+}
+
+// Timed starts timing a phase of the search, the returned function ends the timing
+func Timed(phase string) func() {
+	p := GenerationProfile
+	if p == nil {
+		return func() {}
+	}
+	start := time.Now()
+	return func() {
+		p.Add(phase, time.Since(start))
+	}
+}
+
+// grow makes room for the current byte
+func (p *Profile) grow() {
+	for len(p.Phases) <= p.Byte {
+		p.Phases = append(p.Phases, make(map[string]time.Duration))
+		p.Wall = append(p.Wall, 0)
+	}
+}
+
+// Add adds time to a phase of the current byte
+func (p *Profile) Add(phase string, elapsed time.Duration) {
+	p.Lock()
+	defer p.Unlock()
+	p.grow()
+	p.Phases[p.Byte][phase] += elapsed
+}
+
+// Emitted ends the timing of the current byte
+func (p *Profile) Emitted() {
+	p.Lock()
+	defer p.Unlock()
+	p.grow()
+	now := time.Now()
+	p.Wall[p.Byte] = now.Sub(p.last)
+	p.last = now
+	p.Byte++
+}
+
+// WriteFolded writes the profile in the folded stack format of flame graph tools, in nanoseconds.
+// The time of a byte that isn't in a timed phase is the self time of the byte.
+func (p *Profile) WriteFolded(w io.Writer) error {
+	p.Lock()
+	defer p.Unlock()
+	for i, phases := range p.Phases {
+		names := make([]string, 0, len(phases))
+		for name := range phases {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		timed := time.Duration(0)
+		for _, name := range names {
+			timed += phases[name]
+			if _, err := fmt.Fprintf(w, "generate;byte %d;%s %d\n", i, name, phases[name].Nanoseconds()); err != nil {
+				return err
+			}
+		}
+		if self := p.Wall[i] - timed; self > 0 {
+			if _, err := fmt.Fprintf(w, "generate;byte %d %d\n", i, self.Nanoseconds()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Save writes the profile to a folded stack file
+func (p *Profile) Save(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(file)
+	if err := p.WriteFolded(writer); err != nil {
+		file.Close()
+		return err
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
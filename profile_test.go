@@ -0,0 +1,41 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestProfileGen(t *testing.T) {
+	db := NewTestModel(t)
+	defer func(profile *Profile) {
+		GenerationProfile = profile
+	}(GenerationProfile)
+	GenerationProfile = NewProfile()
+	SelfEntropy(db, []byte("it was the best of times"), nil)
+	GenerationProfile.Emitted()
+	Timed(PhaseSort)()
+	GenerationProfile.Emitted()
+
+	folded := bytes.Buffer{}
+	if err := GenerationProfile.WriteFolded(&folded); err != nil {
+		t.Fatal(err)
+	}
+	text := folded.String()
+	for _, stack := range []string{"generate;byte 0;lookup ", "generate;byte 0;decompress ", "generate;byte 0;kernel ", "generate;byte 1;sort "} {
+		if !strings.Contains(text, stack) {
+			t.Fatal("the profile should have the stack", stack, text)
+		}
+	}
+	for _, line := range strings.Split(strings.TrimSpace(text), "\n") {
+		fields := strings.Fields(line)
+		if _, err := strconv.ParseInt(fields[len(fields)-1], 10, 64); err != nil {
+			t.Fatal("a folded stack should end in its count", line)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+)
+
+// NormalizePrompt validates and normalizes a generation prompt.
+// Prompts longer than -maxprompt bytes are an error so that the memory of a generation is bounded.
+// Leading padding symbols are removed, they can't be told apart from the padding of the beginning of the text.
+// The other bytes are kept, so binary prompts are generated from as they are and the json records have their exact bytes.
+// Prompts of any length up to the maximum are valid, the modes pad short prompts.
+func NormalizePrompt(prompt []byte) ([]byte, error) {
+	if *FlagMaxPrompt > 0 && len(prompt) > *FlagMaxPrompt {
+		return nil, fmt.Errorf("the prompt is %d bytes, the maximum is %d", len(prompt), *FlagMaxPrompt)
+	}
+	return bytes.TrimLeft(prompt, string([]byte{PadSymbol})), nil
+}
+
+// ReadPrompt reads the prompt from -inputFile, or from stdin if -input is -, otherwise it is -input.
+// The files and stdin are read verbatim, including their newlines.
+func ReadPrompt(stdin io.Reader) ([]byte, error) {
+	if *FlagInputFile != "" {
+		return os.ReadFile(*FlagInputFile)
+	}
+	if *FlagInput == "-" {
+		return io.ReadAll(stdin)
+	}
+	return []byte(*FlagInput), nil
+}
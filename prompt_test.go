@@ -0,0 +1,75 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func FuzzPrompt(f *testing.F) {
+	model, err := GoldenModel(f.TempDir())
+	if err != nil {
+		f.Fatal(err)
+	}
+	path := *FlagModel
+	*FlagModel = model
+	defer func() {
+		*FlagModel = path
+	}()
+	seeds := []string{"", "a", GoldenPrompt, "\x00\x00it was", "\xff\xfe\xfd", strings.Repeat("it was the ", 1<<17)}
+	for _, seed := range seeds {
+		f.Add([]byte(seed))
+	}
+	server := &Server{}
+	f.Fuzz(func(t *testing.T, prompt []byte) {
+		normalized, err := NormalizePrompt(prompt)
+		if err != nil {
+			if len(prompt) <= *FlagMaxPrompt {
+				t.Fatal("prompts up to the maximum should be valid", err)
+			}
+			return
+		}
+		if len(normalized) > 0 && normalized[0] == PadSymbol {
+			t.Fatalf("the prompt %q isn't normalized", normalized)
+		}
+		for _, mode := range GoldenModes {
+			request := GenerateRequest{Mode: mode.Name, Prompt: string(prompt), Steps: 1, Depth: 1}
+			_, _, err := server.Generate(context.Background(), request)
+			var e *Error
+			if err != nil && (!errors.As(err, &e) || e.Code == ExitInternal) {
+				t.Fatalf("%s failed on %q: %v", mode.Name, prompt, err)
+			}
+		}
+	})
+}
+
+func TestReadPrompt(t *testing.T) {
+	input, file := *FlagInput, *FlagInputFile
+	defer func() {
+		*FlagInput, *FlagInputFile = input, file
+	}()
+	binary := []byte("it was\nthe \xff\x00best\n")
+	*FlagInput = "-"
+	if prompt, err := ReadPrompt(bytes.NewReader(binary)); err != nil || !bytes.Equal(prompt, binary) {
+		t.Fatalf("stdin should be read verbatim %q %v", prompt, err)
+	}
+	*FlagInputFile = filepath.Join(t.TempDir(), "prompt")
+	if err := os.WriteFile(*FlagInputFile, binary, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if prompt, err := ReadPrompt(nil); err != nil || !bytes.Equal(prompt, binary) {
+		t.Fatalf("the file should be read verbatim %q %v", prompt, err)
+	}
+	*FlagInput, *FlagInputFile = "it was", ""
+	if prompt, err := ReadPrompt(nil); err != nil || string(prompt) != "it was" {
+		t.Fatal("the input should be the prompt", prompt, err)
+	}
+}
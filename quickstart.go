@@ -0,0 +1,121 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// QuickstartCorpus is the public domain text of Opticks by Isaac Newton from Project Gutenberg
+//
+//go:embed corpus/opticks.txt
+var QuickstartCorpus []byte
+
+const (
+	// QuickstartHoldout is the fraction of the quickstart corpus held out for the evaluation
+	QuickstartHoldout = 0.1
+	// QuickstartPrompt is the prompt of the quickstart generation
+	QuickstartPrompt = "the rays of light"
+)
+
+// QuickstartReport is the report of a quickstart run written to report.json in its directory
+type QuickstartReport struct {
+	Model string `json:"model"`
+	// Mode is the generation mode
+	Mode  string `json:"mode"`
+	Train int    `json:"train"`
+	Test  int    `json:"test"`
+	// Entropy is the self entropy per byte of the held out text
+	Entropy    float64 `json:"entropy"`
+	Prompt     string  `json:"prompt"`
+	Generation string  `json:"generation"`
+}
+
+// Quickstart learns a model from the corpus without its held out tail, generates from a prompt and evaluates the
+// self entropy of the held out tail. The model, generation.txt and report.json are written to dir.
+func Quickstart(dir string, corpus []byte) (QuickstartReport, error) {
+	report := QuickstartReport{
+		Model:  filepath.Join(dir, "model.bolt"),
+		Mode:   ModeName(),
+		Prompt: QuickstartPrompt,
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return report, err
+	}
+	// the held out tail starts at a line, so the evaluation doesn't start in the middle of a word
+	split := int(float64(len(corpus)) * (1 - QuickstartHoldout))
+	if newline := bytes.LastIndexByte(corpus[:split], '\n'); newline >= 0 {
+		split = newline + 1
+	}
+	train, test := corpus[:split], corpus[split:]
+	report.Train, report.Test = len(train), len(test)
+
+	s := NewLRU(*FlagLRU)
+	if err := s.Learn(train); err != nil {
+		return report, err
+	}
+	s.Close()
+	os.Remove(report.Model)
+	db, err := bolt.Open(report.Model, 0600, nil)
+	if err != nil {
+		return report, err
+	}
+	WriteModel(db, ModelBucket, &s)
+	total, length, err := ScoreText(db, bytes.NewReader(test), ScoreChunk, 0, nil)
+	if err := db.Close(); err != nil {
+		return report, err
+	}
+	if err != nil {
+		return report, err
+	}
+	if length > 0 {
+		report.Entropy = total / float64(length)
+	}
+
+	// the markov mode is the fastest, the other modes are slow on a model of this size
+	generate := Generator()
+	if generate == nil {
+		report.Mode, generate = "markov", markov
+	}
+	model := *FlagModel
+	defer func() {
+		*FlagModel = model
+	}()
+	*FlagModel = report.Model
+	seed := *FlagSeed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	report.Generation = string(Continuation(generate, []byte(QuickstartPrompt), seed))
+	if err := os.WriteFile(filepath.Join(dir, "generation.txt"), []byte(QuickstartPrompt+report.Generation), 0644); err != nil {
+		return report, err
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return report, err
+	}
+	return report, os.WriteFile(filepath.Join(dir, "report.json"), append(data, '\n'), 0644)
+}
+
+func quickstart() {
+	fmt.Printf("learning %d bytes of the quickstart corpus\n", len(QuickstartCorpus))
+	report, err := Quickstart(*FlagQuickstart, QuickstartCorpus)
+	if err != nil {
+		Fail(ExitData, err)
+	}
+	fmt.Printf("wrote %s\n", report.Model)
+	fmt.Printf("%s: %s%s\n", report.Mode, report.Prompt, report.Generation)
+	fmt.Printf("held out %d bytes entropy %f\n", report.Test, report.Entropy)
+	fmt.Printf("wrote %s\n", filepath.Join(*FlagQuickstart, "report.json"))
+}
@@ -0,0 +1,48 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestQuickstart(t *testing.T) {
+	steps, seed := *FlagSteps, *FlagSeed
+	defer func() {
+		*FlagSteps, *FlagSeed = steps, seed
+	}()
+	*FlagSteps, *FlagSeed = GoldenSteps, 1
+	if len(QuickstartCorpus) < 1<<19 {
+		t.Fatal("the quickstart corpus should be embedded", len(QuickstartCorpus))
+	}
+	dir := t.TempDir()
+	report, err := Quickstart(dir, []byte(Corpus))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Train+report.Test != len(Corpus) || report.Test == 0 || Corpus[report.Train-1] != '\n' {
+		t.Fatal("the held out tail should start at a line", report.Train, report.Test)
+	}
+	if report.Mode != "markov" || report.Entropy <= 0 || report.Generation == "" {
+		t.Fatal("the model should be evaluated and generated from", report)
+	}
+	db := OpenModel(report.Model)
+	db.Close()
+	generation, err := os.ReadFile(filepath.Join(dir, "generation.txt"))
+	if err != nil || string(generation) != QuickstartPrompt+report.Generation {
+		t.Fatal("invalid generation", string(generation), err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "report.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	written := QuickstartReport{}
+	if err := json.Unmarshal(data, &written); err != nil || written != report {
+		t.Fatal("invalid report", string(data), err)
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"sync"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// read is a pool of long lived read transactions of a model.
+// A bolt transaction can't be used by concurrent goroutines, so each lookup borrows a transaction from the pool
+// and a new one is only started when all of them are in use.
+type read struct {
+	sync.Mutex
+	db   *bolt.DB
+	name string
+	free []*bolt.Tx
+	all  []*bolt.Tx
+}
+
+// reads are the open reads by model
+var reads sync.Map
+
+// BeginRead opens a read of the model bucket that the lookups of the model use until the returned function is called,
+// so that a generation doesn't set up a transaction for every window of every candidate
+func BeginRead(db *bolt.DB) (end func()) {
+	r := &read{
+		db:   db,
+		name: string(ModelBucket),
+	}
+	if _, loaded := reads.LoadOrStore(db, r); loaded {
+		return func() {}
+	}
+	return func() {
+		reads.Delete(db)
+		r.Lock()
+		defer r.Unlock()
+		for _, tx := range r.all {
+			tx.Rollback()
+		}
+		r.free, r.all = nil, nil
+	}
+}
+
+// Read runs f with the model bucket of a transaction of the open read of a model.
+// It returns false without running f if there isn't an open read of the model bucket.
+func Read(db *bolt.DB, f func(b *bolt.Bucket)) bool {
+	value, ok := reads.Load(db)
+	if !ok {
+		return false
+	}
+	r := value.(*read)
+	if r.name != string(ModelBucket) {
+		return false
+	}
+	r.Lock()
+	var tx *bolt.Tx
+	if n := len(r.free); n > 0 {
+		tx, r.free = r.free[n-1], r.free[:n-1]
+	} else {
+		var err error
+		tx, err = r.db.Begin(false)
+		if err != nil {
+			r.Unlock()
+			panic(err)
+		}
+		r.all = append(r.all, tx)
+	}
+	r.Unlock()
+	b := tx.Bucket([]byte(r.name))
+	defer func() {
+		r.Lock()
+		r.free = append(r.free, tx)
+		r.Unlock()
+	}()
+	if b == nil {
+		return false
+	}
+	f(b)
+	return true
+}
@@ -0,0 +1,46 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestBeginRead(t *testing.T) {
+	db := NewTestModel(t)
+	workers := Workers
+	defer func() {
+		Workers = workers
+	}()
+	Workers = 4
+	text := []byte(Corpus)
+	expected := Windows(db, text)
+	read := func() bool {
+		return Read(db, func(b *bolt.Bucket) {})
+	}
+	if read() {
+		t.Fatal("there shouldn't be an open read")
+	}
+	end := BeginRead(db)
+	if !read() {
+		t.Fatal("the read should be open")
+	}
+	BeginRead(db)()
+	if !read() {
+		t.Fatal("a nested read shouldn't end the open read")
+	}
+	windows := Windows(db, text)
+	end()
+	if read() {
+		t.Fatal("the read should be closed")
+	}
+	for i, window := range windows {
+		if window.Entry != expected[i].Entry {
+			t.Fatal("window read in the transaction doesn't match", i)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// NodeBytes is the approximate memory used by an entry of the LRU cache
+const NodeBytes = 2*Width + 96
+
+// Curve is an empirical power law curve of the number of model keys learned from a number of bytes
+type Curve struct {
+	A, B float64
+}
+
+// Fit fits the curve through two probe runs
+func Fit(a, b Stats) Curve {
+	if a.Bytes == 0 || b.Bytes == 0 || a.Keys == 0 || b.Keys == 0 || a.Bytes == b.Bytes {
+		return Curve{}
+	}
+	x1, y1 := math.Log(float64(a.Bytes)), math.Log(float64(a.Keys))
+	x2, y2 := math.Log(float64(b.Bytes)), math.Log(float64(b.Keys))
+	slope := (y2 - y1) / (x2 - x1)
+	if slope <= 0 {
+		return Curve{}
+	}
+	return Curve{
+		A: math.Exp(y1 - slope*x1),
+		B: slope,
+	}
+}
+
+// Keys is the number of keys learned from a number of bytes
+func (c Curve) Keys(bytes float64) float64 {
+	return c.A * math.Pow(bytes, c.B)
+}
+
+// Bytes is the number of bytes needed to learn a number of keys
+func (c Curve) Bytes(keys float64) float64 {
+	return math.Pow(keys/c.A, 1/c.B)
+}
+
+// Recommendation is a recommended training configuration
+type Recommendation struct {
+	Scale int
+	LRU   int
+	Size  int
+}
+
+// Recommend recommends a training configuration for a target model size and available memory in bytes
+func Recommend(curve Curve, stats Stats, size, ram int) Recommendation {
+	recommendation := Recommendation{Scale: 1, LRU: 1024}
+	if curve.A == 0 || stats.Keys == 0 || stats.Text == 0 {
+		return recommendation
+	}
+	perKey := float64(Order + stats.ValueBytes/stats.Keys)
+	bytesPerArticle := float64(stats.Bytes) / float64(stats.Text)
+	articles := curve.Bytes(float64(size)/perKey) / bytesPerArticle
+	if scale := int((articles - 1) / 1024); scale > 1 {
+		recommendation.Scale = scale
+	}
+	trained := float64(recommendation.Scale*1024+1) * bytesPerArticle
+	recommendation.Size = int(curve.Keys(trained) * perKey)
+	if lru := (ram - recommendation.Size) / NodeBytes; lru > recommendation.LRU {
+		recommendation.LRU = lru
+	}
+	return recommendation
+}
+
+func recommend() {
+	reader := OpenData()
+	small, large := Scan(reader, ScanSamples/4), Scan(reader, ScanSamples)
+	curve := Fit(small, large)
+	if curve.A == 0 {
+		fmt.Println("not enough text in the probe run to make a recommendation")
+		return
+	}
+	size, ram := *FlagTargetSize*1024*1024, *FlagRAM*1024*1024
+	recommendation := Recommend(curve, large, size, ram)
+	fmt.Printf("keys = %f * bytes^%f\n", curve.A, curve.B)
+	fmt.Printf("-scale %d\n", recommendation.Scale)
+	fmt.Printf("-lru %d\n", recommendation.LRU)
+	fmt.Printf("projected model size %d MB\n", recommendation.Size/(1024*1024))
+	if recommendation.Size > ram {
+		fmt.Println("warning: the projected model doesn't fit in the available memory")
+	}
+}
@@ -0,0 +1,27 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestRecommend(t *testing.T) {
+	small := Stats{Text: 16, Bytes: 16 * 1000, Keys: 4000, ValueBytes: 4000 * 100}
+	large := Stats{Text: 64, Bytes: 64 * 1000, Keys: 8000, ValueBytes: 8000 * 100}
+	curve := Fit(small, large)
+	if math.Abs(curve.B-.5) > 1e-9 || math.Abs(curve.Keys(64000)-8000) > 1e-6 {
+		t.Fatal("unexpected curve", curve)
+	}
+	size := 1024 * 1024 * 1024
+	recommendation := Recommend(curve, large, size, 4*size)
+	if recommendation.Scale <= 1 || recommendation.Size > size {
+		t.Fatal("unexpected recommendation", recommendation)
+	}
+	if recommendation.LRU != (4*size-recommendation.Size)/NodeBytes {
+		t.Fatal("the lru should use the remaining memory", recommendation.LRU)
+	}
+}
@@ -0,0 +1,30 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Start is when lit started, the records are timed from it
+var Start = time.Now()
+
+// Record is a json record printed with -json. The bytes are the exact output, the text replaces invalid utf-8.
+type Record struct {
+	Entropy float64   `json:"entropy"`
+	Text    string    `json:"text,omitempty"`
+	Bytes   []byte    `json:"bytes,omitempty"`
+	Scores  []float64 `json:"scores,omitempty"`
+	Elapsed float64   `json:"elapsed"`
+}
+
+// EmitRecord prints a record as a json line with the seconds elapsed since the start
+func EmitRecord(record Record) {
+	record.Elapsed = time.Since(Start).Seconds()
+	if err := json.NewEncoder(Output).Encode(record); err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,36 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestJSON(t *testing.T) {
+	model, err := GoldenModel(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	flag := *FlagJSON
+	defer func() {
+		*FlagJSON = flag
+	}()
+	*FlagJSON = true
+	lines := strings.Split(strings.TrimSpace(string(Transcript(model, Mode{"attention", markovSelfEntropy}))), "\n")
+	if len(lines) != GoldenSteps+1 {
+		t.Fatal("there should be a record for each step", len(lines))
+	}
+	for _, line := range lines {
+		var record Record
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatal(err)
+		}
+		if len(record.Bytes) == 0 || string(record.Bytes) != record.Text || record.Entropy == 0 {
+			t.Fatal("the record should have the output", line)
+		}
+	}
+}
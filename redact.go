@@ -0,0 +1,62 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Redaction is a pair of delimiters that mark the spans of the training data that aren't learned,
+// e.g. ␂ and ␃ around the sensitive fields of a document
+type Redaction struct {
+	Open, Close []byte
+}
+
+// LearnRedaction is the redaction of the training data when -redact is set
+var LearnRedaction *Redaction
+
+// ParseRedaction parses the open and close delimiters separated by a comma
+func ParseRedaction(delimiters string) (*Redaction, error) {
+	parts := strings.Split(delimiters, ",")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("the redaction should be open and close delimiters separated by a comma, e.g. ␂,␃")
+	}
+	return &Redaction{Open: []byte(parts[0]), Close: []byte(parts[1])}, nil
+}
+
+// Next returns the index of the first redacted byte at or after each index of the data.
+// The delimiters are redacted with their span and a span that isn't closed runs to the end of the data.
+// It returns nil if nothing is redacted.
+func (r *Redaction) Next(data []byte) []int {
+	if r == nil || !bytes.Contains(data, r.Open) {
+		return nil
+	}
+	redacted, i := make([]bool, len(data)), 0
+	for {
+		start := bytes.Index(data[i:], r.Open)
+		if start < 0 {
+			break
+		}
+		start += i
+		end := len(data)
+		if index := bytes.Index(data[start+len(r.Open):], r.Close); index >= 0 {
+			end = start + len(r.Open) + index + len(r.Close)
+		}
+		for k := start; k < end; k++ {
+			redacted[k] = true
+		}
+		i = end
+	}
+	next, first := make([]int, len(data)), len(data)
+	for k := len(data) - 1; k >= 0; k-- {
+		if redacted[k] {
+			first = k
+		}
+		next[k] = first
+	}
+	return next
+}
@@ -0,0 +1,50 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+)
+
+func TestRedaction(t *testing.T) {
+	if _, err := ParseRedaction("␂"); err == nil {
+		t.Fatal("the redaction needs a close delimiter")
+	}
+	redaction, err := ParseRedaction("␂,␃")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if redaction.Next([]byte(Corpus)) != nil {
+		t.Fatal("nothing should be redacted")
+	}
+	next := redaction.Next([]byte("ab␂x␃cd"))
+	if next[0] != 2 || next[8] != 8 || next[9] != 11 {
+		t.Fatal("the span should be redacted with its delimiters", next)
+	}
+
+	before, after, secret := Corpus[:200], Corpus[200:400], "\x01\x02\x01\x02"
+	reference := NewLRU(1024)
+	reference.Learn([]byte(before))
+	reference.Learn([]byte(after))
+	reference.Close()
+	LearnRedaction = redaction
+	defer func() {
+		LearnRedaction = nil
+	}()
+	redacted := NewLRU(1024)
+	redacted.Learn([]byte(before + "␂" + secret + "␃" + after))
+	redacted.Close()
+	if len(redacted.Model) == 0 || len(redacted.Ends) != 1 {
+		t.Fatal("the text around the span should be learned as one article", len(redacted.Model), len(redacted.Ends))
+	}
+	for key, value := range redacted.Model {
+		if _, ok := reference.Model[key]; !ok {
+			t.Fatalf("the context %q joins the text around the span", key[:])
+		}
+		if vector := DecodeVector(value); vector[1] != 0 || vector[2] != 0 {
+			t.Fatalf("the redacted bytes were learned after %q", key[:])
+		}
+	}
+}
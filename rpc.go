@@ -0,0 +1,320 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// The messages of the lit gRPC service defined in lit.proto.
+// They are tagged like generated protocol buffer messages so that the protocol buffer runtime can encode them.
+
+// RPCGenerateRequest is a generation request
+type RPCGenerateRequest struct {
+	Mode        string   `protobuf:"bytes,1,opt,name=mode,proto3"`
+	Prompt      string   `protobuf:"bytes,2,opt,name=prompt,proto3"`
+	Depth       int64    `protobuf:"varint,3,opt,name=depth,proto3"`
+	Steps       int64    `protobuf:"varint,4,opt,name=steps,proto3"`
+	Stop        float64  `protobuf:"fixed64,5,opt,name=stop,proto3"`
+	Vocab       []string `protobuf:"bytes,6,rep,name=vocab,proto3"`
+	Schema      []byte   `protobuf:"bytes,7,opt,name=schema,proto3"`
+	Namespace   string   `protobuf:"bytes,8,opt,name=namespace,proto3"`
+	Temperature float64  `protobuf:"fixed64,9,opt,name=temperature,proto3"`
+	TopK        int64    `protobuf:"varint,10,opt,name=top_k,json=topK,proto3"`
+	TopP        float64  `protobuf:"fixed64,11,opt,name=top_p,json=topP,proto3"`
+}
+
+// Reset resets the message
+func (m *RPCGenerateRequest) Reset() { *m = RPCGenerateRequest{} }
+
+// String returns the message as a string
+func (m *RPCGenerateRequest) String() string { return fmt.Sprintf("%+v", *m) }
+
+// ProtoMessage marks the message as a protocol buffer message
+func (*RPCGenerateRequest) ProtoMessage() {}
+
+// RPCGenerateReply is a generation result, the last reply has the usage of the generation
+type RPCGenerateReply struct {
+	Text       string `protobuf:"bytes,1,opt,name=text,proto3"`
+	Bytes      uint64 `protobuf:"varint,2,opt,name=bytes,proto3"`
+	Expansions uint64 `protobuf:"varint,3,opt,name=expansions,proto3"`
+}
+
+// Reset resets the message
+func (m *RPCGenerateReply) Reset() { *m = RPCGenerateReply{} }
+
+// String returns the message as a string
+func (m *RPCGenerateReply) String() string { return fmt.Sprintf("%+v", *m) }
+
+// ProtoMessage marks the message as a protocol buffer message
+func (*RPCGenerateReply) ProtoMessage() {}
+
+// EntropyRequest is a scoring request
+type EntropyRequest struct {
+	Text string `protobuf:"bytes,1,opt,name=text,proto3"`
+}
+
+// Reset resets the message
+func (m *EntropyRequest) Reset() { *m = EntropyRequest{} }
+
+// String returns the message as a string
+func (m *EntropyRequest) String() string { return fmt.Sprintf("%+v", *m) }
+
+// ProtoMessage marks the message as a protocol buffer message
+func (*EntropyRequest) ProtoMessage() {}
+
+// EntropyReply is the score of a text
+type EntropyReply struct {
+	Entropy   float64 `protobuf:"fixed64,1,opt,name=entropy,proto3"`
+	Deviation float64 `protobuf:"fixed64,2,opt,name=deviation,proto3"`
+	Masses    []int64 `protobuf:"varint,3,rep,packed,name=masses,proto3"`
+}
+
+// Reset resets the message
+func (m *EntropyReply) Reset() { *m = EntropyReply{} }
+
+// String returns the message as a string
+func (m *EntropyReply) String() string { return fmt.Sprintf("%+v", *m) }
+
+// ProtoMessage marks the message as a protocol buffer message
+func (*EntropyReply) ProtoMessage() {}
+
+// LearnRequest is a text to learn
+type LearnRequest struct {
+	Text string `protobuf:"bytes,1,opt,name=text,proto3"`
+}
+
+// Reset resets the message
+func (m *LearnRequest) Reset() { *m = LearnRequest{} }
+
+// String returns the message as a string
+func (m *LearnRequest) String() string { return fmt.Sprintf("%+v", *m) }
+
+// ProtoMessage marks the message as a protocol buffer message
+func (*LearnRequest) ProtoMessage() {}
+
+// LearnReply is the result of learning
+type LearnReply struct {
+	Texts uint64 `protobuf:"varint,1,opt,name=texts,proto3"`
+	Bytes uint64 `protobuf:"varint,2,opt,name=bytes,proto3"`
+	Keys  uint64 `protobuf:"varint,3,opt,name=keys,proto3"`
+}
+
+// Reset resets the message
+func (m *LearnReply) Reset() { *m = LearnReply{} }
+
+// String returns the message as a string
+func (m *LearnReply) String() string { return fmt.Sprintf("%+v", *m) }
+
+// ProtoMessage marks the message as a protocol buffer message
+func (*LearnReply) ProtoMessage() {}
+
+// LitServer is the lit gRPC service
+type LitServer interface {
+	Generate(*RPCGenerateRequest, grpc.ServerStream) error
+	Entropy(context.Context, *EntropyRequest) (*EntropyReply, error)
+	Learn(grpc.ServerStream) error
+}
+
+// LitService describes the lit gRPC service
+var LitService = grpc.ServiceDesc{
+	ServiceName: "lit.Lit",
+	HandlerType: (*LitServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Entropy",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				request := new(EntropyRequest)
+				if err := dec(request); err != nil {
+					return nil, err
+				}
+				if interceptor == nil {
+					return srv.(LitServer).Entropy(ctx, request)
+				}
+				info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/lit.Lit/Entropy"}
+				return interceptor(ctx, request, info, func(ctx context.Context, request interface{}) (interface{}, error) {
+					return srv.(LitServer).Entropy(ctx, request.(*EntropyRequest))
+				})
+			},
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName: "Generate",
+			Handler: func(srv interface{}, stream grpc.ServerStream) error {
+				request := new(RPCGenerateRequest)
+				if err := stream.RecvMsg(request); err != nil {
+					return err
+				}
+				return srv.(LitServer).Generate(request, stream)
+			},
+			ServerStreams: true,
+		},
+		{
+			StreamName: "Learn",
+			Handler: func(srv interface{}, stream grpc.ServerStream) error {
+				return srv.(LitServer).Learn(stream)
+			},
+			ClientStreams: true,
+		},
+	},
+	Metadata: "lit.proto",
+}
+
+// RPCServer implements the lit gRPC service with the generation server
+type RPCServer struct {
+	*Server
+}
+
+// rpcError converts an error to a gRPC status error
+func rpcError(err error) error {
+	if e, ok := err.(*Error); ok && e.Code != ExitInternal {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+// recoverRPC recovers a panic of a call into a gRPC status error, like Server.generate does for generations
+func recoverRPC(err *error) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	if e, ok := r.(error); ok {
+		*err = rpcError(e)
+		return
+	}
+	*err = status.Error(codes.Internal, fmt.Sprint(r))
+}
+
+// streamWriter sends each write of the generation output as a reply
+type streamWriter struct {
+	stream grpc.ServerStream
+}
+
+// Write sends a reply
+func (w streamWriter) Write(p []byte) (int, error) {
+	if len(p) == 1 && p[0] == '\n' {
+		return len(p), nil
+	}
+	if err := w.stream.SendMsg(&RPCGenerateReply{Text: string(p)}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// RPCClient identifies the client of a call by its remote address
+func RPCClient(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	return Host(p.Addr.String())
+}
+
+// Generate streams the results of a generation, the usage is charged to the client like the json server does
+func (s RPCServer) Generate(request *RPCGenerateRequest, stream grpc.ServerStream) error {
+	client := RPCClient(stream.Context())
+	if s.Accounts != nil {
+		if err := s.Accounts.Check(client); err != nil {
+			return status.Error(codes.ResourceExhausted, err.Error())
+		}
+	}
+	usage, err := s.GenerateTo(stream.Context(), streamWriter{stream: stream}, GenerateRequest{
+		Mode:        request.Mode,
+		Prompt:      request.Prompt,
+		Depth:       int(request.Depth),
+		Steps:       int(request.Steps),
+		Stop:        request.Stop,
+		Vocab:       request.Vocab,
+		Schema:      request.Schema,
+		Namespace:   request.Namespace,
+		Temperature: request.Temperature,
+		TopK:        int(request.TopK),
+		TopP:        request.TopP,
+	})
+	if s.Accounts != nil {
+		s.Accounts.Charge(client, usage)
+	}
+	if err != nil {
+		return rpcError(err)
+	}
+	return stream.SendMsg(&RPCGenerateReply{Bytes: usage.Bytes, Expansions: usage.Expansions})
+}
+
+// Entropy scores a text
+func (s RPCServer) Entropy(ctx context.Context, request *EntropyRequest) (reply *EntropyReply, err error) {
+	s.Lock()
+	defer s.Unlock()
+	defer recoverRPC(&err)
+	db := OpenModel(*FlagModel)
+	defer db.Close()
+	input := []byte(request.Text)
+	if len(input) < Order {
+		input = append(Padding(Order-len(input)), input...)
+	}
+	score := Confidence(db, input)
+	reply = &EntropyReply{Entropy: score.Entropy, Deviation: score.Deviation}
+	for _, mass := range score.Masses {
+		reply.Masses = append(reply.Masses, int64(mass))
+	}
+	return reply, nil
+}
+
+// Learn learns the streamed texts into the model, it gives up if another process holds the model for more than a second
+func (s RPCServer) Learn(stream grpc.ServerStream) (err error) {
+	defer recoverRPC(&err)
+	model, reply := NewLRU(*FlagLRU), &LearnReply{}
+	for {
+		request := new(LearnRequest)
+		err := stream.RecvMsg(request)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		if model.Learn([]byte(request.Text)) == nil {
+			reply.Texts++
+			reply.Bytes += uint64(len(request.Text))
+		}
+	}
+	model.Close()
+	reply.Keys = uint64(len(model.Model))
+
+	s.Lock()
+	defer s.Unlock()
+	db, err := bolt.Open(*FlagModel, 0600, &bolt.Options{Timeout: time.Second})
+	if err == bolt.ErrTimeout {
+		return status.Error(codes.Unavailable, fmt.Sprintf("%s: %v", *FlagModel, err))
+	} else if err != nil {
+		return rpcError(&Error{Code: ExitCorruptModel, Err: fmt.Errorf("%s: %w", *FlagModel, err)})
+	}
+	defer db.Close()
+	MergeModel(db, ModelBucket, &model)
+	return stream.SendMsg(reply)
+}
+
+func serveRPC() {
+	listener, err := net.Listen("tcp", *FlagGRPC)
+	if err != nil {
+		Fail(ExitFlags, err)
+	}
+	server := grpc.NewServer()
+	server.RegisterService(&LitService, RPCServer{Server: NewServer()})
+	fmt.Printf("serving grpc on %s\n", *FlagGRPC)
+	if err := server.Serve(listener); err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+func TestRPC(t *testing.T) {
+	model, err := GoldenModel(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := *FlagModel
+	*FlagModel = model
+	defer func() {
+		*FlagModel = path
+	}()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer()
+	server.RegisterService(&LitService, RPCServer{Server: &Server{Accounts: NewAccounts(Usage{Bytes: 1})}})
+	go server.Serve(listener)
+	defer server.Stop()
+
+	conn, err := grpc.Dial(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	ctx := context.Background()
+
+	entropy := new(EntropyReply)
+	if err := conn.Invoke(ctx, "/lit.Lit/Entropy", &EntropyRequest{Text: "it was the best of times"}, entropy); err != nil {
+		t.Fatal(err)
+	}
+	if entropy.Entropy == 0 || len(entropy.Masses) != 24-Order+1 {
+		t.Fatal("unexpected entropy", entropy)
+	}
+
+	stream, err := conn.NewStream(ctx, &LitService.Streams[0], "/lit.Lit/Generate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.SendMsg(&RPCGenerateRequest{Mode: "attention", Prompt: "it was the", Steps: 1, Depth: 1}); err != nil {
+		t.Fatal(err)
+	}
+	stream.CloseSend()
+	replies := []*RPCGenerateReply{}
+	for {
+		reply := new(RPCGenerateReply)
+		if err := stream.RecvMsg(reply); err != nil {
+			break
+		}
+		replies = append(replies, reply)
+	}
+	if len(replies) != 3 || !strings.Contains(replies[0].Text, "it was the") || replies[2].Bytes != 2 {
+		t.Fatal("unexpected generation", replies)
+	}
+
+	stream, err = conn.NewStream(ctx, &LitService.Streams[0], "/lit.Lit/Generate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.SendMsg(&RPCGenerateRequest{Mode: "attention", Prompt: "it was the", Steps: 1, Depth: 1}); err != nil {
+		t.Fatal(err)
+	}
+	stream.CloseSend()
+	if err := stream.RecvMsg(new(RPCGenerateReply)); status.Code(err) != codes.ResourceExhausted {
+		t.Fatal("clients over their quota should be refused", err)
+	}
+
+	stream, err = conn.NewStream(ctx, &LitService.Streams[1], "/lit.Lit/Learn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, text := range []string{"a new text to learn", "and another one"} {
+		if err := stream.SendMsg(&LearnRequest{Text: text}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stream.CloseSend()
+	learned := new(LearnReply)
+	if err := stream.RecvMsg(learned); err != nil {
+		t.Fatal(err)
+	}
+	if learned.Texts != 2 || learned.Keys == 0 {
+		t.Fatal("unexpected learning", learned)
+	}
+
+	*FlagModel = filepath.Join(t.TempDir(), "missing.bolt")
+	err = conn.Invoke(ctx, "/lit.Lit/Entropy", &EntropyRequest{Text: "it was the best of times"}, new(EntropyReply))
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatal("a missing model should be an error of the call", err)
+	}
+}
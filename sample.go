@@ -0,0 +1,108 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Sampler samples the next path of the search when -sample is set
+type Sampler struct {
+	sync.Mutex
+	Rand        *rand.Rand
+	Temperature float64
+	TopK        int
+	TopP        float64
+}
+
+// NewSampler creates a new sampler, a seed of 0 seeds it with the time
+func NewSampler(seed int64, temperature float64, topK int, topP float64) (*Sampler, error) {
+	if temperature <= 0 {
+		return nil, errors.New("the temperature should be positive")
+	}
+	if topK < 0 {
+		return nil, errors.New("top k can't be negative")
+	}
+	if topP <= 0 || topP > 1 {
+		return nil, errors.New("top p should be in (0, 1]")
+	}
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &Sampler{
+		Rand:        rand.New(rand.NewSource(seed)),
+		Temperature: temperature,
+		TopK:        topK,
+		TopP:        topP,
+	}, nil
+}
+
+// Distribution converts the entropies of the pathes into the probabilities of the pathes after the top k and top p
+// cut offs. The pathes are sorted from the most to the least likely, less is true if lower entropy is better.
+func (s *Sampler) Distribution(pathes []Result, less bool) []float64 {
+	sort.Slice(pathes, func(i, j int) bool {
+		if pathes[i].Entropy != pathes[j].Entropy {
+			return (pathes[i].Entropy < pathes[j].Entropy) == less
+		}
+		return bytes.Compare(pathes[i].Output, pathes[j].Output) < 0
+	})
+	n := len(pathes)
+	if s.TopK > 0 && s.TopK < n {
+		n = s.TopK
+	}
+	sign := 1.0
+	if less {
+		sign = -1.0
+	}
+	probabilities, best, sum := make([]float64, len(pathes)), sign*pathes[0].Entropy/s.Temperature, 0.0
+	for i := range pathes[:n] {
+		probabilities[i] = math.Exp(sign*pathes[i].Entropy/s.Temperature - best)
+		if math.IsNaN(probabilities[i]) {
+			probabilities[i] = 0
+		}
+		sum += probabilities[i]
+	}
+	if sum == 0 {
+		probabilities[0], sum = 1, 1
+	}
+	cumulative, total := 0.0, 0.0
+	for i := range probabilities[:n] {
+		probabilities[i] /= sum
+		if cumulative >= s.TopP {
+			probabilities[i] = 0
+			continue
+		}
+		cumulative += probabilities[i]
+		total += probabilities[i]
+	}
+	for i := range probabilities {
+		probabilities[i] /= total
+	}
+	return probabilities
+}
+
+// Sample samples one of the pathes, less is true if lower entropy is better
+func (s *Sampler) Sample(pathes []Result, less bool) Result {
+	probabilities := s.Distribution(pathes, less)
+	s.Lock()
+	r := s.Rand.Float64()
+	s.Unlock()
+	for i, probability := range probabilities {
+		if r < probability {
+			return pathes[i]
+		}
+		r -= probability
+	}
+	return pathes[0]
+}
+
+// OutputSampler is the sampler of the generation, nil if the search takes the best path
+var OutputSampler *Sampler
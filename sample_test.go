@@ -0,0 +1,59 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSampler(t *testing.T) {
+	pathes := func() []Result {
+		return []Result{
+			{Entropy: 3, Output: []byte("c")},
+			{Entropy: 1, Output: []byte("a")},
+			{Entropy: 2, Output: []byte("b")},
+			{Entropy: math.MaxFloat64, Output: []byte("x")},
+		}
+	}
+	if _, err := NewSampler(1, 0, 0, 1); err == nil {
+		t.Fatal("a zero temperature should be an error")
+	}
+	sampler, err := NewSampler(1, 1, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := pathes()
+	probabilities := sampler.Distribution(p, true)
+	if string(p[0].Output) != "a" || probabilities[0] <= probabilities[1] || probabilities[1] <= probabilities[2] ||
+		probabilities[3] != 0 {
+		t.Fatal("lower entropy should be more likely", probabilities)
+	}
+	sum := 0.0
+	for _, probability := range probabilities {
+		sum += probability
+	}
+	if math.Abs(sum-1) > 1e-9 {
+		t.Fatal("the probabilities should sum to 1", sum)
+	}
+
+	sampler.TopK = 2
+	if probabilities := sampler.Distribution(pathes(), true); probabilities[2] != 0 {
+		t.Fatal("top k should only keep the best 2", probabilities)
+	}
+	sampler.TopK, sampler.TopP = 0, .5
+	if probabilities := sampler.Distribution(pathes(), true); probabilities[0] != 1 {
+		t.Fatal("top p should only keep the best path", probabilities)
+	}
+
+	sampler, _ = NewSampler(1, 1, 0, 1)
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		seen[string(sampler.Sample(pathes(), true).Output)] = true
+	}
+	if len(seen) != 3 || seen["x"] {
+		t.Fatal("sampling should give the diverse pathes", seen)
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+
+	zim "github.com/akhenakh/gozim"
+)
+
+// ScanSamples is the number of articles sampled by the corpus scan
+const ScanSamples = 256
+
+// Stats are the statistics of a sample of a corpus
+type Stats struct {
+	// Articles is the number of entries in the corpus
+	Articles int
+	// Sampled is the number of sampled entries
+	Sampled int
+	// Text is the number of sampled entries that are text articles
+	Text int
+	// Bytes is the number of preprocessed bytes of the sampled text articles
+	Bytes int
+	// Languages is the number of sampled text articles in each language
+	Languages map[string]int
+	// Keys is the number of model keys learned from the sample
+	Keys int
+	// ValueBytes is the number of compressed bytes of the model values learned from the sample
+	ValueBytes int
+	// Time is the time it took to learn the sample
+	Time time.Duration
+}
+
+// Projection is the projected cost of training on a number of articles
+type Projection struct {
+	Bytes int
+	Keys  int
+	Size  int
+	Time  time.Duration
+}
+
+// Project projects the bytes, model keys, model size, and training time of learning a number of text articles.
+// Keys are assumed to grow linearly with the bytes, so the projection is an upper bound.
+func (s Stats) Project(articles int) Projection {
+	projection := Projection{}
+	if s.Text == 0 || s.Bytes == 0 {
+		return projection
+	}
+	scale := float64(articles) / float64(s.Text)
+	projection.Bytes = int(float64(s.Bytes) * scale)
+	projection.Keys = int(float64(s.Keys) * scale)
+	if s.Keys > 0 {
+		projection.Size = projection.Keys * (Order + s.ValueBytes/s.Keys)
+	}
+	projection.Time = time.Duration(float64(s.Time) * scale)
+	return projection
+}
+
+// Scan samples the articles of a corpus and learns a probe model from them
+func Scan(reader *zim.ZimReader, samples int) Stats {
+	rnd := rand.New(rand.NewSource(1))
+	stats := Stats{
+		Articles:  int(reader.ArticleCount),
+		Languages: make(map[string]int),
+	}
+	if stats.Articles < 2 {
+		return stats
+	}
+	probe := NewLRU(*FlagLRU)
+	for stats.Sampled < samples {
+		index := rnd.Intn(stats.Articles-1) + 1
+		stats.Sampled++
+		_, plain, ok := ArticleText(reader, uint32(index))
+		if !ok {
+			continue
+		}
+		start := time.Now()
+		if err := probe.Learn([]byte(plain)); err != nil {
+			continue
+		}
+		stats.Time += time.Since(start)
+		stats.Text++
+		stats.Bytes += len(plain)
+		language, _ := DetectLanguage(plain)
+		if language == "" {
+			language = "unknown"
+		}
+		stats.Languages[language]++
+	}
+	start := time.Now()
+	probe.Close()
+	stats.Time += time.Since(start)
+	stats.Keys = len(probe.Model)
+	for _, value := range probe.Model {
+		stats.ValueBytes += len(value)
+	}
+	return stats
+}
+
+func scan() {
+	reader := OpenData()
+	stats := Scan(reader, ScanSamples)
+	fmt.Printf("articles %d sampled %d text %d\n", stats.Articles, stats.Sampled, stats.Text)
+	if stats.Text == 0 {
+		return
+	}
+	fmt.Printf("text articles %d (estimated)\n", stats.Articles*stats.Text/stats.Sampled)
+	fmt.Printf("bytes per text article %d\n", stats.Bytes/stats.Text)
+	languages := make([]string, 0, len(stats.Languages))
+	for language := range stats.Languages {
+		languages = append(languages, language)
+	}
+	sort.Slice(languages, func(i, j int) bool {
+		return stats.Languages[languages[i]] > stats.Languages[languages[j]]
+	})
+	for _, language := range languages {
+		fmt.Printf("language %s %.1f%%\n", language, 100*float64(stats.Languages[language])/float64(stats.Text))
+	}
+	articles := *FlagScale*1024 + 1
+	projection := stats.Project(articles)
+	fmt.Printf("projected for order %d and scale %d (%d articles):\n", Order, *FlagScale, articles)
+	fmt.Printf("  bytes %d\n", projection.Bytes)
+	fmt.Printf("  keys %d\n", projection.Keys)
+	fmt.Printf("  model size %d MB\n", projection.Size/(1024*1024))
+	fmt.Printf("  training time %s\n", projection.Time.Round(time.Second))
+}
@@ -0,0 +1,22 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestProject(t *testing.T) {
+	stats := Stats{Text: 4, Bytes: 4000, Keys: 100, ValueBytes: 1000, Time: time.Second}
+	projection := stats.Project(8)
+	if projection.Bytes != 8000 || projection.Keys != 200 ||
+		projection.Size != 200*(Order+10) || projection.Time != 2*time.Second {
+		t.Fatal("unexpected projection", projection)
+	}
+	if (Stats{}).Project(8) != (Projection{}) {
+		t.Fatal("an empty sample should project nothing")
+	}
+}
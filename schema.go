@@ -0,0 +1,231 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+)
+
+// Slot is the kind of a piece of a schema
+type Slot int
+
+const (
+	// SlotFixed is fixed text
+	SlotFixed Slot = iota
+	// SlotString is a generated string value
+	SlotString
+	// SlotNumber is a generated number value
+	SlotNumber
+	// SlotBool is a generated boolean value
+	SlotBool
+)
+
+// Piece is a piece of a schema
+type Piece struct {
+	Slot Slot
+	Text []byte
+}
+
+// Schema is a json skeleton with fixed keys and generated values
+type Schema struct {
+	Pieces []Piece
+}
+
+// OutputSchema is the schema generation is constrained to
+var OutputSchema *Schema
+
+// ParseSchema parses a json skeleton into a schema
+func ParseSchema(skeleton []byte) (*Schema, error) {
+	schema := &Schema{}
+	fixed := func(text string) {
+		last := len(schema.Pieces) - 1
+		if last >= 0 && schema.Pieces[last].Slot == SlotFixed {
+			schema.Pieces[last].Text = append(schema.Pieces[last].Text, text...)
+			return
+		}
+		schema.Pieces = append(schema.Pieces, Piece{Slot: SlotFixed, Text: []byte(text)})
+	}
+	slot := func(s Slot) {
+		schema.Pieces = append(schema.Pieces, Piece{Slot: s})
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(skeleton))
+	decoder.UseNumber()
+	// objects tracks if a container is an object and if the next string is a key
+	type container struct {
+		object, key, first bool
+	}
+	stack := []container{}
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		value := true
+		if len(stack) > 0 {
+			top := &stack[len(stack)-1]
+			_, end := token.(json.Delim)
+			end = end && (token == json.Delim('}') || token == json.Delim(']'))
+			if !end {
+				if top.object && top.key {
+					value = false
+					if !top.first {
+						fixed(",")
+					}
+				} else if !top.object && !top.first {
+					fixed(",")
+				}
+				top.first = false
+				if top.object {
+					top.key = !top.key
+				}
+			}
+		}
+		switch t := token.(type) {
+		case json.Delim:
+			fixed(t.String())
+			switch t {
+			case '{':
+				stack = append(stack, container{object: true, key: true, first: true})
+			case '[':
+				stack = append(stack, container{first: true})
+			default:
+				stack = stack[:len(stack)-1]
+			}
+		case string:
+			if !value {
+				key, _ := json.Marshal(t)
+				fixed(string(key) + ":")
+			} else if t == "" {
+				slot(SlotString)
+			} else {
+				text, _ := json.Marshal(t)
+				fixed(string(text))
+			}
+		case json.Number:
+			slot(SlotNumber)
+		case bool:
+			slot(SlotBool)
+		case nil:
+			fixed("null")
+		}
+	}
+	if len(schema.Pieces) == 0 {
+		return nil, errors.New("empty schema")
+	}
+	return schema, nil
+}
+
+// NewSchema loads a schema from a json skeleton file
+func NewSchema(file string) *Schema {
+	skeleton, err := os.ReadFile(file)
+	if err != nil {
+		Fail(ExitData, err)
+	}
+	schema, err := ParseSchema(skeleton)
+	if err != nil {
+		Fail(ExitData, err)
+	}
+	return schema
+}
+
+// Match returns true if the generated text is a prefix of a json document matching the schema,
+// and if the document is complete. Only whitespace is allowed after a complete document.
+func (s *Schema) Match(generated []byte) (allowed, complete bool) {
+	i := 0
+	for _, piece := range s.Pieces {
+		switch piece.Slot {
+		case SlotFixed:
+			for _, symbol := range piece.Text {
+				if i == len(generated) {
+					return true, false
+				}
+				if generated[i] != symbol {
+					return false, false
+				}
+				i++
+			}
+		case SlotString:
+			if i == len(generated) {
+				return true, false
+			}
+			if generated[i] != '"' {
+				return false, false
+			}
+			i++
+			for {
+				if i == len(generated) {
+					return true, false
+				}
+				symbol := generated[i]
+				i++
+				if symbol == '"' {
+					break
+				} else if symbol == '\\' || symbol < 0x20 {
+					return false, false
+				}
+			}
+		case SlotNumber:
+			if i < len(generated) && generated[i] == '-' {
+				i++
+			}
+			digits := 0
+			for i < len(generated) && generated[i] >= '0' && generated[i] <= '9' {
+				i++
+				digits++
+			}
+			if i == len(generated) {
+				return true, false
+			}
+			if digits == 0 {
+				return false, false
+			}
+		case SlotBool:
+			rest, matched := generated[i:], false
+			for _, literal := range []string{"true", "false"} {
+				if len(rest) < len(literal) && bytes.HasPrefix([]byte(literal), rest) {
+					return true, false
+				}
+				if bytes.HasPrefix(rest, []byte(literal)) {
+					i, matched = i+len(literal), true
+					break
+				}
+			}
+			if !matched {
+				return false, false
+			}
+		}
+	}
+	for _, symbol := range generated[i:] {
+		if symbol != ' ' && symbol != '\n' {
+			return false, true
+		}
+	}
+	return true, true
+}
+
+// Generated returns the generated part of an output that starts with the prompt padded by Pad
+func Generated(output, prompt []byte) []byte {
+	start := len(Pad(prompt))
+	if start > len(output) {
+		return nil
+	}
+	return output[start:]
+}
+
+// Allowed returns true if the generated part of an output matches the schema
+func (s *Schema) Allowed(generated []byte) bool {
+	if s == nil {
+		return true
+	}
+	allowed, _ := s.Match(generated)
+	return allowed
+}
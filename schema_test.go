@@ -0,0 +1,48 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+)
+
+func TestSchema(t *testing.T) {
+	schema, err := ParseSchema([]byte(`{"name": "", "age": 0, "tags": ["", "x"], "ok": true, "none": null}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		Generated         string
+		Allowed, Complete bool
+	}{
+		{``, true, false},
+		{`{"na`, true, false},
+		{`{"nb`, false, false},
+		{`{"name":"Bob`, true, false},
+		{`{"name":"Bob","age":-4`, true, false},
+		{`{"name":"Bob","age":x`, false, false},
+		{`{"name":"Bob","age":42,"tags":["a","x"],"ok":f`, true, false},
+		{`{"name":"Bob","age":42,"tags":["a","x"],"ok":t,`, false, false},
+		{`{"name":"Bob","age":42,"tags":["a","x"],"ok":false,"none":null}`, true, true},
+		{`{"name":"Bob","age":42,"tags":["a","x"],"ok":true,"none":null} `, true, true},
+		{`{"name":"Bob","age":42,"tags":["a","x"],"ok":true,"none":null}x`, false, true},
+	}
+	for _, test := range tests {
+		allowed, complete := schema.Match([]byte(test.Generated))
+		if allowed != test.Allowed || complete != test.Complete {
+			t.Fatalf("%s should be %t %t but is %t %t", test.Generated, test.Allowed, test.Complete, allowed, complete)
+		}
+	}
+	defer func(symbol byte) {
+		PadSymbol = symbol
+	}(PadSymbol)
+	for _, symbol := range []byte{0, ' '} {
+		PadSymbol = symbol
+		prompt := []byte("  prompt")
+		if generated := string(Generated(append(Pad(prompt), '{'), prompt)); generated != "{" {
+			t.Fatalf("generated text should follow the padding and the prompt %q", generated)
+		}
+	}
+}
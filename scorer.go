@@ -0,0 +1,140 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// Scorer scores the candidate next bytes of a prefix, lower scores are better like entropies
+type Scorer interface {
+	ScoreAppend(prefix []byte, candidates []byte) []float64
+}
+
+// ExternalScorer is the scorer combined with the entropy of the attention mode when -scorer is set
+var ExternalScorer Scorer
+
+// ScoreRequest is the json request sent to an external scorer, the byte slices are base64 encoded
+type ScoreRequest struct {
+	Prefix     []byte `json:"prefix"`
+	Candidates []byte `json:"candidates"`
+}
+
+// ScoreResponse is the json response of an external scorer with a score for each candidate
+type ScoreResponse struct {
+	Scores []float64 `json:"scores"`
+}
+
+// check verifies the response of an external scorer has a score for each candidate
+func (r ScoreResponse) check(candidates []byte) []float64 {
+	if len(r.Scores) != len(candidates) {
+		Fail(ExitScorer, fmt.Errorf("the scorer returned %d scores for %d candidates", len(r.Scores), len(candidates)))
+	}
+	return r.Scores
+}
+
+// HTTPScorer posts the score requests to a url
+type HTTPScorer struct {
+	URL    string
+	Client *http.Client
+}
+
+// ScoreAppend scores the candidates with a post request
+func (h *HTTPScorer) ScoreAppend(prefix []byte, candidates []byte) []float64 {
+	data, err := json.Marshal(ScoreRequest{Prefix: prefix, Candidates: candidates})
+	if err != nil {
+		panic(err)
+	}
+	response, err := h.Client.Post(h.URL, "application/json", bytes.NewReader(data))
+	if err != nil {
+		Fail(ExitScorer, err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		Fail(ExitScorer, fmt.Errorf("%s: %s", h.URL, response.Status))
+	}
+	var scores ScoreResponse
+	if err := json.NewDecoder(response.Body).Decode(&scores); err != nil {
+		Fail(ExitScorer, err)
+	}
+	return scores.check(candidates)
+}
+
+// ProcessScorer sends the score requests to a subprocess as json lines and reads a json line response for each
+type ProcessScorer struct {
+	sync.Mutex
+	Command *exec.Cmd
+	In      io.WriteCloser
+	Out     *bufio.Reader
+}
+
+// NewProcessScorer starts a scorer subprocess, the command is split on spaces
+func NewProcessScorer(command string) (*ProcessScorer, error) {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return nil, fmt.Errorf("the scorer command is empty")
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &ProcessScorer{
+		Command: cmd,
+		In:      in,
+		Out:     bufio.NewReader(out),
+	}, nil
+}
+
+// ScoreAppend scores the candidates with the subprocess, one request is in flight at a time
+func (p *ProcessScorer) ScoreAppend(prefix []byte, candidates []byte) []float64 {
+	p.Lock()
+	defer p.Unlock()
+	if err := json.NewEncoder(p.In).Encode(ScoreRequest{Prefix: prefix, Candidates: candidates}); err != nil {
+		Fail(ExitScorer, err)
+	}
+	line, err := p.Out.ReadBytes('\n')
+	if err != nil {
+		Fail(ExitScorer, err)
+	}
+	var scores ScoreResponse
+	if err := json.Unmarshal(line, &scores); err != nil {
+		Fail(ExitScorer, err)
+	}
+	return scores.check(candidates)
+}
+
+// Close closes the input of the subprocess and waits for it to exit
+func (p *ProcessScorer) Close() error {
+	p.In.Close()
+	return p.Command.Wait()
+}
+
+// NewScorer creates an http scorer for an http or https url and a subprocess scorer for anything else.
+// Http scorers are an error in offline mode.
+func NewScorer(scorer string) (Scorer, error) {
+	if strings.HasPrefix(scorer, "http://") || strings.HasPrefix(scorer, "https://") {
+		if *FlagOffline {
+			return nil, fmt.Errorf("scorer %s: %w", scorer, ErrOffline)
+		}
+		return &HTTPScorer{URL: scorer, Client: &http.Client{}}, nil
+	}
+	return NewProcessScorer(scorer)
+}
@@ -0,0 +1,87 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+// ScoreZ scores z best and every other candidate the same
+func ScoreZ(request ScoreRequest) ScoreResponse {
+	scores := make([]float64, len(request.Candidates))
+	for i, candidate := range request.Candidates {
+		scores[i] = 1
+		if candidate == 'z' {
+			scores[i] = 0
+		}
+	}
+	return ScoreResponse{Scores: scores}
+}
+
+func TestScorerProcess(t *testing.T) {
+	if os.Getenv("LIT_SCORER_PROCESS") != "1" {
+		t.Skip("run as the subprocess of TestScorer")
+	}
+	decoder, encoder := json.NewDecoder(os.Stdin), json.NewEncoder(os.Stdout)
+	for {
+		var request ScoreRequest
+		if err := decoder.Decode(&request); err != nil {
+			os.Exit(0)
+		}
+		if err := encoder.Encode(ScoreZ(request)); err != nil {
+			os.Exit(1)
+		}
+	}
+}
+
+func TestScorer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request ScoreRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(ScoreZ(request))
+	}))
+	defer server.Close()
+	scorer, err := NewScorer(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if scores := scorer.ScoreAppend([]byte("it was"), []byte("az")); scores[0] != 1 || scores[1] != 0 {
+		t.Fatal("the http scorer should return the scores of the server", scores)
+	}
+
+	os.Setenv("LIT_SCORER_PROCESS", "1")
+	defer os.Unsetenv("LIT_SCORER_PROCESS")
+	process, err := NewProcessScorer(os.Args[0] + " -test.run=^TestScorerProcess$")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if scores := process.ScoreAppend([]byte("it was"), []byte("za")); scores[0] != 0 || scores[1] != 1 {
+		t.Fatal("the process scorer should return the scores of the subprocess", scores)
+	}
+	if err := process.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	model, err := GoldenModel(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	weight := *FlagScorerWeight
+	defer func() {
+		ExternalScorer, *FlagScorerWeight = nil, weight
+	}()
+	ExternalScorer, *FlagScorerWeight = scorer, 1
+	if transcript := Transcript(model, Mode{"attention", markovSelfEntropy}); !bytes.Contains(transcript, []byte("zz")) {
+		t.Fatal("the external scorer should decide the output with a weight of 1", string(transcript))
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// ScoreChunk is the window size of -score when -chunk isn't set
+const ScoreChunk = 1024
+
+// LineScore is the self entropy of a line of a scored text
+type LineScore struct {
+	// Line is the line number starting from 1
+	Line  int
+	Text  []byte
+	Total float64
+	// Entropy is the self entropy per byte of the line
+	Entropy float64
+}
+
+// ScoreText streams the lines of a text through the self entropy of the model in windows of chunk bytes,
+// the score of each line that isn't empty is passed to line. The total self entropy and the number of
+// scored bytes are returned, so the entropy per byte of the text is total / length.
+func ScoreText(db *bolt.DB, r io.Reader, chunk, overlap int, line func(score LineScore)) (total float64, length int, err error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 1<<16), 1<<26)
+	number := 0
+	for scanner.Scan() {
+		Check()
+		number++
+		text := scanner.Bytes()
+		if len(text) > 0 && text[len(text)-1] == '\r' {
+			text = text[:len(text)-1]
+		}
+		if len(text) == 0 {
+			continue
+		}
+		input := text
+		if len(input) < Order {
+			input = append(Padding(Order-len(input)), input...)
+		}
+		entropy, _ := ChunkedSelfEntropy(db, input, chunk, overlap)
+		total += entropy
+		length += len(text)
+		if line != nil {
+			line(LineScore{
+				Line:    number,
+				Text:    text,
+				Total:   entropy,
+				Entropy: entropy / float64(len(text)),
+			})
+		}
+	}
+	return total, length, scanner.Err()
+}
+
+func score() {
+	db := OpenModel(*FlagModel)
+	defer db.Close()
+
+	var in io.Reader = os.Stdin
+	if *FlagScore != "-" {
+		file, err := os.Open(*FlagScore)
+		if err != nil {
+			Fail(ExitData, err)
+		}
+		defer file.Close()
+		in = file
+	}
+	chunk := *FlagChunk
+	if chunk == 0 {
+		chunk = ScoreChunk
+	}
+	lines := 0
+	total, length, err := ScoreText(db, in, chunk, *FlagOverlap, func(score LineScore) {
+		lines++
+		if *FlagJSON {
+			EmitRecord(Record{Entropy: score.Entropy, Text: string(score.Text)})
+			return
+		}
+		fmt.Printf("%d %f\n", score.Line, score.Entropy)
+	})
+	if err != nil {
+		Fail(ExitData, fmt.Errorf("%s: %w", *FlagScore, err))
+	}
+	entropy := 0.0
+	if length > 0 {
+		entropy = total / float64(length)
+	}
+	if *FlagJSON {
+		EmitRecord(Record{Entropy: entropy})
+		return
+	}
+	fmt.Printf("lines %d bytes %d total %f entropy %f\n", lines, length, total, entropy)
+}
@@ -0,0 +1,32 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestScoreText(t *testing.T) {
+	db := NewTestModel(t)
+	text := "it was the best of times, it was the worst of times\r\n\nzq\n"
+	scores := []LineScore{}
+	total, length, err := ScoreText(db, strings.NewReader(text), ScoreChunk, 0, func(score LineScore) {
+		scores = append(scores, score)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scores) != 2 || scores[0].Line != 1 || scores[1].Line != 3 || string(scores[1].Text) != "zq" {
+		t.Fatal("the lines that aren't empty should be scored", scores)
+	}
+	if length != 53 || math.Abs(total-scores[0].Total-scores[1].Total) > 1e-9 {
+		t.Fatal("invalid total", total, length)
+	}
+	if expected := SelfEntropy(db, []byte(text[:51]), nil)[0] / 51; math.Abs(scores[0].Entropy-expected) > 1e-9 {
+		t.Fatal("the line should be scored with the self entropy per byte", scores[0].Entropy, expected)
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"runtime"
+	"sync"
+)
+
+var (
+	// Searches bounds the number of concurrent beam search goroutines
+	Searches = make(chan struct{}, runtime.NumCPU())
+	// searching guards Searches and the number of search goroutines in flight
+	searching sync.Mutex
+	// idle is signaled when the last search goroutine in flight is done
+	idle = sync.NewCond(&searching)
+	// running is the number of search goroutines in flight
+	running int
+)
+
+// SetConcurrency sets the number of concurrent beam search goroutines, 0 searches serially.
+// It waits for the search goroutines in flight, so they release their slots to the channel they took them from.
+func SetConcurrency(concurrency int) error {
+	if concurrency < 0 {
+		return errors.New("the concurrency can't be negative")
+	}
+	searching.Lock()
+	defer searching.Unlock()
+	for running > 0 {
+		idle.Wait()
+	}
+	Searches = make(chan struct{}, concurrency)
+	return nil
+}
+
+// Go runs a search in a new goroutine if there is a free slot, otherwise the caller runs it.
+// Running it in the caller never blocks, so the recursive searches can't deadlock waiting for slots,
+// and the results channel must be buffered for all of the searches.
+// A panic in the goroutine is sent to the results, Receive panics with it in the caller.
+func Go(results chan<- Result, search func()) {
+	searching.Lock()
+	slots := Searches
+	select {
+	case slots <- struct{}{}:
+		running++
+		searching.Unlock()
+		scheduled := Timed(PhaseGoroutine)
+		go func() {
+			defer func() {
+				<-slots
+				searching.Lock()
+				running--
+				if running == 0 {
+					idle.Broadcast()
+				}
+				searching.Unlock()
+			}()
+			defer func() {
+				if r := recover(); r != nil {
+					results <- Result{Panic: r}
+				}
+			}()
+			scheduled()
+			search()
+		}()
+	default:
+		searching.Unlock()
+		search()
+	}
+}
+
+// Receive receives a search result, it panics with the panic of a search goroutine
+func Receive(results <-chan Result) Result {
+	result := <-results
+	if result.Panic != nil {
+		panic(result.Panic)
+	}
+	return result
+}
@@ -0,0 +1,58 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConcurrency(t *testing.T) {
+	model, err := GoldenModel(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	searches := cap(Searches)
+	defer SetConcurrency(searches)
+	for _, concurrency := range []int{0, 1} {
+		if err := SetConcurrency(concurrency); err != nil {
+			t.Fatal(err)
+		}
+		for _, mode := range GoldenModes[:2] {
+			expected, err := os.ReadFile(GoldenFile(filepath.Join("testdata", "golden"), mode))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if divergence := Divergence(expected, Transcript(model, mode)); divergence >= 0 {
+				t.Errorf("%s transcript with concurrency %d changed at byte %d", mode.Name, concurrency, divergence)
+			}
+		}
+	}
+	if err := SetConcurrency(-1); err == nil {
+		t.Fatal("negative concurrency should be an error")
+	}
+}
+
+func TestGoPanic(t *testing.T) {
+	searches := cap(Searches)
+	defer SetConcurrency(searches)
+	if err := SetConcurrency(1); err != nil {
+		t.Fatal(err)
+	}
+	next := make(chan Result, 1)
+	Go(next, func() {
+		Fail(ExitData, errors.New("search failed"))
+	})
+	defer func() {
+		err, ok := recover().(*Error)
+		if !ok || err.Code != ExitData {
+			t.Fatal("the panic of the search goroutine should be forwarded", err)
+		}
+	}()
+	Receive(next)
+	t.Fatal("receive should panic")
+}
@@ -0,0 +1,254 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Modes are the decoding modes by name
+var Modes = map[string]func(){
+	"markov":            markov,
+	"attention":         markovSelfEntropy,
+	"mutual":            markovMutualSelfEntropy,
+	"meta":              markovDirectSelfEntropy,
+	"diffusion":         markovSelfEntropyDiffusion,
+	"complex":           markovComplexSelfEntropy,
+	"complex-diffusion": markovComplexSelfEntropyDiffusion,
+}
+
+// GenerateRequest is a generation request, zero values use the server defaults
+type GenerateRequest struct {
+	Mode   string          `json:"mode"`
+	Prompt string          `json:"prompt"`
+	Depth  int             `json:"depth"`
+	Steps  int             `json:"steps"`
+	Stop   float64         `json:"stop"`
+	Vocab  []string        `json:"vocab"`
+	Schema json.RawMessage `json:"schema"`
+	// Namespace selects a named model of the model file, empty for the default model
+	Namespace string `json:"namespace"`
+	// Temperature, TopK, and TopP sample the output instead of taking the best path, the flags are the defaults
+	Temperature float64 `json:"temperature"`
+	TopK        int     `json:"top_k"`
+	TopP        float64 `json:"top_p"`
+}
+
+// GenerateResponse is a generation response with the usage of the request and the total usage of the client
+type GenerateResponse struct {
+	Output string `json:"output"`
+	Usage  Usage  `json:"usage"`
+	Total  Usage  `json:"total"`
+}
+
+// Server serves generation requests.
+// The decoding modes are configured with package state, so requests are served one at a time.
+type Server struct {
+	sync.Mutex
+	// Square is the square markov model, nil if the square mode isn't available
+	Square *Square
+	// Accounts is the usage of the clients, nil if usage isn't tracked
+	Accounts *Accounts
+}
+
+// Generate runs a generation request with its options applied for the duration of the request,
+// the generation stops when ctx is done
+func (s *Server) Generate(ctx context.Context, request GenerateRequest) (output string, usage Usage, err error) {
+	buffer := bytes.Buffer{}
+	usage, err = s.GenerateTo(ctx, &buffer, request)
+	return buffer.String(), usage, err
+}
+
+// GenerateTo runs a generation request writing the results to w as they are generated
+func (s *Server) GenerateTo(ctx context.Context, w io.Writer, request GenerateRequest) (usage Usage, err error) {
+	return s.generate(ctx, w, request, nil)
+}
+
+// generate runs a generation request writing the results to w and calling step with each of them if it isn't nil
+func (s *Server) generate(ctx context.Context, w io.Writer, request GenerateRequest, step func(Result) error) (usage Usage, err error) {
+	generate := Modes[request.Mode]
+	if request.Mode == "square" && s.Square != nil {
+		generate = s.Square.markovSelfEntropy
+	}
+	if generate == nil {
+		return usage, &Error{Code: ExitFlags, Err: fmt.Errorf("unknown mode %q", request.Mode)}
+	}
+	if request.Depth < 0 || request.Steps < 0 || request.Stop < 0 {
+		return usage, &Error{Code: ExitFlags, Err: errors.New("depth, steps, and stop can't be negative")}
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	input, depth, steps, stop := *FlagInput, Depth, *FlagSteps, *FlagStop
+	vocabulary, schema, out, callback, previous := Vocabulary, OutputSchema, Output, Step, Context
+	namespace, bucket, alphabet, sampler := Namespace, ModelBucket, InputAlphabet, OutputSampler
+	defer func() {
+		*FlagInput, Depth, *FlagSteps, *FlagStop = input, depth, steps, stop
+		Vocabulary, OutputSchema, Output, Step, Context = vocabulary, schema, out, callback, previous
+		Namespace, ModelBucket, InputAlphabet, OutputSampler = namespace, bucket, alphabet, sampler
+		if r := recover(); r != nil {
+			switch e := r.(type) {
+			case *Error:
+				err = e
+			case error:
+				err = e
+			default:
+				err = fmt.Errorf("%v", r)
+			}
+		}
+	}()
+
+	prompt, err := NormalizePrompt([]byte(request.Prompt))
+	if err != nil {
+		return usage, &Error{Code: ExitFlags, Err: err}
+	}
+	*FlagInput = string(prompt)
+	if InputAlphabet != nil {
+		InputAlphabet = NewAlphabet(prompt)
+	}
+	if request.Depth > 0 {
+		Depth = request.Depth
+	}
+	if request.Steps > 0 {
+		*FlagSteps = request.Steps
+	}
+	if request.Stop > 0 {
+		*FlagStop = request.Stop
+	}
+	if request.Temperature != 0 || request.TopK != 0 || request.TopP != 0 {
+		temperature, topK, topP := *FlagTemperature, *FlagTopK, *FlagTopP
+		if request.Temperature != 0 {
+			temperature = request.Temperature
+		}
+		if request.TopK != 0 {
+			topK = request.TopK
+		}
+		if request.TopP != 0 {
+			topP = request.TopP
+		}
+		if OutputSampler, err = NewSampler(*FlagSeed, temperature, topK, topP); err != nil {
+			return usage, &Error{Code: ExitFlags, Err: err}
+		}
+	}
+	if len(request.Vocab) > 0 {
+		Vocabulary = NewTrie()
+		for _, word := range request.Vocab {
+			if word = strings.TrimSpace(word); word != "" {
+				Vocabulary.Insert(word)
+			}
+		}
+	}
+	if request.Namespace != "" {
+		if err := SetNamespace(request.Namespace); err != nil {
+			return usage, &Error{Code: ExitFlags, Err: err}
+		}
+	}
+	if len(request.Schema) > 0 {
+		if OutputSchema, err = ParseSchema(request.Schema); err != nil {
+			return usage, &Error{Code: ExitFlags, Err: err}
+		}
+	}
+	Output, Step, Context = w, step, ctx
+	usage = Meter(prompt, func() {
+		err = Stopped(generate)
+	})
+	return usage, err
+}
+
+// Client identifies the client of a request by its remote address.
+// Headers aren't trusted, a client could pick a new identity for each request to escape its quota.
+func Client(r *http.Request) string {
+	return Host(r.RemoteAddr)
+}
+
+// Host is the host of a remote address, the address if it has no port
+func Host(address string) string {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return address
+	}
+	return host
+}
+
+// ServeHTTP serves a json generation request
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "generation requests must be posted", http.StatusMethodNotAllowed)
+		return
+	}
+	client := Client(r)
+	if s.Accounts != nil {
+		if err := s.Accounts.Check(client); err != nil {
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+			return
+		}
+	}
+	var request GenerateRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	output, usage, err := s.Generate(r.Context(), request)
+	total := usage
+	if s.Accounts != nil {
+		total = s.Accounts.Charge(client, usage)
+	}
+	if err != nil {
+		status := http.StatusInternalServerError
+		var e *Error
+		if errors.As(err, &e) && e.Code != ExitInternal {
+			status = http.StatusBadRequest
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(GenerateResponse{Output: output, Usage: usage, Total: total})
+}
+
+// NewServer creates the server of the serving flags
+func NewServer() *Server {
+	server := &Server{
+		Accounts: NewAccounts(Usage{Bytes: *FlagQuotaBytes, Expansions: *FlagQuotaExpansions}),
+	}
+	if *FlagSquareModel != "" {
+		if _, err := os.Stat(*FlagSquareModel); err != nil {
+			Fail(ExitModelNotFound, err)
+		}
+		db, err := bolt.Open(*FlagSquareModel, 0600, nil)
+		if err != nil {
+			Fail(ExitCorruptModel, err)
+		}
+		SquareOffsets = ParseOffsets(*FlagOffsets)
+		server.Square = LoadSquare(db)
+		db.Close()
+	}
+	return server
+}
+
+func serve() {
+	listen(NewServer())
+}
+
+// listen serves the generation requests of a server on -serve
+func listen(server *Server) {
+	http.Handle("/generate", server)
+	fmt.Printf("serving on %s\n", *FlagServe)
+	if err := http.ListenAndServe(*FlagServe, nil); err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServer(t *testing.T) {
+	model, err := GoldenModel(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := *FlagModel
+	*FlagModel = model
+	defer func() {
+		*FlagModel = path
+	}()
+	server := httptest.NewServer(&Server{Accounts: NewAccounts(Usage{Bytes: 1})})
+	defer server.Close()
+	post := func(client, request string) *http.Response {
+		r, err := http.NewRequest(http.MethodPost, server.URL, strings.NewReader(request))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Header.Set("X-Client", client)
+		response, err := http.DefaultClient.Do(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return response
+	}
+
+	response := post("a", `{"mode": "unknown"}`)
+	response.Body.Close()
+	if response.StatusCode != http.StatusBadRequest {
+		t.Fatal("unknown modes should be bad requests", response.Status)
+	}
+
+	request := `{"mode": "attention", "prompt": "it was the", "steps": 1, "depth": 1, "vocab": ["it", "was", "the", "best"]}`
+	response = post("a", request)
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		t.Fatal("unexpected status", response.Status)
+	}
+	var generated GenerateResponse
+	if err := json.NewDecoder(response.Body).Decode(&generated); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(generated.Output, "it was the") != 2 {
+		t.Fatalf("unexpected output %q", generated.Output)
+	}
+	if Depth != 2 || *FlagSteps != 128 || Vocabulary != nil {
+		t.Fatal("request options should not leak")
+	}
+	if generated.Usage.Bytes != 2 || generated.Usage.Expansions == 0 || generated.Total != generated.Usage {
+		t.Fatal("unexpected usage", generated.Usage, generated.Total)
+	}
+
+	response = post("a", request)
+	response.Body.Close()
+	if response.StatusCode != http.StatusTooManyRequests {
+		t.Fatal("clients over their quota should be refused", response.Status)
+	}
+
+	response = post("b", request)
+	response.Body.Close()
+	if response.StatusCode != http.StatusTooManyRequests {
+		t.Fatal("the client header should not escape the quota", response.Status)
+	}
+}
+
+func TestGenerateSampling(t *testing.T) {
+	model, err := GoldenModel(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := GenerateRequest{Mode: "attention", Prompt: GoldenPrompt, Steps: 1, Depth: 1, Temperature: -1}
+	if _, err := Generate(context.Background(), model, request, nil); err == nil {
+		t.Fatal("a negative temperature should be an error")
+	}
+	generate := func(request GenerateRequest) []byte {
+		var output []byte
+		_, err := Generate(context.Background(), model, request, func(step Result) error {
+			output = step.Output
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return output
+	}
+	best := generate(GenerateRequest{Mode: "attention", Prompt: GoldenPrompt, Steps: 1, Depth: 1})
+	request.Temperature, request.TopK = .5, 1
+	if sampled := generate(request); !bytes.Equal(sampled, best) {
+		t.Fatalf("sampling the best candidate should generate the best path %q %q", sampled, best)
+	}
+	if OutputSampler != nil {
+		t.Fatal("the sampler of the request should be restored")
+	}
+}
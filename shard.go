@@ -0,0 +1,135 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"runtime"
+	"sync"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Shards is the number of sub-buckets of a sharded model bucket
+const Shards = 256
+
+// Shard is the name of the sub-bucket of a model key, the last byte of its context.
+// Backoff never zeroes the last byte, so every backoff of a context is in the same shard.
+func Shard(key []byte) []byte {
+	return key[len(key)-1:]
+}
+
+// Sharded returns true if the entries of a model bucket are in shards, a new empty bucket is sharded.
+// The buckets of older models are flat.
+func Sharded(b *bolt.Bucket) bool {
+	k, v := b.Cursor().First()
+	return k == nil || v == nil
+}
+
+// Get gets the value of a key from a model bucket, from its shard if the bucket is sharded
+func Get(b *bolt.Bucket, key []byte) []byte {
+	if shard := b.Bucket(Shard(key)); shard != nil {
+		return shard.Get(key)
+	}
+	return b.Get(key)
+}
+
+// Putter returns a function that puts keys into their shards of a model bucket,
+// or into the bucket itself if it is a flat bucket of an older model
+func Putter(b *bolt.Bucket) func(key, value []byte) error {
+	if !Sharded(b) {
+		return b.Put
+	}
+	shards := [Shards]*bolt.Bucket{}
+	return func(key, value []byte) error {
+		name := Shard(key)
+		shard := shards[name[0]]
+		if shard == nil {
+			var err error
+			shard, err = b.CreateBucketIfNotExists(name)
+			if err != nil {
+				return err
+			}
+			shards[name[0]] = shard
+		}
+		return shard.Put(key, value)
+	}
+}
+
+// ForEach calls a function for each entry of a model bucket, shard by shard if it is sharded
+func ForEach(b *bolt.Bucket, fn func(k, v []byte) error) error {
+	if !Sharded(b) {
+		return b.ForEach(fn)
+	}
+	for i := 0; i < Shards; i++ {
+		shard := b.Bucket([]byte{byte(i)})
+		if shard == nil {
+			continue
+		}
+		if err := shard.ForEach(fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ScanShards calls a function for each entry of a model bucket, scanning the shards concurrently in their own
+// read transactions. The function is called with the index of the shard, so it can accumulate per shard
+// without locking, and the entries of a shard are scanned by one goroutine. A flat bucket is scanned as shard 0.
+func ScanShards(db *bolt.DB, bucket []byte, scan func(shard int, k, v []byte) error) error {
+	sharded := true
+	err := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucket)
+		if b == nil {
+			return bolt.ErrBucketNotFound
+		}
+		sharded = Sharded(b)
+		if sharded {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			return scan(0, k, v)
+		})
+	})
+	if err != nil || !sharded {
+		return err
+	}
+
+	var (
+		wait  sync.WaitGroup
+		once  sync.Once
+		first error
+		slots = make(chan struct{}, runtime.NumCPU())
+	)
+	for i := 0; i < Shards; i++ {
+		wait.Add(1)
+		slots <- struct{}{}
+		go func(i int) {
+			defer func() {
+				<-slots
+				wait.Done()
+			}()
+			err := db.View(func(tx *bolt.Tx) error {
+				b := tx.Bucket(bucket)
+				if b == nil {
+					return bolt.ErrBucketNotFound
+				}
+				shard := b.Bucket([]byte{byte(i)})
+				if shard == nil {
+					return nil
+				}
+				return shard.ForEach(func(k, v []byte) error {
+					return scan(i, k, v)
+				})
+			})
+			if err != nil {
+				once.Do(func() {
+					first = err
+				})
+			}
+		}(i)
+	}
+	wait.Wait()
+	return first
+}
@@ -0,0 +1,73 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestShards(t *testing.T) {
+	s := NewLRU(1024)
+	s.Learn([]byte(Corpus))
+	s.Close()
+	entries := len(s.Model)
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "model.bolt"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	WriteModel(db, []byte("markov"), &s)
+
+	counts := [Shards]int{}
+	err = ScanShards(db, []byte("markov"), func(shard int, k, v []byte) error {
+		if int(Shard(k)[0]) != shard || v == nil {
+			return fmt.Errorf("key %v is in shard %d", k, shard)
+		}
+		counts[shard]++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	total := 0
+	for _, count := range counts {
+		total += count
+	}
+	if total != entries {
+		t.Fatal("every entry should be scanned once", total, entries)
+	}
+
+	flat := map[string][]byte{"abcdefghi": []byte("flat"), "bcdefghij": []byte("flat")}
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket([]byte("flat"))
+		if err != nil {
+			return err
+		}
+		if err := b.Put([]byte("abcdefghi"), flat["abcdefghi"]); err != nil {
+			return err
+		}
+		return Putter(b)([]byte("bcdefghij"), flat["bcdefghij"])
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("flat"))
+		if Sharded(b) || !Sharded(tx.Bucket([]byte("markov"))) {
+			t.Fatal("only the new bucket should be sharded")
+		}
+		for key, value := range flat {
+			if !bytes.Equal(Get(b, []byte(key)), value) {
+				t.Fatal("the flat bucket should be readable", key)
+			}
+		}
+		return nil
+	})
+}
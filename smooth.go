@@ -0,0 +1,110 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	// GoodTuringCutoff is the largest count adjusted by Good-Turing smoothing, larger counts are reliable
+	GoodTuringCutoff = 5
+	// GoodTuringScale scales the counts so the fractional Good-Turing counts survive as integers
+	GoodTuringScale = 16
+)
+
+// Smoother smooths the histograms of a learned model before they are written, so rare contexts don't
+// produce one-hot vectors. It is recorded in the metadata of the model as "smoothing".
+type Smoother struct {
+	Method   string
+	K        uint16
+	Adjusted []float64 `json:",omitempty"`
+}
+
+// ModelSmoother smooths the learned models when -smoothing is set
+var ModelSmoother *Smoother
+
+// NewSmoother creates a smoother for "add-k" or "good-turing" smoothing
+func NewSmoother(method string, k int) (*Smoother, error) {
+	switch method {
+	case "add-k":
+		if k < 1 || k > math.MaxUint16 {
+			return nil, fmt.Errorf("the k of add-k smoothing should be a count")
+		}
+		return &Smoother{Method: method, K: uint16(k)}, nil
+	case "good-turing":
+		return &Smoother{Method: method}, nil
+	}
+	return nil, fmt.Errorf("unknown smoothing %q, should be add-k or good-turing", method)
+}
+
+// Sections calls f with the offset of each 256 count histogram of a model vector that has been observed
+func Sections(vector *[Width]uint16, f func(start int, section []uint16)) {
+	for i := 0; i < Width; i += 256 {
+		section := vector[i : i+256]
+		for _, count := range section {
+			if count != 0 {
+				f(i, section)
+				break
+			}
+		}
+	}
+}
+
+// Fit computes the Good-Turing adjusted counts from the frequencies of the counts of the model
+func (s *Smoother) Fit(model map[Symbols][]uint8) {
+	if s.Method != "good-turing" {
+		return
+	}
+	frequencies := make([]float64, GoodTuringCutoff+2)
+	for _, value := range model {
+		vector := DecodeVector(value)
+		Sections(&vector, func(_ int, section []uint16) {
+			for _, count := range section {
+				if int(count) < len(frequencies) {
+					frequencies[count]++
+				}
+			}
+		})
+	}
+	s.Adjusted = make([]float64, GoodTuringCutoff+1)
+	for r := range s.Adjusted {
+		s.Adjusted[r] = float64(r)
+		if frequencies[r] > 0 && frequencies[r+1] > 0 {
+			s.Adjusted[r] = float64(r+1) * frequencies[r+1] / frequencies[r]
+		}
+	}
+}
+
+// Smooth smooths the observed histograms of a model vector
+func (s *Smoother) Smooth(vector [Width]uint16) [Width]uint16 {
+	wide := [Width]uint64{}
+	for i, count := range vector {
+		wide[i] = uint64(count)
+	}
+	Sections(&vector, func(start int, section []uint16) {
+		for i, count := range section {
+			switch {
+			case s.Method == "add-k":
+				wide[start+i] += uint64(s.K)
+			case int(count) < len(s.Adjusted):
+				// unseen bytes keep at least a count of one, even when the adjusted count rounds to zero
+				wide[start+i] = uint64(math.Max(1, math.Round(GoodTuringScale*s.Adjusted[count])))
+			default:
+				wide[start+i] = GoodTuringScale * uint64(count)
+			}
+		}
+	})
+	return Narrow(wide)
+}
+
+// Apply fits the smoother to the model and smooths every vector of the model
+func (s *Smoother) Apply(model map[Symbols][]uint8) {
+	s.Fit(model)
+	for key, value := range model {
+		model[key] = EncodeVector(s.Smooth(DecodeVector(value)))
+	}
+}
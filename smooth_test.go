@@ -0,0 +1,61 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSmoother(t *testing.T) {
+	if _, err := NewSmoother("add-one", 1); err == nil {
+		t.Fatal("an unknown smoothing should be an error")
+	}
+	if _, err := NewSmoother("add-k", 0); err == nil {
+		t.Fatal("add-k smoothing should add a count")
+	}
+	onehot := [Width]uint16{}
+	onehot['a'] = 3
+	smoother, err := NewSmoother("add-k", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	smoothed := smoother.Smooth(onehot)
+	if smoothed['a'] != 4 || smoothed['b'] != 1 {
+		t.Fatal("add-k should add k to every count", smoothed['a'], smoothed['b'])
+	}
+	if smoother.Smooth([Width]uint16{}) != ([Width]uint16{}) {
+		t.Fatal("unobserved histograms shouldn't be smoothed")
+	}
+
+	s := NewLRU(1024)
+	s.Learn([]byte(Corpus))
+	s.Close()
+	smoother, err = NewSmoother("good-turing", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	smoother.Fit(s.Model)
+	if smoother.Adjusted[0] <= 0 || smoother.Adjusted[1] >= 1 {
+		t.Fatal("good-turing should move mass from seen to unseen bytes", smoother.Adjusted)
+	}
+	smoothed = smoother.Smooth(onehot)
+	if smoothed['b'] == 0 || smoothed['a'] <= smoothed['b'] {
+		t.Fatal("good-turing should keep the seen byte most likely", smoothed['a'], smoothed['b'])
+	}
+
+	ModelSmoother = smoother
+	defer func() {
+		ModelSmoother = nil
+	}()
+	db := NewTestModel(t)
+	stored := Smoother{}
+	if !ReadMetadata(db, "smoothing", &stored) || stored.Method != "good-turing" {
+		t.Fatal("the smoothing should be recorded in the metadata")
+	}
+	if entropy := SelfEntropy(db, []byte(Corpus[:64]), nil)[0]; math.IsNaN(entropy) || entropy <= 0 {
+		t.Fatal("invalid entropy of the smoothed model", entropy)
+	}
+}
@@ -0,0 +1,289 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	zim "github.com/akhenakh/gozim"
+	"github.com/k3a/html2text"
+)
+
+// Source is a source of training articles
+type Source interface {
+	// Next returns the url and the preprocessed plain text of the next article, io.EOF is returned after
+	// the last article. The text is empty if the article should be skipped.
+	Next() (url, plain string, err error)
+	Close() error
+}
+
+// DataPaths returns the paths of -data, a comma separated list of zim files, WARC or WET files,
+// text files, directories of text files, and globs of them
+func DataPaths() ([]string, error) {
+	paths := make([]string, 0, 8)
+	for _, pattern := range strings.Split(*FlagData, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid data %q: %w", pattern, err)
+		}
+		if len(matches) == 0 {
+			// a missing file fails when it is opened
+			matches = []string{pattern}
+		}
+		paths = append(paths, matches...)
+	}
+	if len(paths) == 0 {
+		return nil, errors.New("no training data")
+	}
+	return paths, nil
+}
+
+// SourceData returns true if the training data is learned from interleaved sources,
+// instead of from the articles of a single zim file
+func SourceData() bool {
+	paths, err := DataPaths()
+	return err != nil || len(paths) != 1 || !strings.HasSuffix(strings.ToLower(paths[0]), ".zim")
+}
+
+// Gunzip returns a buffered reader of r that decompresses it if it is gzipped
+func Gunzip(r io.Reader) (*bufio.Reader, error) {
+	reader := bufio.NewReaderSize(r, 1<<16)
+	if magic, err := reader.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		decompressed, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, err
+		}
+		reader = bufio.NewReaderSize(decompressed, 1<<16)
+	}
+	return reader, nil
+}
+
+// OpenSource opens a data source by the kind of its path
+func OpenSource(path string) (Source, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		files := make([]string, 0, 8)
+		err := filepath.Walk(path, func(file string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.Mode().IsRegular() {
+				files = append(files, file)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &textSource{files: files}, nil
+	}
+	name := strings.TrimSuffix(strings.ToLower(path), ".gz")
+	switch {
+	case strings.HasSuffix(name, ".zim"):
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return nil, err
+		}
+		reader, err := zim.NewReader(abs, false)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return &zimSource{path: path, reader: reader}, nil
+	case strings.HasSuffix(name, ".warc") || strings.HasSuffix(name, ".wet"):
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		reader, err := NewWARCReader(file)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return &warcSource{path: path, file: file, reader: reader}, nil
+	}
+	return &textSource{files: []string{path}}, nil
+}
+
+// zimSource is a source of the html articles of a zim file in order
+type zimSource struct {
+	path   string
+	reader *zim.ZimReader
+	index  uint32
+}
+
+// Next returns the text of the next article
+func (z *zimSource) Next() (url, plain string, err error) {
+	if z.index >= z.reader.ArticleCount {
+		return "", "", io.EOF
+	}
+	index := z.index
+	z.index++
+	article, err := z.reader.ArticleAtURLIdx(index)
+	if err != nil {
+		return "", "", nil
+	}
+	url = article.FullURL()
+	if !strings.HasSuffix(url, ".html") {
+		return url, "", nil
+	}
+	html, err := article.Data()
+	if err != nil {
+		return url, "", fmt.Errorf("%s: %w", z.path, err)
+	}
+	return url, PreprocessSource(z.path, html2text.HTML2Text(string(html))), nil
+}
+
+// Close closes the zim file
+func (z *zimSource) Close() error {
+	return z.reader.Close()
+}
+
+// textSource is a source of text files, each file is an article, gzipped files are decompressed
+type textSource struct {
+	files []string
+}
+
+// Next returns the text of the next file
+func (t *textSource) Next() (url, plain string, err error) {
+	if len(t.files) == 0 {
+		return "", "", io.EOF
+	}
+	path := t.files[0]
+	t.files = t.files[1:]
+	file, err := os.Open(path)
+	if err != nil {
+		return path, "", err
+	}
+	defer file.Close()
+	reader, err := Gunzip(file)
+	if err != nil {
+		return path, "", fmt.Errorf("%s: %w", path, err)
+	}
+	text, err := io.ReadAll(reader)
+	if err != nil {
+		return path, "", fmt.Errorf("%s: %w", path, err)
+	}
+	return path, PreprocessSource(path, string(text)), nil
+}
+
+// Close does nothing, the files are closed after they are read
+func (t *textSource) Close() error {
+	return nil
+}
+
+// interleaved takes an article from each of its sources in turn until they are all done
+type interleaved struct {
+	sources []Source
+	next    int
+}
+
+// Interleave interleaves the articles of sources
+func Interleave(sources []Source) Source {
+	return &interleaved{sources: append([]Source{}, sources...)}
+}
+
+// Next returns the next article of the next source that isn't done
+func (i *interleaved) Next() (url, plain string, err error) {
+	for len(i.sources) > 0 {
+		if i.next >= len(i.sources) {
+			i.next = 0
+		}
+		source := i.sources[i.next]
+		url, plain, err = source.Next()
+		if errors.Is(err, io.EOF) {
+			source.Close()
+			i.sources = append(i.sources[:i.next], i.sources[i.next+1:]...)
+			continue
+		}
+		i.next++
+		return url, plain, err
+	}
+	return "", "", io.EOF
+}
+
+// Close closes the sources that aren't done
+func (i *interleaved) Close() (err error) {
+	for _, source := range i.sources {
+		if e := source.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	i.sources = nil
+	return err
+}
+
+// OpenSources opens the sources of -data interleaved
+func OpenSources() Source {
+	paths, err := DataPaths()
+	if err != nil {
+		Fail(ExitData, err)
+	}
+	sources := make([]Source, 0, len(paths))
+	for _, path := range paths {
+		source, err := OpenSource(path)
+		if err != nil {
+			for _, source := range sources {
+				source.Close()
+			}
+			Fail(ExitData, err)
+		}
+		sources = append(sources, source)
+	}
+	return Interleave(sources)
+}
+
+// NewSymbolVectorsSources makes new markov symbol vector model from the interleaved articles of the data sources
+func NewSymbolVectorsSources() LRU {
+	vectors := NewLRU(*FlagLRU)
+	vectors.Store = ModelStore
+	source := OpenSources()
+	defer source.Close()
+	ingestion := NewIngestion(0)
+	skip, i := vectors.Resume()
+	ingestion.Progress.Articles = i
+	position := 0
+	for {
+		url, plain, err := source.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			Fail(ExitData, err)
+		}
+		position++
+		if position <= skip || strings.TrimSpace(plain) == "" || ArticleDedup.Duplicate(url, plain) || LearnHoldout.Hold(url, plain) {
+			continue
+		}
+		if !Supervision.Next(&vectors) {
+			break
+		}
+		if err := vectors.Learn([]byte(plain)); err != nil {
+			ingestion.Skip(url, err)
+			continue
+		}
+		ingestion.Learned(url, len(plain), len(vectors.Model))
+		if i%100 == 0 {
+			runtime.GC()
+		}
+		i++
+		vectors.Checkpoint(position, i)
+	}
+	fmt.Println("done")
+	return vectors
+}
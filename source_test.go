@@ -0,0 +1,68 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSources(t *testing.T) {
+	dir := t.TempDir()
+	texts := filepath.Join(dir, "texts")
+	if err := os.Mkdir(texts, 0755); err != nil {
+		t.Fatal(err)
+	}
+	write := func(path string, data []byte) {
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(filepath.Join(texts, "a.txt"), []byte(Corpus[:200]))
+	compressed := bytes.Buffer{}
+	writer := gzip.NewWriter(&compressed)
+	writer.Write([]byte(Corpus[200:]))
+	writer.Close()
+	write(filepath.Join(texts, "b.txt.gz"), compressed.Bytes())
+	write(filepath.Join(dir, "c.txt"), []byte("it was the season of Light"))
+	write(filepath.Join(dir, "d.txt"), []byte("it was the season of Darkness"))
+
+	data := *FlagData
+	defer func() {
+		*FlagData = data
+	}()
+	*FlagData = filepath.Join(dir, "gutenberg.zim")
+	if SourceData() {
+		t.Fatal("a single zim file should be learned by the zim learners")
+	}
+	*FlagData = texts + ", " + filepath.Join(dir, "*.txt")
+	paths, err := DataPaths()
+	if err != nil || len(paths) != 3 || !SourceData() {
+		t.Fatal("the list and the glob should be expanded", paths, err)
+	}
+	source := OpenSources()
+	defer source.Close()
+	urls, plains := []string{}, []string{}
+	for {
+		url, plain, err := source.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		urls, plains = append(urls, filepath.Base(url)), append(plains, plain)
+	}
+	if strings.Join(urls, " ") != "a.txt c.txt d.txt b.txt.gz" {
+		t.Fatal("the sources should be interleaved", urls)
+	}
+	if plains[3] != Corpus[200:] {
+		t.Fatal("the gzipped text should be decompressed", plains[3])
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/pointlander/lit/matrix"
+)
+
+func TestSquare(t *testing.T) {
+	s := &Square{}
+	s.Learn([]byte(Corpus))
+	if s.Pairs[('t'<<8)|'h'] == nil {
+		t.Fatal("pair th should be learned")
+	}
+	if s.Singles['h'] == nil {
+		t.Fatal("single h should be learned")
+	}
+	if s.Pairs[('q'<<8)|'z'] != nil || s.Singles['z'] != nil {
+		t.Fatal("unseen rows should be nil")
+	}
+
+	found := s.SelfEntropy([]byte("the"))[0]
+	fallback := s.SelfEntropy([]byte("xhe"))[0]
+	unseen := s.SelfEntropy([]byte("qzq"))[0]
+	for _, entropy := range []float64{found, fallback, unseen} {
+		if math.IsNaN(entropy) || entropy <= 0 {
+			t.Fatal("invalid entropy", entropy)
+		}
+	}
+
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "square.bolt"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	s.Save(db)
+	loaded := LoadSquare(db)
+	for i, row := range s.Pairs {
+		if (row == nil) != (loaded.Pairs[i] == nil) {
+			t.Fatal("pair row sparsity doesn't match", i)
+		}
+	}
+	for i, row := range s.Singles {
+		if (row == nil) != (loaded.Singles[i] == nil) {
+			t.Fatal("single row sparsity doesn't match", i)
+		}
+	}
+	if loaded.SelfEntropy([]byte("the"))[0] != found {
+		t.Fatal("loaded model entropy doesn't match")
+	}
+}
+
+func TestSquareProjection(t *testing.T) {
+	s := &Square{Projection: matrix.NewProjection(1, 1<<16, 64)}
+	s.Learn([]byte(Corpus))
+	found := s.SelfEntropy([]byte("the"))[0]
+	if math.IsNaN(found) || found <= 0 {
+		t.Fatal("invalid entropy", found)
+	}
+
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "square.bolt"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	s.Save(db)
+	loaded := LoadSquare(db)
+	if loaded.Projection == nil || loaded.Projection.Out != 64 {
+		t.Fatal("the projection should be stored with the model")
+	}
+	if loaded.SelfEntropy([]byte("the"))[0] != found {
+		t.Fatal("loaded model entropy doesn't match")
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+
+	"github.com/pointlander/compress"
+	bolt "go.etcd.io/bbolt"
+)
+
+// EndBucket is the bucket of the end of text counts of a model bucket
+func EndBucket(bucket []byte) []byte {
+	return append([]byte("eos."), bucket...)
+}
+
+// SortedEndKeys returns the contexts of the end of text counts in sorted order
+func SortedEndKeys(ends map[Symbols]uint32) []Symbols {
+	keys := make([]Symbols, 0, len(ends))
+	for key := range ends {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return bytes.Compare(keys[i][:], keys[j][:]) < 0
+	})
+	return keys
+}
+
+// WriteEnds writes the end of text counts of the contexts that end articles
+func WriteEnds(db *bolt.DB, bucket []byte, ends map[Symbols]uint32) {
+	keys := SortedEndKeys(ends)
+	err := db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(EndBucket(bucket))
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			k, value := key, make([]byte, 4)
+			binary.BigEndian.PutUint32(value, ends[key])
+			if err := b.Put(k[:], value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+// MergeEnds adds the end of text counts to the counts of a model bucket
+func MergeEnds(db *bolt.DB, bucket []byte, ends map[Symbols]uint32) {
+	db.View(func(tx *bolt.Tx) error {
+		e := tx.Bucket(EndBucket(bucket))
+		if e == nil {
+			return nil
+		}
+		for key, count := range ends {
+			k := key
+			if v := e.Get(k[:]); v != nil {
+				ends[key] = count + binary.BigEndian.Uint32(v)
+			}
+		}
+		return nil
+	})
+	WriteEnds(db, bucket, ends)
+}
+
+// End computes the probability that the text ends after the output.
+// The number of times the last context ended an article is compared to the number of times it was seen,
+// which is estimated from the count mass of its vector.
+func End(db *bolt.DB, output []byte) float64 {
+	if len(output) < Order {
+		return 0
+	}
+	symbol := Symbols{}
+	for j := range symbol {
+		symbol[j] = output[len(output)-Order+Indexes[j]]
+	}
+	p := 0.0
+	db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(EndBucket(ModelBucket))
+		if b == nil {
+			return nil
+		}
+		v := b.Get(symbol[:])
+		if v == nil {
+			return nil
+		}
+		ends := float64(binary.BigEndian.Uint32(v))
+		mass := 0.0
+		if v := Get(tx.Bucket(ModelBucket), symbol[:]); v != nil {
+			output := make([]byte, 2*Width)
+			compress.Mark1Decompress1(bytes.NewBuffer(v), output)
+			for key := 0; key < 256; key++ {
+				mass += float64(uint16(output[2*key]) | uint16(output[2*key+1])<<8)
+			}
+		}
+		p = ends / (ends + mass/Order)
+		return nil
+	})
+	return p
+}
+
+// Terminated returns true if generation should stop because the model predicts the end of the text
+func Terminated(db *bolt.DB, output []byte) bool {
+	return *FlagStop > 0 && End(db, output) >= *FlagStop
+}
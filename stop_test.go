@@ -0,0 +1,19 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+)
+
+func TestEnd(t *testing.T) {
+	db := NewTestModel(t)
+	if p := End(db, []byte("going direct the other way.")); p <= 0 || p > 1 {
+		t.Fatal("the end of the corpus should end the text", p)
+	}
+	if p := End(db, []byte("it was the best of")); p != 0 {
+		t.Fatal("the middle of the corpus should not end the text", p)
+	}
+}
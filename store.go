@@ -0,0 +1,65 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	bolt "go.etcd.io/bbolt"
+)
+
+// Store is a model bucket that an LRU streams its evicted vectors into, instead of keeping them in memory,
+// so the model learned isn't limited by memory. The vectors already in the bucket are added to.
+type Store struct {
+	DB     *bolt.DB
+	Bucket []byte
+}
+
+// ModelStore is the store of the learners with -stream
+var ModelStore *Store
+
+// NewStore creates the model bucket of a store, the unit vectors of an existing bucket are removed
+// because streaming changes its histograms
+func NewStore(db *bolt.DB, bucket []byte) (*Store, error) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+			return err
+		}
+		return Denormalize(tx, bucket)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Store{DB: db, Bucket: bucket}, nil
+}
+
+// Get reads the compressed vector of a context, nil if it isn't in the store
+func (s *Store) Get(key Symbols) (value []byte) {
+	err := s.DB.View(func(tx *bolt.Tx) error {
+		if v := Get(tx.Bucket(s.Bucket), key[:]); v != nil {
+			value = append([]byte{}, v...)
+		}
+		return nil
+	})
+	if err != nil {
+		panic(err)
+	}
+	return value
+}
+
+// Write writes a batch of compressed vectors in one transaction, replacing the stored vectors
+func (s *Store) Write(model map[Symbols][]uint8) {
+	err := s.DB.Update(func(tx *bolt.Tx) error {
+		put := Putter(tx.Bucket(s.Bucket))
+		for _, key := range SortedKeys(model) {
+			k := key
+			if err := put(k[:], model[key]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"io"
+	"sync"
+)
+
+// Step is called with each emitted search result when it isn't nil
+var Step func(result Result) error
+
+// stop is the panic that unwinds a generation when Step returns an error or Context is done
+type stop struct {
+	err error
+}
+
+// Stopped runs a generation and returns the error of Step or Context if they stopped it
+func Stopped(generate func()) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			s, ok := r.(stop)
+			if !ok {
+				panic(r)
+			}
+			err = s.err
+		}
+	}()
+	generate()
+	return nil
+}
+
+// Stream runs a generation request calling step with each search result as it is emitted,
+// so that the partial output can be shown while the search continues.
+// The results have the output filter applied. The generation stops after the current result
+// with the error of step, and with the error of ctx as soon as the searches see that it is done.
+func (s *Server) Stream(ctx context.Context, request GenerateRequest, step func(step Result) error) (Usage, error) {
+	if err := ctx.Err(); err != nil {
+		return Usage{}, err
+	}
+	return s.generate(ctx, io.Discard, request, step)
+}
+
+// generations serializes the generations of Generate, the modes are configured with package state
+var generations sync.Mutex
+
+// Generate streams the results of a generation request against the model file to step.
+// The request options are applied for the duration of the generation, see Server.Stream.
+func Generate(ctx context.Context, model string, request GenerateRequest, step func(step Result) error) (Usage, error) {
+	generations.Lock()
+	defer generations.Unlock()
+	path := *FlagModel
+	defer func() {
+		*FlagModel = path
+	}()
+	*FlagModel = model
+	return (&Server{}).Stream(ctx, request, step)
+}
@@ -0,0 +1,61 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestStream(t *testing.T) {
+	model, err := GoldenModel(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := GenerateRequest{Mode: "attention", Prompt: GoldenPrompt, Steps: 2, Depth: 1}
+	steps := make([]Result, 0, 3)
+	usage, err := Generate(context.Background(), model, request, func(step Result) error {
+		steps = append(steps, step)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(steps) != 3 || usage.Bytes != 3 {
+		t.Fatal("there should be a step for each generated byte", len(steps), usage)
+	}
+	for i, step := range steps {
+		if !bytes.Contains(step.Output, []byte(GoldenPrompt)) || len(step.Output) != len(steps[0].Output)+i {
+			t.Fatalf("unexpected step %d %q", i, step.Output)
+		}
+	}
+
+	done := errors.New("done")
+	count := 0
+	usage, err = Generate(context.Background(), model, request, func(step Result) error {
+		count++
+		return done
+	})
+	if err != done || count != 1 || usage.Bytes != 1 {
+		t.Fatal("the error of the step should stop the generation", err, count, usage)
+	}
+	if Step != nil || Output != os.Stdout {
+		t.Fatal("the step should not leak")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	count = 0
+	_, err = Generate(ctx, model, request, func(step Result) error {
+		count++
+		cancel()
+		return nil
+	})
+	if err != context.Canceled || count != 1 {
+		t.Fatal("canceling the context should stop the generation", err, count)
+	}
+}
@@ -6,19 +6,22 @@ package main
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"math"
 	"math/rand"
-	"path/filepath"
+	"os"
 	"runtime"
 	"sort"
+	"strconv"
 	"strings"
 
-	zim "github.com/akhenakh/gozim"
 	"github.com/k3a/html2text"
 	bolt "go.etcd.io/bbolt"
 
 	"github.com/pointlander/compress"
+
+	"github.com/pointlander/lit/matrix"
 )
 
 // Symbols is a set of ordered symbols
@@ -29,32 +32,44 @@ type SymbolVectors map[Symbols]map[uint64]uint16
 
 // NewSymbolVectors makes new markov symbol vector model
 func NewSymbolVectors() LRU {
-	vectors := NewLRU(1024 * 1024)
-	data, err := filepath.Abs(*FlagData)
-	if err != nil {
-		panic(err)
-	}
-	reader, err := zim.NewReader(data, false)
-	if err != nil {
-		panic(err)
-	}
-	var m runtime.MemStats
-	i, articles := 0, reader.ListArticles()
+	vectors := NewLRU(*FlagLRU)
+	vectors.Store = ModelStore
+	reader := OpenData()
+	ingestion := NewIngestion(0)
+	skip, i := vectors.Resume()
+	ingestion.Progress.Articles = i
+	start, end := LearnShard.Range(int(reader.ArticleCount))
+	position, articles := 0, reader.ListArticles()
 	for article := range articles {
+		position++
+		if position <= skip || position-1 < start {
+			continue
+		} else if position-1 >= end {
+			break
+		}
 		url := article.FullURL()
 		if strings.HasSuffix(url, ".html") {
 			html, err := article.Data()
 			if err != nil {
 				panic(err)
 			}
-			plain := html2text.HTML2Text(string(html))
-			runtime.ReadMemStats(&m)
-			fmt.Printf("%5d %5d %20d %s\n", i, m.Alloc/(1024*1024), len(vectors.Model), url)
-			vectors.Learn([]byte(plain))
+			plain := Preprocess(html2text.HTML2Text(string(html)))
+			if plain == "" || ArticleDedup.Duplicate(url, plain) || LearnHoldout.Hold(url, plain) {
+				continue
+			}
+			if !Supervision.Next(&vectors) {
+				break
+			}
+			if err := vectors.Learn([]byte(plain)); err != nil {
+				ingestion.Skip(url, err)
+				continue
+			}
+			ingestion.Learned(url, len(plain), len(vectors.Model))
 			if i%100 == 0 {
 				runtime.GC()
 			}
 			i++
+			vectors.Checkpoint(position, i)
 		}
 	}
 	fmt.Println("done")
@@ -64,20 +79,20 @@ func NewSymbolVectors() LRU {
 // NewSymbolVectorsRandom makes new markov symbol vector model
 func NewSymbolVectorsRandom() LRU {
 	rnd := rand.New(rand.NewSource(1))
-	vectors := NewLRU(1024 * 1024)
-	data, err := filepath.Abs(*FlagData)
-	if err != nil {
-		panic(err)
+	vectors := NewLRU(*FlagLRU)
+	vectors.Store = ModelStore
+	reader := OpenData()
+	ingestion := NewIngestion(*FlagScale*1024 + 1)
+	draws, i := vectors.Resume()
+	ingestion.Progress.Articles = i
+	length := reader.ArticleCount
+	for j := 0; j < draws; j++ {
+		rnd.Intn(int(length))
 	}
-	reader, err := zim.NewReader(data, false)
-	if err != nil {
-		panic(err)
-	}
-	var m runtime.MemStats
-	i, length := 0, reader.ArticleCount
 	for {
 		index := rnd.Intn(int(length))
-		if index == 0 {
+		draws++
+		if index == 0 || !LearnShard.Contains(index, int(length)) {
 			continue
 		}
 		article, err := reader.ArticleAtURLIdx(uint32(index))
@@ -90,10 +105,18 @@ func NewSymbolVectorsRandom() LRU {
 			if err != nil {
 				panic(err)
 			}
-			plain := html2text.HTML2Text(string(html))
-			runtime.ReadMemStats(&m)
-			fmt.Printf("%5d %5d %20d %s\n", i, m.Alloc/(1024*1024), len(vectors.Model), url)
-			vectors.Learn([]byte(plain))
+			plain := Preprocess(html2text.HTML2Text(string(html)))
+			if plain == "" || ArticleDedup.Duplicate(url, plain) || LearnHoldout.Hold(url, plain) {
+				continue
+			}
+			if !Supervision.Next(&vectors) {
+				break
+			}
+			if err := vectors.Learn([]byte(plain)); err != nil {
+				ingestion.Skip(url, err)
+				continue
+			}
+			ingestion.Learned(url, len(plain), len(vectors.Model))
 			if i%100 == 0 {
 				runtime.GC()
 			}
@@ -101,19 +124,39 @@ func NewSymbolVectorsRandom() LRU {
 				break
 			}
 			i++
+			vectors.Checkpoint(draws, i)
 		}
 	}
 	fmt.Println("done")
 	return vectors
 }
 
-// Learn learns a markov model from data
-func (s *LRU) Learn(data []byte) {
+// Learn learns a markov model from data.
+// The data is padded with Order zero bytes marking the beginning of the text,
+// so the first bytes are learned and the tail is learned up to the end of the text.
+// With -redact the transitions that touch a redacted span aren't learned, the bytes around the span
+// aren't joined into transitions that never occurred.
+// ErrEmptyInput is returned if there is no data.
+func (s *LRU) Learn(data []byte) error {
 	var symbols Symbols
-	if len(data) < 2*Order {
-		return
+	if len(data) == 0 {
+		return ErrEmptyInput
 	}
-	for i := range data[:len(data)-2*Order] {
+	data = append(Padding(Order), data...)
+	next := LearnRedaction.Next(data)
+	for j := range symbols {
+		symbols[j] = data[len(data)-Order+Indexes[j]]
+	}
+	if next == nil || next[len(data)-Order] == len(data) {
+		s.Ends[symbols]++
+	}
+	for i := range data[:len(data)-Order] {
+		limit := len(data)
+		if next != nil {
+			if limit = next[i]; limit <= i+Order {
+				continue
+			}
+		}
 		symbol := uint64(data[i+Order])
 		for j := range symbols {
 			symbols[j] = data[i+Indexes[j]]
@@ -135,7 +178,7 @@ func (s *LRU) Learn(data []byte) {
 				}
 				vector[uint64(symbol)] += 1
 			}
-			for j := 1; j < Order; j++ {
+			for j := 1; j < Order && i+j+Order < limit; j++ {
 				if vector[uint64(data[i+j+Order])] < math.MaxUint16 {
 					vector[uint64(data[i+j+Order])] += 1
 				} else {
@@ -159,16 +202,16 @@ func (s *LRU) Learn(data []byte) {
 					}
 					vector[256+uint64(symbol)] += 1
 				}
-				for j := 1; j < 32; j++ {
-					if vector[256+uint64(data[i+j])] < math.MaxUint16 {
-						vector[256+uint64(data[i+j])] += 1
+				for j := 1; j < Lookahead && i+j+Order < limit; j++ {
+					if vector[256+uint64(data[i+j+Order])] < math.MaxUint16 {
+						vector[256+uint64(data[i+j+Order])] += 1
 					} else {
 						for key, value := range vector {
 							if key >= 256 {
 								vector[key] = value >> 1
 							}
 						}
-						vector[256+uint64(data[i+j])] += 1
+						vector[256+uint64(data[i+j+Order])] += 1
 					}
 				}
 			}
@@ -176,27 +219,35 @@ func (s *LRU) Learn(data []byte) {
 			s.Flush()
 		}
 	}
+	return nil
 }
 
-// Square is a square markov vector model
-type Square [1 << 16][]uint16
+// Square is a square markov vector model, rows are allocated when they are first learned
+type Square struct {
+	// Pairs are the vectors indexed by the last two bytes
+	Pairs [1 << 16][]uint16
+	// Singles are the fallback vectors indexed by the last byte
+	Singles [256][]uint16
+	// Projection projects the vectors to a lower dimension before the kernel, nil if they aren't projected
+	Projection *matrix.Projection
+}
+
+// increment increments a count in a row, halving the row if the count would saturate
+func increment(row []uint16, a uint16) {
+	if row[a] == math.MaxUint16 {
+		for k := range row {
+			row[k] >>= 1
+		}
+	}
+	row[a]++
+}
 
 // NewSquareRandom makes new square markov vector model
 func NewSquareRandom() *Square {
 	rnd := rand.New(rand.NewSource(1))
 	vectors := &Square{}
-	for i := range vectors {
-		vectors[i] = make([]uint16, 1<<16)
-	}
-	data, err := filepath.Abs(*FlagData)
-	if err != nil {
-		panic(err)
-	}
-	reader, err := zim.NewReader(data, false)
-	if err != nil {
-		panic(err)
-	}
-	var m runtime.MemStats
+	reader := OpenData()
+	ingestion := NewIngestion(*FlagScale*1024 + 1)
 	i, length := 0, reader.ArticleCount
 	for {
 		index := rnd.Intn(int(length))
@@ -213,10 +264,13 @@ func NewSquareRandom() *Square {
 			if err != nil {
 				panic(err)
 			}
-			plain := html2text.HTML2Text(string(html))
-			runtime.ReadMemStats(&m)
-			fmt.Printf("%5d %5d %s\n", m.Alloc/(1024*1024), i, url)
+			plain := Preprocess(html2text.HTML2Text(string(html)))
+			if plain == "" || ArticleDedup.Duplicate(url, plain) {
+				continue
+			}
+			Check()
 			vectors.Learn([]byte(plain))
+			ingestion.Learned(url, len(plain), 0)
 			if i%100 == 0 {
 				runtime.GC()
 			}
@@ -232,81 +286,164 @@ func NewSquareRandom() *Square {
 
 // Learn learns a square markov model from data
 func (s *Square) Learn(data []byte) {
-	for i := 5; i < len(data)-4; i++ {
+	min, max := 0, 0
+	for _, offset := range SquareOffsets {
+		if offset < min {
+			min = offset
+		}
+		if offset > max {
+			max = offset
+		}
+	}
+	for i := 1 - min; i < len(data)-max; i++ {
 		index := (uint16(data[i-1]) << 8) | uint16(data[i])
-		for j := -4; j < -1; j++ {
+		pair, single := s.Pairs[index], s.Singles[data[i]]
+		if pair == nil {
+			pair = make([]uint16, 1<<16)
+			s.Pairs[index] = pair
+		}
+		if single == nil {
+			single = make([]uint16, 1<<16)
+			s.Singles[data[i]] = single
+		}
+		for _, j := range SquareOffsets {
 			a := (uint16(data[i-1+j]) << 8) | uint16(data[i+j])
-			if s[index][a] == math.MaxUint16 {
-				for k := range s[index] {
-					s[index][k] >>= 1
-				}
-			}
-			s[index][a]++
+			increment(pair, a)
+			increment(single, a)
+		}
+	}
+}
 
-			if s[index&0xff][a] == math.MaxUint16 {
-				for k := range s[index&0xff] {
-					s[index&0xff][k] >>= 1
+// Save saves the square markov model and its offsets to a bolt db.
+// Pair rows have two byte keys and single rows have one byte keys.
+// The rows are sparse so only the nonzero counts are stored as index, count pairs.
+func (s *Square) Save(db *bolt.DB) {
+	WriteMetadata(db, "square", SquareOffsets)
+	if s.Projection != nil {
+		WriteMetadata(db, "projection", s.Projection)
+	}
+	err := db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte("square"))
+		if err != nil {
+			return err
+		}
+		put := func(key []byte, row []uint16) error {
+			if row == nil {
+				return nil
+			}
+			data := make([]byte, 0, 8)
+			for index, value := range row {
+				if value == 0 {
+					continue
 				}
+				data = append(data, byte(index&0xff), byte((index>>8)&0xff),
+					byte(value&0xff), byte((value>>8)&0xff))
 			}
-			s[index&0xff][a]++
+			return b.Put(key, data)
 		}
-		for j := 2; j < 5; j++ {
-			a := (uint16(data[i-1+j]) << 8) | uint16(data[i+j])
-			if s[index][a] == math.MaxUint16 {
-				for k := range s[index] {
-					s[index][k] >>= 1
-				}
+		for i, row := range s.Pairs {
+			if err := put([]byte{byte(i >> 8), byte(i & 0xff)}, row); err != nil {
+				return err
 			}
-			s[index][a]++
-
-			if s[index&0xff][a] == math.MaxUint16 {
-				for k := range s[index&0xff] {
-					s[index&0xff][k] >>= 1
-				}
+		}
+		for i, row := range s.Singles {
+			if err := put([]byte{byte(i)}, row); err != nil {
+				return err
 			}
-			s[index&0xff][a]++
 		}
+		return nil
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+// LoadSquare loads a square markov model and its offsets from a bolt db
+func LoadSquare(db *bolt.DB) *Square {
+	if !ReadMetadata(db, "square", &SquareOffsets) {
+		Fail(ExitCorruptModel, fmt.Errorf("square model offsets not found"))
+	}
+	vectors, projection := &Square{}, matrix.Projection{}
+	if ReadMetadata(db, "projection", &projection) {
+		projection.Init()
+		vectors.Projection = &projection
+	}
+	err := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("square"))
+		if b == nil {
+			return fmt.Errorf("square model not found")
+		}
+		return b.ForEach(func(k, v []byte) error {
+			if len(v)%4 != 0 {
+				return fmt.Errorf("invalid square model row %v", k)
+			}
+			row := make([]uint16, 1<<16)
+			for i := 0; i < len(v); i += 4 {
+				index := uint16(v[i]) | uint16(v[i+1])<<8
+				row[index] = uint16(v[i+2]) | uint16(v[i+3])<<8
+			}
+			switch len(k) {
+			case 1:
+				vectors.Singles[k[0]] = row
+			case 2:
+				vectors.Pairs[(int(k[0])<<8)|int(k[1])] = row
+			default:
+				return fmt.Errorf("invalid square model key %v", k)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		Fail(ExitCorruptModel, err)
 	}
+	return vectors
 }
 
 // SelfEntropy calculates entropy
 func (s *Square) SelfEntropy(input []byte) (ax []float64) {
 	rnd := rand.New(rand.NewSource(1))
-	length := len(input)
-	weights := NewMatrix(0, 256, (length - 2 + 1))
+	length, dims := len(input), 1<<16
+	if s.Projection != nil {
+		dims = s.Projection.Out
+	}
+	weights := matrix.NewMatrix(0, dims, (length - 2 + 1))
 	orders := make([]int, length-2+1)
 	for i := 0; i < length-2+1; i++ {
 		order := 2
-		a := s[(uint(input[i])<<8)|uint(input[i+1])]
+		a := s.Pairs[(uint(input[i])<<8)|uint(input[i+1])]
 		if a == nil {
 			order = 1
-			a = s[input[i+1]]
+			a = s.Singles[input[i+1]]
 		}
 		if a == nil {
-			orders[i] = 2 - 1
-			vector, sum := make([]float64, 1<<16), float64(0.0)
+			orders[i] = 0
+			vector, sum := make([]float64, dims), matrix.Accumulator{}
 			for key := range vector {
 				v := rnd.Float64()
-				sum += v * v
+				sum.Add(v * v)
 				vector[key] = v
 			}
-			length := math.Sqrt(sum)
+			length := math.Sqrt(sum.Sum)
 			for i, v := range vector {
 				vector[i] = v / length
 			}
 			weights.Data = append(weights.Data, vector...)
 		} else {
 			orders[i] = order
-			vector, sum := make([]float64, 1<<16), float64(0.0)
+			vector, sum := make([]float64, 1<<16), matrix.Accumulator{}
 			for key, value := range a {
-				/*if value == math.MaxUint16 {
-					fmt.Println("max value")
-				}*/
-				v := float64(value)
-				sum += v * v
-				vector[key] = v
+				vector[key] = float64(value)
+			}
+			if s.Projection != nil {
+				vector = s.Projection.Project(vector)
+			}
+			for _, v := range vector {
+				sum.Add(v * v)
+			}
+			length := math.Sqrt(sum.Sum)
+			if sum.Sum == 0 {
+				length = 1
 			}
-			length := math.Sqrt(sum)
 			for i, v := range vector {
 				vector[i] = v / length
 			}
@@ -314,13 +451,13 @@ func (s *Square) SelfEntropy(input []byte) (ax []float64) {
 		}
 	}
 
-	importance := NewMatrix(0, len(orders), 1)
+	importance := matrix.NewMatrix(0, len(orders), 1)
 	for _, order := range orders {
 		importance.Data = append(importance.Data, 1/float64(Order-order))
 	}
 
 	entropy := make([]float64, 1)
-	entropy[0] = SelfEntropyKernel(weights, weights, weights, importance)
+	entropy[0] = matrix.SelfEntropyKernel(weights, weights, weights, importance)
 	return entropy
 }
 
@@ -328,8 +465,12 @@ func (s *Square) markovSelfEntropy() {
 	in := []byte(*FlagInput)
 	var search func(depth int, input []byte, done chan Result)
 	search = func(depth int, input []byte, done chan Result) {
-		pathes := make([]Result, Width)
-		for i := 0; i < Width; i++ {
+		if Canceled() {
+			done <- Result{Output: input}
+			return
+		}
+		pathes := make([]Result, 256)
+		for i := 0; i < 256; i++ {
 			n := make([]byte, len(input))
 			copy(n, input)
 			n = append(n, byte(i))
@@ -341,9 +482,12 @@ func (s *Square) markovSelfEntropy() {
 			}
 			pathes[i].Entropy = total
 		}
+		Exclude(pathes, true, len(in))
+		sorting := Timed(PhaseSort)
 		sort.Slice(pathes, func(i, j int) bool {
 			return pathes[i].Entropy < pathes[j].Entropy
 		})
+		sorting()
 		index := split(pathes)
 		/*for _, path := range pathes[:index] {
 			fmt.Println(path.Entropy,
@@ -358,13 +502,16 @@ func (s *Square) markovSelfEntropy() {
 		if depth <= 1 {
 			min, output = pathes[0].Entropy, pathes[0].Output
 		} else {
-			next := make(chan Result, 8)
+			next := make(chan Result, index)
 			for _, path := range pathes[:index] {
-				go search(depth-1, path.Output, next)
+				path := path
+				Go(next, func() {
+					search(depth-1, path.Output, next)
+				})
 			}
 			for range pathes[:index] {
-				result := <-next
-				if result.Entropy < min {
+				result := Receive(next)
+				if Better(result, Result{Entropy: min, Output: output}, true) {
 					min, output = result.Entropy, result.Output
 				}
 			}
@@ -377,24 +524,39 @@ func (s *Square) markovSelfEntropy() {
 	//padding := make([]byte, Order-2)
 	//in = append(padding, in...)
 	done := make(chan Result, 8)
-	go search(Depth, in, done)
+	search(Depth, in, done)
 	result := <-done
 	result.Output = result.Output[:len(result.Output)-Depth+1]
-	fmt.Println(result.Entropy, string(result.Output))
-	fmt.Printf("\n")
-	for i := 0; i < 128; i++ {
+	Emit(result)
+	for i := 0; i < *FlagSteps; i++ {
 		search(Depth, result.Output, done)
 		result = <-done
 		result.Output = result.Output[:len(result.Output)-Depth+1]
-		fmt.Println(result.Entropy, string(result.Output))
-		fmt.Printf("\n")
+		Emit(result)
 	}
 }
 
 // MarkovProbability calculates the markov probability
 func MarkovProbability(db *bolt.DB, input []byte) (ax []float64) {
 	length := len(input)
-	weights := NewMatrix(0, Width, length-Order+1)
+	if MixtureWeights != nil {
+		probabilities := make([]float64, length-Order+1)
+		db.View(func(tx *bolt.Tx) error {
+			b := tx.Bucket(ModelBucket)
+			for i := range probabilities {
+				symbol := Symbols{}
+				for j := range symbol {
+					symbol[j] = input[i+j]
+				}
+				if mixed := Mix(Histograms(b, symbol), MixtureWeights); mixed != nil {
+					probabilities[i] = mixed[input[i+Order-1]]
+				}
+			}
+			return nil
+		})
+		return probabilities
+	}
+	weights := matrix.NewMatrix(0, Width, length-Order+1)
 	orders := make([]int, length-Order+1)
 	for i := 0; i < length-Order+1; i++ {
 		symbol := Symbols{}
@@ -404,23 +566,18 @@ func MarkovProbability(db *bolt.DB, input []byte) (ax []float64) {
 		var decoded [Width]uint16
 		found, order := false, 0
 		db.View(func(tx *bolt.Tx) error {
-			b := tx.Bucket([]byte("markov"))
-			for j := 0; j < Order-1; j++ {
+			b := tx.Bucket(ModelBucket)
+			for j := Backoff(); j < Order-1; j++ {
 				symbol := symbol
 				for k := 0; k < j; k++ {
 					symbol[k] = 0
 				}
-				v := b.Get(symbol[:])
+				v := Get(b, symbol[:])
 				if v != nil {
 					found, order = true, j
-					index, buffer, output := 0, bytes.NewBuffer(v), make([]byte, 2*Width)
-					compress.Mark1Decompress1(buffer, output)
-					for key := range decoded {
-						decoded[key] = uint16(output[index])
-						index++
-						decoded[key] |= uint16(output[index]) << 8
-						index++
-					}
+					output := make([]byte, 2*Width)
+					compress.Mark1Decompress1(bytes.NewBuffer(v), output)
+					DecodeCounts(decoded[:], output)
 					return nil
 				}
 			}
@@ -432,19 +589,8 @@ func MarkovProbability(db *bolt.DB, input []byte) (ax []float64) {
 			weights.Data = append(weights.Data, vector...)
 		} else {
 			orders[i] = Order - order
-			vector, sum := make([]float64, Width), float64(0.0)
-			for key, value := range decoded {
-				/*if value == math.MaxUint16 {
-					fmt.Println("max value")
-				}*/
-				v := float64(value)
-				sum += v * v
-				vector[key] = v
-			}
-			length := math.Sqrt(sum)
-			for i, v := range vector {
-				vector[i] = v / length
-			}
+			vector := make([]float64, Width)
+			UnitCounts(vector, decoded[:])
 			weights.Data = append(weights.Data, vector...)
 		}
 	}
@@ -460,160 +606,49 @@ func MarkovProbability(db *bolt.DB, input []byte) (ax []float64) {
 
 // SelfEntropy calculates entropy
 func SelfEntropy(db *bolt.DB, input, context []byte) (ax []float64) {
+	if len(context) < Order {
+		context = nil
+	}
 	rnd := rand.New(rand.NewSource(1))
 	length := len(input)
-	weights := NewMatrix(0, 256, (length - Order + 1))
-	hmm := NewMatrix(0, 256, (length - Order + 1))
+	weights := matrix.NewMatrix(0, 256, (length - Order + 1))
+	hmm := matrix.NewMatrix(0, 256, (length - Order + 1))
 	if len(context) > 0 {
-		hmm = NewMatrix(0, 256, (length-Order+1)+(len(context)-Order+1))
+		hmm = matrix.NewMatrix(0, 256, (length-Order+1)+(len(context)-Order+1))
 	}
 	orders := make([]int, length-Order+1)
-	for i := 0; i < length-Order+1; i++ {
-		symbol := Symbols{}
-		for j := range symbol {
-			symbol[j] = input[i+Indexes[j]]
-		}
-		var decoded [Width]uint16
-		found, order := false, 0
-		db.View(func(tx *bolt.Tx) error {
-			b := tx.Bucket([]byte("markov"))
-			for j := 0; j < len(Indexes)-1; j++ {
-				symbol := symbol
-				for k := 0; k < j; k++ {
-					symbol[k] = 0
-				}
-				v := b.Get(symbol[:])
-				if v != nil {
-					found, order = true, j
-					index, buffer, output := 0, bytes.NewBuffer(v), make([]byte, 2*Width)
-					compress.Mark1Decompress1(buffer, output)
-					for key := range decoded {
-						decoded[key] = uint16(output[index])
-						index++
-						decoded[key] |= uint16(output[index]) << 8
-						index++
-					}
-					return nil
-				}
-			}
-			return nil
-		})
-		a := decoded[:256]
-		var b []uint16
-		if Size == 2 {
-			b = decoded[256:]
-		}
-		if !found {
-			orders[i] = Order - 1
-			vector, sum := make([]float64, 256), float64(0.0)
-			for key := range vector {
-				v := rnd.Float64()
-				sum += v * v
-				vector[key] = v
-			}
-			length := math.Sqrt(sum)
-			for i, v := range vector {
-				vector[i] = v / length
-			}
-			weights.Data = append(weights.Data, vector...)
-
-			if Size == 2 {
-				vector, sum = make([]float64, 256), float64(0.0)
-				for key := range vector {
-					v := rnd.Float64()
-					sum += v * v
-					vector[key] = v
-				}
-				length = math.Sqrt(sum)
-				for i, v := range vector {
-					vector[i] = v / length
-				}
-				hmm.Data = append(hmm.Data, vector...)
-			}
-		} else {
-			orders[i] = order
-			vector, sum := make([]float64, 256), float64(0.0)
-			for key, value := range a {
-				/*if value == math.MaxUint16 {
-					fmt.Println("max value")
-				}*/
-				v := float64(value)
-				sum += v * v
-				vector[key] = v
-			}
-			length := math.Sqrt(sum)
-			for i, v := range vector {
-				vector[i] = v / length
-			}
-			weights.Data = append(weights.Data, vector...)
-
-			if Size == 2 {
-				vector, sum = make([]float64, 256), float64(0.0)
-				for key, value := range b {
-					/*if value == math.MaxUint16 {
-						fmt.Println("max value")
-					}*/
-					v := float64(value)
-					sum += v * v
-					vector[key] = v
-				}
-				length = math.Sqrt(sum)
-				for i, v := range vector {
-					vector[i] = v / length
-				}
-				hmm.Data = append(hmm.Data, vector...)
-			}
-		}
+	for i, window := range Windows(db, input) {
+		weight, second, order := WindowVectors(rnd, window)
+		orders[i] = order
+		weights.Data = append(weights.Data, weight...)
+		hmm.Data = append(hmm.Data, second...)
 	}
 
-	importance := NewMatrix(0, len(orders), 1)
-	for _, order := range orders {
-		importance.Data = append(importance.Data, 1/float64(Order-order))
+	importance := matrix.NewMatrix(0, len(orders), 1)
+	for i, order := range orders {
+		importance.Data = append(importance.Data, Recency(i, len(orders))/float64(Order-order))
 	}
 
 	entropy := make([]float64, 1)
-	entropy[0] = SelfEntropyKernel(weights, weights, weights, importance)
+	kernel := Timed(PhaseKernel)
+	entropy[0] = matrix.SelfEntropyKernel(weights, weights, weights, importance)
+	kernel()
 
+	if Size != 2 {
+		return entropy
+	}
 	if len(context) == 0 {
-		if Size == 2 {
-			entropy[0] += SelfEntropyKernel(hmm, hmm, hmm, importance)
-		}
+		kernel := Timed(PhaseKernel)
+		entropy[0] += matrix.SelfEntropyKernel(hmm, hmm, hmm, importance)
+		kernel()
 		return entropy
 	}
 
 	length = len(context)
 	ordersHMM := make([]int, length-Order+1)
+	windows := Windows(db, context)
 	for i := 0; i < length-Order+1; i++ {
-		symbol := Symbols{}
-		for j := range symbol {
-			symbol[j] = input[i+Indexes[j]]
-		}
-		var decoded [Width]uint16
-		found, order := false, 0
-		db.View(func(tx *bolt.Tx) error {
-			b := tx.Bucket([]byte("markov"))
-			for j := 0; j < len(Indexes)-1; j++ {
-				symbol := symbol
-				for k := 0; k < j; k++ {
-					symbol[k] = 0
-				}
-				v := b.Get(symbol[:])
-				if v != nil {
-					found, order = true, j
-					index, buffer, output := 0, bytes.NewBuffer(v), make([]byte, 2*Width)
-					compress.Mark1Decompress1(buffer, output)
-					for key := range decoded {
-						decoded[key] = uint16(output[index])
-						index++
-						decoded[key] |= uint16(output[index]) << 8
-						index++
-					}
-					return nil
-				}
-			}
-			return nil
-		})
-		b := decoded[256:]
+		found, order := windows[i].Found, windows[i].Order
 		if !found {
 			ordersHMM[i] = Order - 1
 
@@ -630,41 +665,65 @@ func SelfEntropy(db *bolt.DB, input, context []byte) (ax []float64) {
 			hmm.Data = append(hmm.Data, vector...)
 		} else {
 			ordersHMM[i] = order
-
-			vector, sum := make([]float64, 256), float64(0.0)
-			for key, value := range b {
-				/*if value == math.MaxUint16 {
-					fmt.Println("max value")
-				}*/
-				v := float64(value)
-				sum += v * v
-				vector[key] = v
-			}
-			length := math.Sqrt(sum)
-			for i, v := range vector {
-				vector[i] = v / length
+			vector := windows[i].HMM
+			if vector == nil {
+				vector = make([]float64, 256)
 			}
 			hmm.Data = append(hmm.Data, vector...)
 		}
 	}
 
-	importance = NewMatrix(0, len(orders)+len(ordersHMM), 1)
-	for _, order := range orders {
-		importance.Data = append(importance.Data, 1/float64(Order-order))
+	importance = matrix.NewMatrix(0, len(orders)+len(ordersHMM), 1)
+	for i, order := range orders {
+		importance.Data = append(importance.Data, Recency(i, len(orders))/float64(Order-order))
 	}
 	for _, order := range ordersHMM {
 		importance.Data = append(importance.Data, 1/float64(Order-order))
 	}
-	entropy[0] += SelfEntropyKernel(hmm, hmm, hmm, importance)
+	hmm.Rows = len(hmm.Data) / hmm.Cols
+	kernel = Timed(PhaseKernel)
+	entropy[0] += matrix.SelfEntropyKernel(hmm, hmm, hmm, importance)
+	kernel()
 	return entropy
 }
 
+// ChunkedSelfEntropy calculates the self entropy of a long input in overlapping windows
+// so that peak memory is bounded by the window size. Each window contributes its entropy
+// in proportion to the bytes it adds beyond the overlap with the previous window.
+func ChunkedSelfEntropy(db *bolt.DB, input []byte, chunk, overlap int) (total float64, windows []float64) {
+	if chunk < Order {
+		Fail(ExitFlags, fmt.Errorf("chunk %d should be at least %d", chunk, Order))
+	}
+	if overlap < 0 || overlap >= chunk {
+		Fail(ExitFlags, fmt.Errorf("overlap %d should be in [0, %d)", overlap, chunk))
+	}
+	if len(input) <= chunk {
+		entropy := SelfEntropy(db, input, nil)
+		return entropy[0], entropy
+	}
+	stride, end := chunk-overlap, 0
+	for start := 0; end < len(input); start += stride {
+		stop := start + chunk
+		if stop > len(input) {
+			stop = len(input)
+		}
+		if stop-start < Order {
+			start = stop - Order
+		}
+		entropy := SelfEntropy(db, input[start:stop], nil)
+		windows = append(windows, entropy[0])
+		total += entropy[0] * float64(stop-end) / float64(stop-start)
+		end = stop
+	}
+	return total, windows
+}
+
 // MutalSelfEntropy calculates mutual entropy
 func MutualSelfEntropy(db *bolt.DB, input []byte) (ax []float64) {
 	rnd := rand.New(rand.NewSource(1))
 	length := len(input)
-	aa := NewMatrix(0, 256, 256)
-	weights := NewMatrix(0, 256, (length-Order+1)+256)
+	aa := matrix.NewMatrix(0, 256, 256)
+	weights := matrix.NewMatrix(0, 256, (length-Order+1)+256)
 	orders := make([]int, 256)
 	for i := 0; i < length-Order+1; i++ {
 		symbol := Symbols{}
@@ -674,23 +733,18 @@ func MutualSelfEntropy(db *bolt.DB, input []byte) (ax []float64) {
 		var decoded [Width]uint16
 		found := false
 		db.View(func(tx *bolt.Tx) error {
-			b := tx.Bucket([]byte("markov"))
-			for j := 0; j < len(Indexes)-1; j++ {
+			b := tx.Bucket(ModelBucket)
+			for j := Backoff(); j < len(Indexes)-1; j++ {
 				symbol := symbol
 				for k := 0; k < j; k++ {
 					symbol[k] = 0
 				}
-				v := b.Get(symbol[:])
+				v := Get(b, symbol[:])
 				if v != nil {
 					found = true
-					index, buffer, output := 0, bytes.NewBuffer(v), make([]byte, 2*Width)
-					compress.Mark1Decompress1(buffer, output)
-					for key := range decoded {
-						decoded[key] = uint16(output[index])
-						index++
-						decoded[key] |= uint16(output[index]) << 8
-						index++
-					}
+					output := make([]byte, 2*Width)
+					compress.Mark1Decompress1(bytes.NewBuffer(v), output)
+					DecodeCounts(decoded[:], output)
 					return nil
 				}
 			}
@@ -710,19 +764,8 @@ func MutualSelfEntropy(db *bolt.DB, input []byte) (ax []float64) {
 			}
 			weights.Data = append(weights.Data, vector...)
 		} else {
-			vector, sum := make([]float64, 256), float64(0.0)
-			for key, value := range a {
-				/*if value == math.MaxUint16 {
-					fmt.Println("max value")
-				}*/
-				v := float64(value)
-				sum += v * v
-				vector[key] = v
-			}
-			length := math.Sqrt(sum)
-			for i, v := range vector {
-				vector[i] = v / length
-			}
+			vector := make([]float64, 256)
+			UnitCounts(vector, a[:])
 			weights.Data = append(weights.Data, vector...)
 		}
 	}
@@ -734,31 +777,7 @@ func MutualSelfEntropy(db *bolt.DB, input []byte) (ax []float64) {
 		}
 		symbol[len(Indexes)-1] = byte(s)
 
-		var decoded [Width]uint16
-		found, order := false, 0
-		db.View(func(tx *bolt.Tx) error {
-			b := tx.Bucket([]byte("markov"))
-			for j := 0; j < len(Indexes)-1; j++ {
-				symbol := symbol
-				for k := 0; k < j; k++ {
-					symbol[k] = 0
-				}
-				v := b.Get(symbol[:])
-				if v != nil {
-					found, order = true, j
-					index, buffer, output := 0, bytes.NewBuffer(v), make([]byte, 2*Width)
-					compress.Mark1Decompress1(buffer, output)
-					for key := range decoded {
-						decoded[key] = uint16(output[index])
-						index++
-						decoded[key] |= uint16(output[index]) << 8
-						index++
-					}
-					return nil
-				}
-			}
-			return nil
-		})
+		found, order, decoded := CachedLookup(db, symbol)
 		a := decoded[:256]
 		if !found {
 			orders[s] = Order - 1
@@ -776,31 +795,20 @@ func MutualSelfEntropy(db *bolt.DB, input []byte) (ax []float64) {
 			aa.Data = append(aa.Data, vector...)
 		} else {
 			orders[s] = order
-			vector, sum := make([]float64, 256), float64(0.0)
-			for key, value := range a {
-				/*if value == math.MaxUint16 {
-					fmt.Println("max value")
-				}*/
-				v := float64(value)
-				sum += v * v
-				vector[key] = v
-			}
-			length := math.Sqrt(sum)
-			for i, v := range vector {
-				vector[i] = v / length
-			}
+			vector := make([]float64, 256)
+			UnitCounts(vector, a[:])
 			weights.Data = append(weights.Data, vector...)
 			aa.Data = append(aa.Data, vector...)
 		}
 	}
 
-	importance := NewMatrix(0, len(orders), 1)
+	importance := matrix.NewMatrix(0, len(orders), 1)
 	for _, order := range orders {
 		importance.Data = append(importance.Data, float64(Order-order))
 	}
 
-	e := DirectSelfEntropyKernel(aa, aa, aa, Matrix{})
-	entropy := DirectSelfEntropyKernel(weights, weights, weights, Matrix{})
+	e := matrix.DirectSelfEntropyKernel(aa, aa, aa, matrix.Matrix{})
+	entropy := matrix.DirectSelfEntropyKernel(weights, weights, weights, matrix.Matrix{})
 
 	for i := 0; i < 256; i++ {
 		e[i] = (-e[i] + entropy[(length-Order+1)+i]) * importance.Data[i]
@@ -813,8 +821,8 @@ func MutualSelfEntropy(db *bolt.DB, input []byte) (ax []float64) {
 func MutualSelfEntropyUnitVector(db *bolt.DB, input []byte) (ax []float64) {
 	rnd := rand.New(rand.NewSource(1))
 	length := len(input)
-	aa := NewMatrix(0, 256, 256)
-	weights := NewMatrix(0, 256, (length-Order+1)+256)
+	aa := matrix.NewMatrix(0, 256, 256)
+	weights := matrix.NewMatrix(0, 256, (length-Order+1)+256)
 	for i := 0; i < length-Order+1; i++ {
 		symbol := Symbols{}
 		for j := range symbol {
@@ -823,23 +831,18 @@ func MutualSelfEntropyUnitVector(db *bolt.DB, input []byte) (ax []float64) {
 		var decoded [Width]uint16
 		found := false
 		db.View(func(tx *bolt.Tx) error {
-			b := tx.Bucket([]byte("markov"))
-			for j := 0; j < len(Indexes)-1; j++ {
+			b := tx.Bucket(ModelBucket)
+			for j := Backoff(); j < len(Indexes)-1; j++ {
 				symbol := symbol
 				for k := 0; k < j; k++ {
 					symbol[k] = 0
 				}
-				v := b.Get(symbol[:])
+				v := Get(b, symbol[:])
 				if v != nil {
 					found = true
-					index, buffer, output := 0, bytes.NewBuffer(v), make([]byte, 2*Width)
-					compress.Mark1Decompress1(buffer, output)
-					for key := range decoded {
-						decoded[key] = uint16(output[index])
-						index++
-						decoded[key] |= uint16(output[index]) << 8
-						index++
-					}
+					output := make([]byte, 2*Width)
+					compress.Mark1Decompress1(bytes.NewBuffer(v), output)
+					DecodeCounts(decoded[:], output)
 					return nil
 				}
 			}
@@ -859,19 +862,8 @@ func MutualSelfEntropyUnitVector(db *bolt.DB, input []byte) (ax []float64) {
 			}
 			weights.Data = append(weights.Data, vector...)
 		} else {
-			vector, sum := make([]float64, 256), float64(0.0)
-			for key, value := range a {
-				/*if value == math.MaxUint16 {
-					fmt.Println("max value")
-				}*/
-				v := float64(value)
-				sum += v * v
-				vector[key] = v
-			}
-			length := math.Sqrt(sum)
-			for i, v := range vector {
-				vector[i] = v / length
-			}
+			vector := make([]float64, 256)
+			UnitCounts(vector, a[:])
 			weights.Data = append(weights.Data, vector...)
 		}
 	}
@@ -886,23 +878,18 @@ func MutualSelfEntropyUnitVector(db *bolt.DB, input []byte) (ax []float64) {
 		var decoded [Width]uint16
 		found := false
 		db.View(func(tx *bolt.Tx) error {
-			b := tx.Bucket([]byte("markov"))
-			for j := 0; j < len(Indexes)-1; j++ {
+			b := tx.Bucket(ModelBucket)
+			for j := Backoff(); j < len(Indexes)-1; j++ {
 				symbol := symbol
 				for k := 0; k < j; k++ {
 					symbol[k] = 0
 				}
-				v := b.Get(symbol[:])
+				v := Get(b, symbol[:])
 				if v != nil {
 					found = true
-					index, buffer, output := 0, bytes.NewBuffer(v), make([]byte, 2*Width)
-					compress.Mark1Decompress1(buffer, output)
-					for key := range decoded {
-						decoded[key] = uint16(output[index])
-						index++
-						decoded[key] |= uint16(output[index]) << 8
-						index++
-					}
+					output := make([]byte, 2*Width)
+					compress.Mark1Decompress1(bytes.NewBuffer(v), output)
+					DecodeCounts(decoded[:], output)
 					return nil
 				}
 			}
@@ -923,26 +910,15 @@ func MutualSelfEntropyUnitVector(db *bolt.DB, input []byte) (ax []float64) {
 			weights.Data = append(weights.Data, vector...)
 			aa.Data = append(aa.Data, vector...)
 		} else {
-			vector, sum := make([]float64, 256), float64(0.0)
-			for key, value := range a {
-				/*if value == math.MaxUint16 {
-					fmt.Println("max value")
-				}*/
-				v := float64(value)
-				sum += v * v
-				vector[key] = v
-			}
-			length := math.Sqrt(sum)
-			for i, v := range vector {
-				vector[i] = v / length
-			}
+			vector := make([]float64, 256)
+			UnitCounts(vector, a[:])
 			weights.Data = append(weights.Data, vector...)
 			aa.Data = append(aa.Data, vector...)
 		}
 	}
 
-	e := DirectSelfEntropyKernel(aa, aa, aa, Matrix{})
-	entropy := DirectSelfEntropyKernel(weights, weights, weights, Matrix{})
+	e := matrix.DirectSelfEntropyKernel(aa, aa, aa, matrix.Matrix{})
+	entropy := matrix.DirectSelfEntropyKernel(weights, weights, weights, matrix.Matrix{})
 
 	sum := 0.0
 	for i := 0; i < 256; i++ {
@@ -960,165 +936,59 @@ func MutualSelfEntropyUnitVector(db *bolt.DB, input []byte) (ax []float64) {
 
 // DirectSelfEntropy calculates direct entropy
 func DirectSelfEntropy(db *bolt.DB, input, context []byte) (ax []float64) {
+	ax, _ = DirectSelfEntropyOrders(db, input, context)
+	return ax
+}
+
+// DirectSelfEntropyOrders calculates direct entropy and returns the backoff order of each window of the input
+func DirectSelfEntropyOrders(db *bolt.DB, input, context []byte) (ax []float64, orders []int) {
+	if len(context) < Order {
+		context = nil
+	}
 	rnd := rand.New(rand.NewSource(1))
 	length := len(input)
-	weights := NewMatrix(0, 256, (length - Order + 1))
-	hmm := NewMatrix(0, 256, (length - Order + 1))
+	weights := matrix.NewMatrix(0, 256, (length - Order + 1))
+	hmm := matrix.NewMatrix(0, 256, (length - Order + 1))
 	if len(context) > 0 {
-		hmm = NewMatrix(0, 256, (length-Order+1)+(len(context)-Order+1))
+		hmm = matrix.NewMatrix(0, 256, (length-Order+1)+(len(context)-Order+1))
 	}
-	orders := make([]int, length-Order+1)
-	for i := 0; i < length-Order+1; i++ {
-		symbol := Symbols{}
-		for j := range symbol {
-			symbol[j] = input[i+Indexes[j]]
-		}
-		var decoded [Width]uint16
-		found, order := false, 0
-		db.View(func(tx *bolt.Tx) error {
-			b := tx.Bucket([]byte("markov"))
-			for j := 0; j < len(Indexes)-1; j++ {
-				symbol := symbol
-				for k := 0; k < j; k++ {
-					symbol[k] = 0
-				}
-				v := b.Get(symbol[:])
-				if v != nil {
-					found, order = true, j
-					index, buffer, output := 0, bytes.NewBuffer(v), make([]byte, 2*Width)
-					compress.Mark1Decompress1(buffer, output)
-					for key := range decoded {
-						decoded[key] = uint16(output[index])
-						index++
-						decoded[key] |= uint16(output[index]) << 8
-						index++
-					}
-					return nil
-				}
-			}
-			return nil
-		})
-		a := decoded[:256]
-		var b []uint16
-		if Size == 2 {
-			b = decoded[256:]
-		}
-		if !found {
-			orders[i] = Order - 1
-			vector, sum := make([]float64, 256), float64(0.0)
-			for key := range vector {
-				v := rnd.Float64()
-				sum += v * v
-				vector[key] = v
-			}
-			length := math.Sqrt(sum)
-			for i, v := range vector {
-				vector[i] = v / length
-			}
-			weights.Data = append(weights.Data, vector...)
-
-			if Size == 2 {
-				vector, sum = make([]float64, 256), float64(0.0)
-				for key := range vector {
-					v := rnd.Float64()
-					sum += v * v
-					vector[key] = v
-				}
-				length = math.Sqrt(sum)
-				for i, v := range vector {
-					vector[i] = v / length
-				}
-				hmm.Data = append(hmm.Data, vector...)
-			}
-		} else {
-			orders[i] = order
-			vector, sum := make([]float64, 256), float64(0.0)
-			for key, value := range a {
-				/*if value == math.MaxUint16 {
-					fmt.Println("max value")
-				}*/
-				v := float64(value)
-				sum += v * v
-				vector[key] = v
-			}
-			length := math.Sqrt(sum)
-			for i, v := range vector {
-				vector[i] = v / length
-			}
-			weights.Data = append(weights.Data, vector...)
-
-			if Size == 2 {
-				vector, sum = make([]float64, 256), float64(0.0)
-				for key, value := range b {
-					/*if value == math.MaxUint16 {
-						fmt.Println("max value")
-					}*/
-					v := float64(value)
-					sum += v * v
-					vector[key] = v
-				}
-				length = math.Sqrt(sum)
-				for i, v := range vector {
-					vector[i] = v / length
-				}
-				hmm.Data = append(hmm.Data, vector...)
-			}
-		}
+	orders = make([]int, length-Order+1)
+	for i, window := range Windows(db, input) {
+		weight, second, order := WindowVectors(rnd, window)
+		orders[i] = order
+		weights.Data = append(weights.Data, weight...)
+		hmm.Data = append(hmm.Data, second...)
 	}
 
-	importance := NewMatrix(0, len(orders), 1)
-	for _, order := range orders {
-		importance.Data = append(importance.Data, 1/float64(Order-order))
+	importance := matrix.NewMatrix(0, len(orders), 1)
+	for i, order := range orders {
+		importance.Data = append(importance.Data, Recency(i, len(orders))/float64(Order-order))
 	}
 
-	entropy := DirectSelfEntropyKernel(weights, weights, weights, importance)
+	kernel := Timed(PhaseKernel)
+	entropy := matrix.DirectSelfEntropyKernel(weights, weights, weights, importance)
+	kernel()
 	for key, value := range entropy {
 		entropy[key] = -value
 	}
 
 	if len(context) == 0 {
 		if Size == 2 {
-			h := DirectSelfEntropyKernel(hmm, hmm, hmm, importance)
+			kernel := Timed(PhaseKernel)
+			h := matrix.DirectSelfEntropyKernel(hmm, hmm, hmm, importance)
+			kernel()
 			for key, value := range h {
 				entropy[key] -= value
 			}
 		}
-		return entropy
+		return entropy, orders
 	}
 
 	length = len(context)
 	ordersHMM := make([]int, length-Order+1)
+	windows := Windows(db, context)
 	for i := 0; i < length-Order+1; i++ {
-		symbol := Symbols{}
-		for j := range symbol {
-			symbol[j] = input[i+Indexes[j]]
-		}
-		var decoded [Width]uint16
-		found, order := false, 0
-		db.View(func(tx *bolt.Tx) error {
-			b := tx.Bucket([]byte("markov"))
-			for j := 0; j < len(Indexes)-1; j++ {
-				symbol := symbol
-				for k := 0; k < j; k++ {
-					symbol[k] = 0
-				}
-				v := b.Get(symbol[:])
-				if v != nil {
-					found, order = true, j
-					index, buffer, output := 0, bytes.NewBuffer(v), make([]byte, 2*Width)
-					compress.Mark1Decompress1(buffer, output)
-					for key := range decoded {
-						decoded[key] = uint16(output[index])
-						index++
-						decoded[key] |= uint16(output[index]) << 8
-						index++
-					}
-					return nil
-				}
-			}
-			return nil
-		})
-		b := decoded[256:]
+		found, order := windows[i].Found, windows[i].Order
 		if !found {
 			ordersHMM[i] = Order - 1
 
@@ -1135,37 +1005,41 @@ func DirectSelfEntropy(db *bolt.DB, input, context []byte) (ax []float64) {
 			hmm.Data = append(hmm.Data, vector...)
 		} else {
 			ordersHMM[i] = order
-
-			vector, sum := make([]float64, 256), float64(0.0)
-			for key, value := range b {
-				/*if value == math.MaxUint16 {
-					fmt.Println("max value")
-				}*/
-				v := float64(value)
-				sum += v * v
-				vector[key] = v
-			}
-			length := math.Sqrt(sum)
-			for i, v := range vector {
-				vector[i] = v / length
+			vector := windows[i].HMM
+			if vector == nil {
+				vector = make([]float64, 256)
 			}
 			hmm.Data = append(hmm.Data, vector...)
 		}
 	}
 
-	importance = NewMatrix(0, len(orders)+len(ordersHMM), 1)
-	for _, order := range orders {
-		importance.Data = append(importance.Data, 1/float64(Order-order))
+	importance = matrix.NewMatrix(0, len(orders)+len(ordersHMM), 1)
+	for i, order := range orders {
+		importance.Data = append(importance.Data, Recency(i, len(orders))/float64(Order-order))
 	}
 	for _, order := range ordersHMM {
 		importance.Data = append(importance.Data, 1/float64(Order-order))
 	}
 
-	h := DirectSelfEntropyKernel(hmm, hmm, hmm, importance)
+	kernel = Timed(PhaseKernel)
+	h := matrix.DirectSelfEntropyKernel(hmm, hmm, hmm, importance)
+	kernel()
 	for key, value := range h {
 		entropy[key] -= value
 	}
-	return entropy
+	return entropy, orders
+}
+
+// Better returns true if a is a better search result than b, with -deterministic ties are broken
+// by the output so that the goroutine completion order doesn't change the result
+func Better(a, b Result, less bool) bool {
+	if a.Entropy == b.Entropy {
+		return *FlagDeterministic && len(b.Output) > 0 && bytes.Compare(a.Output, b.Output) < 0
+	}
+	if less {
+		return a.Entropy < b.Entropy
+	}
+	return a.Entropy > b.Entropy
 }
 
 func split(pathes []Result) int {
@@ -1214,17 +1088,21 @@ func split(pathes []Result) int {
 }
 
 func markov() {
-	db, err := bolt.Open(*FlagModel, 0600, nil)
-	if err != nil {
-		panic(err)
-	}
+	db := OpenModel(*FlagModel)
 	defer db.Close()
+	RouteModel(db, []byte(*FlagInput))
+	defer BeginRead(db)()
+	MixtureWeights = LoadMixture(db)
 
 	in := []byte(*FlagInput)
 	var search func(depth int, input []byte, done chan Result)
 	search = func(depth int, input []byte, done chan Result) {
-		pathes := make([]Result, Width)
-		for i := 0; i < Width; i++ {
+		if Canceled() {
+			done <- Result{Output: input}
+			return
+		}
+		pathes := make([]Result, 256)
+		for i := 0; i < 256; i++ {
 			n := make([]byte, len(input))
 			copy(n, input)
 			n = append(n, byte(i))
@@ -1236,9 +1114,12 @@ func markov() {
 			}
 			pathes[i].Entropy = total
 		}
+		Exclude(pathes, false, len(in))
+		sorting := Timed(PhaseSort)
 		sort.Slice(pathes, func(i, j int) bool {
 			return pathes[i].Entropy > pathes[j].Entropy
 		})
+		sorting()
 		index := split(pathes)
 		/*for _, path := range pathes[:index] {
 			fmt.Println(path.Entropy,
@@ -1253,13 +1134,16 @@ func markov() {
 		if depth <= 1 {
 			max, output = pathes[0].Entropy, pathes[0].Output
 		} else {
-			next := make(chan Result, 8)
+			next := make(chan Result, index)
 			for _, path := range pathes[:index] {
-				go search(depth-1, path.Output, next)
+				path := path
+				Go(next, func() {
+					search(depth-1, path.Output, next)
+				})
 			}
 			for range pathes[:index] {
-				result := <-next
-				if result.Entropy > max {
+				result := Receive(next)
+				if Better(result, Result{Entropy: max, Output: output}, false) {
 					max, output = result.Entropy, result.Output
 				}
 			}
@@ -1269,48 +1153,118 @@ func markov() {
 			Output:  output,
 		}
 	}
-	padding := make([]byte, Order-2)
-	in = append(padding, in...)
+	in = Pad(in)
 	done := make(chan Result, 8)
-	go search(Depth, in, done)
+	search(Depth, in, done)
 	result := <-done
-	fmt.Println(result.Entropy, string(result.Output))
-	fmt.Printf("\n")
-	for i := 0; i < 128; i++ {
+	Emit(result)
+	for i := 0; i < *FlagSteps && !Terminated(db, result.Output); i++ {
 		search(Depth, result.Output, done)
 		result = <-done
-		fmt.Println(result.Entropy, string(result.Output))
-		fmt.Printf("\n")
+		Emit(result)
 	}
 }
 
-func markovSelfEntropy() {
-	db, err := bolt.Open(*FlagModel, 0600, nil)
+// ReadContextFile reads the document of -context-file, nil if there isn't one
+func ReadContextFile() []byte {
+	if *FlagContextFile == "" {
+		return nil
+	}
+	context, err := os.ReadFile(*FlagContextFile)
 	if err != nil {
-		panic(err)
+		Fail(ExitData, err)
 	}
+	if len(context) < Order {
+		Fail(ExitFlags, fmt.Errorf("context file should be at least %d bytes", Order))
+	}
+	return context
+}
+
+// ContextFile reads the document the attention mode is conditioned on, nil if there isn't one.
+// The context is attended to through the second histograms, so it only conditions Size 2 models.
+func ContextFile() []byte {
+	context := ReadContextFile()
+	if context != nil && Size != 2 {
+		fmt.Fprintln(os.Stderr, "the context file only conditions Size 2 models")
+	}
+	return context
+}
+
+func markovSelfEntropy() {
+	db := OpenModel(*FlagModel)
 	defer db.Close()
+	RouteModel(db, []byte(*FlagInput))
+	defer BeginRead(db)()
 
+	context := ContextFile()
 	in := []byte(*FlagInput)
+	prompt := Pad(in)
+	start := len(prompt) - Order + 1
+	if start < 0 {
+		start = 0
+	}
+	var kv matrix.Matrix
+	if *FlagPromptAdherence > 0 {
+		kv = PromptVectors(db, prompt)
+	}
+	// branches are the results of the first byte of the root of the search for the n-best output
+	var branches []Result
 	var search func(depth int, input []byte, done chan Result)
 	search = func(depth int, input []byte, done chan Result) {
-		pathes := make([]Result, Width)
-		for i := 0; i < Width; i++ {
+		if Canceled() {
+			done <- Result{Output: input}
+			return
+		}
+		var prefix *Prefix
+		if context == nil {
+			prefix = NewPrefix(db, input)
+		}
+		candidates := Candidates(db, input)
+		if prefix != nil {
+			candidates = prefix.Prefilter(candidates, *FlagPrefilter)
+		}
+		var external []float64
+		if ExternalScorer != nil {
+			external = ExternalScorer.ScoreAppend(input, candidates)
+		}
+		pathes := make([]Result, len(candidates))
+		for i, candidate := range candidates {
 			n := make([]byte, len(input))
 			copy(n, input)
-			n = append(n, byte(i))
+			n = append(n, candidate)
 			pathes[i].Output = n
 			total := 0.0
-			entropy := SelfEntropy(db, n, nil)
+			var entropy []float64
+			if prefix != nil {
+				entropy = prefix.SelfEntropy(candidate)
+			} else {
+				entropy = SelfEntropy(db, n, context)
+			}
 			for _, value := range entropy {
 				total += value
 			}
+			if *FlagPromptAdherence > 0 {
+				total += *FlagPromptAdherence * CrossEntropy(db, n[start:], kv)
+			}
+			if external != nil {
+				total = (1-*FlagScorerWeight)*total + *FlagScorerWeight*external[i]
+			}
 			pathes[i].Entropy = total
 		}
+		Exclude(pathes, true, len(prompt))
+		sorting := Timed(PhaseSort)
 		sort.Slice(pathes, func(i, j int) bool {
 			return pathes[i].Entropy < pathes[j].Entropy
 		})
+		sorting()
 		index := split(pathes)
+		if depth == Depth && index < *FlagNBest {
+			// the root keeps a branch for each of the n-best paths
+			index = *FlagNBest
+			if index > len(pathes) {
+				index = len(pathes)
+			}
+		}
 		/*for _, path := range pathes[:index] {
 			fmt.Println(path.Entropy,
 				strings.Map(func(r rune) rune {
@@ -1323,51 +1277,106 @@ func markovSelfEntropy() {
 		min, output := math.MaxFloat64, []byte{}
 		if depth <= 1 {
 			min, output = pathes[0].Entropy, pathes[0].Output
+			if depth == Depth {
+				branches = pathes
+			}
+			if depth == Depth && OutputSampler != nil {
+				result := OutputSampler.Sample(pathes, true)
+				min, output = result.Entropy, result.Output
+			}
 		} else {
-			next := make(chan Result, 8)
+			next, results := make(chan Result, index), make([]Result, 0, index)
 			for _, path := range pathes[:index] {
-				go search(depth-1, path.Output, next)
+				path := path
+				Go(next, func() {
+					search(depth-1, path.Output, next)
+				})
 			}
 			for range pathes[:index] {
-				result := <-next
-				if result.Entropy < min {
+				result := Receive(next)
+				results = append(results, result)
+				if Better(result, Result{Entropy: min, Output: output}, true) {
 					min, output = result.Entropy, result.Output
 				}
 			}
+			if depth == Depth {
+				branches = results
+			}
+			if depth == Depth && OutputSampler != nil {
+				result := OutputSampler.Sample(results, true)
+				min, output = result.Entropy, result.Output
+			}
 		}
 		done <- Result{
 			Entropy: min,
 			Output:  output,
 		}
 	}
-	padding := make([]byte, Order-2)
-	in = append(padding, in...)
+	in = Pad(in)
 	done := make(chan Result, 8)
-	go search(Depth, in, done)
+	if *FlagNBest > 0 && *FlagDiversity > 0 {
+		beam := []Result{{Output: in}}
+		for i := 0; i <= *FlagSteps; i++ {
+			Check()
+			expanded := make([]Result, 0, len(beam)**FlagNBest)
+			for _, path := range beam {
+				if i > 0 && Terminated(db, path.Output) {
+					expanded = append(expanded, path)
+					continue
+				}
+				search(Depth, path.Output, done)
+				<-done
+				for _, branch := range NBest(branches, *FlagNBest) {
+					branch.Output = branch.Output[:len(path.Output)+1]
+					expanded = append(expanded, branch)
+				}
+			}
+			beam = Diverse(expanded, *FlagNBest, *FlagDiversity, len(in))
+		}
+		EmitNBest(beam)
+		return
+	}
+	search(Depth, in, done)
 	result := <-done
 	result.Output = result.Output[:len(result.Output)-Depth+1]
-	fmt.Println(result.Entropy, string(result.Output))
-	fmt.Printf("\n")
-	for i := 0; i < 128; i++ {
+	if *FlagNBest > 0 {
+		completed := make([]Result, 0, *FlagNBest)
+		for _, branch := range NBest(branches, *FlagNBest) {
+			branch.Output = branch.Output[:len(in)+1]
+			for i := 0; i < *FlagSteps && !Terminated(db, branch.Output); i++ {
+				Check()
+				search(Depth, branch.Output, done)
+				branch = <-done
+				branch.Output = branch.Output[:len(branch.Output)-Depth+1]
+			}
+			completed = append(completed, branch)
+		}
+		EmitNBest(completed)
+		return
+	}
+	Emit(result)
+	for i := 0; i < *FlagSteps && !Terminated(db, result.Output); i++ {
 		search(Depth, result.Output, done)
 		result = <-done
 		result.Output = result.Output[:len(result.Output)-Depth+1]
-		fmt.Println(result.Entropy, string(result.Output))
-		fmt.Printf("\n")
+		Emit(result)
 	}
 }
 
 func markovMutualSelfEntropy() {
-	db, err := bolt.Open(*FlagModel, 0600, nil)
-	if err != nil {
-		panic(err)
-	}
+	db := OpenModel(*FlagModel)
 	defer db.Close()
+	RouteModel(db, []byte(*FlagInput))
+	defer BeginRead(db)()
 
 	in := []byte(*FlagInput)
 	var search func(depth int, input []byte, done chan Result)
 	search = func(depth int, input []byte, done chan Result) {
-		pathes := make([]Result, Width)
+		if Canceled() {
+			done <- Result{Output: input}
+			return
+		}
+		pathes := make([]Result, 256)
 		entropy := MutualSelfEntropy(db, input)
 		for i, e := range entropy {
 			n := make([]byte, len(input))
@@ -1376,9 +1385,12 @@ func markovMutualSelfEntropy() {
 			pathes[i].Output = n
 			pathes[i].Entropy = e
 		}
+		Exclude(pathes, false, len(in))
+		sorting := Timed(PhaseSort)
 		sort.Slice(pathes, func(i, j int) bool {
 			return pathes[i].Entropy > pathes[j].Entropy
 		})
+		sorting()
 		index := split(pathes)
 		/*for _, path := range pathes[:index] {
 			fmt.Println(path.Entropy,
@@ -1393,13 +1405,16 @@ func markovMutualSelfEntropy() {
 		if depth <= 1 {
 			max, output = pathes[0].Entropy, pathes[0].Output
 		} else {
-			next := make(chan Result, 8)
+			next := make(chan Result, index)
 			for _, path := range pathes[:index] {
-				go search(depth-1, path.Output, next)
+				path := path
+				Go(next, func() {
+					search(depth-1, path.Output, next)
+				})
 			}
 			for range pathes[:index] {
-				result := <-next
-				if result.Entropy > max {
+				result := Receive(next)
+				if Better(result, Result{Entropy: max, Output: output}, false) {
 					max, output = result.Entropy, result.Output
 				}
 			}
@@ -1409,52 +1424,59 @@ func markovMutualSelfEntropy() {
 			Output:  output,
 		}
 	}
-	padding := make([]byte, Order-2)
-	in = append(padding, in...)
+	in = Pad(in)
 	done := make(chan Result, 8)
-	go search(Depth, in, done)
+	search(Depth, in, done)
 	result := <-done
 	result.Output = result.Output[:len(result.Output)-Depth+1]
-	fmt.Println(result.Entropy, string(result.Output))
-	fmt.Printf("\n")
-	for i := 0; i < 128; i++ {
+	Emit(result)
+	for i := 0; i < *FlagSteps && !Terminated(db, result.Output); i++ {
 		search(Depth, result.Output, done)
 		result = <-done
 		result.Output = result.Output[:len(result.Output)-Depth+1]
-		fmt.Println(result.Entropy, string(result.Output))
-		fmt.Printf("\n")
+		Emit(result)
 	}
 }
 
 func markovDirectSelfEntropy() {
-	db, err := bolt.Open(*FlagModel, 0600, nil)
-	if err != nil {
-		panic(err)
-	}
+	db := OpenModel(*FlagModel)
 	defer db.Close()
+	RouteModel(db, []byte(*FlagInput))
+	defer BeginRead(db)()
 
 	in := []byte(*FlagInput)
 	var search func(depth int, input []byte, done chan Result)
 	search = func(depth int, input []byte, done chan Result) {
-		pathes := make([]Result, Width)
-		for i := 0; i < Width; i++ {
+		if Canceled() {
+			done <- Result{Output: input}
+			return
+		}
+		candidates := Candidates(db, input)
+		if *FlagPrefilter > 0 {
+			candidates = NewPrefix(db, input).Prefilter(candidates, *FlagPrefilter)
+		}
+		pathes := make([]Result, len(candidates))
+		for i, candidate := range candidates {
 			n := make([]byte, len(input))
 			copy(n, input)
-			n = append(n, byte(i))
+			n = append(n, candidate)
 			pathes[i].Output = n
 			pathes[i].Symbols = DirectSelfEntropy(db, n, nil)
 		}
-		s := NewMatrix(0, len(pathes[0].Symbols), Width)
+		s := matrix.NewMatrix(0, len(pathes[0].Symbols), len(pathes))
 		for _, value := range pathes {
 			s.Data = append(s.Data, value.Symbols...)
 		}
-		entropy := DirectSelfEntropyKernel(s, s, s, Matrix{})
+		entropy := matrix.DirectSelfEntropyKernel(s, s, s, matrix.Matrix{})
 		for i := range pathes {
 			pathes[i].Entropy = entropy[i]
 		}
+		Exclude(pathes, true, len(in))
+		sorting := Timed(PhaseSort)
 		sort.Slice(pathes, func(i, j int) bool {
 			return pathes[i].Entropy < pathes[j].Entropy
 		})
+		sorting()
 		index := split(pathes)
 		/*for _, path := range pathes[:index] {
 			fmt.Println(path.Entropy,
@@ -1469,13 +1491,16 @@ func markovDirectSelfEntropy() {
 		if depth <= 1 {
 			min, output = pathes[0].Entropy, pathes[0].Output
 		} else {
-			next := make(chan Result, 8)
+			next := make(chan Result, index)
 			for _, path := range pathes[:index] {
-				go search(depth-1, path.Output, next)
+				path := path
+				Go(next, func() {
+					search(depth-1, path.Output, next)
+				})
 			}
 			for range pathes[:index] {
-				result := <-next
-				if result.Entropy < min {
+				result := Receive(next)
+				if Better(result, Result{Entropy: min, Output: output}, true) {
 					min, output = result.Entropy, result.Output
 				}
 			}
@@ -1485,31 +1510,27 @@ func markovDirectSelfEntropy() {
 			Output:  output,
 		}
 	}
-	padding := make([]byte, Order-2)
-	in = append(padding, in...)
+	in = Pad(in)
 	done := make(chan Result, 8)
-	go search(Depth, in, done)
+	search(Depth, in, done)
 	result := <-done
 	result.Output = result.Output[:len(result.Output)-Depth+1]
-	fmt.Println(result.Entropy, string(result.Output))
-	fmt.Printf("\n")
-	for i := 0; i < 128; i++ {
+	Emit(result)
+	for i := 0; i < *FlagSteps && !Terminated(db, result.Output); i++ {
 		search(Depth, result.Output, done)
 		result = <-done
 		result.Output = result.Output[:len(result.Output)-Depth+1]
-		fmt.Println(result.Entropy, string(result.Output))
-		fmt.Printf("\n")
+		Emit(result)
 	}
 }
 
 func markovSelfEntropyDiffusion() {
 	rnd := rand.New(rand.NewSource(1))
 
-	db, err := bolt.Open(*FlagModel, 0600, nil)
-	if err != nil {
-		panic(err)
-	}
+	db := OpenModel(*FlagModel)
 	defer db.Close()
+	RouteModel(db, []byte(*FlagInput))
+	defer BeginRead(db)()
 
 	in := []byte(*FlagInput)
 	if *FlagRandomInput != 0 {
@@ -1521,8 +1542,12 @@ func markovSelfEntropyDiffusion() {
 	}
 	var search func(index, depth int, input []byte, done chan Result)
 	search = func(idx, depth int, input []byte, done chan Result) {
-		pathes := make([]Result, Width)
-		for i := 0; i < Width; i++ {
+		if Canceled() {
+			done <- Result{Output: input}
+			return
+		}
+		pathes := make([]Result, 256)
+		for i := 0; i < 256; i++ {
 			n := make([]byte, len(input))
 			copy(n, input)
 			n[idx] = byte(i)
@@ -1534,9 +1559,12 @@ func markovSelfEntropyDiffusion() {
 			}
 			pathes[i].Entropy = total
 		}
+		Exclude(pathes, true, len(in))
+		sorting := Timed(PhaseSort)
 		sort.Slice(pathes, func(i, j int) bool {
 			return pathes[i].Entropy < pathes[j].Entropy
 		})
+		sorting()
 		index := split(pathes)
 		/*for _, path := range pathes[:index] {
 			fmt.Println(path.Entropy,
@@ -1551,13 +1579,16 @@ func markovSelfEntropyDiffusion() {
 		if depth <= 1 {
 			min, output = pathes[0].Entropy, pathes[0].Output
 		} else {
-			next := make(chan Result, 8)
+			next := make(chan Result, index)
 			for _, path := range pathes[:index] {
-				go search(idx, depth-1, path.Output, next)
+				path := path
+				Go(next, func() {
+					search(idx, depth-1, path.Output, next)
+				})
 			}
 			for range pathes[:index] {
-				result := <-next
-				if result.Entropy < min {
+				result := Receive(next)
+				if Better(result, Result{Entropy: min, Output: output}, true) {
 					min, output = result.Entropy, result.Output
 				}
 			}
@@ -1567,18 +1598,37 @@ func markovSelfEntropyDiffusion() {
 			Output:  output,
 		}
 	}
-	padding := make([]byte, Order-2)
 	size := len(in)
-	in = append(padding, in...)
+	if size == 0 {
+		Fail(ExitFlags, errors.New("diffusion requires a non empty -input"))
+	}
+	in = Pad(in)
+	if len(in) < Order {
+		in = append(Padding(Order-len(in)), in...)
+	}
 	done := make(chan Result, 8)
-	go search(Order-2+rnd.Intn(size), 1, in, done)
+	search(len(in)-size+rnd.Intn(size), 1, in, done)
 	result := <-done
-	fmt.Println(result.Entropy, string(result.Output))
-	fmt.Printf("\n")
-	for i := 0; i < 512; i++ {
-		search(Order-2+rnd.Intn(size), 1, result.Output, done)
+	Emit(result)
+	for i := 0; i < 4**FlagSteps; i++ {
+		search(len(in)-size+rnd.Intn(size), 1, result.Output, done)
 		result = <-done
-		fmt.Println(result.Entropy, string(result.Output))
-		fmt.Printf("\n")
+		Emit(result)
+	}
+}
+
+// ParseOffsets parses comma separated square model pair offsets
+func ParseOffsets(offsets string) []int {
+	parsed := make([]int, 0, 8)
+	for _, offset := range strings.Split(offsets, ",") {
+		value, err := strconv.Atoi(strings.TrimSpace(offset))
+		if err != nil {
+			Fail(ExitFlags, fmt.Errorf("invalid offset %q", offset))
+		}
+		if value == 0 {
+			Fail(ExitFlags, fmt.Errorf("offset 0 is the indexed pair"))
+		}
+		parsed = append(parsed, value)
 	}
+	return parsed
 }
@@ -0,0 +1,16 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !linux && !darwin
+
+package main
+
+import (
+	"errors"
+)
+
+// RawTerminal isn't supported on this platform, the explorer reads lines instead
+func RawTerminal(fd int) (restore func(), err error) {
+	return nil, errors.New("raw terminal mode isn't supported")
+}
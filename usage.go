@@ -0,0 +1,82 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// Expansions counts the candidate pathes expanded by the searches
+var Expansions uint64
+
+// Emitted is the last emitted output
+var Emitted []byte
+
+// Usage is the generated bytes and search expansions used
+type Usage struct {
+	Bytes      uint64 `json:"bytes"`
+	Expansions uint64 `json:"expansions"`
+}
+
+// Add adds usage
+func (u Usage) Add(v Usage) Usage {
+	return Usage{
+		Bytes:      u.Bytes + v.Bytes,
+		Expansions: u.Expansions + v.Expansions,
+	}
+}
+
+// Exceeds returns true if the usage exceeds the non zero parts of the quota
+func (u Usage) Exceeds(quota Usage) bool {
+	return (quota.Bytes > 0 && u.Bytes >= quota.Bytes) ||
+		(quota.Expansions > 0 && u.Expansions >= quota.Expansions)
+}
+
+// Meter measures the usage of a generation
+func Meter(prompt []byte, generate func()) Usage {
+	start := atomic.LoadUint64(&Expansions)
+	Emitted = nil
+	generate()
+	return Usage{
+		Bytes:      uint64(len(Generated(Emitted, prompt))),
+		Expansions: atomic.LoadUint64(&Expansions) - start,
+	}
+}
+
+// Accounts is the usage of each client with an optional quota
+type Accounts struct {
+	sync.Mutex
+	Quota Usage
+	Usage map[string]Usage
+}
+
+// NewAccounts creates new accounts with a quota, zero parts of the quota are unlimited
+func NewAccounts(quota Usage) *Accounts {
+	return &Accounts{
+		Quota: quota,
+		Usage: make(map[string]Usage),
+	}
+}
+
+// Check returns an error if a client has used up its quota
+func (a *Accounts) Check(client string) error {
+	a.Lock()
+	defer a.Unlock()
+	if used := a.Usage[client]; used.Exceeds(a.Quota) {
+		return fmt.Errorf("client %s exceeded its quota, used %d bytes and %d expansions", client, used.Bytes, used.Expansions)
+	}
+	return nil
+}
+
+// Charge adds usage to a client and returns the client's total usage
+func (a *Accounts) Charge(client string, usage Usage) Usage {
+	a.Lock()
+	defer a.Unlock()
+	total := a.Usage[client].Add(usage)
+	a.Usage[client] = total
+	return total
+}
@@ -0,0 +1,105 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"os"
+	"strings"
+)
+
+// Trie is a trie of words
+type Trie struct {
+	Children map[byte]*Trie
+	Word     bool
+}
+
+// Vocabulary is the vocabulary generation is restricted to
+var Vocabulary *Trie
+
+// NewTrie creates a new trie
+func NewTrie() *Trie {
+	return &Trie{
+		Children: make(map[byte]*Trie),
+	}
+}
+
+// Insert inserts a word into the trie
+func (t *Trie) Insert(word string) {
+	node := t
+	for i := 0; i < len(word); i++ {
+		child := node.Children[word[i]]
+		if child == nil {
+			child = NewTrie()
+			node.Children[word[i]] = child
+		}
+		node = child
+	}
+	node.Word = true
+}
+
+// Find finds the node of a prefix, nil is returned if the prefix isn't in the trie
+func (t *Trie) Find(prefix []byte) *Trie {
+	node := t
+	for _, symbol := range prefix {
+		node = node.Children[symbol]
+		if node == nil {
+			return nil
+		}
+	}
+	return node
+}
+
+// NewVocabulary loads a vocabulary with one word per line
+func NewVocabulary(file string) *Trie {
+	in, err := os.Open(file)
+	if err != nil {
+		Fail(ExitData, err)
+	}
+	defer in.Close()
+
+	trie, scanner := NewTrie(), bufio.NewScanner(in)
+	for scanner.Scan() {
+		if word := strings.TrimSpace(scanner.Text()); word != "" {
+			trie.Insert(word)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		Fail(ExitData, err)
+	}
+	return trie
+}
+
+// Separator returns true if the symbol separates words
+func Separator(symbol byte) bool {
+	return strings.IndexByte(" \n.,;:!?", symbol) >= 0
+}
+
+// Allowed returns true if the last word of the output is in the vocabulary.
+// A word being written must be a prefix of a vocabulary word,
+// and a word followed by a separator must be a complete vocabulary word.
+func (t *Trie) Allowed(output []byte) bool {
+	if t == nil || len(output) == 0 {
+		return true
+	}
+	last := output[len(output)-1]
+	if Separator(last) {
+		end := len(output) - 1
+		start := end
+		for start > 0 && !Separator(output[start-1]) {
+			start--
+		}
+		if start == end {
+			return true
+		}
+		node := t.Find(output[start:end])
+		return node != nil && node.Word
+	}
+	start := len(output) - 1
+	for start > 0 && !Separator(output[start-1]) {
+		start--
+	}
+	return t.Find(output[start:]) != nil
+}
@@ -0,0 +1,54 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestVocabulary(t *testing.T) {
+	trie := NewTrie()
+	for _, word := range []string{"ls", "list", "cat"} {
+		trie.Insert(word)
+	}
+	tests := []struct {
+		Output  string
+		Allowed bool
+	}{
+		{"run li", true},
+		{"run lx", false},
+		{"run ls ", true},
+		{"run lis ", false},
+		{"run list.", true},
+		{"run  ", true},
+		{"c", true},
+	}
+	for _, test := range tests {
+		if trie.Allowed([]byte(test.Output)) != test.Allowed {
+			t.Fatalf("%q should be allowed %t", test.Output, test.Allowed)
+		}
+	}
+	var none *Trie
+	if !none.Allowed([]byte("anything")) {
+		t.Fatal("no vocabulary should allow everything")
+	}
+}
+
+func TestVocabularyContinuation(t *testing.T) {
+	defer func(vocabulary *Trie) {
+		Vocabulary = vocabulary
+	}(Vocabulary)
+	Vocabulary = NewTrie()
+	for _, word := range []string{"of", "the", "best"} {
+		Vocabulary.Insert(word)
+	}
+	prompt := Pad([]byte("it was the worst"))
+	pathes := []Result{{Output: append(append([]byte(nil), prompt...), " "...)}, {Output: append(append([]byte(nil), prompt...), " of wo "...)}}
+	Exclude(pathes, true, len(prompt))
+	if pathes[0].Entropy == math.MaxFloat64 || pathes[1].Entropy != math.MaxFloat64 {
+		t.Fatal("only the pathes whose continuation leaves the vocabulary should be excluded", pathes)
+	}
+}
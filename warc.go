@@ -0,0 +1,151 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/k3a/html2text"
+)
+
+// WARCRecord is a record of a common crawl WARC or WET file
+type WARCRecord struct {
+	// Type is the WARC-Type of the record: conversion for the plain text of a WET file, response for a WARC file
+	Type string
+	URI  string
+	// Header are the WARC headers of the record
+	Header map[string]string
+	Body   []byte
+}
+
+// WARCReader reads the records of a WARC or WET file, gzipped files are decompressed
+type WARCReader struct {
+	reader *bufio.Reader
+}
+
+// NewWARCReader creates a WARC reader, the gzip members of a .warc.gz or .wet.gz file are read as one stream
+func NewWARCReader(r io.Reader) (*WARCReader, error) {
+	reader, err := Gunzip(r)
+	if err != nil {
+		return nil, err
+	}
+	return &WARCReader{reader: reader}, nil
+}
+
+// Next reads the next record, io.EOF is returned after the last record
+func (w *WARCReader) Next() (*WARCRecord, error) {
+	line := ""
+	for line == "" {
+		l, err := w.reader.ReadString('\n')
+		if err == io.EOF && strings.TrimSpace(l) == "" {
+			return nil, io.EOF
+		} else if err != nil && err != io.EOF {
+			return nil, err
+		}
+		line = strings.TrimSpace(l)
+	}
+	if !strings.HasPrefix(line, "WARC/") {
+		return nil, fmt.Errorf("invalid WARC record version %q", line)
+	}
+	record := WARCRecord{Header: make(map[string]string)}
+	for {
+		l, err := w.reader.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("truncated WARC header: %w", err)
+		}
+		l = strings.TrimRight(l, "\r\n")
+		if l == "" {
+			break
+		}
+		if name, value, ok := strings.Cut(l, ":"); ok {
+			record.Header[strings.ToLower(strings.TrimSpace(name))] = strings.TrimSpace(value)
+		}
+	}
+	record.Type, record.URI = record.Header["warc-type"], record.Header["warc-target-uri"]
+	length, err := strconv.ParseInt(record.Header["content-length"], 10, 64)
+	if err != nil || length < 0 {
+		return nil, fmt.Errorf("invalid WARC content length %q", record.Header["content-length"])
+	}
+	record.Body = make([]byte, length)
+	if _, err := io.ReadFull(w.reader, record.Body); err != nil {
+		return nil, fmt.Errorf("truncated WARC record %s: %w", record.URI, err)
+	}
+	return &record, nil
+}
+
+// Text returns the plain text of a record: the text of a conversion record or the html of a response record
+// converted to text, the boilerplate is removed. The text is empty for the other records.
+func (r *WARCRecord) Text() string {
+	switch r.Type {
+	case "conversion":
+		return RemoveBoilerplate(string(r.Body))
+	case "response":
+		// the http headers of the response come before a blank line
+		header, body, ok := bytes.Cut(r.Body, []byte("\r\n\r\n"))
+		if !ok || !bytes.Contains(bytes.ToLower(header), []byte("content-type: text/html")) {
+			return ""
+		}
+		return RemoveBoilerplate(html2text.HTML2Text(string(body)))
+	}
+	return ""
+}
+
+// Boilerplate are the phrases of the lines of web pages that aren't content
+var Boilerplate = []string{"javascript", "cookie", "terms of use", "privacy policy", "all rights reserved", "lorem ipsum"}
+
+// RemoveBoilerplate keeps the lines of a web page that read as sentences: at least 5 words ending in punctuation,
+// without the phrases of menus and notices
+func RemoveBoilerplate(text string) string {
+	kept := strings.Builder{}
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if len(strings.Fields(line)) < 5 {
+			continue
+		}
+		if last := rune(line[len(line)-1]); !unicode.IsPunct(last) || last == '|' || last == '-' {
+			continue
+		}
+		lower, boilerplate := strings.ToLower(line), false
+		for _, phrase := range Boilerplate {
+			if strings.Contains(lower, phrase) {
+				boilerplate = true
+				break
+			}
+		}
+		if !boilerplate {
+			kept.WriteString(line)
+			kept.WriteByte('\n')
+		}
+	}
+	return kept.String()
+}
+
+// warcSource is a source of the records of a WARC or WET file
+type warcSource struct {
+	path   string
+	file   *os.File
+	reader *WARCReader
+}
+
+// Next returns the text of the next record
+func (w *warcSource) Next() (url, plain string, err error) {
+	record, err := w.reader.Next()
+	if err != nil {
+		return "", "", err
+	}
+	return record.URI, PreprocessSource(w.path, record.Text()), nil
+}
+
+// Close closes the file
+func (w *warcSource) Close() error {
+	return w.file.Close()
+}
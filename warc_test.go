@@ -0,0 +1,82 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWARC(t *testing.T) {
+	record := func(kind, uri, body string) string {
+		return fmt.Sprintf("WARC/1.0\r\nWARC-Type: %s\r\nWARC-Target-URI: %s\r\nContent-Length: %d\r\n\r\n%s\r\n\r\n",
+			kind, uri, len(body), body)
+	}
+	text := "Home | About | Contact\nIt was the best of times, it was the worst of times.\nWe use cookies to improve your experience on this site.\n"
+	html := "HTTP/1.1 200 OK\r\nContent-Type: text/html\r\n\r\n<html><body><p>It was the age of wisdom, it was the age of foolishness.</p></body></html>"
+	members := []string{
+		record("warcinfo", "", "software: test"),
+		record("conversion", "http://example.com/a", text),
+		record("response", "http://example.com/b", html),
+	}
+	compressed := bytes.Buffer{}
+	for _, member := range members {
+		writer := gzip.NewWriter(&compressed)
+		writer.Write([]byte(member))
+		writer.Close()
+	}
+	wet := append([]byte{}, compressed.Bytes()...)
+	reader, err := NewWARCReader(&compressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	texts := []string{}
+	for {
+		record, err := reader.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		texts = append(texts, record.Text())
+	}
+	if len(texts) != 3 || texts[0] != "" {
+		t.Fatal("the records should be read from the gzip members", texts)
+	}
+	if texts[1] != "It was the best of times, it was the worst of times.\n" {
+		t.Fatal("the boilerplate should be removed", texts[1])
+	}
+	if !strings.Contains(texts[2], "It was the age of wisdom") || strings.Contains(texts[2], "<p>") {
+		t.Fatal("the html should be converted to text", texts[2])
+	}
+
+	path := filepath.Join(t.TempDir(), "crawl.wet.gz")
+	if err := os.WriteFile(path, wet, 0644); err != nil {
+		t.Fatal(err)
+	}
+	data, progress := *FlagData, OnProgress
+	defer func() {
+		*FlagData, OnProgress = data, progress
+	}()
+	*FlagData = path
+	urls := []string{}
+	OnProgress = func(p Progress) {
+		urls = append(urls, p.URL)
+	}
+	if !SourceData() {
+		t.Fatal("the file should be WARC data")
+	}
+	vectors := NewSymbolVectorsSources()
+	vectors.Close()
+	if len(vectors.Model) == 0 || len(urls) != 2 || urls[0] != "http://example.com/a" {
+		t.Fatal("the records with text should be learned", len(vectors.Model), urls)
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/pointlander/lit/matrix"
+)
+
+// WhiteningEpsilon regularizes the eigenvalues of the sampled covariance relative to its mean variance
+const WhiteningEpsilon = 1e-2
+
+// WhiteningKey is the metadata key of the whitening of a model bucket
+func WhiteningKey(bucket []byte) string {
+	return "whitening." + string(bucket)
+}
+
+// SampleVectors samples the unit vectors of up to n contexts of a model bucket with reservoir sampling
+func SampleVectors(db *bolt.DB, bucket []byte, n int, rnd *rand.Rand) (matrix.Matrix, error) {
+	sampled, seen := make([][]byte, 0, n), 0
+	err := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucket)
+		if b == nil {
+			return fmt.Errorf("bucket %s not found", bucket)
+		}
+		return ForEach(b, func(k, v []byte) error {
+			seen++
+			if len(sampled) < n {
+				sampled = append(sampled, append([]byte(nil), v...))
+			} else if i := rnd.Intn(seen); i < n {
+				sampled[i] = append(sampled[i][:0], v...)
+			}
+			return nil
+		})
+	})
+	rows := matrix.NewMatrix(0, 256, len(sampled))
+	for _, v := range sampled {
+		vector, sum := DecodeVector(v), 0.0
+		for _, count := range vector[:256] {
+			sum += float64(count) * float64(count)
+		}
+		length := math.Sqrt(sum)
+		for _, count := range vector[:256] {
+			rows.Data = append(rows.Data, float64(count)/length)
+		}
+	}
+	return rows, err
+}
+
+// Whiten computes a whitening transform of the vectors of sampled contexts of a model bucket and stores it in
+// the metadata, inference whitens the vectors of the bucket before the kernel. The whitening decorrelates the
+// dimensions of the common bytes, such as space, e and t, that dominate every vector.
+func Whiten(db *bolt.DB, bucket []byte, samples int) error {
+	rows, err := SampleVectors(db, bucket, samples, rand.New(rand.NewSource(1)))
+	if err != nil {
+		return err
+	}
+	if rows.Rows < 2 {
+		return fmt.Errorf("bucket %s has too few contexts to whiten", bucket)
+	}
+	WriteMetadata(db, WhiteningKey(bucket), matrix.NewWhitening(rows, WhiteningEpsilon))
+	whitenings.Delete(unit{db: db, bucket: string(bucket)})
+	return nil
+}
+
+// whitenings caches the whitening of model buckets
+var whitenings sync.Map
+
+// ModelWhitening returns the whitening of the current model bucket, nil if it hasn't been whitened
+func ModelWhitening(db *bolt.DB) *matrix.Whitening {
+	key := unit{db: db, bucket: string(ModelBucket)}
+	if whitening, ok := whitenings.Load(key); ok {
+		return whitening.(*matrix.Whitening)
+	}
+	var whitening *matrix.Whitening
+	if w := (matrix.Whitening{}); ReadMetadata(db, WhiteningKey(ModelBucket), &w) {
+		whitening = &w
+	}
+	whitenings.Store(key, whitening)
+	return whitening
+}
+
+func whiten() {
+	db := OpenModel(*FlagModel)
+	defer db.Close()
+	for _, bucket := range ModelBuckets(db) {
+		if err := Whiten(db, []byte(bucket), *FlagWhiten); err != nil {
+			Fail(ExitCorruptModel, err)
+		}
+		fmt.Println("whitened", bucket)
+	}
+}
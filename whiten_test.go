@@ -0,0 +1,43 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestWhiten(t *testing.T) {
+	db := NewTestModel(t)
+	input := []byte(Corpus[:64])
+	entropy := SelfEntropy(db, input, nil)[0]
+	if ModelWhitening(db) != nil {
+		t.Fatal("the model shouldn't be whitened")
+	}
+	if err := Whiten(db, ModelBucket, 64); err != nil {
+		t.Fatal(err)
+	}
+	whitening := ModelWhitening(db)
+	if whitening == nil || len(whitening.Mean) != 256 || whitening.Matrix.Rows != 256 {
+		t.Fatal("the whitening should be stored in the model")
+	}
+	rows, err := SampleVectors(db, ModelBucket, 1, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	negative, norm := false, 0.0
+	for _, value := range whitening.Whiten(rows.Data) {
+		negative = negative || value < 0
+		norm += value * value
+	}
+	if !negative || math.Abs(norm-1) > 1e-9 {
+		t.Fatal("the whitened vector should be a centered unit vector", norm)
+	}
+	whitened := SelfEntropy(db, input, nil)[0]
+	if math.IsNaN(whitened) || math.IsInf(whitened, 0) || whitened == entropy {
+		t.Fatal("the self entropy should be computed from the whitened vectors", entropy, whitened)
+	}
+}
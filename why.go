@@ -0,0 +1,109 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Continuation generates from a prompt and returns the generated bytes after the prompt.
+// The sampler is seeded with seed, so two prompts are generated with the same random choices.
+func Continuation(generate func(), prompt []byte, seed int64) []byte {
+	input, output := *FlagInput, Output
+	defer func() {
+		*FlagInput, Output = input, output
+	}()
+	*FlagInput, Output, Emitted = string(prompt), io.Discard, nil
+	if OutputSampler != nil {
+		OutputSampler.Lock()
+		OutputSampler.Rand = rand.New(rand.NewSource(seed))
+		OutputSampler.Unlock()
+	}
+	generate()
+	padded := Pad(prompt)
+	if len(Emitted) < len(padded) {
+		return nil
+	}
+	return append([]byte(nil), Emitted[len(padded):]...)
+}
+
+// Why generates from two prompts with the same seed and returns the continuations
+// and the first generated byte where they diverge, -1 if they are identical
+func Why(generate func(), a, b []byte, seed int64) (continuationA, continuationB []byte, divergence int) {
+	continuationA, continuationB = Continuation(generate, a, seed), Continuation(generate, b, seed)
+	return continuationA, continuationB, Divergence(continuationA, continuationB)
+}
+
+// WriteCandidates writes the candidate tables of two prompts side by side at a decision point,
+// the k next bytes with the lowest self entropy after each prompt and its continuation up to the point
+func WriteCandidates(w io.Writer, db *bolt.DB, a, b []byte, k int) {
+	predictionsA, predictionsB := Predict(db, a, k), Predict(db, b, k)
+	fmt.Fprintf(w, "%-4s %-24s %s\n", "rank", "a", "b")
+	for i := 0; i < len(predictionsA) || i < len(predictionsB); i++ {
+		cell := func(predictions []Prediction) string {
+			if i >= len(predictions) {
+				return ""
+			}
+			return fmt.Sprintf("%-6q %f", predictions[i].Symbol, predictions[i].Entropy)
+		}
+		fmt.Fprintf(w, "%-4d %-24s %s\n", i+1, cell(predictionsA), cell(predictionsB))
+	}
+}
+
+func why(generate func()) {
+	const Top = 8
+	if generate == nil {
+		Fail(ExitFlags, fmt.Errorf("why requires a generation mode"))
+	}
+	if *FlagPromptA == "" || *FlagPromptB == "" {
+		Fail(ExitFlags, fmt.Errorf("why compares the prompts of -prompt-a and -prompt-b"))
+	}
+	read := func(path string) []byte {
+		prompt, err := os.ReadFile(path)
+		if err != nil {
+			Fail(ExitData, err)
+		}
+		if prompt, err = NormalizePrompt(prompt); err != nil {
+			Fail(ExitFlags, fmt.Errorf("%s: %w", path, err))
+		}
+		return prompt
+	}
+	a, b := read(*FlagPromptA), read(*FlagPromptB)
+	seed := *FlagSeed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	continuationA, continuationB, divergence := Why(generate, a, b, seed)
+	if divergence < 0 {
+		fmt.Printf("identical %d generated bytes\n", len(continuationA))
+		return
+	}
+	start := divergence - 32
+	if start < 0 {
+		start = 0
+	}
+	end := func(output []byte) int {
+		if divergence+32 < len(output) {
+			return divergence + 32
+		}
+		return len(output)
+	}
+	fmt.Printf("diverged at generated byte %d\n", divergence)
+	fmt.Printf("a: %q\n", continuationA[start:end(continuationA)])
+	fmt.Printf("b: %q\n", continuationB[start:end(continuationB)])
+
+	db := OpenModel(*FlagModel)
+	defer db.Close()
+	contextA := append(Pad(a), continuationA[:divergence]...)
+	contextB := append(Pad(b), continuationB[:divergence]...)
+	fmt.Println("candidates at the decision point")
+	WriteCandidates(os.Stdout, db, contextA, contextB, Top)
+}
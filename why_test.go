@@ -0,0 +1,43 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWhy(t *testing.T) {
+	sampler := OutputSampler
+	defer func() {
+		OutputSampler = sampler
+	}()
+	OutputSampler = &Sampler{}
+	generate := func() {
+		output := Pad([]byte(*FlagInput))
+		for i := 0; i < 8; i++ {
+			output = append(output, byte('a'+OutputSampler.Rand.Intn(4)))
+		}
+		if strings.HasSuffix(*FlagInput, "b") {
+			output[len(output)-3] = 'z'
+		}
+		Emit(Result{Output: output})
+	}
+	a, b, divergence := Why(generate, []byte("it was a"), []byte("it was a"), 1)
+	if divergence != -1 || len(a) != 8 || !bytes.Equal(a, b) {
+		t.Fatal("the same prompt and seed should generate the same continuation", string(a), string(b))
+	}
+	a, b, divergence = Why(generate, []byte("it was a"), []byte("it was b"), 1)
+	if divergence != 5 {
+		t.Fatal("unexpected divergence", divergence, string(a), string(b))
+	}
+	db := NewTestModel(t)
+	out := bytes.Buffer{}
+	WriteCandidates(&out, db, []byte("it was"), []byte("it is"), 3)
+	if lines := strings.Split(strings.TrimSpace(out.String()), "\n"); len(lines) != 4 {
+		t.Fatal("unexpected candidates", out.String())
+	}
+}
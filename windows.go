@@ -0,0 +1,127 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"math"
+	"runtime"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// ParallelWindows is the number of windows above which the windows of a text are looked up in parallel
+const ParallelWindows = 64
+
+// Workers is the number of goroutines that look up the windows of a long text
+var Workers = runtime.NumCPU()
+
+// SetWorkers sets the number of goroutines that look up the windows of a long text
+func SetWorkers(workers int) error {
+	if workers < 1 {
+		return errors.New("there should be at least 1 worker")
+	}
+	Workers = workers
+	return nil
+}
+
+// WindowVector is a looked up context window with its unit vectors
+type WindowVector struct {
+	Entry
+	// Weight and HMM are the unit vectors of the histograms, HMM is nil unless Size is 2
+	Weight, HMM []float64
+}
+
+// VectorCache caches the looked up windows across the whole search, nil if it is disabled
+var VectorCache *VectorLRU
+
+// LookupWindow looks up a context window through the vector cache
+func LookupWindow(db *bolt.DB, symbol Symbols) WindowVector {
+	cache := VectorCache
+	if cache != nil && cache.Bucket != string(ModelBucket) {
+		cache.Reset(string(ModelBucket))
+	}
+	if cache != nil {
+		if window, ok := cache.Get(symbol); ok {
+			return window
+		}
+	}
+	window := WindowVector{Entry: Entry{Key: symbol}}
+	if !UnitLookup(db, &window) {
+		window.Found, window.Order, window.Decoded = CachedLookup(db, symbol)
+		if window.Found {
+			window.Weight = Unit(window.Decoded[:256])
+			if Size == 2 {
+				window.HMM = Unit(window.Decoded[256:])
+			}
+		}
+	}
+	if window.Found {
+		window.Weight = ModelWhitening(db).Whiten(window.Weight)
+	}
+	if cache != nil {
+		cache.Put(window)
+	}
+	return window
+}
+
+// Unit converts a histogram to a unit vector
+func Unit(histogram []uint16) []float64 {
+	defer Timed(PhaseNormalize)()
+	vector := make([]float64, len(histogram))
+	UnitCounts(vector, histogram)
+	return vector
+}
+
+// Windows looks up the vectors of the context windows of a text in order.
+// Texts with more than ParallelWindows windows are split into contiguous blocks looked up by Workers goroutines.
+func Windows(db *bolt.DB, text []byte) []WindowVector {
+	length := len(text) - Order + 1
+	if length < 0 {
+		length = 0
+	}
+	windows := make([]WindowVector, length)
+	lookup := func(begin, end int) {
+		for i := begin; i < end; i++ {
+			symbol := Symbols{}
+			for j := range symbol {
+				symbol[j] = text[i+Indexes[j]]
+			}
+			windows[i] = LookupWindow(db, symbol)
+		}
+	}
+	workers := Workers
+	if length <= ParallelWindows || workers < 2 {
+		lookup(0, length)
+		return windows
+	}
+	if workers > length {
+		workers = length
+	}
+	block, done := (length+workers-1)/workers, make(chan bool, workers)
+	for w := 0; w < workers; w++ {
+		begin, end := w*block, (w+1)*block
+		if end > length {
+			end = length
+		}
+		go func() {
+			lookup(begin, end)
+			done <- true
+		}()
+	}
+	for w := 0; w < workers; w++ {
+		<-done
+	}
+	return windows
+}
+
+// Recency is the importance of window i of n windows, with -halflife the importance halves every half life bytes
+// before the last window
+func Recency(i, n int) float64 {
+	if *FlagHalfLife <= 0 {
+		return 1
+	}
+	return math.Exp2(-float64(n-1-i) / *FlagHalfLife)
+}
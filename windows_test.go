@@ -0,0 +1,100 @@
+// Copyright 2023 The Lit Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+)
+
+func TestWindows(t *testing.T) {
+	db := NewTestModel(t)
+	workers := Workers
+	defer func() {
+		Workers = workers
+	}()
+	text := []byte(Corpus)
+	if len(text)-Order+1 <= ParallelWindows {
+		t.Fatal("the corpus should be long enough to be looked up in parallel")
+	}
+	Workers = 1
+	serial := Windows(db, text)
+	Workers = 7
+	parallel := Windows(db, text)
+	if len(serial) != len(text)-Order+1 || len(parallel) != len(serial) {
+		t.Fatal("there should be a window for each context")
+	}
+	for i, window := range serial {
+		if parallel[i].Entry != window.Entry || len(parallel[i].Weight) != len(window.Weight) {
+			t.Fatal("parallel window doesn't match", i)
+		}
+		for j, v := range window.Weight {
+			if parallel[i].Weight[j] != v {
+				t.Fatal("parallel window vector doesn't match", i)
+			}
+		}
+	}
+	if err := SetWorkers(0); err == nil {
+		t.Fatal("0 workers should be an error")
+	}
+}
+
+func TestRecency(t *testing.T) {
+	halflife := *FlagHalfLife
+	defer func() {
+		*FlagHalfLife = halflife
+	}()
+	*FlagHalfLife = 0
+	if Recency(0, 1000) != 1 {
+		t.Fatal("without a half life the windows should weigh the same")
+	}
+	*FlagHalfLife = 10
+	if Recency(9, 10) != 1 || Recency(0, 11) != .5 || Recency(0, 21) != .25 {
+		t.Fatal("the importance should halve every half life")
+	}
+
+	db := NewTestModel(t)
+	text := []byte("it was the best of times")
+	prefix := NewPrefix(db, text)
+	expected := SelfEntropy(db, append(text, 'x'), nil)[0]
+	if entropy := prefix.SelfEntropy('x')[0]; entropy != expected {
+		t.Fatalf("prefix entropy %v != %v with a half life", entropy, expected)
+	}
+	*FlagHalfLife = 0
+	if SelfEntropy(db, append(text, 'x'), nil)[0] == expected {
+		t.Fatal("the half life should change the entropy")
+	}
+}
+
+func TestVectorCache(t *testing.T) {
+	db := NewTestModel(t)
+	cache := VectorCache
+	defer func() {
+		VectorCache = cache
+	}()
+	text := append([]byte(Corpus[:64]), 'x')
+	VectorCache = nil
+	expected := SelfEntropy(db, text, nil)[0]
+	VectorCache = NewVectorLRU(4 * VectorBytes)
+	for i := 0; i < 2; i++ {
+		if entropy := SelfEntropy(db, text, nil)[0]; entropy != expected {
+			t.Fatalf("cached entropy %v != %v", entropy, expected)
+		}
+	}
+	if len(VectorCache.Nodes) != 4 {
+		t.Fatal("the cache should be bounded by its budget", len(VectorCache.Nodes))
+	}
+	last := Symbols{}
+	for j := range last {
+		last[j] = text[len(text)-Order+Indexes[j]]
+	}
+	if VectorCache.Head.Window.Key != last {
+		t.Fatal("the last window should be the most recent")
+	}
+	for node := VectorCache.Head; node != nil; node = node.B {
+		if node.B != nil && node.B.F != node {
+			t.Fatal("the cache list is broken")
+		}
+	}
+}
@@ -14,6 +14,8 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+
+	"github.com/pointlander/lit/matrix"
 )
 
 // Vector is a word vector
@@ -86,15 +88,15 @@ func NewVectors(file string) Vectors {
 func (v *Vectors) Entropy(input []string) (ax []float64) {
 	width := len(v.Dictionary["dog"].Vector)
 	length := len(input)
-	weights := NewMatrix(0, width, length)
+	weights := matrix.NewMatrix(0, width, length)
 	for _, word := range input {
 		vector := v.Dictionary[word].Vector
 		weights.Data = append(weights.Data, vector...)
 	}
 
-	l1 := Softmax(Mul(weights, weights))
-	l2 := Softmax(Mul(T(weights), l1))
-	entropy := Entropy(l2)
+	l1 := matrix.Softmax(matrix.Mul(weights, weights))
+	l2 := matrix.Softmax(matrix.Mul(matrix.T(weights), l1))
+	entropy := matrix.Entropy(l2)
 
 	return entropy.Data
 }